@@ -0,0 +1,463 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/trace"
+)
+
+type (
+	/* AnalyticsResult is a result of a single question in a single submission. */
+	AnalyticsResult struct {
+		Percent int
+		Correct bool
+	}
+
+	QuestionAnalytics struct {
+		Attempts     int
+		Correct      int
+		AnswerCounts []int
+
+		Results []AnalyticsResult
+	}
+	CheckAnalytics struct {
+		Attempts int
+		Passed   int
+
+		/* Failures maps failure message to number of times it occurred. */
+		Failures map[string]int
+	}
+
+	StepAnalytics struct {
+		Submissions int
+		Students    int
+
+		Questions []QuestionAnalytics
+		Checks    []CheckAnalytics
+	}
+)
+
+const (
+	/* DiscriminationGroupPercent is a size of upper and lower groups used to compute discrimination index. */
+	DiscriminationGroupPercent = 27
+
+	CheckMaxDisplayLen = 30
+)
+
+/* GetQuestionDiscrimination returns discrimination index in hundredths (from -100 to 100): difference between shares of correct answers in upper and lower groups by total score. Second value is false if there are not enough results. */
+func GetQuestionDiscrimination(results []AnalyticsResult) (int, bool) {
+	defer trace.End(trace.Begin(""))
+
+	if len(results) < 2 {
+		return 0, false
+	}
+
+	sorted := append([]AnalyticsResult(nil), results...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Percent > sorted[j].Percent })
+
+	group := max(1, (len(sorted)*DiscriminationGroupPercent+50)/100)
+	if 2*group > len(sorted) {
+		group = len(sorted) / 2
+	}
+
+	var upper, lower int
+	for i := 0; i < group; i++ {
+		if sorted[i].Correct {
+			upper++
+		}
+		if sorted[len(sorted)-1-i].Correct {
+			lower++
+		}
+	}
+	return (upper - lower) * 100 / group, true
+}
+
+/* GetCheckCommonFailure returns the most common failure message. Ties are resolved in favour of lexicographically smaller message. */
+func GetCheckCommonFailure(ca *CheckAnalytics) (string, int) {
+	var failure string
+	var count int
+
+	for message, n := range ca.Failures {
+		if (n > count) || ((n == count) && (message < failure)) {
+			failure = message
+			count = n
+		}
+	}
+	return failure, count
+}
+
+func AnalyticsQuestionsEqual(q1 *Question, q2 *Question) bool {
+	if (q1.Name != q2.Name) || (len(q1.Answers) != len(q2.Answers)) {
+		return false
+	}
+	for i := 0; i < len(q1.Answers); i++ {
+		if q1.Answers[i] != q2.Answers[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/* GetStepAnalytics computes statistics of lesson step from checked submissions. Submissions keep steps they were started with, so only questions and checks, which did not change since then, are taken into account. */
+func GetStepAnalytics(lesson *Lesson, stepIndex int) (StepAnalytics, error) {
+	defer trace.End(trace.Begin(""))
+
+	var submission Submission
+	var sa StepAnalytics
+
+	step := &lesson.Steps[stepIndex]
+	students := make(map[database.ID]struct{})
+
+	switch step.Type {
+	case StepTypeTest:
+		test, _ := Step2Test(step)
+		sa.Questions = make([]QuestionAnalytics, len(test.Questions))
+		for i := 0; i < len(test.Questions); i++ {
+			sa.Questions[i].AnswerCounts = make([]int, len(test.Questions[i].Answers))
+		}
+	case StepTypeProgramming:
+		task, _ := Step2Programming(step)
+		sa.Checks = make([]CheckAnalytics, len(task.Checks[CheckTypeTest]))
+		for i := 0; i < len(sa.Checks); i++ {
+			sa.Checks[i].Failures = make(map[string]int)
+		}
+	}
+
+	for i := 0; i < len(lesson.Submissions); i++ {
+		if err := GetSubmissionByID(lesson.Submissions[i], &submission); err != nil {
+			return sa, err
+		}
+		if (submission.Flags != SubmissionActive) || (submission.Status != SubmissionCheckDone) || (stepIndex >= len(submission.SubmittedSteps)) {
+			continue
+		}
+
+		submittedStep := &submission.SubmittedSteps[stepIndex]
+		if (submittedStep.Flags == SubmittedStepSkipped) || (StepType(submittedStep.Type) != step.Type) {
+			continue
+		}
+		sa.Submissions++
+		students[submission.UserID] = struct{}{}
+
+		switch step.Type {
+		case StepTypeTest:
+			test, _ := Step2Test(step)
+			submittedTest, _ := Submitted2Test(submittedStep)
+			submittedQuestions, _ := Step2Test(&submittedTest.Step)
+			percent := GetSubmissionPercent(&submission)
+
+			for j := 0; j < len(test.Questions); j++ {
+				if (j >= len(submittedQuestions.Questions)) || (j >= len(submittedTest.Scores)) || (!AnalyticsQuestionsEqual(&test.Questions[j], &submittedQuestions.Questions[j])) {
+					continue
+				}
+				qa := &sa.Questions[j]
+
+				correct := submittedTest.Scores[j] > 0
+				qa.Attempts++
+				if correct {
+					qa.Correct++
+				}
+				qa.Results = append(qa.Results, AnalyticsResult{Percent: percent, Correct: correct})
+
+				selectedAnswers := submittedTest.SubmittedQuestions[j].SelectedAnswers
+				for k := 0; k < len(selectedAnswers); k++ {
+					if (selectedAnswers[k] >= 0) && (selectedAnswers[k] < len(qa.AnswerCounts)) {
+						qa.AnswerCounts[selectedAnswers[k]]++
+					}
+				}
+			}
+		case StepTypeProgramming:
+			task, _ := Step2Programming(step)
+			submittedTask, _ := Submitted2Programming(submittedStep)
+			submittedChecks, _ := Step2Programming(&submittedTask.Step)
+
+			checks := task.Checks[CheckTypeTest]
+			scores := submittedTask.Scores[CheckTypeTest]
+			messages := submittedTask.Messages[CheckTypeTest]
+			for j := 0; j < len(checks); j++ {
+				if (j >= len(submittedChecks.Checks[CheckTypeTest])) || (j >= len(scores)) || (checks[j] != submittedChecks.Checks[CheckTypeTest][j]) {
+					continue
+				}
+				ca := &sa.Checks[j]
+
+				ca.Attempts++
+				if scores[j] > 0 {
+					ca.Passed++
+				} else if (j < len(messages)) && (messages[j] != "") {
+					ca.Failures[messages[j]]++
+				}
+			}
+		}
+	}
+	sa.Students = len(students)
+
+	return sa, nil
+}
+
+/* DisplayPercent displays 'n' out of 'total' in percents or dash if 'total' is zero. */
+func DisplayPercent(w *http.Response, n int, total int) {
+	if total == 0 {
+		w.WriteString(`-`)
+		return
+	}
+	w.WriteInt(n * 100 / total)
+	w.WriteString(`%`)
+}
+
+/* DisplayHundredths displays 'x' divided by 100 with two decimal places. */
+func DisplayHundredths(w *http.Response, x int) {
+	if x < 0 {
+		w.WriteString(`-`)
+		x = -x
+	}
+	w.WriteInt(x / 100)
+	w.WriteString(`.`)
+	if x%100 < 10 {
+		w.WriteString(`0`)
+	}
+	w.WriteInt(x % 100)
+}
+
+func DisplayTestAnalytics(w *http.Response, l Language, test *StepTest, sa *StepAnalytics) {
+	defer trace.End(trace.Begin(""))
+
+	for i := 0; i < len(test.Questions); i++ {
+		question := &test.Questions[i]
+		qa := &sa.Questions[i]
+
+		DisplayFrameStart(w)
+
+		w.WriteString(`<p><b>`)
+		w.WriteString(Ls(l, "Question"))
+		w.WriteString(` #`)
+		w.WriteInt(i + 1)
+		w.WriteString(`: `)
+		w.WriteHTMLString(question.Name)
+		w.WriteString(`</b></p>`)
+
+		w.WriteString(`<p>`)
+		w.WriteString(Ls(l, "Answered correctly"))
+		w.WriteString(`: `)
+		DisplayPercent(w, qa.Correct, qa.Attempts)
+		w.WriteString(` (`)
+		w.WriteInt(qa.Correct)
+		w.WriteString(`/`)
+		w.WriteInt(qa.Attempts)
+		w.WriteString(`)</p>`)
+
+		w.WriteString(`<p>`)
+		w.WriteString(Ls(l, "Discrimination index"))
+		w.WriteString(`: `)
+		if d, ok := GetQuestionDiscrimination(qa.Results); ok {
+			DisplayHundredths(w, d)
+		} else {
+			w.WriteString(`-`)
+		}
+		w.WriteString(`</p>`)
+
+		DisplayTableStart(w, l, []string{"Answer", "Correct", "Chosen"})
+		for j := 0; j < len(question.Answers); j++ {
+			DisplayTableRowStart(w)
+
+			DisplayTableItemString(w, question.Answers[j])
+
+			DisplayTableItemStart(w)
+			for k := 0; k < len(question.CorrectAnswers); k++ {
+				if question.CorrectAnswers[k] == j {
+					w.WriteString(`✓`)
+					break
+				}
+			}
+			DisplayTableItemEnd(w)
+
+			DisplayTableItemStart(w)
+			DisplayPercent(w, qa.AnswerCounts[j], qa.Attempts)
+			DisplayTableItemEnd(w)
+
+			DisplayTableRowEnd(w)
+		}
+		DisplayTableEnd(w)
+
+		DisplayFrameEnd(w)
+	}
+}
+
+func DisplayProgrammingAnalytics(w *http.Response, l Language, task *StepProgramming, sa *StepAnalytics) {
+	defer trace.End(trace.Begin(""))
+
+	checks := task.Checks[CheckTypeTest]
+	if len(checks) == 0 {
+		return
+	}
+
+	DisplayTableStart(w, l, []string{"#", "Input", "Output", "Pass rate", "Most common failure"})
+	for i := 0; i < len(checks); i++ {
+		ca := &sa.Checks[i]
+
+		DisplayTableRowStart(w)
+
+		DisplayTableItemInt(w, i+1)
+		DisplayTableItemShortenedString(w, checks[i].Input, CheckMaxDisplayLen)
+		DisplayTableItemShortenedString(w, checks[i].Output, CheckMaxDisplayLen)
+
+		DisplayTableItemStart(w)
+		DisplayPercent(w, ca.Passed, ca.Attempts)
+		w.WriteString(` (`)
+		w.WriteInt(ca.Passed)
+		w.WriteString(`/`)
+		w.WriteInt(ca.Attempts)
+		w.WriteString(`)`)
+		DisplayTableItemEnd(w)
+
+		DisplayTableItemStart(w)
+		if failure, count := GetCheckCommonFailure(ca); count > 0 {
+			w.WriteHTMLString(failure)
+			w.WriteString(` (`)
+			w.WriteInt(count)
+			w.WriteString(`)`)
+		} else {
+			w.WriteString(`-`)
+		}
+		DisplayTableItemEnd(w)
+
+		DisplayTableRowEnd(w)
+	}
+	DisplayTableEnd(w)
+}
+
+func DisplayStepAnalyticsLink(w *http.Response, l Language, lessonID database.ID, stepIndex int) {
+	w.WriteString(`<a href="/lesson/analytics?ID=`)
+	w.WriteInt(int(lessonID))
+	w.WriteString(`&StepIndex=`)
+	w.WriteInt(stepIndex)
+	w.WriteString(`">`)
+	w.WriteString(Ls(l, "Analytics"))
+	w.WriteString(`</a>`)
+}
+
+func LessonAnalyticsPageHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	const width = WidthLarge
+
+	var subject Subject
+	var lesson Lesson
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	lessonID, err := r.URL.Query.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if err := GetLessonByID(lessonID, &lesson); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "lesson with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if lesson.ContainerType != LessonContainerSubject {
+		return http.BadRequest("%s", Ls(GL, "analytics is only available for lessons in subjects"))
+	}
+
+	stepIndex, err := GetValidIndex(r.URL.Query.Get("StepIndex"), len(lesson.Steps))
+	if err != nil {
+		return http.ClientError(err)
+	}
+	step := &lesson.Steps[stepIndex]
+
+	if err := GetSubjectByID(lesson.ContainerID, &subject); err != nil {
+		return http.ServerError(err)
+	}
+	who, err := WhoIsUserInSubject(session.ID, &subject)
+	if err != nil {
+		return http.ServerError(err)
+	}
+	if (who != SubjectUserAdmin) && (who != SubjectUserTeacher) {
+		return ForbiddenError
+	}
+
+	sa, err := GetStepAnalytics(&lesson, stepIndex)
+	if err != nil {
+		return http.ServerError(err)
+	}
+
+	DisplayHTMLStart(w)
+
+	DisplayHeadStart(w)
+	{
+		w.WriteString(`<title>`)
+		w.WriteString(Ls(GL, "Analytics"))
+		w.WriteString(`: `)
+		w.WriteHTMLString(step.Name)
+		w.WriteString(`</title>`)
+	}
+	DisplayHeadEnd(w)
+
+	DisplayBodyStart(w)
+	{
+		DisplayHeader(w, GL, session)
+		DisplaySidebarWithLessons(w, GL, session, subject.Lessons, nil)
+
+		DisplayMainStart(w)
+
+		DisplayCrumbsStart(w, width)
+		{
+			DisplayCrumbsLinkID(w, "/subject", subject.ID, subject.Name)
+			DisplayCrumbsLinkID(w, "/lesson", lesson.ID, lesson.Name)
+			DisplayCrumbsItem(w, GL, "Analytics")
+		}
+		DisplayCrumbsEnd(w)
+
+		DisplayPageStart(w, width)
+		{
+			w.WriteString(`<h2>`)
+			w.WriteString(Ls(GL, "Analytics"))
+			w.WriteString(`: `)
+			w.WriteHTMLString(step.Name)
+			w.WriteString(`</h2>`)
+			w.WriteString(`<br>`)
+
+			w.WriteString(`<p>`)
+			w.WriteString(Ls(GL, "Type"))
+			w.WriteString(`: `)
+			w.WriteString(StepStringType(GL, step))
+			w.WriteString(`</p>`)
+
+			w.WriteString(`<p>`)
+			w.WriteString(Ls(GL, "Checked submissions"))
+			w.WriteString(`: `)
+			w.WriteInt(sa.Submissions)
+			w.WriteString(`</p>`)
+
+			w.WriteString(`<p>`)
+			w.WriteString(Ls(GL, "Average attempts per student"))
+			w.WriteString(`: `)
+			if sa.Students > 0 {
+				DisplayHundredths(w, sa.Submissions*100/sa.Students)
+			} else {
+				w.WriteString(`-`)
+			}
+			w.WriteString(`</p>`)
+			w.WriteString(`<br>`)
+
+			switch step.Type {
+			case StepTypeTest:
+				test, _ := Step2Test(step)
+				DisplayTestAnalytics(w, GL, test, &sa)
+			case StepTypeProgramming:
+				task, _ := Step2Programming(step)
+				DisplayProgrammingAnalytics(w, GL, task, &sa)
+			}
+		}
+		DisplayPageEnd(w)
+		DisplayMainEnd(w)
+	}
+	DisplayBodyEnd(w)
+
+	DisplayHTMLEnd(w)
+	return nil
+}
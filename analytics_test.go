@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+)
+
+func testAnalyticsCreateSubmission(t *testing.T, lesson *Lesson, userID database.ID, selected int, passed bool, message string) {
+	t.Helper()
+
+	submission := Submission{LessonID: lesson.ID, UserID: userID, Status: SubmissionCheckDone, SubmittedSteps: make([]SubmittedStep, 2)}
+
+	test, _ := Step2Test(&lesson.Steps[0])
+	submittedTest := (*SubmittedTest)(unsafe.Pointer(&submission.SubmittedSteps[0]))
+	*submittedTest = SubmittedTest{SubmittedCommon: SubmittedCommon{Type: SubmittedTypeTest, Flags: SubmittedStepPassed, Step: lesson.Steps[0]}, SubmittedQuestions: []SubmittedQuestion{{SelectedAnswers: []int{selected}}}, Scores: []int{0}}
+	if selected == test.Questions[0].CorrectAnswers[0] {
+		submittedTest.Scores[0] = 1
+	}
+
+	submittedTask := (*SubmittedProgramming)(unsafe.Pointer(&submission.SubmittedSteps[1]))
+	*submittedTask = SubmittedProgramming{SubmittedCommon: SubmittedCommon{Type: SubmittedTypeProgramming, Flags: SubmittedStepPassed, Step: lesson.Steps[1]}}
+	submittedTask.Scores[CheckTypeTest] = []int{0}
+	submittedTask.Messages[CheckTypeTest] = []string{message}
+	if passed {
+		submittedTask.Scores[CheckTypeTest][0] = 1
+	}
+
+	if err := CreateSubmission(&submission); err != nil {
+		t.Fatalf("Failed to create submission: %v", err)
+	}
+	lesson.Submissions = append(lesson.Submissions, submission.ID)
+}
+
+func TestGetStepAnalytics(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	lesson := Lesson{ID: 2, Steps: make([]Step, 2)}
+	*((*StepTest)(unsafe.Pointer(&lesson.Steps[0]))) = StepTest{
+		StepCommon: StepCommon{Name: "Test", Type: StepTypeTest},
+		Questions:  []Question{{Name: "Question", Answers: []string{"Right", "Wrong"}, CorrectAnswers: []int{0}}},
+	}
+	*((*StepProgramming)(unsafe.Pointer(&lesson.Steps[1]))) = StepProgramming{
+		StepCommon: StepCommon{Name: "Task", Type: StepTypeProgramming},
+		Checks:     [2][]Check{CheckTypeTest: {{Input: "1", Output: "2"}}},
+	}
+
+	testAnalyticsCreateSubmission(t, &lesson, 2, 0, true, "")
+	testAnalyticsCreateSubmission(t, &lesson, 2, 1, false, "expected 2")
+	testAnalyticsCreateSubmission(t, &lesson, 3, 1, false, "expected 2")
+	testAnalyticsCreateSubmission(t, &lesson, 3, 1, false, "timeout")
+
+	sa, err := GetStepAnalytics(&lesson, 0)
+	if err != nil {
+		t.Fatalf("Failed to get analytics: %v", err)
+	}
+	if (sa.Submissions != 4) || (sa.Students != 2) {
+		t.Errorf("Expected 4 submissions by 2 students, got %d by %d", sa.Submissions, sa.Students)
+	}
+	qa := &sa.Questions[0]
+	if (qa.Attempts != 4) || (qa.Correct != 1) || (qa.AnswerCounts[0] != 1) || (qa.AnswerCounts[1] != 3) {
+		t.Errorf("Unexpected question analytics %+v", qa)
+	}
+	if d, ok := GetQuestionDiscrimination(qa.Results); (!ok) || (d != 100) {
+		t.Errorf("Expected discrimination index 100, got %d", d)
+	}
+
+	sa, err = GetStepAnalytics(&lesson, 1)
+	if err != nil {
+		t.Fatalf("Failed to get analytics: %v", err)
+	}
+	ca := &sa.Checks[0]
+	if (ca.Attempts != 4) || (ca.Passed != 1) {
+		t.Errorf("Expected 1 of 4 passed checks, got %d of %d", ca.Passed, ca.Attempts)
+	}
+	if failure, count := GetCheckCommonFailure(ca); (failure != "expected 2") || (count != 2) {
+		t.Errorf("Expected most common failure %q (2), got %q (%d)", "expected 2", failure, count)
+	}
+
+	/* Changed questions are not taken into account. */
+	test, _ := Step2Test(&lesson.Steps[0])
+	test.Questions[0] = Question{Name: "Other question", Answers: []string{"Right", "Wrong"}, CorrectAnswers: []int{0}}
+	sa, err = GetStepAnalytics(&lesson, 0)
+	if err != nil {
+		t.Fatalf("Failed to get analytics: %v", err)
+	}
+	if sa.Questions[0].Attempts != 0 {
+		t.Errorf("Expected no attempts for changed question, got %d", sa.Questions[0].Attempts)
+	}
+}
+
+func TestGetQuestionDiscrimination(t *testing.T) {
+	expected := [...]struct {
+		Results []AnalyticsResult
+		Index   int
+		OK      bool
+	}{
+		{nil, 0, false},
+		{[]AnalyticsResult{{100, true}}, 0, false},
+		{[]AnalyticsResult{{0, true}, {100, false}}, -100, true},
+		{[]AnalyticsResult{{50, true}, {100, true}, {0, false}, {75, false}}, 100, true},
+		{[]AnalyticsResult{{50, true}, {100, true}, {0, true}, {75, true}}, 0, true},
+	}
+
+	for _, e := range expected {
+		index, ok := GetQuestionDiscrimination(e.Results)
+		if (index != e.Index) || (ok != e.OK) {
+			t.Errorf("Expected discrimination of %v to be (%d, %t), got (%d, %t)", e.Results, e.Index, e.OK, index, ok)
+		}
+	}
+}
+
+func TestLessonAnalyticsPageHandler(t *testing.T) {
+	testGetAuth(t, "/lesson/analytics?ID=2&StepIndex=0", testTokens[1], http.StatusOK)
+	testGetAuth(t, "/lesson/analytics?ID=2&StepIndex=1", testTokens[0], http.StatusOK)
+	testGetAuth(t, "/lesson/analytics?ID=2&StepIndex=0", testTokens[2], http.StatusForbidden)
+	testGetAuth(t, "/lesson/analytics?ID=2&StepIndex=2", testTokens[1], http.StatusBadRequest)
+	testGetAuth(t, "/lesson/analytics?ID=a&StepIndex=0", testTokens[1], http.StatusBadRequest)
+	testGetAuth(t, "/lesson/analytics?ID=100&StepIndex=0", testTokens[1], http.StatusNotFound)
+	testGetAuth(t, "/lesson/analytics?ID=0&StepIndex=0", testTokens[1], http.StatusBadRequest)
+	testGet(t, "/lesson/analytics?ID=2&StepIndex=0", http.StatusUnauthorized)
+}
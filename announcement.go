@@ -0,0 +1,312 @@
+package main
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/strings"
+	"github.com/anton2920/gofa/trace"
+)
+
+type Announcement struct {
+	ID    database.ID
+	Flags int32
+
+	SubjectID database.ID
+	AuthorID  database.ID
+	Text      string
+	CreatedOn int64
+
+	Blob Blob
+	Data [2048]byte
+}
+
+const (
+	AnnouncementActive int32 = iota
+	AnnouncementDeleted
+)
+
+const (
+	MinAnnouncementLen = 1
+	MaxAnnouncementLen = 4096
+)
+
+func CreateAnnouncementTx(tx *Tx, announcement *Announcement) error {
+	defer trace.End(trace.Begin(""))
+
+	announcement.ID = NewIDTx(tx, AnnouncementsDB)
+
+	return SaveAnnouncementTx(tx, announcement)
+}
+
+func CreateAnnouncement(announcement *Announcement) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := CreateAnnouncementTx(&tx, announcement); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func DBAnnouncement2Announcement(announcement *Announcement, data *byte) {
+	defer trace.End(trace.Begin(""))
+
+	announcement.Text = database.Offset2String(announcement.Text, data)
+}
+
+func GetAnnouncementByID(id database.ID, announcement *Announcement) error {
+	defer trace.End(trace.Begin(""))
+
+	if err := DBRead(AnnouncementsDB, id, unsafe.Pointer(announcement), int(unsafe.Sizeof(*announcement))); err != nil {
+		return err
+	}
+	if announcement.ID != id {
+		return database.NotFound
+	}
+
+	data, err := GetBlobData(&announcement.Blob, announcement.Data[:])
+	if err != nil {
+		return err
+	}
+
+	DBAnnouncement2Announcement(announcement, data)
+	return nil
+}
+
+func GetAnnouncements(pos *int64, announcements []Announcement) (int, error) {
+	defer trace.End(trace.Begin(""))
+
+	n, err := DBReadManyValid(AnnouncementsDB, pos, announcements, func(announcement *Announcement) database.ID { return announcement.ID })
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < n; i++ {
+		data, err := GetBlobData(&announcements[i].Blob, announcements[i].Data[:])
+		if err != nil {
+			return 0, err
+		}
+		DBAnnouncement2Announcement(&announcements[i], data)
+	}
+	return n, nil
+}
+
+func DeleteAnnouncementByIDTx(tx *Tx, id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	flags := AnnouncementDeleted
+	var announcement Announcement
+
+	offset := int64(int(id)*int(unsafe.Sizeof(announcement))) + database.DataOffset + int64(unsafe.Offsetof(announcement.Flags))
+	tx.WriteAt(AnnouncementsDB, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
+
+	tx.OnCommit(func() { UnindexAnnouncement(id) })
+	return nil
+}
+
+func DeleteAnnouncementByID(id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := DeleteAnnouncementByIDTx(&tx, id); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func AnnouncementDataSize(announcement *Announcement) int {
+	return DBStringSize(announcement.Text)
+}
+
+func SaveAnnouncementTx(tx *Tx, announcement *Announcement) error {
+	defer trace.End(trace.Begin(""))
+
+	var announcementDB Announcement
+	var n int
+
+	announcementDB.ID = announcement.ID
+	announcementDB.Flags = announcement.Flags
+	announcementDB.SubjectID = announcement.SubjectID
+	announcementDB.AuthorID = announcement.AuthorID
+
+	data, err := GetDataBuffer(announcementDB.Data[:], AnnouncementDataSize(announcement))
+	if err != nil {
+		return err
+	}
+
+	n += database.String2DBString(&announcementDB.Text, announcement.Text, data, n)
+
+	announcementDB.CreatedOn = announcement.CreatedOn
+
+	if err := SaveBlob(&announcementDB.Blob, announcementDB.Data[:], data[:n]); err != nil {
+		return err
+	}
+
+	tx.Write(AnnouncementsDB, announcementDB.ID, unsafe.Pointer(&announcementDB), int(unsafe.Sizeof(announcementDB)))
+
+	indexed := *announcement
+	tx.OnCommit(func() { IndexAnnouncement(&indexed) })
+	return nil
+}
+
+func SaveAnnouncement(announcement *Announcement) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := SaveAnnouncementTx(&tx, announcement); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+/* DisplaySubjectAnnouncements displays announcements of a subject, newest first. Teacher gets a form to post new ones and buttons to delete existing ones. */
+func DisplaySubjectAnnouncements(w *http.Response, l Language, subject *Subject, who SubjectUserType) {
+	defer trace.End(trace.Begin(""))
+
+	canPost := (who == SubjectUserAdmin) || (who == SubjectUserTeacher)
+	ids := GetSubjectAnnouncementIDs(subject.ID)
+
+	if (len(ids) == 0) && (!canPost) {
+		return
+	}
+
+	w.WriteString(`<br>`)
+	w.WriteString(`<h3>`)
+	w.WriteString(Ls(l, "Announcements"))
+	w.WriteString(`</h3>`)
+
+	if canPost {
+		w.WriteString(`<form method="POST" action="/api/announcement/create">`)
+		DisplayHiddenID(w, "ID", subject.ID)
+		DisplayConstraintTextarea(w, MinAnnouncementLen, MaxAnnouncementLen, "Text", "", true)
+		DisplayButton(w, l, "", "Post")
+		w.WriteString(`</form>`)
+		w.WriteString(`<br>`)
+	}
+
+	for i := len(ids) - 1; i >= 0; i-- {
+		var announcement Announcement
+		if err := GetAnnouncementByID(ids[i], &announcement); err != nil {
+			/* TODO(anton2920): report error. */
+			continue
+		}
+
+		var author User
+		if err := GetUserByID(announcement.AuthorID, &author); err != nil {
+			/* TODO(anton2920): report error. */
+		}
+
+		DisplayFrameStart(w)
+
+		w.WriteString(`<p><b>`)
+		w.WriteHTMLString(author.LastName)
+		w.WriteString(` `)
+		w.WriteHTMLString(author.FirstName)
+		w.WriteString(`</b>, `)
+		DisplayFormattedTime(w, announcement.CreatedOn)
+		w.WriteString(`</p>`)
+
+		DisplayMarkdown(w, announcement.Text)
+
+		if canPost {
+			w.WriteString(`<form method="POST" action="/api/announcement/delete">`)
+			DisplayHiddenID(w, "ID", announcement.ID)
+			DisplayButton(w, l, "", "Delete")
+			w.WriteString(`</form>`)
+		}
+
+		DisplayFrameEnd(w)
+	}
+}
+
+func AnnouncementCreateHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var subject Subject
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	subjectID, err := r.Form.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if err := GetSubjectByID(subjectID, &subject); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "subject with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if (session.ID != AdminID) && (session.ID != subject.TeacherID) {
+		return ForbiddenError
+	}
+
+	text := r.Form.Get("Text")
+	if !strings.LengthInRange(text, MinAnnouncementLen, MaxAnnouncementLen) {
+		return http.BadRequest(Ls(GL, "announcement length must be between %d and %d characters long"), MinAnnouncementLen, MaxAnnouncementLen)
+	}
+
+	announcement := Announcement{SubjectID: subject.ID, AuthorID: session.ID, Text: text, CreatedOn: time.Now().Unix()}
+
+	var tx Tx
+	if err := CreateAnnouncementTx(&tx, &announcement); err != nil {
+		return http.ServerError(err)
+	}
+	if err := NotifySubjectStudentsTx(&tx, &subject, NotificationAnnouncement, subject.ID, subject.Name); err != nil {
+		return http.ServerError(err)
+	}
+	if err := CommitTx(&tx); err != nil {
+		return http.ServerError(err)
+	}
+
+	Audit(r, session.ID, "create", "announcement", announcement.ID, "", AuditTextSummary(text))
+
+	w.Redirect(w.PathID("/subject/", subject.ID), http.StatusSeeOther)
+	return nil
+}
+
+func AnnouncementDeleteHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var announcement Announcement
+	var subject Subject
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	announcementID, err := r.Form.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if err := GetAnnouncementByID(announcementID, &announcement); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "announcement with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if announcement.Flags == AnnouncementDeleted {
+		return http.NotFound("%s", Ls(GL, "announcement with this ID does not exist"))
+	}
+	if err := GetSubjectByID(announcement.SubjectID, &subject); err != nil {
+		return http.ServerError(err)
+	}
+	if (session.ID != AdminID) && (session.ID != subject.TeacherID) {
+		return ForbiddenError
+	}
+
+	if err := DeleteAnnouncementByID(announcementID); err != nil {
+		return http.ServerError(err)
+	}
+
+	Audit(r, session.ID, "delete", "announcement", announcementID, AuditTextSummary(announcement.Text), "")
+
+	w.Redirect(w.PathID("/subject/", subject.ID), http.StatusSeeOther)
+	return nil
+}
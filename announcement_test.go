@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+)
+
+func TestAnnouncementHandlers(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	testPostAuth(t, "/api/announcement/create", testTokens[2], url.Values{"ID": {"1"}, "Text": {"Hello"}}, http.StatusForbidden)
+	testPostAuth(t, "/api/announcement/create", testTokens[1], url.Values{"ID": {"1"}, "Text": {""}}, http.StatusBadRequest)
+	testPostAuth(t, "/api/announcement/create", testTokens[1], url.Values{"ID": {"100"}, "Text": {"Hello"}}, http.StatusNotFound)
+	testPostAuth(t, "/api/announcement/create", testTokens[1], url.Values{"ID": {"1"}, "Text": {"Hello"}}, http.StatusSeeOther)
+
+	ids := GetSubjectAnnouncementIDs(1)
+	if len(ids) != 1 {
+		t.Fatalf("Expected 1 announcement, got %d", len(ids))
+	}
+	for _, userID := range [...]database.ID{2, 3} {
+		if n := GetUserUnreadNotificationsCount(userID); n != 1 {
+			t.Errorf("Expected student %d to have 1 unread notification, got %d", userID, n)
+		}
+	}
+	if n := GetUserUnreadNotificationsCount(1); n != 0 {
+		t.Errorf("Expected teacher to have no unread notifications, got %d", n)
+	}
+
+	testGetAuth(t, "/subject/1", testTokens[1], http.StatusOK)
+	testGetAuth(t, "/subject/1", testTokens[2], http.StatusOK)
+
+	id := strconv.Itoa(int(ids[0]))
+	testPostAuth(t, "/api/announcement/delete", testTokens[2], url.Values{"ID": {id}}, http.StatusForbidden)
+	testPostAuth(t, "/api/announcement/delete", testTokens[1], url.Values{"ID": {id}}, http.StatusSeeOther)
+	testPostAuth(t, "/api/announcement/delete", testTokens[1], url.Values{"ID": {id}}, http.StatusNotFound)
+	if ids := GetSubjectAnnouncementIDs(1); len(ids) != 0 {
+		t.Errorf("Expected no announcements after delete, got %d", len(ids))
+	}
+}
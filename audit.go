@@ -0,0 +1,515 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/log"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/strings"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* AuditEntry records one change made by user. 'Before' and 'After' are short human-readable summaries of changed entity. */
+type AuditEntry struct {
+	Time   int64       `json:"time"`
+	Actor  database.ID `json:"actor"`
+	Action string      `json:"action"`
+	Entity string      `json:"entity"`
+	ID     database.ID `json:"id"`
+	Before string      `json:"before,omitempty"`
+	After  string      `json:"after,omitempty"`
+	IP     string      `json:"ip,omitempty"`
+}
+
+/* AccessEntry records one HTTP request. */
+type AccessEntry struct {
+	Time     string      `json:"time"`
+	IP       string      `json:"ip,omitempty"`
+	User     database.ID `json:"user"`
+	Method   string      `json:"method"`
+	Path     string      `json:"path"`
+	Status   int         `json:"status"`
+	Duration float64     `json:"duration"`
+}
+
+const (
+	AuditFile     = "audit.log"
+	AccessLogFile = "access.log"
+)
+
+/* AuditSystem is an actor of changes made by server itself, like verification of submissions. Requests without session are logged with it too. */
+const AuditSystem database.ID = -1
+
+const (
+	/* AuditEntriesPerPage is a number of entries on audit page. */
+	AuditEntriesPerPage = 50
+
+	/* AuditMaxTextLen limits length of user-provided texts, like messages, in summaries. */
+	AuditMaxTextLen = 128
+)
+
+var (
+	AuditLog     *os.File
+	AuditLogLock sync.Mutex
+
+	AccessLog     *os.File
+	AccessLogLock sync.Mutex
+)
+
+func OpenLogFile(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+}
+
+/* RequestAddrs are peer addresses of connections, which requests are being handled from. See 'ServeConn'. */
+var (
+	RequestAddrs     = make(map[*http.Request]string)
+	RequestAddrsLock sync.Mutex
+)
+
+func SetRequestAddr(r *http.Request, addr string) {
+	RequestAddrsLock.Lock()
+	RequestAddrs[r] = addr
+	RequestAddrsLock.Unlock()
+}
+
+func DeleteRequestAddr(r *http.Request) {
+	RequestAddrsLock.Lock()
+	delete(RequestAddrs, r)
+	RequestAddrsLock.Unlock()
+}
+
+/* TrustedProxy returns true if 'ip' matches one of 'Config.TrustedProxies'. */
+func TrustedProxy(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for i := 0; i < len(Config.TrustedProxies); i++ {
+		proxy := Config.TrustedProxies[i]
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if addr.Equal(net.ParseIP(proxy)) {
+			return true
+		}
+	}
+	return false
+}
+
+/* GetRequestIP returns address of a client, including ones connected through 'TLSProxy'. Forwarded headers are set by clients as they like, so they are only honored when connection came from trusted proxy. Empty string means that address is unknown. */
+func GetRequestIP(r *http.Request) string {
+	RequestAddrsLock.Lock()
+	addr := RequestAddrs[r]
+	RequestAddrsLock.Unlock()
+
+	if client, ok := TLSClientAddr(addr); ok {
+		addr = client
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	if !TrustedProxy(host) {
+		return host
+	}
+
+	if ip := r.Headers.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+
+	/* NOTE(anton2920): proxy appends address of its client, everything before it comes from client. */
+	forwarded := r.Headers.Get("X-Forwarded-For")
+	if comma := strings.FindCharReverse(forwarded, ','); comma != -1 {
+		forwarded = forwarded[comma+1:]
+	}
+	for (len(forwarded) > 0) && (forwarded[0] == ' ') {
+		forwarded = forwarded[1:]
+	}
+	if forwarded == "" {
+		return host
+	}
+	return forwarded
+}
+
+func WriteLogEntry(f *os.File, lock *sync.Mutex, entry interface{}) error {
+	if f == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	/* NOTE(anton2920): file is opened with O_APPEND, so every entry is written with single write(2) and is never interleaved. */
+	_, err = f.Write(data)
+	return err
+}
+
+/* Audit appends entry to audit log. Errors are only logged, because change is already committed by then. */
+func Audit(r *http.Request, actor database.ID, action string, entity string, id database.ID, before string, after string) {
+	defer trace.End(trace.Begin(""))
+
+	entry := AuditEntry{Time: time.Now().Unix(), Actor: actor, Action: action, Entity: entity, ID: id, Before: before, After: after}
+	if r != nil {
+		entry.IP = GetRequestIP(r)
+	}
+	if err := WriteLogEntry(AuditLog, &AuditLogLock, &entry); err != nil {
+		log.Errorf("Failed to write audit log entry: %v", err)
+	}
+}
+
+/* AccessLogRequest must be deferred by router, like 'MetricsObserveRequest'. */
+func AccessLogRequest(w *http.Response, r *http.Request, err *error, start time.Time) {
+	if AccessLog == nil {
+		return
+	}
+
+	entry := AccessEntry{Time: start.UTC().Format(time.RFC3339), IP: GetRequestIP(r), User: AuditSystem, Method: r.Method, Path: string(r.URL.Path), Status: int(MetricsStatus(w, *err)), Duration: time.Since(start).Seconds()}
+	if session, err := GetSessionFromRequest(r); err == nil {
+		entry.User = session.ID
+	}
+	if err := WriteLogEntry(AccessLog, &AccessLogLock, &entry); err != nil {
+		log.Errorf("Failed to write access log entry: %v", err)
+	}
+}
+
+func AuditUserSummary(user *User) string {
+	return user.LastName + " " + user.FirstName + " <" + user.Email + ">"
+}
+
+func AuditGroupSummary(group *Group) string {
+	return group.Name + ", " + strconv.Itoa(len(group.Students)) + " students"
+}
+
+func AuditSubjectSummary(subject *Subject) string {
+	return subject.Name + ", teacher " + strconv.Itoa(int(subject.TeacherID)) + ", group " + strconv.Itoa(int(subject.GroupID))
+}
+
+func AuditCourseSummary(course *Course) string {
+	return course.Name + ", " + strconv.Itoa(len(course.Lessons)) + " lessons"
+}
+
+func AuditCourseUsersSummary(course *Course) string {
+	return fmt.Sprintf("viewers %v, co-authors %v", course.Viewers, course.CoAuthors)
+}
+
+func AuditLessonSummary(lesson *Lesson) string {
+	return lesson.Name + ", " + strconv.Itoa(len(lesson.Steps)) + " steps"
+}
+
+func AuditTextSummary(text string) string {
+	if utf8.RuneCountInString(text) <= AuditMaxTextLen {
+		return text
+	}
+
+	var n int
+	for i := range text {
+		if n == AuditMaxTextLen {
+			return text[:i] + "..."
+		}
+		n++
+	}
+	return text
+}
+
+func AuditQuestionSummary(bq *BankQuestion) string {
+	return fmt.Sprintf("%s, version %d, %d answers", AuditTextSummary(bq.Question.Name), bq.Version, len(bq.Question.Answers))
+}
+
+func AuditMessageSummary(message *Message) string {
+	return fmt.Sprintf("flags %d, pinned %t, answer %t", message.Flags, message.Pinned, message.Answer)
+}
+
+func AuditScoreSummary(score int, maximum int) string {
+	return strconv.Itoa(score) + "/" + strconv.Itoa(maximum)
+}
+
+/* AuditFilterAny matches any actor or ID in 'AuditFilter'. */
+const AuditFilterAny database.ID = -2
+
+/* AuditFilter selects audit entries. Empty strings and 'AuditFilterAny' match everything. */
+type AuditFilter struct {
+	Actor  database.ID
+	Action string
+	Entity string
+	ID     database.ID
+}
+
+func AuditFilterMatch(filter *AuditFilter, entry *AuditEntry) bool {
+	return ((filter.Actor == AuditFilterAny) || (filter.Actor == entry.Actor)) &&
+		((filter.Action == "") || (filter.Action == entry.Action)) &&
+		((filter.Entity == "") || (filter.Entity == entry.Entity)) &&
+		((filter.ID == AuditFilterAny) || (filter.ID == entry.ID))
+}
+
+/* AuditReadChunkLen is a number of bytes read from the end of audit log at once. */
+const AuditReadChunkLen = 64 * 1024
+
+/* ReadAuditEntries returns at most 'count' entries matching filter, newest first, after skipping 'skip' newer ones. Log is read from the end, so only needed part of it is read. 'more' is true if there are older matching entries. */
+func ReadAuditEntries(filter *AuditFilter, skip int, count int) (entries []AuditEntry, more bool, err error) {
+	defer trace.End(trace.Begin(""))
+
+	if AuditLog == nil {
+		return nil, false, nil
+	}
+
+	f, err := os.Open(AuditLog.Name())
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+
+	/* NOTE(anton2920): log may be cut by crash in the middle of a line, or edited by hand. Such lines are skipped, so the rest of log is still available. */
+	match := func(line []byte) bool {
+		var entry AuditEntry
+		if (len(line) == 0) || (json.Unmarshal(line, &entry) != nil) || (!AuditFilterMatch(filter, &entry)) {
+			return false
+		}
+		if skip > 0 {
+			skip--
+			return false
+		}
+		if len(entries) == count {
+			more = true
+			return true
+		}
+		entries = append(entries, entry)
+		return false
+	}
+
+	var rest []byte
+	for pos := fi.Size(); pos > 0; {
+		n := min(AuditReadChunkLen, pos)
+		pos -= n
+
+		data := make([]byte, int(n)+len(rest))
+		if _, err := f.ReadAt(data[:n], pos); err != nil {
+			return nil, false, err
+		}
+		copy(data[n:], rest)
+
+		end := len(data)
+		for {
+			nl := bytes.LastIndexByte(data[:end], '\n')
+			if nl == -1 {
+				break
+			}
+			if match(data[nl+1 : end]) {
+				return entries, more, nil
+			}
+			end = nl
+		}
+		rest = data[:end]
+	}
+	match(rest)
+
+	return entries, more, nil
+}
+
+func GetAuditFilterID(s string) (database.ID, error) {
+	if s == "" {
+		return AuditFilterAny, nil
+	}
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		return AuditFilterAny, err
+	}
+	return database.ID(id), nil
+}
+
+func AuditPageLink(filter *AuditFilter, page int) string {
+	vs := make(url.Values)
+	if filter.Actor != AuditFilterAny {
+		vs.Set("Actor", strconv.Itoa(int(filter.Actor)))
+	}
+	vs.Set("Action", filter.Action)
+	vs.Set("Entity", filter.Entity)
+	if filter.ID != AuditFilterAny {
+		vs.Set("ID", strconv.Itoa(int(filter.ID)))
+	}
+	vs.Set("Page", strconv.Itoa(page))
+	return "/audit?" + vs.Encode()
+}
+
+func DisplayAuditActor(w *http.Response, l Language, actor database.ID) {
+	DisplayTableItemStart(w)
+	if actor == AuditSystem {
+		w.WriteString(Ls(l, "system"))
+	} else {
+		w.WriteString(`<a href="/user/`)
+		w.WriteInt(int(actor))
+		w.WriteString(`">`)
+		w.WriteInt(int(actor))
+		w.WriteString(`</a>`)
+	}
+	DisplayTableItemEnd(w)
+}
+
+/* AuditPageHandler displays audit log to administrator. Entries can be filtered by actor, action, entity and its ID. */
+func AuditPageHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	const width = WidthLarge
+
+	var filter AuditFilter
+	var page int
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+	if session.ID != AdminID {
+		return ForbiddenError
+	}
+
+	filter.Actor, err = GetAuditFilterID(r.URL.Query.Get("Actor"))
+	if err != nil {
+		return http.ClientError(err)
+	}
+	filter.Action = r.URL.Query.Get("Action")
+	filter.Entity = r.URL.Query.Get("Entity")
+	filter.ID, err = GetAuditFilterID(r.URL.Query.Get("ID"))
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if r.URL.Query.Has("Page") {
+		page, err = r.URL.Query.GetInt("Page")
+		if (err != nil) || (page < 0) {
+			return http.ClientError(err)
+		}
+	}
+
+	entries, more, err := ReadAuditEntries(&filter, page*AuditEntriesPerPage, AuditEntriesPerPage)
+	if err != nil {
+		return http.ServerError(err)
+	}
+
+	DisplayHTMLStart(w)
+
+	DisplayHeadStart(w)
+	{
+		w.WriteString(`<title>`)
+		w.WriteString(Ls(GL, "Audit log"))
+		w.WriteString(`</title>`)
+	}
+	DisplayHeadEnd(w)
+
+	DisplayBodyStart(w)
+	{
+		DisplayHeader(w, GL, session)
+		DisplaySidebar(w, GL, session)
+
+		DisplayMainStart(w)
+
+		DisplayCrumbsStart(w, width)
+		{
+			DisplayCrumbsItem(w, GL, "Audit log")
+		}
+		DisplayCrumbsEnd(w)
+
+		DisplayPageStart(w, width)
+		{
+			w.WriteString(`<h2 class="text-center">`)
+			w.WriteString(Ls(GL, "Audit log"))
+			w.WriteString(`</h2>`)
+			w.WriteString(`<br>`)
+
+			w.WriteString(`<form class="d-flex gap-2 mb-3" method="GET" action="/audit">`)
+			{
+				var actor, id string
+				if filter.Actor != AuditFilterAny {
+					actor = strconv.Itoa(int(filter.Actor))
+				}
+				if filter.ID != AuditFilterAny {
+					id = strconv.Itoa(int(filter.ID))
+				}
+
+				w.WriteString(`<input class="form-control" type="number" name="Actor" placeholder="`)
+				w.WriteString(Ls(GL, "Actor"))
+				w.WriteString(`" value="`)
+				w.WriteHTMLString(actor)
+				w.WriteString(`">`)
+				w.WriteString(`<input class="form-control" type="text" name="Action" placeholder="`)
+				w.WriteString(Ls(GL, "Action"))
+				w.WriteString(`" value="`)
+				w.WriteHTMLString(filter.Action)
+				w.WriteString(`">`)
+				w.WriteString(`<input class="form-control" type="text" name="Entity" placeholder="`)
+				w.WriteString(Ls(GL, "Entity"))
+				w.WriteString(`" value="`)
+				w.WriteHTMLString(filter.Entity)
+				w.WriteString(`">`)
+				w.WriteString(`<input class="form-control" type="number" name="ID" placeholder="ID" value="`)
+				w.WriteHTMLString(id)
+				w.WriteString(`">`)
+				DisplayButton(w, GL, "", "Filter")
+			}
+			w.WriteString(`</form>`)
+
+			DisplayTableStart(w, GL, []string{"Time", "Actor", "Action", "Entity", "ID", "Before", "After", "IP"})
+			for i := 0; i < len(entries); i++ {
+				entry := &entries[i]
+
+				DisplayTableRowStart(w)
+				DisplayTableItemTime(w, entry.Time)
+				DisplayAuditActor(w, GL, entry.Actor)
+				DisplayTableItemString(w, entry.Action)
+				DisplayTableItemString(w, entry.Entity)
+				DisplayTableItemID(w, entry.ID)
+				DisplayTableItemShortenedString(w, entry.Before, 40)
+				DisplayTableItemShortenedString(w, entry.After, 40)
+				DisplayTableItemString(w, entry.IP)
+				DisplayTableRowEnd(w)
+			}
+			DisplayTableEnd(w)
+
+			w.WriteString(`<div class="d-flex justify-content-between">`)
+			if page > 0 {
+				w.WriteString(`<a href="`)
+				w.WriteHTMLString(AuditPageLink(&filter, page-1))
+				w.WriteString(`">`)
+				w.WriteString(Ls(GL, "Newer"))
+				w.WriteString(`</a>`)
+			} else {
+				w.WriteString(`<span></span>`)
+			}
+			if more {
+				w.WriteString(`<a href="`)
+				w.WriteHTMLString(AuditPageLink(&filter, page+1))
+				w.WriteString(`">`)
+				w.WriteString(Ls(GL, "Older"))
+				w.WriteString(`</a>`)
+			}
+			w.WriteString(`</div>`)
+		}
+		DisplayPageEnd(w)
+		DisplayMainEnd(w)
+	}
+	DisplayBodyEnd(w)
+
+	DisplayHTMLEnd(w)
+	return nil
+}
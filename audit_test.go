@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+)
+
+func TestAuditTextSummary(t *testing.T) {
+	if s := AuditTextSummary("Привет"); s != "Привет" {
+		t.Errorf("Expected short text to be left as is, got %q", s)
+	}
+
+	long := []rune(testString(AuditMaxTextLen + 1))
+	long[AuditMaxTextLen-1] = 'Ж'
+	expected := string(long[:AuditMaxTextLen]) + "..."
+	if s := AuditTextSummary(string(long)); s != expected {
+		t.Errorf("Expected %q, got %q", expected, s)
+	}
+}
+
+func TestAuditEntries(t *testing.T) {
+	testCreateInitialDBs()
+
+	testPostAuth(t, APIPrefix+"/group/edit", testTokens[AdminID], url.Values{"ID": {"1"}, "Name": {"Audited group"}, "StudentID": {"2", "3"}}, http.StatusSeeOther)
+
+	filter := AuditFilter{Actor: AdminID, Action: "edit", Entity: "group", ID: 1}
+	entries, _, err := ReadAuditEntries(&filter, 0, AuditEntriesPerPage)
+	if err != nil {
+		t.Fatalf("Failed to read audit entries: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Fatalf("Expected group edit to be audited")
+	}
+	if entry := &entries[0]; entry.After != "Audited group, 2 students" {
+		t.Errorf("Expected summary of edited group, got %q", entry.After)
+	}
+
+	filter.Actor = 2
+	entries, _, err = ReadAuditEntries(&filter, 0, AuditEntriesPerPage)
+	if err != nil {
+		t.Fatalf("Failed to read audit entries: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected no entries from user 2, got %d", len(entries))
+	}
+}
+
+func TestAuditCourseEdit(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	testPostAuth(t, "/course/edit", testTokens[AdminID], url.Values{"ID": {"0"}, "CurrentPage": {"Course"}, "Name": {"Audited course"}, "NextPage": {Ls(GL, "Save")}}, http.StatusSeeOther)
+
+	filter := AuditFilter{Actor: AdminID, Action: "edit", Entity: "course", ID: 0}
+	entries, _, err := ReadAuditEntries(&filter, 0, 1)
+	if err != nil {
+		t.Fatalf("Failed to read audit entries: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Fatalf("Expected course edit to be audited")
+	}
+	if entry := &entries[0]; (entry.Before != "Programming basics, 1 lessons") || (entry.After != "Audited course, 1 lessons") {
+		t.Errorf("Expected summaries of course before and after edit, got %q and %q", entry.Before, entry.After)
+	}
+}
+
+func TestReadAuditEntries(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		Audit(nil, 3, "test", "audit", database.ID(i), "", "")
+	}
+	AuditLogLock.Lock()
+	AuditLog.Write([]byte("{\"broken\n"))
+	AuditLogLock.Unlock()
+	Audit(nil, 3, "test", "audit", 3, "", "")
+
+	filter := AuditFilter{Actor: 3, Action: "test", Entity: "audit", ID: AuditFilterAny}
+	entries, more, err := ReadAuditEntries(&filter, 0, 10)
+	if err != nil {
+		t.Fatalf("Failed to read audit entries: %v", err)
+	}
+	if (len(entries) != 4) || (more) {
+		t.Fatalf("Expected 4 entries and no more, got %d (%t)", len(entries), more)
+	}
+	for i := 0; i < len(entries); i++ {
+		if entries[i].ID != database.ID(3-i) {
+			t.Errorf("Expected entry %d to have ID %d, got %d", i, 3-i, entries[i].ID)
+		}
+	}
+
+	entries, more, err = ReadAuditEntries(&filter, 1, 2)
+	if err != nil {
+		t.Fatalf("Failed to read audit entries: %v", err)
+	}
+	if (len(entries) != 2) || (entries[0].ID != 2) || (entries[1].ID != 1) || (!more) {
+		t.Errorf("Expected entries 2 and 1 with more, got %v (%t)", entries, more)
+	}
+}
+
+func TestAuditPageHandler(t *testing.T) {
+	testGetAuth(t, "/audit", testTokens[AdminID], http.StatusOK)
+	testGetAuth(t, "/audit?Actor=0&Action=edit&Entity=group&ID=1&Page=0", testTokens[AdminID], http.StatusOK)
+	testGetAuth(t, "/audit?Actor=a", testTokens[AdminID], http.StatusBadRequest)
+	testGetAuth(t, "/audit?ID=a", testTokens[AdminID], http.StatusBadRequest)
+	testGetAuth(t, "/audit?Page=-1", testTokens[AdminID], http.StatusBadRequest)
+	testGetAuth(t, "/audit", testTokens[1], http.StatusForbidden)
+
+	testGet(t, "/audit", http.StatusUnauthorized)
+}
+
+func TestGetRequestIP(t *testing.T) {
+	proxies := Config.TrustedProxies
+	Config.TrustedProxies = ConfigList{"10.0.0.0/8"}
+	defer func() { Config.TrustedProxies = proxies }()
+
+	var r http.Request
+	r.Headers.Set("X-Forwarded-For", "1.1.1.1, 2.2.2.2")
+
+	if ip := GetRequestIP(&r); ip != "" {
+		t.Errorf("Expected unknown address for request without connection, got %q", ip)
+	}
+
+	SetRequestAddr(&r, "192.168.1.5:40000")
+	defer DeleteRequestAddr(&r)
+	if ip := GetRequestIP(&r); ip != "192.168.1.5" {
+		t.Errorf("Expected headers from untrusted peer to be ignored, got %q", ip)
+	}
+
+	SetRequestAddr(&r, "10.0.0.1:40000")
+	if ip := GetRequestIP(&r); ip != "2.2.2.2" {
+		t.Errorf("Expected address appended by trusted proxy, got %q", ip)
+	}
+
+	TLSClientsLock.Lock()
+	TLSClients["127.0.0.1:40000"] = "3.3.3.3:50000"
+	TLSClientsLock.Unlock()
+	defer func() {
+		TLSClientsLock.Lock()
+		delete(TLSClients, "127.0.0.1:40000")
+		TLSClientsLock.Unlock()
+	}()
+	SetRequestAddr(&r, "127.0.0.1:40000")
+	if ip := GetRequestIP(&r); ip != "3.3.3.3" {
+		t.Errorf("Expected address of TLS client, got %q", ip)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* BackupFiles are files, which are enough to restore all data. WAL is empty while backup is made and indexes are rebuilt on start. */
+var BackupFiles = [...]string{
+	SchemaFile,
+	"Users.db",
+	"Groups.db",
+	"Courses.db",
+	"Lessons.db",
+	"Subjects.db",
+	"Submissions.db",
+	"Questions.db",
+	"Announcements.db",
+	"Notifications.db",
+	"Messages.db",
+	"TaskFiles.db",
+	BlobsName,
+}
+
+/* SnapshotDBs copies DBs into 'dir'. New transactions are blocked only while files are copied, so snapshot is consistent. */
+func SnapshotDBs(dir string) error {
+	defer trace.End(trace.Begin(""))
+
+	WALLock.Lock()
+	defer WALLock.Unlock()
+
+	for i := 0; i < len(BackupFiles); i++ {
+		name := BackupFiles[i]
+
+		src, err := os.Open(GetPath(DBDirectory, name))
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", name, err)
+		}
+
+		/* NOTE(anton2920): blobs may be appended concurrently, but committed records only reference data before current size. */
+		fi, err := src.Stat()
+		if err != nil {
+			src.Close()
+			return fmt.Errorf("failed to stat %s: %w", name, err)
+		}
+
+		dst, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			src.Close()
+			return err
+		}
+		_, err = io.CopyN(dst, src, fi.Size())
+		src.Close()
+		if err1 := dst.Close(); err == nil {
+			err = err1
+		}
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+/* BackupDBs writes consistent snapshot of DBs as a gzipped tar archive. DBs are copied first, so transactions are not blocked while archive is compressed. */
+func BackupDBs(w io.Writer) error {
+	defer trace.End(trace.Begin(""))
+
+	dir, err := os.MkdirTemp(filepath.Dir(DBDirectory), filepath.Base(DBDirectory)+".backup-")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := SnapshotDBs(dir); err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	for i := 0; i < len(BackupFiles); i++ {
+		name := BackupFiles[i]
+
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", name, err)
+		}
+
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("failed to stat %s: %w", name, err)
+		}
+
+		hdr := tar.Header{Name: name, Mode: 0644, Size: fi.Size(), ModTime: fi.ModTime()}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write header for %s: %w", name, err)
+		}
+		if _, err := io.CopyN(tw, f, fi.Size()); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		f.Close()
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+/* RestoreDBs replaces DBs in 'dir' with ones from archive. Previous DBs are kept in a separate directory. Server must not be running. */
+func RestoreDBs(dir string, r io.Reader) (string, error) {
+	defer trace.End(trace.Begin(""))
+
+	tmp := dir + ".restore"
+	if err := os.RemoveAll(tmp); err != nil {
+		return "", err
+	}
+	if err := os.Mkdir(tmp, 0755); err != nil {
+		return "", err
+	}
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive: %w", err)
+	}
+	tr := tar.NewReader(gr)
+
+	var found [len(BackupFiles)]bool
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		index := -1
+		for i := 0; i < len(BackupFiles); i++ {
+			if hdr.Name == BackupFiles[i] {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			return "", fmt.Errorf("unexpected file %q in archive", hdr.Name)
+		}
+		found[index] = true
+
+		f, err := os.Create(filepath.Join(tmp, hdr.Name))
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return "", fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return "", err
+		}
+		f.Close()
+	}
+	for i := 0; i < len(found); i++ {
+		if !found[i] {
+			return "", fmt.Errorf("archive does not contain %s", BackupFiles[i])
+		}
+	}
+
+	var old string
+	if _, err := os.Stat(dir); err == nil {
+		old = dir + ".old-" + strconv.FormatInt(time.Now().Unix(), 10)
+		if err := os.Rename(dir, old); err != nil {
+			return "", err
+		}
+	}
+
+	return old, os.Rename(tmp, dir)
+}
+
+/* BackupToFile writes archive of DBs next to DB directory and returns its path. Archive is written to a temporary file first, so it's never left incomplete under its final name. */
+func BackupToFile() (string, error) {
+	defer trace.End(trace.Begin(""))
+
+	name := DBDirectory + ".backup-" + time.Now().UTC().Format("20060102-150405") + ".tar.gz"
+	tmp := name + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+
+	if err := BackupDBs(f); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	return name, os.Rename(tmp, name)
+}
+
+func BackupHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+	if session.ID != AdminID {
+		return ForbiddenError
+	}
+
+	/* NOTE(anton2920): response is buffered by server and blobs are not bounded, so archive is written to disk instead of response. */
+	name, err := BackupToFile()
+	if err != nil {
+		return http.ServerError(err)
+	}
+
+	Audit(r, session.ID, "backup", "database", 0, "", name)
+
+	w.Headers.Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("Backup is written to " + name + "\n"))
+	return nil
+}
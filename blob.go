@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	sys "syscall"
+	"unsafe"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/syscall"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* Blob is a reference to record data, which did not fit into record's inline 'Data' buffer. */
+type Blob struct {
+	Offset int64
+	Len    int64
+}
+
+const (
+	/* NOTE(anton2920): blobs are aligned to make sure slices decoded from them are properly aligned. */
+	BlobAlignment = 8
+
+	MaxBlobLen = 1 << 20
+
+	/* CompactBlobsTxLen is a number of bytes of blobs moved by a single transaction of 'CompactBlobs'. */
+	CompactBlobsTxLen = 16 * MaxBlobLen
+)
+
+const BlobsName = "Blobs.db"
+
+/* RecordLayouts contains record size and offset of 'Blob' field for every DB. Must be in the same order as 'TxDBs'. */
+var RecordLayouts = [len(TxDBs)]struct {
+	Size       uintptr
+	BlobOffset uintptr
+}{
+	{unsafe.Sizeof(User{}), unsafe.Offsetof(User{}.Blob)},
+	{unsafe.Sizeof(Group{}), unsafe.Offsetof(Group{}.Blob)},
+	{unsafe.Sizeof(Course{}), unsafe.Offsetof(Course{}.Blob)},
+	{unsafe.Sizeof(Lesson{}), unsafe.Offsetof(Lesson{}.Blob)},
+	{unsafe.Sizeof(Subject{}), unsafe.Offsetof(Subject{}.Blob)},
+	{unsafe.Sizeof(Submission{}), unsafe.Offsetof(Submission{}.Blob)},
+	{unsafe.Sizeof(BankQuestion{}), unsafe.Offsetof(BankQuestion{}.Blob)},
+	{unsafe.Sizeof(Announcement{}), unsafe.Offsetof(Announcement{}.Blob)},
+	{unsafe.Sizeof(Notification{}), unsafe.Offsetof(Notification{}.Blob)},
+	{unsafe.Sizeof(Message{}), unsafe.Offsetof(Message{}.Blob)},
+	{unsafe.Sizeof(TaskFiles{}), unsafe.Offsetof(TaskFiles{}.Blob)},
+}
+
+var (
+	BlobsFile *os.File
+	BlobsLock sync.Mutex
+	BlobsEnd  int64
+)
+
+var DataTooLarge = errors.New("record data is too large")
+
+func OpenBlobs(dir string, name string) error {
+	defer trace.End(trace.Begin(""))
+
+	buf := make([]byte, syscall.PATH_MAX)
+	n := PutPath(buf, dir, name)
+
+	f, err := os.OpenFile(unsafe.String(unsafe.SliceData(buf), n), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	BlobsFile = f
+	BlobsEnd = end
+	return nil
+}
+
+func CloseBlobs() error {
+	defer trace.End(trace.Begin(""))
+
+	if BlobsFile == nil {
+		return nil
+	}
+	return BlobsFile.Close()
+}
+
+func DBStringSize(s string) int {
+	return len(s)
+}
+
+/* DBSliceSize returns upper bound of number of bytes 'database.Slice2DBSlice' will use, including padding. */
+func DBSliceSize[T any](vs []T) int {
+	var t T
+	return len(vs)*int(unsafe.Sizeof(t)) + int(unsafe.Alignof(t)) - 1
+}
+
+/* GetDataBuffer returns buffer big enough to hold 'size' bytes of record data. If data does not fit into 'inline', separate buffer is allocated and data must be saved with 'SaveBlob'. */
+func GetDataBuffer(inline []byte, size int) ([]byte, error) {
+	defer trace.End(trace.Begin(""))
+
+	if size <= len(inline) {
+		return inline, nil
+	}
+	if size > MaxBlobLen {
+		return nil, fmt.Errorf("%w: %d bytes, maximum is %d", DataTooLarge, size, MaxBlobLen)
+	}
+	return make([]byte, size), nil
+}
+
+/* SaveBlob writes record data to a blobs file, if it's not stored inline. Blobs are never overwritten, so record always points to a complete one. Space of blobs, which are no longer referenced, is reclaimed by 'CompactBlobs'. */
+func SaveBlob(blob *Blob, inline []byte, data []byte) error {
+	defer trace.End(trace.Begin(""))
+
+	if unsafe.SliceData(data) == unsafe.SliceData(inline) {
+		*blob = Blob{}
+		return nil
+	}
+
+	BlobsLock.Lock()
+	offset := BlobsEnd
+	BlobsEnd += BlobAlignedLen(int64(len(data)))
+	BlobsLock.Unlock()
+
+	if _, err := BlobsFile.WriteAt(data, offset); err != nil {
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+
+	blob.Offset = offset
+	blob.Len = int64(len(data))
+	return nil
+}
+
+/* GetBlobData returns pointer to the beginning of record data, which is either 'inline' buffer or contents of a blob. */
+func GetBlobData(blob *Blob, inline []byte) (*byte, error) {
+	defer trace.End(trace.Begin(""))
+
+	if blob.Len == 0 {
+		return &inline[0], nil
+	}
+
+	BlobsLock.Lock()
+	end := BlobsEnd
+	BlobsLock.Unlock()
+
+	if (blob.Len < 0) || (blob.Len > MaxBlobLen) || (blob.Offset < 0) || (blob.Offset+blob.Len > end) {
+		return nil, fmt.Errorf("invalid blob reference: offset %d, length %d", blob.Offset, blob.Len)
+	}
+
+	buf := make([]byte, blob.Len)
+	if _, err := BlobsFile.ReadAt(buf, blob.Offset); err != nil {
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+	return &buf[0], nil
+}
+
+func BlobAlignedLen(n int64) int64 {
+	return (n + BlobAlignment - 1) &^ (BlobAlignment - 1)
+}
+
+/*
+ * CompactBlobs moves blobs referenced by records of all DBs, including deleted ones, to the beginning of blobs file and truncates it, reclaiming space of
+ * blobs left by updated records and failed transactions. Blobs are only moved towards the beginning in order of their offsets, so every transaction
+ * overwrites only blobs, which are either unreferenced or already moved. Each transaction moves blobs together with records referencing them, so a crash
+ * leaves blobs file consistent. Must not be called while server is running. Returns number of reclaimed bytes.
+ */
+func CompactBlobs() (int64, error) {
+	defer trace.End(trace.Begin(""))
+
+	type BlobRef struct {
+		DB     int32
+		Offset int64
+		Blob   Blob
+	}
+	var refs []BlobRef
+
+	for i := 0; i < len(TxDBs); i++ {
+		db := *TxDBs[i]
+		layout := &RecordLayouts[i]
+
+		n := GetNextID(db)
+		for id := database.ID(0); id < n; id++ {
+			var blob Blob
+
+			offset := database.GetOffsetForID(id, int(layout.Size)) + int64(layout.BlobOffset)
+			if _, err := sys.Pread(int(db.FD), unsafe.Slice((*byte)(unsafe.Pointer(&blob)), unsafe.Sizeof(blob)), offset); err != nil {
+				return 0, fmt.Errorf("failed to read blob reference: %w", err)
+			}
+
+			/* NOTE(anton2920): invalid references are reported by 'FsckDBs', their records are deleted, but not changed. */
+			if (blob.Len > 0) && (blob.Len <= MaxBlobLen) && (blob.Offset >= 0) && (blob.Offset+blob.Len <= BlobsEnd) {
+				refs = append(refs, BlobRef{DB: int32(i), Offset: offset, Blob: blob})
+			}
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Blob.Offset < refs[j].Blob.Offset })
+
+	var tx Tx
+	var txLen int
+	var end int64
+
+	/* NOTE(anton2920): records may share a blob only if one was copied from another, so they keep sharing it. */
+	var prev, moved Blob
+
+	for i := 0; i < len(refs); i++ {
+		ref := &refs[i]
+
+		blob := ref.Blob
+		if (blob.Offset >= prev.Offset) && (blob.Offset+blob.Len <= prev.Offset+prev.Len) {
+			blob.Offset = moved.Offset + (blob.Offset - prev.Offset)
+		} else {
+			prev = ref.Blob
+			blob.Offset = end
+			end += BlobAlignedLen(blob.Len)
+			moved = blob
+
+			if blob.Offset != ref.Blob.Offset {
+				buf := make([]byte, blob.Len)
+				if _, err := BlobsFile.ReadAt(buf, ref.Blob.Offset); err != nil {
+					return 0, fmt.Errorf("failed to read blob: %w", err)
+				}
+				tx.WriteBlobAt(buf, blob.Offset)
+				txLen += len(buf)
+			}
+		}
+
+		if blob != ref.Blob {
+			tx.WriteAt(*TxDBs[ref.DB], unsafe.Slice((*byte)(unsafe.Pointer(&blob)), unsafe.Sizeof(blob)), ref.Offset)
+		}
+
+		if (txLen >= CompactBlobsTxLen) || (i == len(refs)-1) {
+			if err := CommitTx(&tx); err != nil {
+				return 0, fmt.Errorf("failed to commit moved blobs: %w", err)
+			}
+			tx = Tx{}
+			txLen = 0
+		}
+	}
+
+	reclaimed := BlobsEnd - end
+	if reclaimed > 0 {
+		if err := BlobsFile.Truncate(end); err != nil {
+			return 0, fmt.Errorf("failed to truncate blobs: %w", err)
+		}
+		if err := BlobsFile.Sync(); err != nil {
+			return 0, fmt.Errorf("failed to sync blobs: %w", err)
+		}
+		BlobsEnd = end
+	}
+
+	return reclaimed, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/anton2920/gofa/database"
+)
+
+func TestSaveLargeLesson(t *testing.T) {
+	testCreateInitialDBs()
+
+	lesson := Lesson{
+		ContainerType: LessonContainerCourse,
+		Name:          "Large lesson",
+		Theory:        strings.Repeat("Very long theory. ", 2048),
+		Steps:         make([]Step, 50),
+	}
+	for i := 0; i < len(lesson.Steps); i++ {
+		*((*StepProgramming)(unsafe.Pointer(&lesson.Steps[i]))) = StepProgramming{
+			StepCommon:  StepCommon{Name: "Task", Type: StepTypeProgramming},
+			Description: strings.Repeat("Description. ", 64),
+			Checks: [2][]Check{
+				CheckTypeExample: []Check{{Input: "input", Output: "output"}},
+				CheckTypeTest:    []Check{{Input: strings.Repeat("i", 256), Output: strings.Repeat("o", 256)}},
+			},
+		}
+	}
+	if err := CreateLesson(&lesson); err != nil {
+		t.Fatalf("Failed to create large lesson: %v", err)
+	}
+
+	var saved Lesson
+	if err := GetLessonByID(lesson.ID, &saved); err != nil {
+		t.Fatalf("Failed to get large lesson: %v", err)
+	}
+	if saved.Blob.Len == 0 {
+		t.Errorf("Expected large lesson to be stored in blob")
+	}
+	if saved.Theory != lesson.Theory {
+		t.Errorf("Theory mismatch")
+	}
+	if len(saved.Steps) != len(lesson.Steps) {
+		t.Fatalf("Expected %d steps, got %d", len(lesson.Steps), len(saved.Steps))
+	}
+	for i := 0; i < len(saved.Steps); i++ {
+		task, _ := Step2Programming(&saved.Steps[i])
+		expected, _ := Step2Programming(&lesson.Steps[i])
+		if (task.Description != expected.Description) || (task.Checks[CheckTypeTest][0].Output != expected.Checks[CheckTypeTest][0].Output) {
+			t.Errorf("Step %d mismatch", i)
+		}
+	}
+
+	/* Shrinking lesson must move its data back inline. */
+	saved.Theory = "Short theory."
+	saved.Steps = saved.Steps[:1]
+	if err := SaveLesson(&saved); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+	if err := GetLessonByID(lesson.ID, &saved); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	if (saved.Blob.Len != 0) || (saved.Theory != "Short theory.") || (len(saved.Steps) != 1) {
+		t.Errorf("Expected lesson to be stored inline")
+	}
+}
+
+func TestSaveLargeGroup(t *testing.T) {
+	testCreateInitialDBs()
+
+	group := Group{Name: "Large group", Students: make([]database.ID, 500)}
+	for i := 0; i < len(group.Students); i++ {
+		group.Students[i] = database.ID(i)
+	}
+	if err := CreateGroup(&group); err != nil {
+		t.Fatalf("Failed to create large group: %v", err)
+	}
+
+	groups := make([]Group, 4)
+	var pos int64
+	var found bool
+	for !found {
+		n, err := GetGroups(&pos, groups)
+		if err != nil {
+			t.Fatalf("Failed to get groups: %v", err)
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			if groups[i].ID == group.ID {
+				if len(groups[i].Students) != len(group.Students) {
+					t.Fatalf("Expected %d students, got %d", len(group.Students), len(groups[i].Students))
+				}
+				for j := 0; j < len(group.Students); j++ {
+					if groups[i].Students[j] != group.Students[j] {
+						t.Errorf("Student %d mismatch", j)
+					}
+				}
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Large group was not found")
+	}
+}
+
+func TestSaveTooLarge(t *testing.T) {
+	testCreateInitialDBs()
+
+	lesson := Lesson{Name: "Huge lesson", Theory: strings.Repeat("a", MaxBlobLen+1)}
+	if err := CreateLesson(&lesson); !errors.Is(err, DataTooLarge) {
+		t.Errorf("Expected %v, got %v", DataTooLarge, err)
+	}
+}
+
+func TestCompactBlobs(t *testing.T) {
+	testCreateInitialDBs()
+
+	lesson := Lesson{ContainerType: LessonContainerCourse, Name: "Large lesson", Theory: strings.Repeat("First theory. ", 2048)}
+	if err := CreateLesson(&lesson); err != nil {
+		t.Fatalf("Failed to create large lesson: %v", err)
+	}
+
+	/* Every save leaves previous blob unreferenced. */
+	for i := 0; i < 3; i++ {
+		lesson.Theory = strings.Repeat("Updated theory. ", 2048+i)
+		if err := SaveLesson(&lesson); err != nil {
+			t.Fatalf("Failed to save large lesson: %v", err)
+		}
+	}
+
+	reclaimed, err := CompactBlobs()
+	if err != nil {
+		t.Fatalf("Failed to compact blobs: %v", err)
+	}
+	if reclaimed < int64(3*len("First theory. ")*2048) {
+		t.Errorf("Expected at least three old blobs to be reclaimed, got %d bytes", reclaimed)
+	}
+
+	var saved Lesson
+	if err := GetLessonByID(lesson.ID, &saved); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	if saved.Theory != lesson.Theory {
+		t.Errorf("Theory mismatch after compaction")
+	}
+
+	if reclaimed, err := CompactBlobs(); (err != nil) || (reclaimed != 0) {
+		t.Errorf("Expected compacted blobs to stay the same, reclaimed %d bytes, error %v", reclaimed, err)
+	}
+
+	lesson.Theory = strings.Repeat("Theory after compaction. ", 2048)
+	if err := SaveLesson(&lesson); err != nil {
+		t.Fatalf("Failed to save large lesson: %v", err)
+	}
+	if err := GetLessonByID(lesson.ID, &saved); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	if saved.Theory != lesson.Theory {
+		t.Errorf("Theory mismatch after save")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/anton2920/gofa/log"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* RunCommand runs maintenance command instead of a server. */
+func RunCommand(dir string, name string, args []string) error {
+	defer trace.End(trace.Begin(""))
+
+	switch name {
+	default:
+		return fmt.Errorf("unknown command %q, available commands: backup, config, fsck, restore, schema", name)
+	case "backup":
+		return BackupCommand(dir, args)
+	case "config":
+		return ConfigCommand(os.Stdout, &Config)
+	case "fsck":
+		return FsckCommand(dir, args)
+	case "restore":
+		return RestoreCommand(dir, args)
+	case "schema":
+		return SchemaCommand(dir)
+	}
+}
+
+/* BackupCommand writes archive of DBs to a file. It's meant to be used while server is stopped, running server provides '/api/backup' instead. */
+func BackupCommand(dir string, args []string) error {
+	defer trace.End(trace.Begin(""))
+
+	if len(args) != 1 {
+		return fmt.Errorf("usage: backup <archive.tar.gz>")
+	}
+
+	if err := OpenDBs(dir); err != nil {
+		return fmt.Errorf("failed to open DBs: %w", err)
+	}
+	defer CloseDBs()
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := BackupDBs(f); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	log.Infof("Backup is written to %s", args[0])
+	return nil
+}
+
+/* RestoreCommand replaces DBs with ones from archive. Server must be stopped. */
+func RestoreCommand(dir string, args []string) error {
+	defer trace.End(trace.Begin(""))
+
+	if len(args) != 1 {
+		return fmt.Errorf("usage: restore <archive.tar.gz>")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	old, err := RestoreDBs(dir, f)
+	if err != nil {
+		return err
+	}
+
+	if old != "" {
+		log.Infof("Restored DBs from %s, previous DBs are moved to %s", args[0], old)
+	} else {
+		log.Infof("Restored DBs from %s", args[0])
+	}
+	return nil
+}
+
+/* FsckCommand checks consistency of DBs and optionally repairs them. */
+func FsckCommand(dir string, args []string) error {
+	defer trace.End(trace.Begin(""))
+
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "fix problems, which can be fixed automatically")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := OpenDBs(dir); err != nil {
+		return fmt.Errorf("failed to open DBs: %w", err)
+	}
+	defer CloseDBs()
+
+	report, err := FsckDBs(os.Stdout, *repair)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "Found %d problem(s), repaired %d record(s)\n", report.Problems, report.Repaired)
+	if (report.Problems > 0) && (!*repair) {
+		return fmt.Errorf("DBs are inconsistent, run with -repair to fix")
+	}
+	return nil
+}
+
+/* SchemaCommand reports schema versions of DBs without migrating them. */
+func SchemaCommand(dir string) error {
+	defer trace.End(trace.Begin(""))
+
+	var versions SchemaVersions
+
+	exists, err := ReadSchemaVersions(dir, &versions)
+	if err != nil {
+		return fmt.Errorf("failed to read schema versions: %w", err)
+	}
+	if !exists {
+		fmt.Fprintf(os.Stdout, "No schema file in %q, DBs are either missing or predate schema versioning (version 0)\n", dir)
+	}
+
+	fmt.Fprintf(os.Stdout, "Supported schema version: %d\n", SchemaVersion)
+	for i := 0; i < len(SchemaDBs); i++ {
+		status := "up to date"
+		if versions[i] < SchemaVersion {
+			status = "will be migrated on start"
+		} else if versions[i] > SchemaVersion {
+			status = "newer than supported"
+		}
+		fmt.Fprintf(os.Stdout, "%-16s %d (%s)\n", SchemaDBs[i].Name, versions[i], status)
+	}
+
+	return nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anton2920/gofa/trace"
+)
+
+/* ConfigDuration is 'time.Duration', which is written as "1h30m" in config file and flags. */
+type ConfigDuration time.Duration
+
+/* ConfigList is a list of strings, which is written as JSON array in config file and as comma-separated values in flags. */
+type ConfigList []string
+
+/* Configuration contains settings, which may differ between installations. */
+type Configuration struct {
+	/* Address is TCP address server listens on. */
+	Address string
+
+	/* DBDir is a directory with DBs. Commands work with it too. */
+	DBDir string
+
+	SessionsFile  string
+	LanguagesFile string
+	AuditFile     string
+	AccessLogFile string
+
+	/* JailsDir is a root directory of jails, JailTemplate is a jail, which is cloned to verify submissions. */
+	JailsDir     string
+	JailTemplate string
+
+	SessionLifetime ConfigDuration
+
+	/* Timeouts in seconds, see 'CompileTimeout' and 'RunTimeout'. */
+	CompileTimeout int
+	RunTimeout     int
+
+	ProgrammingRunInterval ConfigDuration
+
+	/* TLSAddress enables HTTPS on a given address, requests are then passed to 'Address', which must be a loopback one. Certificate is reloaded on SIGHUP. */
+	TLSAddress  string
+	TLSCertFile string
+	TLSKeyFile  string
+
+	/* RedirectAddress is an address, which redirects plain HTTP requests to HTTPS. */
+	RedirectAddress string
+
+	/* TrustedProxies are IP addresses or networks of reverse proxies, whose 'X-Real-IP' and 'X-Forwarded-For' headers are trusted. */
+	TrustedProxies ConfigList
+
+	ShutdownTimeout ConfigDuration
+}
+
+/* ConfigFile is read on startup if it exists. Other file may be specified with '-config' flag. */
+const ConfigFile = "sems.json"
+
+const JailTemplate = "/usr/local/jails/templates/workster"
+
+var DefaultConfig = Configuration{
+	Address:                "0.0.0.0:7072",
+	DBDir:                  "db",
+	SessionsFile:           SessionsFile,
+	LanguagesFile:          LanguagesFile,
+	AuditFile:              AuditFile,
+	AccessLogFile:          AccessLogFile,
+	JailsDir:               "/usr/local/jails",
+	JailTemplate:           JailTemplate,
+	SessionLifetime:        ConfigDuration(OneWeek),
+	CompileTimeout:         CompileTimeout,
+	RunTimeout:             RunTimeout,
+	ProgrammingRunInterval: ConfigDuration(ProgrammingRunInterval),
+	ShutdownTimeout:        ConfigDuration(ShutdownTimeout),
+}
+
+/* Config is an effective configuration of a server. */
+var Config = DefaultConfig
+
+func (d ConfigDuration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *ConfigDuration) Set(s string) error {
+	x, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = ConfigDuration(x)
+	return nil
+}
+
+func (d ConfigDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *ConfigDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"1h30m\": %w", err)
+	}
+	return d.Set(s)
+}
+
+func (l ConfigList) String() string {
+	return strings.Join(l, ",")
+}
+
+func (l *ConfigList) Set(s string) error {
+	*l = nil
+	if s != "" {
+		*l = strings.Split(s, ",")
+	}
+	return nil
+}
+
+func ConfigFlagSet(config *Configuration, configFile *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("sems", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: sems [flags] [backup|config|fsck|restore|schema] [args]\n")
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(configFile, "config", ConfigFile, "path to config file")
+	fs.StringVar(&config.Address, "address", config.Address, "TCP address to listen on")
+	fs.StringVar(&config.DBDir, "db", config.DBDir, "directory with DBs")
+	fs.StringVar(&config.SessionsFile, "sessions", config.SessionsFile, "file sessions are stored to on exit")
+	fs.StringVar(&config.LanguagesFile, "languages", config.LanguagesFile, "file with programming languages")
+	fs.StringVar(&config.AuditFile, "audit-log", config.AuditFile, "file audit log is appended to")
+	fs.StringVar(&config.AccessLogFile, "access-log", config.AccessLogFile, "file access log is appended to")
+	fs.StringVar(&config.JailsDir, "jails", config.JailsDir, "root directory of jails")
+	fs.StringVar(&config.JailTemplate, "jail-template", config.JailTemplate, "jail used as a template for verification")
+	fs.Var(&config.SessionLifetime, "session-lifetime", "time of inactivity after which user is signed out")
+	fs.IntVar(&config.CompileTimeout, "compile-timeout", config.CompileTimeout, "compilation timeout in seconds")
+	fs.IntVar(&config.RunTimeout, "run-timeout", config.RunTimeout, "run timeout of a solution in seconds")
+	fs.Var(&config.ProgrammingRunInterval, "run-interval", "minimal interval between custom runs of the same user")
+	fs.StringVar(&config.TLSAddress, "tls-address", config.TLSAddress, "TCP address to serve HTTPS on, empty disables TLS")
+	fs.StringVar(&config.TLSCertFile, "tls-cert", config.TLSCertFile, "PEM file with TLS certificate chain")
+	fs.StringVar(&config.TLSKeyFile, "tls-key", config.TLSKeyFile, "PEM file with TLS private key")
+	fs.StringVar(&config.RedirectAddress, "redirect-address", config.RedirectAddress, "TCP address redirecting HTTP to HTTPS, empty disables redirects")
+	fs.Var(&config.TrustedProxies, "trusted-proxies", "comma-separated IP addresses or networks of reverse proxies, which may set client address")
+	fs.Var(&config.ShutdownTimeout, "shutdown-timeout", "time in-flight requests and verification have to finish on shutdown")
+	return fs
+}
+
+/* ParseConfig fills config from config file and command-line flags, which take precedence over it. Returns arguments left after flags. */
+func ParseConfig(config *Configuration, args []string) ([]string, error) {
+	defer trace.End(trace.Begin(""))
+
+	var configFile string
+
+	fs := ConfigFlagSet(config, &configFile)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	var explicit bool
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			explicit = true
+		}
+	})
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		if (!os.IsNotExist(err)) || (explicit) {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+	} else {
+		/* NOTE(anton2920): misspelled option would be silently ignored otherwise. */
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(config); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %q: %w", configFile, err)
+		}
+
+		/* NOTE(anton2920): file has overwritten values set by flags, so they are parsed again. */
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ConfigVerify(config); err != nil {
+		return nil, err
+	}
+	return fs.Args(), nil
+}
+
+func ConfigVerifyAddress(name string, address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", name, address, err)
+	}
+	if (host != "") && (net.ParseIP(host) == nil) {
+		return fmt.Errorf("invalid %s %q: host must be an IP address", name, address)
+	}
+	if p, err := strconv.Atoi(port); (err != nil) || (p <= 0) || (p > 65535) {
+		return fmt.Errorf("invalid %s %q: port must be a number between 1 and 65535", name, address)
+	}
+	return nil
+}
+
+func ConfigVerify(config *Configuration) error {
+	if err := ConfigVerifyAddress("address", config.Address); err != nil {
+		return err
+	}
+
+	paths := [...]struct {
+		Name  string
+		Value string
+	}{
+		{"DB directory", config.DBDir},
+		{"sessions file", config.SessionsFile},
+		{"languages file", config.LanguagesFile},
+		{"audit log file", config.AuditFile},
+		{"access log file", config.AccessLogFile},
+		{"jails directory", config.JailsDir},
+		{"jail template", config.JailTemplate},
+	}
+	for i := 0; i < len(paths); i++ {
+		if paths[i].Value == "" {
+			return fmt.Errorf("%s must not be empty", paths[i].Name)
+		}
+	}
+	if !filepath.IsAbs(config.JailTemplate) {
+		return fmt.Errorf("invalid jail template %q: path must be absolute", config.JailTemplate)
+	}
+
+	if config.SessionLifetime < ConfigDuration(time.Minute) {
+		return fmt.Errorf("invalid session lifetime %v: must be at least 1m", config.SessionLifetime)
+	}
+	if config.CompileTimeout <= 0 {
+		return fmt.Errorf("invalid compile timeout %d: must be positive", config.CompileTimeout)
+	}
+	if config.RunTimeout <= 0 {
+		return fmt.Errorf("invalid run timeout %d: must be positive", config.RunTimeout)
+	}
+	if config.ProgrammingRunInterval < 0 {
+		return fmt.Errorf("invalid run interval %v: must not be negative", config.ProgrammingRunInterval)
+	}
+
+	if config.ShutdownTimeout <= 0 {
+		return fmt.Errorf("invalid shutdown timeout %v: must be positive", config.ShutdownTimeout)
+	}
+
+	if config.TLSAddress != "" {
+		if err := ConfigVerifyAddress("TLS address", config.TLSAddress); err != nil {
+			return err
+		}
+		if (config.TLSCertFile == "") || (config.TLSKeyFile == "") {
+			return fmt.Errorf("TLS certificate and key files must be specified when TLS address is set")
+		}
+
+		/* NOTE(anton2920): otherwise clients could bypass TLS by connecting to plain HTTP listener directly. */
+		if host, _, _ := net.SplitHostPort(config.Address); !net.ParseIP(host).IsLoopback() {
+			return fmt.Errorf("invalid address %q: must be a loopback address when TLS address is set", config.Address)
+		}
+	}
+	for i := 0; i < len(config.TrustedProxies); i++ {
+		proxy := config.TrustedProxies[i]
+		if _, _, err := net.ParseCIDR(proxy); (err != nil) && (net.ParseIP(proxy) == nil) {
+			return fmt.Errorf("invalid trusted proxy %q: must be an IP address or network", proxy)
+		}
+	}
+
+	if config.RedirectAddress != "" {
+		if config.TLSAddress == "" {
+			return fmt.Errorf("redirect address requires TLS address to be set")
+		}
+		if err := ConfigVerifyAddress("redirect address", config.RedirectAddress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* ConfigCommand prints effective configuration in a format of config file. */
+func ConfigCommand(w io.Writer, config *Configuration) error {
+	defer trace.End(trace.Begin(""))
+
+	data, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	_, err = w.Write(data)
+	return err
+}
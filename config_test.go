@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "sems.json")
+	if err := os.WriteFile(filename, []byte(`{"Address": "127.0.0.1:8080", "DBDir": "data", "SessionLifetime": "48h", "RunTimeout": 4}`), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	config := DefaultConfig
+	args, err := ParseConfig(&config, []string{"-config", filename, "-db", "other", "-compile-timeout", "10", "fsck", "-repair"})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	if (len(args) != 2) || (args[0] != "fsck") || (args[1] != "-repair") {
+		t.Errorf("Expected command to be left in arguments, got %v", args)
+	}
+
+	if config.Address != "127.0.0.1:8080" {
+		t.Errorf("Expected address from config file, got %q", config.Address)
+	}
+	if config.DBDir != "other" {
+		t.Errorf("Expected flag to override config file, got %q", config.DBDir)
+	}
+	if (config.SessionLifetime != ConfigDuration(48*time.Hour)) || (config.RunTimeout != 4) || (config.CompileTimeout != 10) {
+		t.Errorf("Unexpected effective config: %+v", config)
+	}
+	if config.SessionsFile != SessionsFile {
+		t.Errorf("Expected default sessions file, got %q", config.SessionsFile)
+	}
+
+	config = DefaultConfig
+	if _, err := ParseConfig(&config, []string{"-config", filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Errorf("Expected error for missing config file given explicitly")
+	}
+
+	filename = filepath.Join(t.TempDir(), "unknown.json")
+	if err := os.WriteFile(filename, []byte(`{"Address": "127.0.0.1:8080", "DBDirectory": "data"}`), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	config = DefaultConfig
+	if _, err := ParseConfig(&config, []string{"-config", filename}); err == nil {
+		t.Errorf("Expected error for unknown option in config file")
+	}
+}
+
+func TestConfigVerify(t *testing.T) {
+	expectedFail := [...]func(*Configuration){
+		func(c *Configuration) { c.Address = "7072" },
+		func(c *Configuration) { c.Address = "localhost:7072" },
+		func(c *Configuration) { c.Address = "0.0.0.0:0" },
+		func(c *Configuration) { c.Address = "0.0.0.0:http" },
+		func(c *Configuration) { c.DBDir = "" },
+		func(c *Configuration) { c.JailTemplate = "templates/workster" },
+		func(c *Configuration) { c.SessionLifetime = ConfigDuration(time.Second) },
+		func(c *Configuration) { c.CompileTimeout = 0 },
+		func(c *Configuration) { c.RunTimeout = -1 },
+		func(c *Configuration) { c.ProgrammingRunInterval = -1 },
+		func(c *Configuration) { c.ShutdownTimeout = 0 },
+		func(c *Configuration) { c.TLSAddress = "0.0.0.0:443" },
+		func(c *Configuration) { c.TLSAddress = "443"; c.TLSCertFile = "cert.pem"; c.TLSKeyFile = "key.pem" },
+		func(c *Configuration) { c.RedirectAddress = "0.0.0.0:80" },
+		func(c *Configuration) {
+			c.TLSAddress = "0.0.0.0:443"
+			c.TLSCertFile = "cert.pem"
+			c.TLSKeyFile = "key.pem"
+		},
+		func(c *Configuration) { c.TrustedProxies = ConfigList{"10.0.0.0/8", "proxy.local"} },
+		func(c *Configuration) {
+			c.Address = "127.0.0.1:7072"
+			c.TLSAddress = "0.0.0.0:443"
+			c.TLSCertFile = "cert.pem"
+			c.TLSKeyFile = "key.pem"
+			c.RedirectAddress = "80"
+		},
+	}
+
+	config := DefaultConfig
+	if err := ConfigVerify(&config); err != nil {
+		t.Errorf("Expected default config to be valid, got %v", err)
+	}
+
+	config.Address = "127.0.0.1:7072"
+	config.TLSAddress = "0.0.0.0:443"
+	config.TLSCertFile = "cert.pem"
+	config.TLSKeyFile = "key.pem"
+	config.RedirectAddress = "0.0.0.0:80"
+	if err := ConfigVerify(&config); err != nil {
+		t.Errorf("Expected config with TLS to be valid, got %v", err)
+	}
+
+	for i, modify := range expectedFail {
+		config := DefaultConfig
+		modify(&config)
+		if err := ConfigVerify(&config); err == nil {
+			t.Errorf("Expected config %d to be invalid", i)
+		}
+	}
+}
+
+func TestConfigCommand(t *testing.T) {
+	var buf bytes.Buffer
+	var config Configuration
+
+	if err := ConfigCommand(&buf, &DefaultConfig); err != nil {
+		t.Fatalf("Failed to print config: %v", err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &config); err != nil {
+		t.Fatalf("Failed to parse printed config: %v", err)
+	}
+	if !reflect.DeepEqual(config, DefaultConfig) {
+		t.Errorf("Expected printed config to be parsed back, got %+v", config)
+	}
+}
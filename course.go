@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"unsafe"
 
 	"github.com/anton2920/gofa/database"
@@ -9,13 +8,20 @@ import (
 	"github.com/anton2920/gofa/net/http"
 	"github.com/anton2920/gofa/net/url"
 	"github.com/anton2920/gofa/strings"
-	"github.com/anton2920/gofa/syscall"
 	"github.com/anton2920/gofa/trace"
 )
 
 type Course struct {
 	LessonContainer
 
+	/* CoAuthors may edit course, Viewers may only read and copy it. */
+	CoAuthors []database.ID
+	Viewers   []database.ID
+
+	/* Published courses are visible to all teachers in a course library, see 'UserIsTeacher'. */
+	Published bool
+
+	Blob Blob
 	Data [1024]byte
 }
 
@@ -25,76 +31,118 @@ const (
 	CourseDraft
 )
 
+type CourseAccess int32
+
+const (
+	CourseAccessNone CourseAccess = iota
+	CourseAccessViewer
+	CourseAccessCoAuthor
+	CourseAccessOwner
+)
+
 const (
 	MinNameLen = 1
 	MaxNameLen = 45
 )
 
-func CreateCourse(course *Course) error {
+func CreateCourseTx(tx *Tx, course *Course) error {
 	defer trace.End(trace.Begin(""))
 
-	var err error
+	course.ID = NewIDTx(tx, CoursesDB)
 
-	course.ID, err = database.IncrementNextID(CoursesDB)
-	if err != nil {
-		return fmt.Errorf("failed to increment course ID: %w", err)
-	}
-
-	return SaveCourse(course)
+	return SaveCourseTx(tx, course)
 }
 
-func DBCourse2Course(course *Course) {
+func CreateCourse(course *Course) error {
 	defer trace.End(trace.Begin(""))
 
-	data := &course.Data[0]
+	var tx Tx
+	if err := CreateCourseTx(&tx, course); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func DBCourse2Course(course *Course, data *byte) {
+	defer trace.End(trace.Begin(""))
 
 	course.Name = database.Offset2String(course.Name, data)
 
 	slice := database.Offset2Slice(*(*[]byte)(unsafe.Pointer(&course.Lessons)), data)
 	course.Lessons = *(*[]database.ID)(unsafe.Pointer(&slice))
+
+	slice = database.Offset2Slice(*(*[]byte)(unsafe.Pointer(&course.CoAuthors)), data)
+	course.CoAuthors = *(*[]database.ID)(unsafe.Pointer(&slice))
+
+	slice = database.Offset2Slice(*(*[]byte)(unsafe.Pointer(&course.Viewers)), data)
+	course.Viewers = *(*[]database.ID)(unsafe.Pointer(&slice))
 }
 
 func GetCourseByID(id database.ID, course *Course) error {
 	defer trace.End(trace.Begin(""))
 
-	if err := database.Read(CoursesDB, id, unsafe.Pointer(course), int(unsafe.Sizeof(*course))); err != nil {
+	if err := DBRead(CoursesDB, id, unsafe.Pointer(course), int(unsafe.Sizeof(*course))); err != nil {
 		return err
 	}
+	if course.ID != id {
+		return database.NotFound
+	}
 
-	DBCourse2Course(course)
+	data, err := GetBlobData(&course.Blob, course.Data[:])
+	if err != nil {
+		return err
+	}
+
+	DBCourse2Course(course, data)
 	return nil
 }
 
 func GetCourses(pos *int64, courses []Course) (int, error) {
 	defer trace.End(trace.Begin(""))
 
-	n, err := database.ReadMany(CoursesDB, pos, *(*[]byte)(unsafe.Pointer(&courses)), int(unsafe.Sizeof(courses[0])))
+	n, err := DBReadManyValid(CoursesDB, pos, courses, func(course *Course) database.ID { return course.ID })
 	if err != nil {
 		return 0, err
 	}
 
 	for i := 0; i < n; i++ {
-		DBCourse2Course(&courses[i])
+		data, err := GetBlobData(&courses[i].Blob, courses[i].Data[:])
+		if err != nil {
+			return 0, err
+		}
+		DBCourse2Course(&courses[i], data)
 	}
 	return n, nil
 }
 
-func DeleteCourseByID(id database.ID) error {
+func DeleteCourseByIDTx(tx *Tx, id database.ID) error {
 	defer trace.End(trace.Begin(""))
 
 	flags := CourseDeleted
 	var course Course
 
 	offset := int64(int(id)*int(unsafe.Sizeof(course))) + database.DataOffset + int64(unsafe.Offsetof(course.Flags))
-	_, err := syscall.Pwrite(CoursesDB.FD, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
-	if err != nil {
-		return fmt.Errorf("failed to delete course from DB: %w", err)
-	}
+	tx.WriteAt(CoursesDB, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
 
+	tx.OnCommit(func() { UnindexCourse(id) })
 	return nil
 }
 
-func SaveCourse(course *Course) error {
+func DeleteCourseByID(id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := DeleteCourseByIDTx(&tx, id); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func CourseDataSize(course *Course) int {
+	return DBStringSize(course.Name) + DBSliceSize(course.Lessons) + DBSliceSize(course.CoAuthors) + DBSliceSize(course.Viewers)
+}
+
+func SaveCourseTx(tx *Tx, course *Course) error {
 	defer trace.End(trace.Begin(""))
 
 	var courseDB Course
@@ -103,12 +151,85 @@ func SaveCourse(course *Course) error {
 	courseDB.ID = course.ID
 	courseDB.Flags = course.Flags
 
-	/* TODO(anton2920): save up to a sizeof(course.Data). */
-	data := unsafe.Slice(&courseDB.Data[0], len(courseDB.Data))
+	data, err := GetDataBuffer(courseDB.Data[:], CourseDataSize(course))
+	if err != nil {
+		return err
+	}
+
 	n += database.String2DBString(&courseDB.Name, course.Name, data, n)
 	n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&courseDB.Lessons)), *(*[]byte)(unsafe.Pointer(&course.Lessons)), int(unsafe.Sizeof(course.Lessons[0])), int(unsafe.Alignof(course.Lessons[0])), data, n)
+	n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&courseDB.CoAuthors)), *(*[]byte)(unsafe.Pointer(&course.CoAuthors)), int(unsafe.Sizeof(course.CoAuthors[0])), int(unsafe.Alignof(course.CoAuthors[0])), data, n)
+	n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&courseDB.Viewers)), *(*[]byte)(unsafe.Pointer(&course.Viewers)), int(unsafe.Sizeof(course.Viewers[0])), int(unsafe.Alignof(course.Viewers[0])), data, n)
+
+	courseDB.Published = course.Published
+
+	if err := SaveBlob(&courseDB.Blob, courseDB.Data[:], data[:n]); err != nil {
+		return err
+	}
+
+	tx.Write(CoursesDB, courseDB.ID, unsafe.Pointer(&courseDB), int(unsafe.Sizeof(courseDB)))
+
+	indexed := *course
+	tx.OnCommit(func() { IndexCourse(&indexed) })
+	return nil
+}
+
+func SaveCourse(course *Course) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := SaveCourseTx(&tx, course); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
 
-	return database.Write(CoursesDB, courseDB.ID, unsafe.Pointer(&courseDB), int(unsafe.Sizeof(courseDB)))
+/* UserCourseAccess returns the highest access level user has to a course. */
+func UserCourseAccess(user *User, course *Course) CourseAccess {
+	defer trace.End(trace.Begin(""))
+
+	if UserOwnsCourse(user, course.ID) {
+		return CourseAccessOwner
+	}
+	for i := 0; i < len(course.CoAuthors); i++ {
+		if course.CoAuthors[i] == user.ID {
+			return CourseAccessCoAuthor
+		}
+	}
+	for i := 0; i < len(course.Viewers); i++ {
+		if course.Viewers[i] == user.ID {
+			return CourseAccessViewer
+		}
+	}
+	if (course.Published) && (course.Flags == CourseActive) && (UserIsTeacher(user.ID)) {
+		return CourseAccessViewer
+	}
+	return CourseAccessNone
+}
+
+/* GetUserCourseIDs returns IDs of courses, which user owns, followed by IDs of courses shared with user. */
+func GetUserCourseIDs(user *User) []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	ids := append([]database.ID(nil), user.Courses...)
+	shared := GetUserSharedCourseIDs(user.ID)
+	for i := 0; i < len(shared); i++ {
+		if !UserOwnsCourse(user, shared[i]) {
+			ids = append(ids, shared[i])
+		}
+	}
+	return ids
+}
+
+func DisplayCourseAccess(w *http.Response, l Language, access CourseAccess) {
+	switch access {
+	case CourseAccessViewer:
+		w.WriteString(Ls(l, "Viewer"))
+	case CourseAccessCoAuthor:
+		w.WriteString(Ls(l, "Co-author"))
+	case CourseAccessOwner:
+		w.WriteString(Ls(l, "Owner"))
+	}
 }
 
 func DisplayCourseTitle(w *http.Response, l Language, course *Course, italics bool) {
@@ -149,7 +270,8 @@ func CoursesPageHandler(w *http.Response, r *http.Request) error {
 	if err := GetUserByID(session.ID, &user); err != nil {
 		return http.ServerError(err)
 	}
-	ncourses := len(user.Courses)
+	ids := GetUserCourseIDs(&user)
+	ncourses := len(ids)
 
 	var page int
 	if r.URL.Query.Has("Page") {
@@ -175,7 +297,7 @@ func CoursesPageHandler(w *http.Response, r *http.Request) error {
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -193,13 +315,13 @@ func CoursesPageHandler(w *http.Response, r *http.Request) error {
 			w.WriteString(`</h2>`)
 			w.WriteString(`<br>`)
 
-			DisplayTableStart(w, GL, []string{"ID", "Name", "Lessons", "Status"})
+			DisplayTableStart(w, GL, []string{"ID", "Name", "Lessons", "Access", "Status"})
 			{
 				var course Course
 
 				start := page * coursesPerPage
-				for i := start; i < min(len(user.Courses), start+coursesPerPage); i++ {
-					id := user.Courses[i]
+				for i := start; i < min(len(ids), start+coursesPerPage); i++ {
+					id := ids[i]
 					if err := GetCourseByID(id, &course); err != nil {
 						return http.ServerError(err)
 					}
@@ -208,6 +330,9 @@ func CoursesPageHandler(w *http.Response, r *http.Request) error {
 
 					DisplayTableItemString(w, strings.Or(course.Name, Ls(GL, "Unnamed")))
 					DisplayTableItemInt(w, len(course.Lessons))
+					DisplayTableItemStart(w)
+					DisplayCourseAccess(w, GL, UserCourseAccess(&user, &course))
+					DisplayTableItemEnd(w)
 					DisplayTableItemFlags(w, GL, course.Flags)
 
 					DisplayTableRowEnd(w)
@@ -221,6 +346,16 @@ func CoursesPageHandler(w *http.Response, r *http.Request) error {
 			w.WriteString(`<form method="POST" action="/course/create">`)
 			DisplaySubmit(w, GL, "", "Create course", true)
 			w.WriteString(`</form>`)
+
+			w.WriteString(`<form method="POST" action="/course/import">`)
+			DisplaySubmit(w, GL, "", "Import course", true)
+			w.WriteString(`</form>`)
+
+			if UserIsTeacher(session.ID) {
+				w.WriteString(`<form method="GET" action="/courses/library">`)
+				DisplaySubmit(w, GL, "", "Library", true)
+				w.WriteString(`</form>`)
+			}
 		}
 		DisplayPageEnd(w)
 		DisplayMainEnd(w)
@@ -251,15 +386,16 @@ func CoursePageHandler(w *http.Response, r *http.Request) error {
 	if err != nil {
 		return err
 	}
-	if !UserOwnsCourse(&user, id) {
-		return ForbiddenError
-	}
 	if err := GetCourseByID(id, &course); err != nil {
 		if err == database.NotFound {
 			return http.NotFound("%s", Ls(GL, "course with this ID does not exist"))
 		}
 		return http.ServerError(err)
 	}
+	access := UserCourseAccess(&user, &course)
+	if access == CourseAccessNone {
+		return ForbiddenError
+	}
 
 	DisplayHTMLStart(w)
 
@@ -273,8 +409,8 @@ func CoursePageHandler(w *http.Response, r *http.Request) error {
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
-		DisplaySidebarWithLessons(w, GL, session, course.Lessons)
+		DisplayHeader(w, GL, session)
+		DisplaySidebarWithLessons(w, GL, session, course.Lessons, nil)
 
 		DisplayMainStart(w)
 
@@ -296,16 +432,49 @@ func CoursePageHandler(w *http.Response, r *http.Request) error {
 			w.WriteString(`</h3>`)
 			DisplayLessons(w, GL, course.Lessons)
 
+			if access == CourseAccessOwner {
+				DisplayCourseSharing(w, GL, &course)
+			}
+
+			DisplayExportForm(w, GL, "/api/course/export", course.ID)
+
 			w.WriteString(`<div>`)
-			w.WriteString(`<form style="display:inline" method="POST" action="/course/edit">`)
-			DisplayHiddenID(w, "ID", course.ID)
-			DisplayButton(w, GL, "", "Edit")
-			w.WriteString(`</form> `)
-
-			w.WriteString(`<form style="display:inline" method="POST" action="/api/course/delete">`)
-			DisplayHiddenID(w, "ID", course.ID)
-			DisplayButton(w, GL, "", "Delete")
-			w.WriteString(`</form>`)
+			if access >= CourseAccessCoAuthor {
+				w.WriteString(`<form style="display:inline" method="POST" action="/course/edit">`)
+				DisplayHiddenID(w, "ID", course.ID)
+				DisplayButton(w, GL, "", "Edit")
+				w.WriteString(`</form> `)
+
+				w.WriteString(`<form style="display:inline" method="POST" action="/course/import">`)
+				DisplayHiddenID(w, "ID", course.ID)
+				DisplayButton(w, GL, "", "Import lessons")
+				w.WriteString(`</form> `)
+			}
+
+			if course.Flags == CourseActive {
+				w.WriteString(`<form style="display:inline" method="POST" action="/api/course/fork">`)
+				DisplayHiddenID(w, "ID", course.ID)
+				DisplayButton(w, GL, "", "Fork")
+				w.WriteString(`</form> `)
+			}
+
+			if access == CourseAccessOwner {
+				if course.Flags == CourseActive {
+					w.WriteString(`<form style="display:inline" method="POST" action="/api/course/publish">`)
+					DisplayHiddenID(w, "ID", course.ID)
+					if course.Published {
+						DisplayButton(w, GL, "Action", "Remove from library")
+					} else {
+						DisplayButton(w, GL, "Action", "Publish to library")
+					}
+					w.WriteString(`</form> `)
+				}
+
+				w.WriteString(`<form style="display:inline" method="POST" action="/api/course/delete">`)
+				DisplayHiddenID(w, "ID", course.ID)
+				DisplayButton(w, GL, "", "Delete")
+				w.WriteString(`</form>`)
+			}
 			w.WriteString(`</div>`)
 		}
 		DisplayPageEnd(w)
@@ -364,7 +533,7 @@ func CourseCreateEditCoursePageHandler(w *http.Response, r *http.Request, sessio
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -460,31 +629,38 @@ func CourseCreateEditPageHandler(w *http.Response, r *http.Request) error {
 	nextPage := r.Form.Get("NextPage")
 
 	if r.Form.Get("ID") == "" {
-		if err := CreateCourse(&course); err != nil {
+		var tx Tx
+		if err := CreateCourseTx(&tx, &course); err != nil {
 			return http.ServerError(err)
 		}
 
 		user.Courses = append(user.Courses, course.ID)
-		if err := SaveUser(&user); err != nil {
+		if err := SaveUserTx(&tx, &user); err != nil {
 			return http.ServerError(err)
 		}
 
+		if err := CommitTx(&tx); err != nil {
+			return http.ServerError(err)
+		}
+
+		Audit(r, session.ID, "create", "course", course.ID, "", "")
 		r.Form.SetInt("ID", int(course.ID))
 	} else {
 		courseID, err := r.Form.GetID("ID")
 		if err != nil {
 			return http.ClientError(err)
 		}
-		if !UserOwnsCourse(&user, courseID) {
-			return ForbiddenError
-		}
 		if err := GetCourseByID(courseID, &course); err != nil {
 			if err == database.NotFound {
 				return http.NotFound("course with this ID does not exist")
 			}
 			return http.ServerError(err)
 		}
+		if UserCourseAccess(&user, &course) < CourseAccessCoAuthor {
+			return ForbiddenError
+		}
 	}
+	before := AuditCourseSummary(&course)
 	course.Flags = CourseDraft
 	defer SaveCourse(&course)
 
@@ -517,7 +693,9 @@ func CourseCreateEditPageHandler(w *http.Response, r *http.Request) error {
 		}
 		defer SaveLesson(&lesson)
 
-		LessonFillFromRequest(r.Form, &lesson)
+		if err := LessonFillFromRequest(r.Form, &lesson); err != nil {
+			return http.ClientError(err)
+		}
 	case "Test":
 		li, err := GetValidIndex(r.Form.Get("LessonIndex"), len(course.Lessons))
 		if err != nil {
@@ -577,9 +755,11 @@ func CourseCreateEditPageHandler(w *http.Response, r *http.Request) error {
 			return LessonAddPageHandler(w, r, session, &course.LessonContainer, &lesson, err)
 		}
 		lesson.Flags = LessonActive
+		lesson.Version++
 		if err := SaveLesson(&lesson); err != nil {
 			return http.ServerError(err)
 		}
+		Audit(r, session.ID, "edit", "lesson", lesson.ID, "", AuditLessonSummary(&lesson))
 
 		return CourseCreateEditCoursePageHandler(w, r, session, &course, nil)
 	case Ls(GL, "Add lesson"):
@@ -628,6 +808,7 @@ func CourseCreateEditPageHandler(w *http.Response, r *http.Request) error {
 			return CourseCreateEditCoursePageHandler(w, r, session, &course, err)
 		}
 		course.Flags = CourseActive
+		Audit(r, session.ID, "edit", "course", course.ID, before, AuditCourseSummary(&course))
 
 		w.Redirect(w.PathID("/course/", course.ID), http.StatusSeeOther)
 		return nil
@@ -637,6 +818,7 @@ func CourseCreateEditPageHandler(w *http.Response, r *http.Request) error {
 func CourseDeleteHandler(w *http.Response, r *http.Request) error {
 	defer trace.End(trace.Begin(""))
 
+	var course Course
 	var user User
 
 	session, err := GetSessionFromRequest(r)
@@ -656,10 +838,16 @@ func CourseDeleteHandler(w *http.Response, r *http.Request) error {
 		return ForbiddenError
 	}
 
+	if err := GetCourseByID(courseID, &course); err != nil {
+		return http.ServerError(err)
+	}
+
 	if err := DeleteCourseByID(courseID); err != nil {
 		return http.ServerError(err)
 	}
 
+	Audit(r, session.ID, "delete", "course", courseID, AuditCourseSummary(&course), "")
+
 	w.Redirect("/courses", http.StatusSeeOther)
 	return nil
 }
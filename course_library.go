@@ -0,0 +1,415 @@
+package main
+
+import (
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/ints"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/strings"
+	"github.com/anton2920/gofa/trace"
+)
+
+func CourseRemoveUser(course *Course, userID database.ID) {
+	for i := 0; i < len(course.CoAuthors); i++ {
+		if course.CoAuthors[i] == userID {
+			course.CoAuthors = RemoveAt(course.CoAuthors, i)
+			break
+		}
+	}
+	for i := 0; i < len(course.Viewers); i++ {
+		if course.Viewers[i] == userID {
+			course.Viewers = RemoveAt(course.Viewers, i)
+			break
+		}
+	}
+}
+
+func DisplayCourseSharedUsers(w *http.Response, l Language, course *Course, users []database.ID, access string) {
+	var user User
+
+	for i := 0; i < len(users); i++ {
+		if err := GetUserByID(users[i], &user); err != nil {
+			/* TODO(anton2920): report error. */
+			continue
+		}
+
+		w.WriteString(`<li>`)
+		w.WriteString(`<form method="POST" action="/api/course/unshare">`)
+		DisplayUserLink(w, l, &user)
+		w.WriteString(` (`)
+		w.WriteString(Ls(l, access))
+		w.WriteString(`) `)
+		DisplayHiddenID(w, "ID", course.ID)
+		DisplayHiddenID(w, "UserID", user.ID)
+		DisplayButton(w, l, "", "Remove")
+		w.WriteString(`</form>`)
+		w.WriteString(`</li>`)
+	}
+}
+
+func DisplayCourseSharing(w *http.Response, l Language, course *Course) {
+	w.WriteString(`<h3>`)
+	w.WriteString(Ls(l, "Sharing"))
+	w.WriteString(`</h3>`)
+
+	if (len(course.CoAuthors) > 0) || (len(course.Viewers) > 0) {
+		w.WriteString(`<ul>`)
+		DisplayCourseSharedUsers(w, l, course, course.CoAuthors, "Co-author")
+		DisplayCourseSharedUsers(w, l, course, course.Viewers, "Viewer")
+		w.WriteString(`</ul>`)
+	}
+
+	w.WriteString(`<form method="POST" action="/api/course/share">`)
+	DisplayHiddenID(w, "ID", course.ID)
+
+	DisplayLabel(w, l, "Email")
+	DisplayInput(w, "email", "Email", "", true)
+
+	w.WriteString(`<select class="form-select mt-2" name="Access">`)
+	w.WriteString(`<option value="`)
+	w.WriteInt(int(CourseAccessViewer))
+	w.WriteString(`">`)
+	w.WriteString(Ls(l, "Viewer"))
+	w.WriteString(`</option>`)
+	w.WriteString(`<option value="`)
+	w.WriteInt(int(CourseAccessCoAuthor))
+	w.WriteString(`">`)
+	w.WriteString(Ls(l, "Co-author"))
+	w.WriteString(`</option>`)
+	w.WriteString(`</select>`)
+
+	w.WriteString(`<br>`)
+	DisplaySubmit(w, l, "", "Share", true)
+	w.WriteString(`</form>`)
+	w.WriteString(`<br>`)
+}
+
+func CoursesLibraryPageHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	const width = WidthLarge
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+	if !UserIsTeacher(session.ID) {
+		return ForbiddenError
+	}
+
+	ids := GetLibraryCourseIDs()
+	ncourses := len(ids)
+
+	var page int
+	if r.URL.Query.Has("Page") {
+		page, err = r.URL.Query.GetInt("Page")
+		if err != nil {
+			return http.ClientError(err)
+		}
+	}
+
+	const coursesPerPage = 10
+	npages := ncourses / coursesPerPage
+	page = ints.Clamp(page, 0, npages)
+
+	DisplayHTMLStart(w)
+
+	DisplayHeadStart(w)
+	{
+		w.WriteString(`<title>`)
+		w.WriteString(Ls(GL, "Library"))
+		w.WriteString(`</title>`)
+	}
+	DisplayHeadEnd(w)
+
+	DisplayBodyStart(w)
+	{
+		DisplayHeader(w, GL, session)
+		DisplaySidebar(w, GL, session)
+
+		DisplayMainStart(w)
+
+		DisplayCrumbsStart(w, width)
+		{
+			DisplayCrumbsLink(w, GL, "/courses", "Courses")
+			DisplayCrumbsItem(w, GL, "Library")
+		}
+		DisplayCrumbsEnd(w)
+
+		DisplayPageStart(w, width)
+		{
+			w.WriteString(`<h2 class="text-center">`)
+			w.WriteString(Ls(GL, "Library"))
+			w.WriteString(`</h2>`)
+			w.WriteString(`<br>`)
+
+			DisplayTableStart(w, GL, []string{"ID", "Name", "Author", "Lessons"})
+			{
+				var course Course
+				var author User
+
+				start := page * coursesPerPage
+				for i := start; i < min(len(ids), start+coursesPerPage); i++ {
+					if err := GetCourseByID(ids[i], &course); err != nil {
+						return http.ServerError(err)
+					}
+
+					DisplayTableRowLinkIDStart(w, "/course", course.ID)
+
+					DisplayTableItemString(w, strings.Or(course.Name, Ls(GL, "Unnamed")))
+					DisplayTableItemStart(w)
+					if authorID, ok := GetCourseOwnerID(course.ID); ok {
+						if err := GetUserByID(authorID, &author); err != nil {
+							return http.ServerError(err)
+						}
+						DisplayUserLink(w, GL, &author)
+					}
+					DisplayTableItemEnd(w)
+					DisplayTableItemInt(w, len(course.Lessons))
+
+					DisplayTableRowEnd(w)
+				}
+			}
+			DisplayTableEnd(w)
+
+			DisplayPageSelector(w, "/courses/library", page, npages)
+		}
+		DisplayPageEnd(w)
+		DisplayMainEnd(w)
+	}
+	DisplayBodyEnd(w)
+
+	DisplayHTMLEnd(w)
+	return nil
+}
+
+func CourseShareHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var course Course
+	var owner, user User
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	courseID, err := r.Form.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	access, err := r.Form.GetInt("Access")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if (CourseAccess(access) != CourseAccessViewer) && (CourseAccess(access) != CourseAccessCoAuthor) {
+		return http.ClientError(nil)
+	}
+
+	if err := GetUserByID(session.ID, &owner); err != nil {
+		return http.ServerError(err)
+	}
+	if err := GetCourseByID(courseID, &course); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "course with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if UserCourseAccess(&owner, &course) != CourseAccessOwner {
+		return ForbiddenError
+	}
+
+	if err := GetUserByEmail(r.Form.Get("Email"), &user); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "user with this email does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if UserOwnsCourse(&user, course.ID) {
+		return http.BadRequest("%s", Ls(GL, "user already owns this course"))
+	}
+
+	before := AuditCourseUsersSummary(&course)
+	CourseRemoveUser(&course, user.ID)
+	switch CourseAccess(access) {
+	case CourseAccessViewer:
+		course.Viewers = append(course.Viewers, user.ID)
+	case CourseAccessCoAuthor:
+		course.CoAuthors = append(course.CoAuthors, user.ID)
+	}
+
+	if err := SaveCourse(&course); err != nil {
+		return http.ServerError(err)
+	}
+
+	Audit(r, session.ID, "share", "course", course.ID, before, AuditCourseUsersSummary(&course))
+
+	w.Redirect(w.PathID("/course/", course.ID), http.StatusSeeOther)
+	return nil
+}
+
+func CourseUnshareHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var course Course
+	var user User
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	courseID, err := r.Form.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	userID, err := r.Form.GetID("UserID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+
+	if err := GetUserByID(session.ID, &user); err != nil {
+		return http.ServerError(err)
+	}
+	if err := GetCourseByID(courseID, &course); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "course with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+
+	/* NOTE(anton2920): users may leave courses shared with them. */
+	if (UserCourseAccess(&user, &course) != CourseAccessOwner) && (session.ID != userID) {
+		return ForbiddenError
+	}
+
+	before := AuditCourseUsersSummary(&course)
+	CourseRemoveUser(&course, userID)
+	if err := SaveCourse(&course); err != nil {
+		return http.ServerError(err)
+	}
+
+	Audit(r, session.ID, "unshare", "course", course.ID, before, AuditCourseUsersSummary(&course))
+
+	if session.ID == userID {
+		w.Redirect("/courses", http.StatusSeeOther)
+	} else {
+		w.Redirect(w.PathID("/course/", course.ID), http.StatusSeeOther)
+	}
+	return nil
+}
+
+func CoursePublishHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var course Course
+	var user User
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	courseID, err := r.Form.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+
+	if err := GetUserByID(session.ID, &user); err != nil {
+		return http.ServerError(err)
+	}
+	if err := GetCourseByID(courseID, &course); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "course with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if UserCourseAccess(&user, &course) != CourseAccessOwner {
+		return ForbiddenError
+	}
+
+	switch r.Form.Get("Action") {
+	default:
+		return http.ClientError(nil)
+	case Ls(GL, "Publish to library"):
+		if course.Flags != CourseActive {
+			return http.BadRequest("%s", Ls(GL, "only active courses can be published"))
+		}
+		course.Published = true
+	case Ls(GL, "Remove from library"):
+		course.Published = false
+	}
+
+	if err := SaveCourse(&course); err != nil {
+		return http.ServerError(err)
+	}
+
+	if course.Published {
+		Audit(r, session.ID, "publish", "course", course.ID, "", AuditCourseSummary(&course))
+	} else {
+		Audit(r, session.ID, "unpublish", "course", course.ID, AuditCourseSummary(&course), "")
+	}
+
+	w.Redirect(w.PathID("/course/", course.ID), http.StatusSeeOther)
+	return nil
+}
+
+func CourseForkHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var source, course Course
+	var user User
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	courseID, err := r.Form.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+
+	if err := GetUserByID(session.ID, &user); err != nil {
+		return http.ServerError(err)
+	}
+	if err := GetCourseByID(courseID, &source); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "course with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if UserCourseAccess(&user, &source) == CourseAccessNone {
+		return ForbiddenError
+	}
+	if source.Flags != CourseActive {
+		return http.BadRequest("%s", Ls(GL, "only active courses can be forked"))
+	}
+
+	var tx Tx
+	if err := CreateCourseTx(&tx, &course); err != nil {
+		return http.ServerError(err)
+	}
+
+	course.Flags = CourseActive
+	course.Name = source.Name
+	if err := LessonsDeepCopyTx(&tx, &course.Lessons, source.Lessons, course.ID, LessonContainerCourse); err != nil {
+		return http.ServerError(err)
+	}
+	if err := SaveCourseTx(&tx, &course); err != nil {
+		return http.ServerError(err)
+	}
+
+	user.Courses = append(user.Courses, course.ID)
+	if err := SaveUserTx(&tx, &user); err != nil {
+		return http.ServerError(err)
+	}
+
+	if err := CommitTx(&tx); err != nil {
+		return http.ServerError(err)
+	}
+
+	Audit(r, session.ID, "fork", "course", course.ID, AuditCourseSummary(&source), AuditCourseSummary(&course))
+
+	w.Redirect(w.PathID("/course/", course.ID), http.StatusSeeOther)
+	return nil
+}
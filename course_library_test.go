@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+)
+
+func TestCourseShareHandler(t *testing.T) {
+	const endpoint = APIPrefix + "/course/share"
+
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	viewer := strconv.Itoa(int(CourseAccessViewer))
+	coauthor := strconv.Itoa(int(CourseAccessCoAuthor))
+	saveCourse := url.Values{"ID": {"0"}, "CurrentPage": {"Course"}, "Name": {"Programming basics"}, "NextPage": {Ls(GL, "Save")}}
+
+	testGetAuth(t, "/course/0", testTokens[1], http.StatusForbidden)
+
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"0"}, "Email": {"teacher@masters.com"}, "Access": {viewer}}, http.StatusSeeOther)
+	testGetAuth(t, "/course/0", testTokens[1], http.StatusOK)
+	testGetAuth(t, "/lesson/0", testTokens[1], http.StatusOK)
+	testPostAuth(t, "/course/edit", testTokens[1], saveCourse, http.StatusForbidden)
+
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"0"}, "Email": {"teacher@masters.com"}, "Access": {coauthor}}, http.StatusSeeOther)
+	testPostAuth(t, "/course/edit", testTokens[1], saveCourse, http.StatusSeeOther)
+	testPostAuth(t, APIPrefix+"/course/delete", testTokens[1], url.Values{"ID": {"0"}}, http.StatusForbidden)
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"ID": {"0"}, "Email": {"student@masters.com"}, "Access": {viewer}}, http.StatusForbidden)
+
+	var course Course
+	if err := GetCourseByID(0, &course); err != nil {
+		t.Fatalf("Failed to get course: %v", err)
+	}
+	if (len(course.CoAuthors) != 1) || (course.CoAuthors[0] != 1) || (len(course.Viewers) != 0) {
+		t.Errorf("Expected teacher to be the only co-author, got %v and %v", course.CoAuthors, course.Viewers)
+	}
+	if ids := GetUserSharedCourseIDs(1); !reflect.DeepEqual(ids, []database.ID{0}) {
+		t.Errorf("Expected shared courses [0], got %v", ids)
+	}
+
+	expectedBadRequest := [...]url.Values{
+		{"ID": {"a"}, "Email": {"teacher@masters.com"}, "Access": {viewer}},
+		{"ID": {"0"}, "Email": {"teacher@masters.com"}, "Access": {"a"}},
+		{"ID": {"0"}, "Email": {"teacher@masters.com"}, "Access": {strconv.Itoa(int(CourseAccessOwner))}},
+		{"ID": {"0"}, "Email": {"admin@masters.com"}, "Access": {viewer}},
+	}
+	for _, test := range expectedBadRequest {
+		testPostAuth(t, endpoint, testTokens[AdminID], test, http.StatusBadRequest)
+	}
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"0"}, "Email": {"nobody@masters.com"}, "Access": {viewer}}, http.StatusNotFound)
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"5"}, "Email": {"teacher@masters.com"}, "Access": {viewer}}, http.StatusNotFound)
+	testPost(t, endpoint, url.Values{"ID": {"0"}}, http.StatusUnauthorized)
+
+	testPostAuth(t, APIPrefix+"/course/unshare", testTokens[2], url.Values{"ID": {"0"}, "UserID": {"1"}}, http.StatusForbidden)
+	testPostAuth(t, APIPrefix+"/course/unshare", testTokens[1], url.Values{"ID": {"0"}, "UserID": {"1"}}, http.StatusSeeOther)
+	testGetAuth(t, "/course/0", testTokens[1], http.StatusForbidden)
+	if ids := GetUserSharedCourseIDs(1); len(ids) != 0 {
+		t.Errorf("Expected no shared courses, got %v", ids)
+	}
+}
+
+func TestCourseLibrary(t *testing.T) {
+	const endpoint = APIPrefix + "/course/publish"
+
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"ID": {"0"}, "Action": {Ls(GL, "Publish to library")}}, http.StatusForbidden)
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"0"}, "Action": {"a"}}, http.StatusBadRequest)
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"0"}, "Action": {Ls(GL, "Publish to library")}}, http.StatusSeeOther)
+
+	if ids := GetLibraryCourseIDs(); !reflect.DeepEqual(ids, []database.ID{0}) {
+		t.Errorf("Expected library courses [0], got %v", ids)
+	}
+	testGetAuth(t, "/courses/library", testTokens[1], http.StatusOK)
+	testGet(t, "/courses/library", http.StatusUnauthorized)
+	testGetAuth(t, "/course/0", testTokens[1], http.StatusOK)
+
+	/* Students can't see library, because courses contain correct answers and hidden checks. */
+	testGetAuth(t, "/courses/library", testTokens[2], http.StatusForbidden)
+	testGetAuth(t, "/course/0", testTokens[2], http.StatusForbidden)
+	testPostAuth(t, APIPrefix+"/course/fork", testTokens[2], url.Values{"ID": {"0"}}, http.StatusForbidden)
+	testPostAuth(t, APIPrefix+"/course/export", testTokens[2], url.Values{"ID": {"0"}, "Format": {FormatJSON}}, http.StatusForbidden)
+	testPostAuth(t, "/course/edit", testTokens[1], url.Values{"ID": {"0"}}, http.StatusForbidden)
+
+	/* Teacher forks published course into their own list. */
+	testPostAuth(t, APIPrefix+"/course/fork", testTokens[1], url.Values{"ID": {"0"}}, http.StatusSeeOther)
+
+	var user User
+	if err := GetUserByID(1, &user); err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if len(user.Courses) != 2 {
+		t.Fatalf("Expected forked course to be added to user's courses, got %v", user.Courses)
+	}
+
+	var course Course
+	if err := GetCourseByID(user.Courses[1], &course); err != nil {
+		t.Fatalf("Failed to get course: %v", err)
+	}
+	if (course.Name != "Programming basics") || (course.Flags != CourseActive) || (course.Published) || (len(course.Lessons) != 1) {
+		t.Errorf("Unexpected forked course %q with %d lessons", course.Name, len(course.Lessons))
+	}
+
+	var lesson Lesson
+	if err := GetLessonByID(course.Lessons[0], &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	if (lesson.ContainerID != course.ID) || (lesson.ContainerType != LessonContainerCourse) || (lesson.Version != 1) || (lesson.SourceVersion != 0) {
+		t.Errorf("Unexpected forked lesson: container %d, version %d, source version %d", lesson.ContainerID, lesson.Version, lesson.SourceVersion)
+	}
+
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"0"}, "Action": {Ls(GL, "Remove from library")}}, http.StatusSeeOther)
+	if ids := GetLibraryCourseIDs(); len(ids) != 0 {
+		t.Errorf("Expected empty library, got %v", ids)
+	}
+	testGetAuth(t, "/course/0", testTokens[1], http.StatusForbidden)
+	testPostAuth(t, APIPrefix+"/course/fork", testTokens[1], url.Values{"ID": {"0"}}, http.StatusForbidden)
+}
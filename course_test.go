@@ -5,7 +5,6 @@ import (
 	"strconv"
 	"testing"
 
-	"github.com/anton2920/gofa/database"
 	"github.com/anton2920/gofa/net/http"
 )
 
@@ -190,7 +189,7 @@ func testCourseCreateEditPageHandler(t *testing.T, endpoint string) {
 		{"ID": {"4"}},
 	}
 
-	if err := database.Drop(CoursesDB); err != nil {
+	if err := DropDB(CoursesDB); err != nil {
 		t.Fatalf("Failed to drop courses data: %v", err)
 	}
 	for i, token := range testTokens {
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* DashboardItem is a lesson or submission, which requires student's attention. */
+type DashboardItem struct {
+	ID          database.ID
+	SubjectName string
+	LessonName  string
+	Status      SubmissionCheckStatus
+}
+
+/* GetSubjectCompletion returns percentage of lessons with steps, which have checked submissions. */
+func GetSubjectCompletion(lessons []database.ID, states []LessonState) (int, error) {
+	defer trace.End(trace.Begin(""))
+
+	var lesson Lesson
+	var completed, total int
+
+	for i := 0; i < len(lessons); i++ {
+		if err := GetLessonByID(lessons[i], &lesson); err != nil {
+			return 0, err
+		}
+		if len(lesson.Steps) == 0 {
+			continue
+		}
+		if states[i] == LessonStateCompleted {
+			completed++
+		}
+		total++
+	}
+
+	if total == 0 {
+		return 100, nil
+	}
+	return completed * 100 / total, nil
+}
+
+func DisplayLessonState(w *http.Response, l Language, state LessonState, draft bool) {
+	switch {
+	case state == LessonStateLocked:
+		w.WriteString(Ls(l, "Locked"))
+	case state == LessonStateCompleted:
+		w.WriteString(Ls(l, "Completed"))
+	case draft:
+		w.WriteString(Ls(l, "In progress"))
+	default:
+		w.WriteString(Ls(l, "Not started"))
+	}
+}
+
+func DisplaySubmissionStatus(w *http.Response, l Language, status SubmissionCheckStatus) {
+	switch status {
+	case SubmissionCheckPending:
+		w.WriteString(Ls(l, "pending"))
+		w.WriteString(` `)
+		w.WriteString(Ls(l, "verification"))
+	case SubmissionCheckInProgress:
+		w.WriteString(Ls(l, "verification"))
+		w.WriteString(` `)
+		w.WriteString(Ls(l, "in progress"))
+	}
+}
+
+/* DisplayDashboardSubject displays progress of a student in subject and appends unfinished drafts and submissions pending verification. */
+func DisplayDashboardSubject(w *http.Response, l Language, userID database.ID, subject *Subject, drafts []DashboardItem, pending []DashboardItem) ([]DashboardItem, []DashboardItem, error) {
+	defer trace.End(trace.Begin(""))
+
+	var submission Submission
+	var lesson Lesson
+
+	states, err := GetUserLessonStates(userID, subject.Lessons)
+	if err != nil {
+		return nil, nil, err
+	}
+	completion, err := GetSubjectCompletion(subject.Lessons, states)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w.WriteString(`<h3>`)
+	w.WriteString(`<a href="/subject/`)
+	w.WriteInt(int(subject.ID))
+	w.WriteString(`">`)
+	w.WriteHTMLString(subject.Name)
+	w.WriteString(`</a>`)
+	w.WriteString(`</h3>`)
+
+	w.WriteString(`<p>`)
+	w.WriteString(Ls(l, "Completed"))
+	w.WriteString(`: `)
+	w.WriteInt(completion)
+	w.WriteString(`%</p>`)
+
+	if len(subject.Lessons) == 0 {
+		w.WriteString(`<br>`)
+		return drafts, pending, nil
+	}
+
+	DisplayTableStart(w, l, []string{"ID", "Lesson", "Status", "Best score"})
+	for i := 0; i < len(subject.Lessons); i++ {
+		if err := GetLessonByID(subject.Lessons[i], &lesson); err != nil {
+			return nil, nil, err
+		}
+
+		var draft bool
+		submissionIDs := GetUserLessonSubmissionIDs(userID, lesson.ID)
+		for j := 0; j < len(submissionIDs); j++ {
+			if err := GetSubmissionByID(submissionIDs[j], &submission); err != nil {
+				return nil, nil, err
+			}
+
+			switch submission.Flags {
+			case SubmissionDraft:
+				drafts = append(drafts, DashboardItem{ID: lesson.ID, SubjectName: subject.Name, LessonName: lesson.Name})
+				draft = true
+			case SubmissionActive:
+				if submission.Status != SubmissionCheckDone {
+					pending = append(pending, DashboardItem{ID: submission.ID, SubjectName: subject.Name, LessonName: lesson.Name, Status: submission.Status})
+				}
+			}
+		}
+
+		DisplayTableRowLinkIDStart(w, "/lesson", lesson.ID)
+
+		DisplayTableItemString(w, lesson.Name)
+
+		DisplayTableItemStart(w)
+		if len(lesson.Steps) > 0 {
+			DisplayLessonState(w, l, states[i], draft)
+		} else if states[i] == LessonStateLocked {
+			DisplayLessonState(w, l, states[i], false)
+		} else {
+			w.WriteString(`-`)
+		}
+		DisplayTableItemEnd(w)
+
+		DisplayTableItemStart(w)
+		score, checked, err := GetUserLessonBestScore(userID, lesson.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if checked {
+			w.WriteInt(score)
+			w.WriteString(`%`)
+		} else {
+			w.WriteString(`-`)
+		}
+		DisplayTableItemEnd(w)
+
+		DisplayTableRowEnd(w)
+	}
+	DisplayTableEnd(w)
+	w.WriteString(`<br>`)
+
+	return drafts, pending, nil
+}
+
+func DashboardPageHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	const width = WidthLarge
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	DisplayHTMLStart(w)
+
+	DisplayHeadStart(w)
+	{
+		w.WriteString(`<title>`)
+		w.WriteString(Ls(GL, "Dashboard"))
+		w.WriteString(`</title>`)
+	}
+	DisplayHeadEnd(w)
+
+	DisplayBodyStart(w)
+	{
+		DisplayHeader(w, GL, session)
+		DisplaySidebar(w, GL, session)
+
+		DisplayMainStart(w)
+
+		DisplayCrumbsStart(w, width)
+		{
+			DisplayCrumbsItem(w, GL, "Dashboard")
+		}
+		DisplayCrumbsEnd(w)
+
+		DisplayPageStart(w, width)
+		{
+			w.WriteString(`<h2 class="text-center">`)
+			w.WriteString(Ls(GL, "Dashboard"))
+			w.WriteString(`</h2>`)
+			w.WriteString(`<br>`)
+
+			var drafts, pending []DashboardItem
+			var displayed bool
+
+			subjectIDs := GetStudentSubjectIDs(session.ID)
+			for i := 0; i < len(subjectIDs); i++ {
+				var subject Subject
+				if err := GetSubjectByID(subjectIDs[i], &subject); err != nil {
+					return http.ServerError(err)
+				}
+				who, err := WhoIsUserInSubject(session.ID, &subject)
+				if err != nil {
+					return http.ServerError(err)
+				}
+				if who != SubjectUserStudent {
+					continue
+				}
+
+				drafts, pending, err = DisplayDashboardSubject(w, GL, session.ID, &subject, drafts, pending)
+				if err != nil {
+					return http.ServerError(err)
+				}
+				displayed = true
+			}
+			if !displayed {
+				w.WriteString(`<h4>`)
+				w.WriteString(Ls(GL, "You are not studying any subjects"))
+				w.WriteString(`</h4>`)
+				w.WriteString(`<br>`)
+			}
+
+			w.WriteString(`<h2 class="text-center">`)
+			w.WriteString(Ls(GL, "Unfinished submissions"))
+			w.WriteString(`</h2>`)
+			w.WriteString(`<br>`)
+
+			if len(drafts) > 0 {
+				DisplayTableStart(w, GL, []string{"ID", "Subject", "Lesson"})
+				for i := 0; i < len(drafts); i++ {
+					DisplayTableRowLinkIDStart(w, "/lesson", drafts[i].ID)
+					DisplayTableItemString(w, drafts[i].SubjectName)
+					DisplayTableItemString(w, drafts[i].LessonName)
+					DisplayTableRowEnd(w)
+				}
+				DisplayTableEnd(w)
+			} else {
+				w.WriteString(`<h4>`)
+				w.WriteString(Ls(GL, "You don't have any unfinished submissions"))
+				w.WriteString(`</h4>`)
+			}
+			w.WriteString(`<br>`)
+
+			w.WriteString(`<h2 class="text-center">`)
+			w.WriteString(Ls(GL, "Pending verification"))
+			w.WriteString(`</h2>`)
+			w.WriteString(`<br>`)
+
+			if len(pending) > 0 {
+				DisplayTableStart(w, GL, []string{"ID", "Subject", "Lesson", "Status"})
+				for i := 0; i < len(pending); i++ {
+					DisplayTableRowLinkIDStart(w, "/submission", pending[i].ID)
+					DisplayTableItemString(w, pending[i].SubjectName)
+					DisplayTableItemString(w, pending[i].LessonName)
+					DisplayTableItemStart(w)
+					DisplaySubmissionStatus(w, GL, pending[i].Status)
+					DisplayTableItemEnd(w)
+					DisplayTableRowEnd(w)
+				}
+				DisplayTableEnd(w)
+			} else {
+				w.WriteString(`<h4>`)
+				w.WriteString(Ls(GL, "You don't have any submissions pending verification"))
+				w.WriteString(`</h4>`)
+			}
+		}
+		DisplayPageEnd(w)
+		DisplayMainEnd(w)
+	}
+	DisplayBodyEnd(w)
+
+	DisplayHTMLEnd(w)
+	return nil
+}
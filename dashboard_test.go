@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/anton2920/gofa/net/http"
+)
+
+func TestDashboardPageHandler(t *testing.T) {
+	for i := 0; i < len(testTokens); i++ {
+		testGetAuth(t, "/dashboard", testTokens[i], http.StatusOK)
+	}
+	testGet(t, "/dashboard", http.StatusUnauthorized)
+}
+
+func TestDisplayDashboardSubject(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	var subject Subject
+	if err := GetSubjectByID(1, &subject); err != nil {
+		t.Fatalf("Failed to get subject: %v", err)
+	}
+
+	/* Student 2 has checked submission, student 3 has nothing. */
+	completion, err := GetSubjectCompletion(subject.Lessons, []LessonState{LessonStateCompleted})
+	if err != nil {
+		t.Fatalf("Failed to get completion: %v", err)
+	}
+	if completion != 100 {
+		t.Errorf("Expected completion 100%%, got %d%%", completion)
+	}
+
+	var w http.Response
+	drafts, pending, err := DisplayDashboardSubject(&w, GL, 2, &subject, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to display subject: %v", err)
+	}
+	if (len(drafts) != 0) || (len(pending) != 0) {
+		t.Errorf("Expected no drafts and pending submissions, got %d and %d", len(drafts), len(pending))
+	}
+
+	submission := Submission{Flags: SubmissionDraft, UserID: 3, LessonID: subject.Lessons[0], SubmittedSteps: make([]SubmittedStep, 0)}
+	if err := CreateSubmission(&submission); err != nil {
+		t.Fatalf("Failed to create submission: %v", err)
+	}
+	drafts, pending, err = DisplayDashboardSubject(&w, GL, 3, &subject, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to display subject: %v", err)
+	}
+	if (len(drafts) != 1) || (drafts[0].ID != subject.Lessons[0]) || (len(pending) != 0) {
+		t.Errorf("Expected one draft of lesson %d, got %v and %v", subject.Lessons[0], drafts, pending)
+	}
+
+	submission.Flags = SubmissionActive
+	submission.Status = SubmissionCheckPending
+	if err := SaveSubmission(&submission); err != nil {
+		t.Fatalf("Failed to save submission: %v", err)
+	}
+	drafts, pending, err = DisplayDashboardSubject(&w, GL, 3, &subject, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to display subject: %v", err)
+	}
+	if (len(drafts) != 0) || (len(pending) != 1) || (pending[0].ID != submission.ID) {
+		t.Errorf("Expected one pending submission %d, got %v and %v", submission.ID, drafts, pending)
+	}
+	testGetAuth(t, "/dashboard", testTokens[3], http.StatusOK)
+}
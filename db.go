@@ -3,6 +3,8 @@ package main
 import (
 	"errors"
 	"fmt"
+	"sync"
+	sys "syscall"
 	"unsafe"
 
 	"github.com/anton2920/gofa/database"
@@ -19,6 +21,25 @@ var (
 	LessonsDB     *database.DB
 	SubjectsDB    *database.DB
 	SubmissionsDB *database.DB
+	QuestionsDB   *database.DB
+
+	AnnouncementsDB *database.DB
+	NotificationsDB *database.DB
+	MessagesDB      *database.DB
+
+	TaskFilesDB *database.DB
+)
+
+var DBDirectory string
+
+/*
+ * NextIDs[i] is ID of the next record created in 'TxDBs[i]'. New record is written by the same transaction, which creates it, so DB file grows
+ * atomically with it. Next ID in 'database' header is written outside of WAL, so it's advanced only after transaction is committed and is recovered
+ * from size of DB file on open. IDs of transactions, which failed or were abandoned, leave gaps, which read back as zeroes and are skipped.
+ */
+var (
+	NextIDs     [len(TxDBs)]database.ID
+	NextIDsLock sync.Mutex
 )
 
 const AdminID database.ID = 0
@@ -58,6 +79,119 @@ func OpenDB(dir string, name string) (*database.DB, error) {
 	return database.Open(unsafe.String(unsafe.SliceData(buf), n))
 }
 
+/* LoadNextID initializes next ID of 'db' from its header and size of its file, whichever is greater, and advances header to it. */
+func LoadNextID(db *database.DB) error {
+	defer trace.End(trace.Begin(""))
+
+	i := GetTxDBIndex(db)
+	size := int64(RecordLayouts[i].Size)
+
+	next, err := database.GetNextID(db)
+	if err != nil {
+		return err
+	}
+
+	var st sys.Stat_t
+	if err := sys.Fstat(int(db.FD), &st); err != nil {
+		return err
+	}
+	if n := database.ID((st.Size - database.GetOffsetForID(0, int(size)) + size - 1) / size); n > next {
+		next = n
+	}
+
+	if err := AdvanceHeaderNextID(db, next); err != nil {
+		return err
+	}
+
+	NextIDsLock.Lock()
+	NextIDs[i] = next
+	NextIDsLock.Unlock()
+
+	return nil
+}
+
+/* AdvanceHeaderNextID increments next ID in 'database' header until it reaches 'next'. */
+func AdvanceHeaderNextID(db *database.DB, next database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	for {
+		id, err := database.GetNextID(db)
+		if err != nil {
+			return err
+		}
+		if id >= next {
+			return nil
+		}
+		if _, err := database.IncrementNextID(db); err != nil {
+			return err
+		}
+	}
+}
+
+/* GetNextID returns number of records in 'db', including gaps. */
+func GetNextID(db *database.DB) database.ID {
+	NextIDsLock.Lock()
+	defer NextIDsLock.Unlock()
+
+	return NextIDs[GetTxDBIndex(db)]
+}
+
+/* NewIDTx returns ID for a new record of 'db', which must be written by 'tx'. */
+func NewIDTx(tx *Tx, db *database.DB) database.ID {
+	defer trace.End(trace.Begin(""))
+
+	i := GetTxDBIndex(db)
+
+	NextIDsLock.Lock()
+	id := NextIDs[i]
+	NextIDs[i]++
+	NextIDsLock.Unlock()
+
+	tx.OnCommit(func() {
+		if err := AdvanceHeaderNextID(db, id+1); err != nil {
+			log.Warnf("Failed to advance next ID of %s: %v", SchemaDBs[i].Name, err)
+		}
+	})
+	return id
+}
+
+/* DropDB removes all records of 'db'. */
+func DropDB(db *database.DB) error {
+	defer trace.End(trace.Begin(""))
+
+	if err := database.Drop(db); err != nil {
+		return err
+	}
+	return LoadNextID(db)
+}
+
+/* DBReadManyValid is 'DBReadMany', which skips gaps left by IDs of failed transactions. Slot of a gap reads back as zeroes, so its ID does not match it. */
+func DBReadManyValid[T any](db *database.DB, pos *int64, records []T, getID func(*T) database.ID) (int, error) {
+	size := int(unsafe.Sizeof(records[0]))
+
+	for {
+		first := database.ID((*pos - database.GetOffsetForID(0, size)) / int64(size))
+
+		n, err := DBReadMany(db, pos, *(*[]byte)(unsafe.Pointer(&records)), size)
+		if (err != nil) || (n == 0) {
+			return n, err
+		}
+
+		var valid int
+		for i := 0; i < n; i++ {
+			if getID(&records[i]) == first+database.ID(i) {
+				if valid != i {
+					records[valid] = records[i]
+				}
+				valid++
+			}
+		}
+		if valid > 0 {
+			return valid, nil
+		}
+	}
+}
+
 func OpenDBs(dir string) error {
 	defer trace.End(trace.Begin(""))
 
@@ -73,6 +207,19 @@ func OpenDBs(dir string) error {
 		shouldCreate = true
 	}
 
+	/* NOTE(anton2920): transaction left by a crash must be applied to DBs in the layout it was logged for. */
+	replayed, err := ReplayWALFile(dir, WALName)
+	if err != nil {
+		return fmt.Errorf("failed to replay WAL: %w", err)
+	}
+	if replayed {
+		log.Infof("Replayed unfinished transaction from WAL")
+	}
+
+	if err := MigrateDBs(dir, shouldCreate); err != nil {
+		return fmt.Errorf("failed to migrate DBs: %w", err)
+	}
+
 	UsersDB, err = OpenDB(dir, "Users.db")
 	if err != nil {
 		return fmt.Errorf("failed to open users DB file: %w", err)
@@ -103,6 +250,53 @@ func OpenDBs(dir string) error {
 		return fmt.Errorf("failed to open subjects DB file: %w", err)
 	}
 
+	QuestionsDB, err = OpenDB(dir, "Questions.db")
+	if err != nil {
+		return fmt.Errorf("failed to open questions DB file: %w", err)
+	}
+
+	AnnouncementsDB, err = OpenDB(dir, "Announcements.db")
+	if err != nil {
+		return fmt.Errorf("failed to open announcements DB file: %w", err)
+	}
+
+	NotificationsDB, err = OpenDB(dir, "Notifications.db")
+	if err != nil {
+		return fmt.Errorf("failed to open notifications DB file: %w", err)
+	}
+
+	MessagesDB, err = OpenDB(dir, "Messages.db")
+	if err != nil {
+		return fmt.Errorf("failed to open messages DB file: %w", err)
+	}
+
+	TaskFilesDB, err = OpenDB(dir, "TaskFiles.db")
+	if err != nil {
+		return fmt.Errorf("failed to open task files DB file: %w", err)
+	}
+
+	if err := OpenBlobs(dir, BlobsName); err != nil {
+		return fmt.Errorf("failed to open blobs file: %w", err)
+	}
+
+	if err := OpenWAL(dir, WALName); err != nil {
+		return fmt.Errorf("failed to open WAL file: %w", err)
+	}
+
+	for i := 0; i < len(TxDBs); i++ {
+		if err := LoadNextID(*TxDBs[i]); err != nil {
+			return fmt.Errorf("failed to load next ID of %s: %w", SchemaDBs[i].Name, err)
+		}
+	}
+
+	if err := RestoreIndexesFromFile(dir, IndexesFile); (err != nil) || (replayed) {
+		log.Infof("Rebuilding indexes...")
+		if err := RebuildIndexes(); err != nil {
+			return fmt.Errorf("failed to rebuild indexes: %w", err)
+		}
+	}
+	DBDirectory = dir
+
 	if shouldCreate {
 		log.Infof("Creating new DBs...")
 		CreateInitialDBs()
@@ -116,6 +310,10 @@ func CloseDBs() error {
 
 	var err error
 
+	if err1 := StoreIndexesToFile(DBDirectory, IndexesFile); err1 != nil {
+		err = errors.Join(err, err1)
+	}
+
 	if err1 := database.Close(UsersDB); err1 != nil {
 		err = errors.Join(err, err1)
 	}
@@ -140,5 +338,33 @@ func CloseDBs() error {
 		err = errors.Join(err, err1)
 	}
 
+	if err1 := database.Close(QuestionsDB); err1 != nil {
+		err = errors.Join(err, err1)
+	}
+
+	if err1 := database.Close(AnnouncementsDB); err1 != nil {
+		err = errors.Join(err, err1)
+	}
+
+	if err1 := database.Close(NotificationsDB); err1 != nil {
+		err = errors.Join(err, err1)
+	}
+
+	if err1 := database.Close(MessagesDB); err1 != nil {
+		err = errors.Join(err, err1)
+	}
+
+	if err1 := database.Close(TaskFilesDB); err1 != nil {
+		err = errors.Join(err, err1)
+	}
+
+	if err1 := CloseBlobs(); err1 != nil {
+		err = errors.Join(err, err1)
+	}
+
+	if err1 := CloseWAL(); err1 != nil {
+		err = errors.Join(err, err1)
+	}
+
 	return err
 }
@@ -16,7 +16,9 @@ func testCreateInitialDBs() error {
 		{FirstName: "Robert", LastName: "Martin", Email: "student2@masters.com", Password: "student2", CreatedOn: int64(time.Now())},
 	}
 
-	if err := database.Drop(UsersDB); err != nil {
+	ResetIndexes()
+
+	if err := DropDB(UsersDB); err != nil {
 		return fmt.Errorf("failed to drop users data: %w", err)
 	}
 	for id := database.ID(0); id < database.ID(len(users)); id++ {
@@ -28,7 +30,7 @@ func testCreateInitialDBs() error {
 	groups := [...]Group{
 		{Name: "18-SWE", Students: []database.ID{2, 3}, CreatedOn: int64(time.Now())},
 	}
-	if err := database.Drop(GroupsDB); err != nil {
+	if err := DropDB(GroupsDB); err != nil {
 		return fmt.Errorf("failed to drop groups data: %w", err)
 	}
 	for id := database.ID(0); id < database.ID(len(groups)); id++ {
@@ -41,6 +43,7 @@ func testCreateInitialDBs() error {
 		Lesson{
 			ContainerID:   0,
 			ContainerType: LessonContainerCourse,
+			Version:       1,
 			Name:          "Introduction",
 			Theory:        "This is an introduction.",
 			Steps:         make([]Step, 2),
@@ -48,6 +51,7 @@ func testCreateInitialDBs() error {
 		Lesson{
 			ContainerID:   1,
 			ContainerType: LessonContainerCourse,
+			Version:       1,
 			Name:          "Test lesson",
 			Theory:        "This is a test lesson.",
 		},
@@ -106,7 +110,7 @@ func testCreateInitialDBs() error {
 			},
 		},
 	}
-	if err := database.Drop(LessonsDB); err != nil {
+	if err := DropDB(LessonsDB); err != nil {
 		return fmt.Errorf("failed to drop lessons data: %w", err)
 	}
 	for id := database.ID(0); id < database.ID(len(lessons)); id++ {
@@ -116,10 +120,10 @@ func testCreateInitialDBs() error {
 	}
 
 	courses := [...]Course{
-		{LessonContainer{Name: "Programming basics", Lessons: []database.ID{0}}, [1024]byte{}},
-		{LessonContainer{Name: "Test course", Lessons: []database.ID{1}}, [1024]byte{}},
+		{LessonContainer: LessonContainer{Name: "Programming basics", Lessons: []database.ID{0}}},
+		{LessonContainer: LessonContainer{Name: "Test course", Lessons: []database.ID{1}}},
 	}
-	if err := database.Drop(CoursesDB); err != nil {
+	if err := DropDB(CoursesDB); err != nil {
 		return fmt.Errorf("failed to drop courses data: %w", err)
 	}
 	for id := database.ID(0); id < database.ID(len(courses)); id++ {
@@ -129,10 +133,10 @@ func testCreateInitialDBs() error {
 	}
 
 	subjects := [...]Subject{
-		{LessonContainer{Name: "Programming"}, 0, 0, int64(time.Now()), [1024]byte{}},
-		{LessonContainer{Name: "Physics", Lessons: []database.ID{2}}, 1, 0, int64(time.Now()), [1024]byte{}},
+		{LessonContainer{Name: "Programming"}, 0, 0, int64(time.Now()), Blob{}, [1024]byte{}},
+		{LessonContainer{Name: "Physics", Lessons: []database.ID{2}}, 1, 0, int64(time.Now()), Blob{}, [1024]byte{}},
 	}
-	if err := database.Drop(SubjectsDB); err != nil {
+	if err := DropDB(SubjectsDB); err != nil {
 		return fmt.Errorf("failed to drop subjects data: %w", err)
 	}
 	for id := database.ID(0); id < database.ID(len(subjects)); id++ {
@@ -144,7 +148,7 @@ func testCreateInitialDBs() error {
 	submissions := [...]Submission{
 		{LessonID: 2, UserID: 2, SubmittedSteps: make([]SubmittedStep, 2), Status: SubmissionCheckDone},
 	}
-	if err := database.Drop(SubmissionsDB); err != nil {
+	if err := DropDB(SubmissionsDB); err != nil {
 		return fmt.Errorf("failed to drop submissions data: %w", err)
 	}
 	for id := database.ID(0); id < database.ID(len(submissions)); id++ {
@@ -153,5 +157,33 @@ func testCreateInitialDBs() error {
 		}
 	}
 
+	questions := [...]BankQuestion{
+		{OwnerID: 1, Difficulty: QuestionDifficultyEasy, Version: 1, Question: Question{Name: "What is a goroutine?", Answers: []string{"Lightweight thread", "Process"}, CorrectAnswers: []int{0}}, Tags: []string{"go"}, CreatedOn: int64(time.Now())},
+		{OwnerID: 1, Difficulty: QuestionDifficultyMedium, Version: 1, Question: Question{Name: "What does defer do?", Answers: []string{"Delays call until function returns", "Starts goroutine"}, CorrectAnswers: []int{0}}, Tags: []string{"go", "functions"}, CreatedOn: int64(time.Now())},
+		{OwnerID: 1, Difficulty: QuestionDifficultyHard, Version: 1, Question: Question{Name: "Which isolation level prevents phantom reads?", Answers: []string{"Read committed", "Serializable"}, CorrectAnswers: []int{1}}, Tags: []string{"sql"}, CreatedOn: int64(time.Now())},
+		{OwnerID: AdminID, Difficulty: QuestionDifficultyEasy, Version: 1, Question: Question{Name: "What is HTTP?", Answers: []string{"Protocol", "Language"}, CorrectAnswers: []int{0}}, Tags: []string{"web"}, CreatedOn: int64(time.Now())},
+	}
+	if err := DropDB(QuestionsDB); err != nil {
+		return fmt.Errorf("failed to drop questions data: %w", err)
+	}
+	for id := database.ID(0); id < database.ID(len(questions)); id++ {
+		if err := CreateBankQuestion(&questions[id]); err != nil {
+			return err
+		}
+	}
+
+	if err := DropDB(AnnouncementsDB); err != nil {
+		return fmt.Errorf("failed to drop announcements data: %w", err)
+	}
+	if err := DropDB(NotificationsDB); err != nil {
+		return fmt.Errorf("failed to drop notifications data: %w", err)
+	}
+	if err := DropDB(MessagesDB); err != nil {
+		return fmt.Errorf("failed to drop messages data: %w", err)
+	}
+	if err := DropDB(TaskFilesDB); err != nil {
+		return fmt.Errorf("failed to drop task files data: %w", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,593 @@
+package main
+
+import (
+	"strconv"
+	"time"
+	"unsafe"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/strings"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* Message is a message in discussion of a subject lesson or one of its steps. */
+type Message struct {
+	ID    database.ID
+	Flags int32
+
+	LessonID database.ID
+
+	/* StepIndex is an index of lesson step discussion is about or -1 for discussion of the whole lesson. */
+	StepIndex int32
+	AuthorID  database.ID
+
+	Pinned bool
+	Answer bool
+
+	Text      string
+	CreatedOn int64
+
+	Blob Blob
+	Data [2048]byte
+}
+
+const (
+	MessageActive int32 = iota
+	MessageDeleted
+	MessageHidden
+)
+
+const (
+	MinMessageLen = 1
+	MaxMessageLen = 4096
+)
+
+/* LessonThread is an index of discussion thread about the whole lesson. */
+const LessonThread = -1
+
+func CreateMessageTx(tx *Tx, message *Message) error {
+	defer trace.End(trace.Begin(""))
+
+	message.ID = NewIDTx(tx, MessagesDB)
+
+	return SaveMessageTx(tx, message)
+}
+
+func CreateMessage(message *Message) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := CreateMessageTx(&tx, message); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func DBMessage2Message(message *Message, data *byte) {
+	defer trace.End(trace.Begin(""))
+
+	message.Text = database.Offset2String(message.Text, data)
+}
+
+func GetMessageByID(id database.ID, message *Message) error {
+	defer trace.End(trace.Begin(""))
+
+	if err := DBRead(MessagesDB, id, unsafe.Pointer(message), int(unsafe.Sizeof(*message))); err != nil {
+		return err
+	}
+	if message.ID != id {
+		return database.NotFound
+	}
+
+	data, err := GetBlobData(&message.Blob, message.Data[:])
+	if err != nil {
+		return err
+	}
+
+	DBMessage2Message(message, data)
+	return nil
+}
+
+func GetMessages(pos *int64, messages []Message) (int, error) {
+	defer trace.End(trace.Begin(""))
+
+	n, err := DBReadManyValid(MessagesDB, pos, messages, func(message *Message) database.ID { return message.ID })
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < n; i++ {
+		data, err := GetBlobData(&messages[i].Blob, messages[i].Data[:])
+		if err != nil {
+			return 0, err
+		}
+		DBMessage2Message(&messages[i], data)
+	}
+	return n, nil
+}
+
+func DeleteMessageByIDTx(tx *Tx, id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	flags := MessageDeleted
+	var message Message
+
+	offset := int64(int(id)*int(unsafe.Sizeof(message))) + database.DataOffset + int64(unsafe.Offsetof(message.Flags))
+	tx.WriteAt(MessagesDB, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
+
+	tx.OnCommit(func() { UnindexMessage(id) })
+	return nil
+}
+
+func DeleteMessageByID(id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := DeleteMessageByIDTx(&tx, id); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func MessageDataSize(message *Message) int {
+	return DBStringSize(message.Text)
+}
+
+func SaveMessageTx(tx *Tx, message *Message) error {
+	defer trace.End(trace.Begin(""))
+
+	var messageDB Message
+	var n int
+
+	messageDB.ID = message.ID
+	messageDB.Flags = message.Flags
+	messageDB.LessonID = message.LessonID
+	messageDB.StepIndex = message.StepIndex
+	messageDB.AuthorID = message.AuthorID
+	messageDB.Pinned = message.Pinned
+	messageDB.Answer = message.Answer
+
+	data, err := GetDataBuffer(messageDB.Data[:], MessageDataSize(message))
+	if err != nil {
+		return err
+	}
+
+	n += database.String2DBString(&messageDB.Text, message.Text, data, n)
+
+	messageDB.CreatedOn = message.CreatedOn
+
+	if err := SaveBlob(&messageDB.Blob, messageDB.Data[:], data[:n]); err != nil {
+		return err
+	}
+
+	tx.Write(MessagesDB, messageDB.ID, unsafe.Pointer(&messageDB), int(unsafe.Sizeof(messageDB)))
+
+	indexed := *message
+	tx.OnCommit(func() { IndexMessage(&indexed) })
+	return nil
+}
+
+func SaveMessage(message *Message) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := SaveMessageTx(&tx, message); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func SubjectUserIsModerator(who SubjectUserType) bool {
+	return (who == SubjectUserAdmin) || (who == SubjectUserTeacher)
+}
+
+/* MessageVisible returns true if message can be seen by user. Hidden messages are visible only to moderators. */
+func MessageVisible(message *Message, who SubjectUserType) bool {
+	switch message.Flags {
+	default:
+		return false
+	case MessageActive:
+		return true
+	case MessageHidden:
+		return SubjectUserIsModerator(who)
+	}
+}
+
+/* GetThreadMessages returns messages of a lesson or step thread visible to user. Pinned messages go first, the rest are in order they were posted. */
+func GetThreadMessages(lessonID database.ID, stepIndex int, who SubjectUserType) ([]Message, error) {
+	defer trace.End(trace.Begin(""))
+
+	var pinned, rest []Message
+
+	ids := GetLessonMessageIDs(lessonID)
+	for i := 0; i < len(ids); i++ {
+		var message Message
+		if err := GetMessageByID(ids[i], &message); err != nil {
+			return nil, err
+		}
+		if (int(message.StepIndex) != stepIndex) || (!MessageVisible(&message, who)) {
+			continue
+		}
+
+		if message.Pinned {
+			pinned = append(pinned, message)
+		} else {
+			rest = append(rest, message)
+		}
+	}
+
+	return append(pinned, rest...), nil
+}
+
+/* GetLessonThreadsCounts returns number of messages visible to user in thread of a lesson (last element) and in threads of each of its steps. */
+func GetLessonThreadsCounts(lesson *Lesson, who SubjectUserType) ([]int, error) {
+	defer trace.End(trace.Begin(""))
+
+	var message Message
+
+	counts := make([]int, len(lesson.Steps)+1)
+
+	ids := GetLessonMessageIDs(lesson.ID)
+	for i := 0; i < len(ids); i++ {
+		if err := GetMessageByID(ids[i], &message); err != nil {
+			return nil, err
+		}
+		if !MessageVisible(&message, who) {
+			continue
+		}
+
+		switch {
+		case message.StepIndex == LessonThread:
+			counts[len(lesson.Steps)]++
+		case int(message.StepIndex) < len(lesson.Steps):
+			counts[message.StepIndex]++
+		}
+	}
+
+	return counts, nil
+}
+
+/* GetDiscussionSubject checks that user can access discussions of a lesson and returns user's role in its subject. */
+func GetDiscussionSubject(userID database.ID, lesson *Lesson, subject *Subject) (SubjectUserType, error) {
+	defer trace.End(trace.Begin(""))
+
+	if lesson.ContainerType != LessonContainerSubject {
+		return SubjectUserNone, http.BadRequest("%s", Ls(GL, "discussions are only available for lessons in subjects"))
+	}
+	if err := GetSubjectByID(lesson.ContainerID, subject); err != nil {
+		return SubjectUserNone, http.ServerError(err)
+	}
+
+	who, err := WhoIsUserInSubject(userID, subject)
+	if err != nil {
+		return SubjectUserNone, http.ServerError(err)
+	}
+	switch who {
+	case SubjectUserNone:
+		return SubjectUserNone, ForbiddenError
+	case SubjectUserStudent:
+		states, err := GetUserLessonStates(userID, subject.Lessons)
+		if err != nil {
+			return SubjectUserNone, http.ServerError(err)
+		}
+		if err := LessonCheckUnlocked(GL, subject.Lessons, states, lesson); err != nil {
+			return SubjectUserNone, err
+		}
+	}
+
+	return who, nil
+}
+
+/* GetDiscussionStepIndex returns index of a step from request or 'LessonThread' if it's empty. */
+func GetDiscussionStepIndex(s string, lesson *Lesson) (int, error) {
+	if s == "" {
+		return LessonThread, nil
+	}
+	return GetValidIndex(s, len(lesson.Steps))
+}
+
+func DiscussionPath(lessonID database.ID, stepIndex int) string {
+	path := "/lesson/discussion?ID=" + strconv.Itoa(int(lessonID))
+	if stepIndex != LessonThread {
+		path += "&StepIndex=" + strconv.Itoa(stepIndex)
+	}
+	return path
+}
+
+func DisplayDiscussionLink(w *http.Response, l Language, lessonID database.ID, stepIndex int, count int) {
+	w.WriteString(`<a href="`)
+	w.WriteString(DiscussionPath(lessonID, stepIndex))
+	w.WriteString(`">`)
+	w.WriteString(Ls(l, "Discussion"))
+	w.WriteString(` (`)
+	w.WriteInt(count)
+	w.WriteString(`)</a>`)
+}
+
+func DisplayMessage(w *http.Response, l Language, message *Message, who SubjectUserType) {
+	defer trace.End(trace.Begin(""))
+
+	var author User
+	if err := GetUserByID(message.AuthorID, &author); err != nil {
+		/* TODO(anton2920): report error. */
+	}
+
+	DisplayFrameStart(w)
+
+	w.WriteString(`<p><b>`)
+	w.WriteHTMLString(author.LastName)
+	w.WriteString(` `)
+	w.WriteHTMLString(author.FirstName)
+	w.WriteString(`</b>, `)
+	DisplayFormattedTime(w, message.CreatedOn)
+	if message.Pinned {
+		w.WriteString(` (`)
+		w.WriteString(Ls(l, "pinned"))
+		w.WriteString(`)`)
+	}
+	if message.Answer {
+		w.WriteString(` ✓ `)
+		w.WriteString(Ls(l, "answer"))
+	}
+	if message.Flags == MessageHidden {
+		w.WriteString(` (`)
+		w.WriteString(Ls(l, "hidden"))
+		w.WriteString(`)`)
+	}
+	w.WriteString(`</p>`)
+
+	DisplayMarkdown(w, message.Text)
+
+	if SubjectUserIsModerator(who) {
+		w.WriteString(`<form method="POST" action="/api/message/moderate">`)
+		DisplayHiddenID(w, "ID", message.ID)
+		if message.Pinned {
+			DisplayButton(w, l, "Action", "Unpin")
+		} else {
+			DisplayButton(w, l, "Action", "Pin")
+		}
+		if message.Flags == MessageHidden {
+			DisplayButton(w, l, "Action", "Show")
+		} else {
+			DisplayButton(w, l, "Action", "Hide")
+		}
+		if message.Answer {
+			DisplayButton(w, l, "Action", "Unmark answer")
+		} else {
+			DisplayButton(w, l, "Action", "Mark as answer")
+		}
+		w.WriteString(`</form>`)
+	}
+
+	DisplayFrameEnd(w)
+}
+
+func LessonDiscussionPageHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	const width = WidthLarge
+
+	var subject Subject
+	var lesson Lesson
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	lessonID, err := r.URL.Query.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if err := GetLessonByID(lessonID, &lesson); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "lesson with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	stepIndex, err := GetDiscussionStepIndex(r.URL.Query.Get("StepIndex"), &lesson)
+	if err != nil {
+		return http.ClientError(err)
+	}
+
+	who, err := GetDiscussionSubject(session.ID, &lesson, &subject)
+	if err != nil {
+		return err
+	}
+
+	messages, err := GetThreadMessages(lesson.ID, stepIndex, who)
+	if err != nil {
+		return http.ServerError(err)
+	}
+
+	title := lesson.Name
+	if stepIndex != LessonThread {
+		title = strings.Or(lesson.Steps[stepIndex].Name, Ls(GL, "Step")+" #"+strconv.Itoa(stepIndex+1))
+	}
+
+	DisplayHTMLStart(w)
+
+	DisplayHeadStart(w)
+	{
+		w.WriteString(`<title>`)
+		w.WriteString(Ls(GL, "Discussion"))
+		w.WriteString(`: `)
+		w.WriteHTMLString(title)
+		w.WriteString(`</title>`)
+	}
+	DisplayHeadEnd(w)
+
+	DisplayBodyStart(w)
+	{
+		DisplayHeader(w, GL, session)
+		DisplaySidebarWithLessons(w, GL, session, subject.Lessons, GetStudentLessonStates(session.ID, &subject))
+
+		DisplayMainStart(w)
+
+		DisplayCrumbsStart(w, width)
+		{
+			DisplayCrumbsLinkID(w, "/subject", subject.ID, subject.Name)
+			DisplayCrumbsLinkID(w, "/lesson", lesson.ID, lesson.Name)
+			DisplayCrumbsItem(w, GL, "Discussion")
+		}
+		DisplayCrumbsEnd(w)
+
+		DisplayPageStart(w, width)
+		{
+			w.WriteString(`<h2>`)
+			w.WriteString(Ls(GL, "Discussion"))
+			w.WriteString(`: `)
+			w.WriteHTMLString(title)
+			w.WriteString(`</h2>`)
+			w.WriteString(`<br>`)
+
+			if len(messages) == 0 {
+				w.WriteString(`<h4>`)
+				w.WriteString(Ls(GL, "There are no messages yet"))
+				w.WriteString(`</h4>`)
+				w.WriteString(`<br>`)
+			}
+			for i := 0; i < len(messages); i++ {
+				DisplayMessage(w, GL, &messages[i], who)
+			}
+
+			w.WriteString(`<form method="POST" action="/api/message/create">`)
+			DisplayHiddenID(w, "LessonID", lesson.ID)
+			if stepIndex != LessonThread {
+				DisplayHiddenInt(w, "StepIndex", stepIndex)
+			}
+			DisplayConstraintTextarea(w, MinMessageLen, MaxMessageLen, "Text", "", true)
+			DisplayButton(w, GL, "", "Post")
+			w.WriteString(`</form>`)
+		}
+		DisplayPageEnd(w)
+		DisplayMainEnd(w)
+	}
+	DisplayBodyEnd(w)
+
+	DisplayHTMLEnd(w)
+	return nil
+}
+
+func MessageCreateHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var subject Subject
+	var lesson Lesson
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	lessonID, err := r.Form.GetID("LessonID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if err := GetLessonByID(lessonID, &lesson); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "lesson with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	stepIndex, err := GetDiscussionStepIndex(r.Form.Get("StepIndex"), &lesson)
+	if err != nil {
+		return http.ClientError(err)
+	}
+
+	who, err := GetDiscussionSubject(session.ID, &lesson, &subject)
+	if err != nil {
+		return err
+	}
+
+	text := r.Form.Get("Text")
+	if !strings.LengthInRange(text, MinMessageLen, MaxMessageLen) {
+		return http.BadRequest(Ls(GL, "message length must be between %d and %d characters long"), MinMessageLen, MaxMessageLen)
+	}
+
+	message := Message{LessonID: lesson.ID, StepIndex: int32(stepIndex), AuthorID: session.ID, Text: text, CreatedOn: time.Now().Unix()}
+
+	var tx Tx
+	if err := CreateMessageTx(&tx, &message); err != nil {
+		return http.ServerError(err)
+	}
+	if who == SubjectUserStudent {
+		if err := NotifyUsersTx(&tx, []database.ID{subject.TeacherID}, NotificationDiscussion, lesson.ID, subject.Name+": "+lesson.Name); err != nil {
+			return http.ServerError(err)
+		}
+	}
+	if err := CommitTx(&tx); err != nil {
+		return http.ServerError(err)
+	}
+
+	Audit(r, session.ID, "create", "message", message.ID, "", AuditTextSummary(text))
+
+	w.Redirect(DiscussionPath(lesson.ID, stepIndex), http.StatusSeeOther)
+	return nil
+}
+
+func MessageModerateHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var message Message
+	var subject Subject
+	var lesson Lesson
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	messageID, err := r.Form.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if err := GetMessageByID(messageID, &message); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "message with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if message.Flags == MessageDeleted {
+		return http.NotFound("%s", Ls(GL, "message with this ID does not exist"))
+	}
+	if err := GetLessonByID(message.LessonID, &lesson); err != nil {
+		return http.ServerError(err)
+	}
+
+	who, err := GetDiscussionSubject(session.ID, &lesson, &subject)
+	if err != nil {
+		return err
+	}
+	if !SubjectUserIsModerator(who) {
+		return ForbiddenError
+	}
+
+	before := AuditMessageSummary(&message)
+	switch r.Form.Get("Action") {
+	default:
+		return http.ClientError(nil)
+	case Ls(GL, "Pin"):
+		message.Pinned = true
+	case Ls(GL, "Unpin"):
+		message.Pinned = false
+	case Ls(GL, "Hide"):
+		message.Flags = MessageHidden
+	case Ls(GL, "Show"):
+		message.Flags = MessageActive
+	case Ls(GL, "Mark as answer"):
+		message.Answer = true
+	case Ls(GL, "Unmark answer"):
+		message.Answer = false
+	}
+
+	if err := SaveMessage(&message); err != nil {
+		return http.ServerError(err)
+	}
+
+	Audit(r, session.ID, "moderate", "message", messageID, before, AuditMessageSummary(&message))
+
+	w.Redirect(DiscussionPath(lesson.ID, int(message.StepIndex)), http.StatusSeeOther)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/anton2920/gofa/net/http"
+)
+
+func TestDiscussionHandlers(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	testPostAuth(t, "/api/message/create", testTokens[2], url.Values{"LessonID": {"2"}, "Text": {""}}, http.StatusBadRequest)
+	testPostAuth(t, "/api/message/create", testTokens[2], url.Values{"LessonID": {"2"}, "StepIndex": {"5"}, "Text": {"Question"}}, http.StatusBadRequest)
+	testPostAuth(t, "/api/message/create", testTokens[2], url.Values{"LessonID": {"0"}, "Text": {"Question"}}, http.StatusBadRequest)
+	testPostAuth(t, "/api/message/create", testTokens[2], url.Values{"LessonID": {"100"}, "Text": {"Question"}}, http.StatusNotFound)
+	testPostAuth(t, "/api/message/create", testTokens[2], url.Values{"LessonID": {"2"}, "Text": {"Question"}}, http.StatusSeeOther)
+	testPostAuth(t, "/api/message/create", testTokens[1], url.Values{"LessonID": {"2"}, "StepIndex": {"0"}, "Text": {"Hint"}}, http.StatusSeeOther)
+
+	if n := GetUserUnreadNotificationsCount(1); n != 1 {
+		t.Errorf("Expected teacher to have 1 unread notification, got %d", n)
+	}
+	if n := GetUserUnreadNotificationsCount(2); n != 0 {
+		t.Errorf("Expected student to have no unread notifications, got %d", n)
+	}
+
+	ids := GetLessonMessageIDs(2)
+	if len(ids) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(ids))
+	}
+
+	testGetAuth(t, "/lesson/2", testTokens[2], http.StatusOK)
+	testGetAuth(t, "/lesson/discussion?ID=2", testTokens[2], http.StatusOK)
+	testGetAuth(t, "/lesson/discussion?ID=2&StepIndex=0", testTokens[1], http.StatusOK)
+	testGetAuth(t, "/lesson/discussion?ID=2&StepIndex=2", testTokens[1], http.StatusBadRequest)
+	testGetAuth(t, "/lesson/discussion?ID=0", testTokens[1], http.StatusBadRequest)
+	testGet(t, "/lesson/discussion?ID=2", http.StatusUnauthorized)
+
+	id := strconv.Itoa(int(ids[0]))
+	testPostAuth(t, "/api/message/moderate", testTokens[2], url.Values{"ID": {id}, "Action": {"Hide"}}, http.StatusForbidden)
+	testPostAuth(t, "/api/message/moderate", testTokens[1], url.Values{"ID": {"100"}, "Action": {"Hide"}}, http.StatusNotFound)
+	testPostAuth(t, "/api/message/moderate", testTokens[1], url.Values{"ID": {id}, "Action": {"Unknown"}}, http.StatusBadRequest)
+	for _, action := range [...]string{"Pin", "Mark as answer", "Hide"} {
+		testPostAuth(t, "/api/message/moderate", testTokens[1], url.Values{"ID": {id}, "Action": {action}}, http.StatusSeeOther)
+	}
+
+	messages, err := GetThreadMessages(2, LessonThread, SubjectUserTeacher)
+	if err != nil {
+		t.Fatalf("Failed to get thread messages: %v", err)
+	}
+	if (len(messages) != 1) || (!messages[0].Pinned) || (!messages[0].Answer) || (messages[0].Flags != MessageHidden) {
+		t.Errorf("Expected pinned hidden answer, got %+v", messages)
+	}
+
+	messages, err = GetThreadMessages(2, LessonThread, SubjectUserStudent)
+	if err != nil {
+		t.Fatalf("Failed to get thread messages: %v", err)
+	}
+	if len(messages) != 0 {
+		t.Errorf("Expected hidden message to be invisible to student, got %d messages", len(messages))
+	}
+}
@@ -10,6 +10,8 @@ import (
 var (
 	UnauthorizedError = http.Unauthorized("%s", "whoops... You have to sign in to see this page")
 	ForbiddenError    = http.Forbidden("%s", "whoops... Your permissions are insufficient")
+
+	ShuttingDownError = http.Error{Status: http.StatusServiceUnavailable, DisplayErrorMessage: "whoops... Server is restarting, please try again later"}
 )
 
 func DisplayErrorMessage(w *http.Response, l Language, message string) {
@@ -67,7 +69,7 @@ func ErrorPageHandler(w *http.Response, r *http.Request, l Language, err error)
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, l)
+		DisplayHeader(w, l, session)
 		if session != nil {
 			DisplaySidebar(w, l, session)
 		}
@@ -0,0 +1,706 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/strings"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* Exchange* types describe portable representation of courses and lessons, which doesn't depend on DB layout. */
+type (
+	ExchangeQuestion struct {
+		Question       string   `json:"question"`
+		Answers        []string `json:"answers"`
+		CorrectAnswers []int    `json:"correctAnswers"`
+	}
+	ExchangeCheck struct {
+		Input  string `json:"input"`
+		Output string `json:"output"`
+	}
+	ExchangeFile struct {
+		Name     string `json:"name"`
+		Contents string `json:"contents"`
+	}
+	ExchangeStep struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+
+		Questions []ExchangeQuestion `json:"questions,omitempty"`
+
+		Description string          `json:"description,omitempty"`
+		Languages   []string        `json:"languages,omitempty"`
+		Examples    []ExchangeCheck `json:"examples,omitempty"`
+		Tests       []ExchangeCheck `json:"tests,omitempty"`
+		StarterCode string          `json:"starterCode,omitempty"`
+		Files       []ExchangeFile  `json:"files,omitempty"`
+		HarnessFile string          `json:"harnessFile,omitempty"`
+		Harness     string          `json:"harness,omitempty"`
+
+		InteractorLanguage string `json:"interactorLanguage,omitempty"`
+		InteractorFile     string `json:"interactorFile,omitempty"`
+		Interactor         string `json:"interactor,omitempty"`
+	}
+	ExchangeLesson struct {
+		Name   string         `json:"name"`
+		Theory string         `json:"theory"`
+		Steps  []ExchangeStep `json:"steps"`
+	}
+	ExchangeCourse struct {
+		Name    string           `json:"name"`
+		Lessons []ExchangeLesson `json:"lessons"`
+	}
+
+	/* ExchangeDocument contains either a course or a single lesson. */
+	ExchangeDocument struct {
+		Format  string          `json:"format"`
+		Version int             `json:"version"`
+		Course  *ExchangeCourse `json:"course,omitempty"`
+		Lesson  *ExchangeLesson `json:"lesson,omitempty"`
+	}
+)
+
+type ImportError struct {
+	Item string
+	Err  error
+}
+
+type ImportErrors []ImportError
+
+const (
+	ExchangeFormatName    = "sems"
+	ExchangeFormatVersion = 1
+
+	ExchangeStepTest        = "test"
+	ExchangeStepProgramming = "programming"
+)
+
+const (
+	FormatJSON = "JSON"
+	FormatGIFT = "GIFT"
+	FormatQTI  = "QTI"
+)
+
+var ExchangeFormats = [...]string{FormatJSON, FormatGIFT, FormatQTI}
+
+const MaxImportLen = 256 * 1024
+
+func (errs *ImportErrors) Add(item string, err error) {
+	*errs = append(*errs, ImportError{Item: item, Err: err})
+}
+
+func ImportItem(parent string, l Language, item string, i int) string {
+	if len(parent) == 0 {
+		return fmt.Sprintf("%s %d", Ls(l, item), i+1)
+	}
+	return fmt.Sprintf("%s, %s %d", parent, Ls(l, item), i+1)
+}
+
+func Step2Exchange(step *Step, es *ExchangeStep) error {
+	es.Name = step.Name
+
+	switch step.Type {
+	case StepTypeTest:
+		test, _ := Step2Test(step)
+
+		es.Type = ExchangeStepTest
+		es.Questions = make([]ExchangeQuestion, len(test.Questions))
+		for i := 0; i < len(test.Questions); i++ {
+			question := &test.Questions[i]
+			es.Questions[i] = ExchangeQuestion{Question: question.Name, Answers: question.Answers, CorrectAnswers: question.CorrectAnswers}
+		}
+	case StepTypeProgramming:
+		task, _ := Step2Programming(step)
+
+		es.Type = ExchangeStepProgramming
+		es.Description = task.Description
+		for i := 0; i < len(ProgrammingLanguages); i++ {
+			if (task.Languages & (1 << uint(i))) != 0 {
+				es.Languages = append(es.Languages, ProgrammingLanguages[i].Name)
+			}
+		}
+		for i := 0; i < len(task.Checks[CheckTypeExample]); i++ {
+			check := &task.Checks[CheckTypeExample][i]
+			es.Examples = append(es.Examples, ExchangeCheck{Input: check.Input, Output: check.Output})
+		}
+		for i := 0; i < len(task.Checks[CheckTypeTest]); i++ {
+			check := &task.Checks[CheckTypeTest][i]
+			es.Tests = append(es.Tests, ExchangeCheck{Input: check.Input, Output: check.Output})
+		}
+
+		var files TaskFiles
+		if err := GetStepTaskFiles(task, &files); err != nil {
+			return err
+		}
+		es.StarterCode = files.StarterCode
+		for i := 0; i < len(files.Files); i++ {
+			es.Files = append(es.Files, ExchangeFile{Name: files.Files[i].Name, Contents: files.Files[i].Contents})
+		}
+		es.HarnessFile = files.HarnessFile
+		es.Harness = files.Harness
+		if files.Interactor != "" {
+			es.InteractorLanguage = ProgrammingLanguages[files.InteractorLanguage].Name
+			es.InteractorFile = files.InteractorFile
+			es.Interactor = files.Interactor
+		}
+	}
+
+	return nil
+}
+
+func Lesson2Exchange(lesson *Lesson, el *ExchangeLesson) error {
+	defer trace.End(trace.Begin(""))
+
+	el.Name = lesson.Name
+	el.Theory = lesson.Theory
+	el.Steps = make([]ExchangeStep, len(lesson.Steps))
+	for i := 0; i < len(lesson.Steps); i++ {
+		if err := Step2Exchange(&lesson.Steps[i], &el.Steps[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Course2Exchange(course *Course, ec *ExchangeCourse) error {
+	defer trace.End(trace.Begin(""))
+
+	ec.Name = course.Name
+	ec.Lessons = make([]ExchangeLesson, len(course.Lessons))
+	for i := 0; i < len(course.Lessons); i++ {
+		var lesson Lesson
+		if err := GetLessonByID(course.Lessons[i], &lesson); err != nil {
+			return err
+		}
+		if err := Lesson2Exchange(&lesson, &ec.Lessons[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* Exchange2Step converts and verifies imported step, reporting all problems found. Files of programming step are only put into 'files', so nothing is written until the whole document is verified. */
+func Exchange2Step(l Language, es *ExchangeStep, step *Step, files *TaskFiles, item string, errs *ImportErrors) {
+	switch es.Type {
+	default:
+		errs.Add(item, http.BadRequest(Ls(l, "unsupported step type %q"), es.Type))
+		return
+	case ExchangeStepTest:
+		step.Type = StepTypeTest
+		test, _ := Step2Test(step)
+		test.Name = es.Name
+		test.Questions = make([]Question, len(es.Questions))
+		for i := 0; i < len(es.Questions); i++ {
+			eq := &es.Questions[i]
+			question := &test.Questions[i]
+
+			question.Name = eq.Question
+			question.Answers = eq.Answers
+			question.CorrectAnswers = eq.CorrectAnswers
+			for j := 0; j < len(question.CorrectAnswers); j++ {
+				if (question.CorrectAnswers[j] < 0) || (question.CorrectAnswers[j] >= len(question.Answers)) {
+					errs.Add(ImportItem(item, l, "Question", i), http.BadRequest(Ls(l, "correct answer %d does not exist"), question.CorrectAnswers[j]+1))
+					return
+				}
+			}
+		}
+	case ExchangeStepProgramming:
+		step.Type = StepTypeProgramming
+		task, _ := Step2Programming(step)
+		task.Name = es.Name
+		task.Description = es.Description
+		for i := 0; i < len(es.Languages); i++ {
+			id, ok := GetProgrammingLanguageByName(es.Languages[i])
+			if !ok {
+				errs.Add(item, http.BadRequest(Ls(l, "programming language %q does not exist"), es.Languages[i]))
+				return
+			}
+			task.Languages |= 1 << uint(id)
+		}
+		for i := 0; i < len(es.Examples); i++ {
+			task.Checks[CheckTypeExample] = append(task.Checks[CheckTypeExample], Check{Input: es.Examples[i].Input, Output: es.Examples[i].Output})
+		}
+		for i := 0; i < len(es.Tests); i++ {
+			task.Checks[CheckTypeTest] = append(task.Checks[CheckTypeTest], Check{Input: es.Tests[i].Input, Output: es.Tests[i].Output})
+		}
+
+		*files = TaskFiles{StarterCode: es.StarterCode, HarnessFile: es.HarnessFile, Harness: es.Harness, InteractorFile: es.InteractorFile, Interactor: es.Interactor}
+		for i := 0; i < len(es.Files); i++ {
+			files.Files = append(files.Files, TaskFile{Name: es.Files[i].Name, Contents: es.Files[i].Contents})
+		}
+		if es.Interactor != "" {
+			id, ok := GetProgrammingLanguageByName(es.InteractorLanguage)
+			if !ok {
+				errs.Add(item, http.BadRequest(Ls(l, "programming language %q does not exist"), es.InteractorLanguage))
+				return
+			}
+			files.InteractorLanguage = id
+		}
+		if err := TaskFilesVerify(files); err != nil {
+			errs.Add(item, err)
+			return
+		}
+		/* NOTE(anton2920): files are not in DB yet, so they are verified together with the task directly. */
+		if err := LessonProgrammingVerifyWithFiles(task, files); err != nil {
+			errs.Add(item, err)
+		}
+		return
+	}
+
+	if err := LessonStepVerify(l, step); err != nil {
+		errs.Add(item, err)
+	}
+}
+
+/* Exchange2Lesson converts imported lesson. Files of its steps are put into 'files' in the same order as steps. */
+func Exchange2Lesson(l Language, el *ExchangeLesson, lesson *Lesson, files *[]TaskFiles, item string, errs *ImportErrors) {
+	defer trace.End(trace.Begin(""))
+
+	nerrs := len(*errs)
+
+	lesson.Name = el.Name
+	lesson.Theory = el.Theory
+	lesson.Steps = make([]Step, len(el.Steps))
+	*files = make([]TaskFiles, len(el.Steps))
+	for i := 0; i < len(el.Steps); i++ {
+		Exchange2Step(l, &el.Steps[i], &lesson.Steps[i], &(*files)[i], ImportItem(item, l, "Step", i), errs)
+	}
+
+	/* NOTE(anton2920): step errors are more precise, so lesson is only verified if all steps are valid. */
+	if len(*errs) == nerrs {
+		if err := LessonVerify(l, lesson); err != nil {
+			errs.Add(item, err)
+		}
+	}
+}
+
+/* Exchange2Lessons converts imported document into lessons. Name of a document is the course name or the name of its only lesson. Task files of lessons must be created with 'CreateStepsTaskFilesTx' in the same transaction as lessons. */
+func Exchange2Lessons(l Language, doc *ExchangeDocument) (string, []Lesson, [][]TaskFiles, ImportErrors) {
+	defer trace.End(trace.Begin(""))
+
+	var files [][]TaskFiles
+	var lessons []Lesson
+	var errs ImportErrors
+	var name string
+
+	switch {
+	default:
+		errs.Add(Ls(l, "Document"), http.BadRequest("%s", Ls(l, "document contains neither course nor lesson")))
+	case doc.Course != nil:
+		name = doc.Course.Name
+		if len(doc.Course.Lessons) == 0 {
+			errs.Add(Ls(l, "Course"), http.BadRequest("%s", Ls(l, "create at least one lesson")))
+		}
+
+		lessons = make([]Lesson, len(doc.Course.Lessons))
+		files = make([][]TaskFiles, len(doc.Course.Lessons))
+		for i := 0; i < len(doc.Course.Lessons); i++ {
+			Exchange2Lesson(l, &doc.Course.Lessons[i], &lessons[i], &files[i], ImportItem("", l, "Lesson", i), &errs)
+		}
+	case doc.Lesson != nil:
+		name = doc.Lesson.Name
+
+		lessons = make([]Lesson, 1)
+		files = make([][]TaskFiles, 1)
+		Exchange2Lesson(l, doc.Lesson, &lessons[0], &files[0], Ls(l, "Lesson"), &errs)
+	}
+
+	return name, lessons, files, errs
+}
+
+func ExportJSON(w io.Writer, doc *ExchangeDocument) error {
+	defer trace.End(trace.Begin(""))
+
+	doc.Format = ExchangeFormatName
+	doc.Version = ExchangeFormatVersion
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(doc)
+}
+
+func ImportJSON(l Language, data []byte, doc *ExchangeDocument) ImportErrors {
+	defer trace.End(trace.Begin(""))
+
+	var errs ImportErrors
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(doc); err != nil {
+		errs.Add(Ls(l, "Document"), http.BadRequest(Ls(l, "invalid JSON: %s"), err.Error()))
+		return errs
+	}
+	if (doc.Format != ExchangeFormatName) || (doc.Version != ExchangeFormatVersion) {
+		errs.Add(Ls(l, "Document"), http.BadRequest(Ls(l, "unsupported document format %q version %d"), doc.Format, doc.Version))
+	}
+
+	return errs
+}
+
+func ExportDocument(w io.Writer, format string, doc *ExchangeDocument) error {
+	defer trace.End(trace.Begin(""))
+
+	switch format {
+	default:
+		return http.ClientError(nil)
+	case FormatJSON:
+		return ExportJSON(w, doc)
+	case FormatGIFT:
+		return ExportGIFT(w, doc)
+	case FormatQTI:
+		return ExportQTI(w, doc)
+	}
+}
+
+func ImportDocument(l Language, format string, data []byte, doc *ExchangeDocument) ImportErrors {
+	defer trace.End(trace.Begin(""))
+
+	switch format {
+	default:
+		var errs ImportErrors
+		errs.Add(Ls(l, "Document"), http.BadRequest(Ls(l, "unsupported format %q"), format))
+		return errs
+	case FormatJSON:
+		return ImportJSON(l, data, doc)
+	case FormatGIFT:
+		return ImportGIFT(l, data, doc)
+	case FormatQTI:
+		return ImportQTI(l, data, doc)
+	}
+}
+
+func ExportFormatFile(format string) (contentType string, extension string) {
+	switch format {
+	default:
+		return "application/json", ".json"
+	case FormatGIFT:
+		return "text/plain; charset=utf-8", ".txt"
+	case FormatQTI:
+		return "application/xml", ".xml"
+	}
+}
+
+func WriteExport(w *http.Response, format string, name string, id database.ID, doc *ExchangeDocument) error {
+	defer trace.End(trace.Begin(""))
+
+	var buf bytes.Buffer
+	if err := ExportDocument(&buf, format, doc); err != nil {
+		if _, ok := err.(http.Error); ok {
+			return err
+		}
+		return http.ServerError(err)
+	}
+
+	contentType, extension := ExportFormatFile(format)
+	w.Headers.Set("Content-Type", contentType)
+	w.Headers.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%d%s"`, name, id, extension))
+	w.Write(buf.Bytes())
+	return nil
+}
+
+func DisplayFormatSelect(w *http.Response, l Language, selected string) {
+	w.WriteString(`<select class="form-select" name="Format">`)
+	for i := 0; i < len(ExchangeFormats); i++ {
+		w.WriteString(`<option value="`)
+		w.WriteString(ExchangeFormats[i])
+		w.WriteString(`"`)
+		if ExchangeFormats[i] == selected {
+			w.WriteString(` selected`)
+		}
+		w.WriteString(`>`)
+		w.WriteString(ExchangeFormats[i])
+		w.WriteString(`</option>`)
+	}
+	w.WriteString(`</select>`)
+}
+
+func DisplayExportForm(w *http.Response, l Language, endpoint string, id database.ID) {
+	w.WriteString(`<form class="d-flex gap-2 mb-2" method="POST" action="`)
+	w.WriteString(endpoint)
+	w.WriteString(`">`)
+	DisplayHiddenID(w, "ID", id)
+	DisplayFormatSelect(w, l, FormatJSON)
+	DisplayButton(w, l, "", "Export")
+	w.WriteString(`</form>`)
+}
+
+func DisplayImportErrors(w *http.Response, l Language, errs ImportErrors) {
+	if len(errs) == 0 {
+		return
+	}
+
+	w.WriteString(`<ul>`)
+	for i := 0; i < len(errs); i++ {
+		var message string
+		if httpError, ok := errs[i].Err.(http.Error); ok {
+			message = httpError.DisplayErrorMessage
+		} else {
+			message = errs[i].Err.Error()
+		}
+
+		w.WriteString(`<li>`)
+		w.WriteHTMLString(errs[i].Item)
+		w.WriteString(`: `)
+		w.WriteHTMLString(message)
+		w.WriteString(`</li>`)
+	}
+	w.WriteString(`</ul>`)
+}
+
+func CourseExportHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var course Course
+	var user User
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	courseID, err := r.Form.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+
+	if err := GetUserByID(session.ID, &user); err != nil {
+		return http.ServerError(err)
+	}
+	if err := GetCourseByID(courseID, &course); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "course with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if UserCourseAccess(&user, &course) == CourseAccessNone {
+		return ForbiddenError
+	}
+
+	doc := ExchangeDocument{Course: new(ExchangeCourse)}
+	if err := Course2Exchange(&course, doc.Course); err != nil {
+		return http.ServerError(err)
+	}
+
+	return WriteExport(w, r.Form.Get("Format"), "course", course.ID, &doc)
+}
+
+func LessonExportHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var lesson Lesson
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	lessonID, err := r.Form.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if err := GetLessonByID(lessonID, &lesson); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "lesson with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+
+	switch lesson.ContainerType {
+	default:
+		panic("invalid container type")
+	case LessonContainerCourse:
+		var course Course
+		var user User
+
+		if err := GetUserByID(session.ID, &user); err != nil {
+			return http.ServerError(err)
+		}
+		if err := GetCourseByID(lesson.ContainerID, &course); err != nil {
+			return http.ServerError(err)
+		}
+		if UserCourseAccess(&user, &course) == CourseAccessNone {
+			return ForbiddenError
+		}
+	case LessonContainerSubject:
+		var subject Subject
+
+		if err := GetSubjectByID(lesson.ContainerID, &subject); err != nil {
+			return http.ServerError(err)
+		}
+		who, err := WhoIsUserInSubject(session.ID, &subject)
+		if err != nil {
+			return http.ServerError(err)
+		}
+
+		/* NOTE(anton2920): exported lessons contain correct answers, so students can't export them. */
+		if (who != SubjectUserAdmin) && (who != SubjectUserTeacher) {
+			return ForbiddenError
+		}
+	}
+
+	doc := ExchangeDocument{Lesson: new(ExchangeLesson)}
+	if err := Lesson2Exchange(&lesson, doc.Lesson); err != nil {
+		return http.ServerError(err)
+	}
+
+	return WriteExport(w, r.Form.Get("Format"), "lesson", lesson.ID, &doc)
+}
+
+func CourseImportPageHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	const width = WidthLarge
+
+	var course Course
+	var user User
+	var errs ImportErrors
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+	if err := GetUserByID(session.ID, &user); err != nil {
+		return http.ServerError(err)
+	}
+
+	/* If 'ID' is set, lessons are added to an existing course, otherwise new course is created. */
+	existing := r.Form.Get("ID") != ""
+	if existing {
+		courseID, err := r.Form.GetID("ID")
+		if err != nil {
+			return http.ClientError(err)
+		}
+		if err := GetCourseByID(courseID, &course); err != nil {
+			if err == database.NotFound {
+				return http.NotFound("%s", Ls(GL, "course with this ID does not exist"))
+			}
+			return http.ServerError(err)
+		}
+		if UserCourseAccess(&user, &course) < CourseAccessCoAuthor {
+			return ForbiddenError
+		}
+	}
+
+	format := strings.Or(r.Form.Get("Format"), FormatJSON)
+	data := r.Form.Get("Data")
+
+	if r.Form.Get("Action") == Ls(GL, "Import") {
+		var doc ExchangeDocument
+		var files [][]TaskFiles
+		var lessons []Lesson
+		var name string
+
+		if len(data) > MaxImportLen {
+			errs.Add(Ls(GL, "Document"), http.BadRequest(Ls(GL, "document is too large, maximum size is %d bytes"), MaxImportLen))
+		} else {
+			errs = ImportDocument(GL, format, []byte(data), &doc)
+		}
+		if len(errs) == 0 {
+			name, lessons, files, errs = Exchange2Lessons(GL, &doc)
+		}
+		if (!existing) && (!strings.LengthInRange(name, MinNameLen, MaxNameLen)) {
+			errs.Add(Ls(GL, "Course"), http.BadRequest(Ls(GL, "course name length must be between %d and %d characters long"), MinNameLen, MaxNameLen))
+		}
+
+		if len(errs) == 0 {
+			var tx Tx
+
+			if !existing {
+				course.Flags = CourseActive
+				course.Name = name
+				if err := CreateCourseTx(&tx, &course); err != nil {
+					return http.ServerError(err)
+				}
+
+				user.Courses = append(user.Courses, course.ID)
+				if err := SaveUserTx(&tx, &user); err != nil {
+					return http.ServerError(err)
+				}
+			}
+
+			for i := 0; i < len(lessons); i++ {
+				lesson := &lessons[i]
+
+				lesson.Flags = LessonActive
+				lesson.ContainerID = course.ID
+				lesson.ContainerType = LessonContainerCourse
+				lesson.Version = 1
+				if err := CreateStepsTaskFilesTx(&tx, lesson.Steps, files[i]); err != nil {
+					return http.ServerError(err)
+				}
+				if err := CreateLessonTx(&tx, lesson); err != nil {
+					return http.ServerError(err)
+				}
+				course.Lessons = append(course.Lessons, lesson.ID)
+			}
+
+			if err := SaveCourseTx(&tx, &course); err != nil {
+				return http.ServerError(err)
+			}
+			if err := CommitTx(&tx); err != nil {
+				return http.ServerError(err)
+			}
+
+			Audit(r, session.ID, "import", "course", course.ID, "", AuditCourseSummary(&course))
+
+			w.Redirect(w.PathID("/course/", course.ID), http.StatusSeeOther)
+			return nil
+		}
+
+		err = http.BadRequest("%s", Ls(GL, "document contains errors"))
+	}
+
+	DisplayHTMLStart(w)
+
+	DisplayHeadStart(w)
+	{
+		w.WriteString(`<title>`)
+		w.WriteString(Ls(GL, "Import"))
+		w.WriteString(`</title>`)
+	}
+	DisplayHeadEnd(w)
+
+	DisplayBodyStart(w)
+	{
+		DisplayHeader(w, GL, session)
+		DisplaySidebar(w, GL, session)
+
+		DisplayMainStart(w)
+
+		DisplayCrumbsStart(w, width)
+		{
+			DisplayCrumbsLink(w, GL, "/courses", "Courses")
+			if existing {
+				DisplayCrumbsLinkID(w, "/course", course.ID, strings.Or(course.Name, Ls(GL, "Unnamed")))
+			}
+			DisplayCrumbsItem(w, GL, "Import")
+		}
+		DisplayCrumbsEnd(w)
+
+		DisplayFormPageStart(w, r, GL, width, "Import", "/course/import", err)
+		{
+			DisplayImportErrors(w, GL, errs)
+
+			DisplayLabel(w, GL, "Format")
+			DisplayFormatSelect(w, GL, format)
+			w.WriteString(`<br>`)
+
+			DisplayLabel(w, GL, "Document")
+			DisplayConstraintTextarea(w, 1, MaxImportLen, "Data", data, true)
+			w.WriteString(`<br>`)
+
+			DisplaySubmit(w, GL, "Action", "Import", true)
+		}
+		DisplayFormPageEnd(w)
+		DisplayMainEnd(w)
+	}
+	DisplayBodyEnd(w)
+
+	DisplayHTMLEnd(w)
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/anton2920/gofa/net/http"
+)
+
+func testExchangeLesson(t *testing.T) ExchangeDocument {
+	t.Helper()
+
+	var lesson Lesson
+	if err := GetLessonByID(0, &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+
+	doc := ExchangeDocument{Lesson: new(ExchangeLesson)}
+	if err := Lesson2Exchange(&lesson, doc.Lesson); err != nil {
+		t.Fatalf("Failed to convert lesson: %v", err)
+	}
+	return doc
+}
+
+func TestExchangeFormats(t *testing.T) {
+	testCreateInitialDBs()
+
+	for _, format := range ExchangeFormats {
+		doc := testExchangeLesson(t)
+		expected := doc.Lesson.Steps[0].Questions
+
+		var buf bytes.Buffer
+		if err := ExportDocument(&buf, format, &doc); err != nil {
+			t.Fatalf("Failed to export %s: %v", format, err)
+		}
+
+		var imported ExchangeDocument
+		if errs := ImportDocument(GL, format, buf.Bytes(), &imported); len(errs) != 0 {
+			t.Fatalf("Failed to import %s: %v", format, errs)
+		}
+		_, lessons, _, errs := Exchange2Lessons(GL, &imported)
+		if (len(errs) != 0) || (len(lessons) != 1) {
+			t.Fatalf("Failed to convert %s: %v", format, errs)
+		}
+
+		/* GIFT and QTI only contain test steps. */
+		steps := imported.Lesson.Steps
+		if (format == FormatJSON) && (len(steps) != 2) {
+			t.Errorf("%s: expected 2 steps, got %d", format, len(steps))
+		} else if (format != FormatJSON) && (len(steps) != 1) {
+			t.Errorf("%s: expected 1 step, got %d", format, len(steps))
+		}
+		if (len(steps) == 0) || (steps[0].Name != "Back-end development basics") || (!reflect.DeepEqual(steps[0].Questions, expected)) {
+			t.Errorf("%s: questions differ after import:\n%+v\n%+v", format, steps, expected)
+		}
+	}
+}
+
+func TestImportGIFT(t *testing.T) {
+	const gift = `// Questions from another system.
+$CATEGORY: Course/Basics/Quiz
+
+::Q1:: What is 2+2? {
+	=4 #Right.
+	~3
+	~5
+}
+
+Pick primes {~%50%2 ~%50%3 ~%-100%4}
+
+Sky is blue {T}
+
+Match {=a -> b =c -> d}
+
+Typed answer {=yes =yep}
+
+Escaped \{braces\} {=a\=b ~c}
+`
+
+	var doc ExchangeDocument
+	errs := ImportGIFT(GL, []byte(gift), &doc)
+	if (len(errs) != 2) || (errs[0].Item != ImportItem("", GL, "Question", 3)) || (errs[1].Item != ImportItem("", GL, "Question", 4)) {
+		t.Fatalf("Expected errors for questions 4 and 5, got %v", errs)
+	}
+
+	lesson := doc.Lesson
+	if (lesson.Name != "Basics") || (len(lesson.Steps) != 1) || (lesson.Steps[0].Name != "Quiz") {
+		t.Fatalf("Unexpected lesson %+v", lesson)
+	}
+
+	expected := []ExchangeQuestion{
+		{Question: "What is 2+2?", Answers: []string{"4", "3", "5"}, CorrectAnswers: []int{0}},
+		{Question: "Pick primes", Answers: []string{"2", "3", "4"}, CorrectAnswers: []int{0, 1}},
+		{Question: "Sky is blue", Answers: []string{"True", "False"}, CorrectAnswers: []int{0}},
+		{Question: "Escaped {braces}", Answers: []string{"a=b", "c"}, CorrectAnswers: []int{0}},
+	}
+	if !reflect.DeepEqual(lesson.Steps[0].Questions, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, lesson.Steps[0].Questions)
+	}
+}
+
+func TestImportJSONErrors(t *testing.T) {
+	const data = `{"format": "sems", "version": 1, "course": {"name": "Imported", "lessons": [
+		{"name": "", "theory": "Theory", "steps": []},
+		{"name": "Lesson", "theory": "Theory", "steps": [
+			{"type": "test", "name": "Test", "questions": [{"question": "Q", "answers": ["A"], "correctAnswers": [1]}]},
+			{"type": "unknown", "name": "Unknown"}
+		]}
+	]}}`
+
+	var doc ExchangeDocument
+	if errs := ImportJSON(GL, []byte(data), &doc); len(errs) != 0 {
+		t.Fatalf("Failed to import JSON: %v", errs)
+	}
+	_, _, _, errs := Exchange2Lessons(GL, &doc)
+
+	expected := []string{
+		ImportItem("", GL, "Lesson", 0),
+		ImportItem(ImportItem(ImportItem("", GL, "Lesson", 1), GL, "Step", 0), GL, "Question", 0),
+		ImportItem(ImportItem("", GL, "Lesson", 1), GL, "Step", 1),
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v", len(expected), errs)
+	}
+	for i := 0; i < len(errs); i++ {
+		if errs[i].Item != expected[i] {
+			t.Errorf("Expected error for %q, got %q", expected[i], errs[i].Item)
+		}
+	}
+
+	if errs := ImportJSON(GL, []byte(`{"format": "other", "version": 1}`), &doc); len(errs) != 1 {
+		t.Errorf("Expected error for unknown format, got %v", errs)
+	}
+	if errs := ImportJSON(GL, []byte(`{`), &doc); len(errs) != 1 {
+		t.Errorf("Expected error for invalid JSON, got %v", errs)
+	}
+}
+
+func TestExportHandlers(t *testing.T) {
+	testCreateInitialDBs()
+
+	for _, format := range ExchangeFormats {
+		testPostAuth(t, APIPrefix+"/course/export", testTokens[AdminID], url.Values{"ID": {"0"}, "Format": {format}}, http.StatusOK)
+		testPostAuth(t, APIPrefix+"/lesson/export", testTokens[AdminID], url.Values{"ID": {"0"}, "Format": {format}}, http.StatusOK)
+	}
+	testPostAuth(t, APIPrefix+"/course/export", testTokens[AdminID], url.Values{"ID": {"0"}, "Format": {"a"}}, http.StatusBadRequest)
+	testPostAuth(t, APIPrefix+"/course/export", testTokens[AdminID], url.Values{"ID": {"a"}, "Format": {FormatJSON}}, http.StatusBadRequest)
+	testPostAuth(t, APIPrefix+"/course/export", testTokens[AdminID], url.Values{"ID": {"5"}, "Format": {FormatJSON}}, http.StatusNotFound)
+	testPostAuth(t, APIPrefix+"/course/export", testTokens[1], url.Values{"ID": {"0"}, "Format": {FormatJSON}}, http.StatusForbidden)
+	testPost(t, APIPrefix+"/course/export", url.Values{"ID": {"0"}, "Format": {FormatJSON}}, http.StatusUnauthorized)
+
+	/* Students can't export lessons with correct answers. */
+	testPostAuth(t, APIPrefix+"/lesson/export", testTokens[1], url.Values{"ID": {"2"}, "Format": {FormatJSON}}, http.StatusOK)
+	testPostAuth(t, APIPrefix+"/lesson/export", testTokens[2], url.Values{"ID": {"2"}, "Format": {FormatJSON}}, http.StatusForbidden)
+}
+
+func TestCourseImportPageHandler(t *testing.T) {
+	const endpoint = "/course/import"
+
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	doc := ExchangeDocument{Course: new(ExchangeCourse)}
+	var course Course
+	if err := GetCourseByID(0, &course); err != nil {
+		t.Fatalf("Failed to get course: %v", err)
+	}
+	if err := Course2Exchange(&course, doc.Course); err != nil {
+		t.Fatalf("Failed to export course: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := ExportJSON(&buf, &doc); err != nil {
+		t.Fatalf("Failed to export course: %v", err)
+	}
+
+	testPostAuth(t, endpoint, testTokens[1], url.Values{}, http.StatusOK)
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"Format": {FormatJSON}, "Data": {buf.String()}, "Action": {Ls(GL, "Import")}}, http.StatusSeeOther)
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"Format": {FormatJSON}, "Data": {"{}"}, "Action": {Ls(GL, "Import")}}, http.StatusBadRequest)
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"Format": {"a"}, "Data": {buf.String()}, "Action": {Ls(GL, "Import")}}, http.StatusBadRequest)
+	testPost(t, endpoint, url.Values{}, http.StatusUnauthorized)
+
+	var user User
+	if err := GetUserByID(1, &user); err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if len(user.Courses) != 2 {
+		t.Fatalf("Expected imported course to be added to user's courses, got %v", user.Courses)
+	}
+	if err := GetCourseByID(user.Courses[1], &course); err != nil {
+		t.Fatalf("Failed to get course: %v", err)
+	}
+	if (course.Name != "Programming basics") || (course.Flags != CourseActive) || (len(course.Lessons) != 1) {
+		t.Errorf("Unexpected imported course %q with %d lessons", course.Name, len(course.Lessons))
+	}
+
+	/* Questions from GIFT are added as a new lesson to an existing course. */
+	gift := "$CATEGORY: Quiz\n\nWhat is 2+2? {=4 ~5}\n"
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"1"}, "Format": {FormatGIFT}, "Data": {gift}, "Action": {Ls(GL, "Import")}}, http.StatusForbidden)
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"ID": {"0"}, "Format": {FormatGIFT}, "Data": {gift}, "Action": {Ls(GL, "Import")}}, http.StatusForbidden)
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"ID": {"1"}, "Format": {FormatGIFT}, "Data": {gift}, "Action": {Ls(GL, "Import")}}, http.StatusSeeOther)
+
+	if err := GetCourseByID(1, &course); err != nil {
+		t.Fatalf("Failed to get course: %v", err)
+	}
+	if len(course.Lessons) != 2 {
+		t.Fatalf("Expected imported lesson to be added to course, got %v", course.Lessons)
+	}
+	var lesson Lesson
+	if err := GetLessonByID(course.Lessons[1], &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	if (lesson.ContainerID != 1) || (lesson.ContainerType != LessonContainerCourse) || (lesson.Version != 1) || (len(lesson.Steps) != 1) || (lesson.Steps[0].Name != "Quiz") {
+		t.Errorf("Unexpected imported lesson %q with %d steps", lesson.Name, len(lesson.Steps))
+	}
+}
+
+func TestCourseImportTaskFiles(t *testing.T) {
+	const endpoint = "/course/import"
+	const data = `{"format": "sems", "version": 1, "course": {"name": "Imported", "lessons": [
+		{"name": "Lesson", "theory": "Theory", "steps": [
+			{"type": "programming", "name": "Sum", "description": "Print sum", "tests": [{"input": "1 2", "output": "3"}], "starterCode": "int main() {}"}
+		]},
+		{"name": "%s", "theory": "Theory", "steps": []}
+	]}}`
+
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	nextID := GetNextID(TaskFilesDB)
+
+	/* NOTE(anton2920): first lesson is valid, but nothing must be written until the whole document is. */
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"Format": {FormatJSON}, "Data": {fmt.Sprintf(data, "")}, "Action": {Ls(GL, "Import")}}, http.StatusBadRequest)
+	if id := GetNextID(TaskFilesDB); id != nextID {
+		t.Fatalf("Expected failed import not to create task files, next ID changed from %d to %d", nextID, id)
+	}
+
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"Format": {FormatJSON}, "Data": {fmt.Sprintf(data, "Lesson")}, "Action": {Ls(GL, "Import")}}, http.StatusSeeOther)
+
+	var user User
+	if err := GetUserByID(1, &user); err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	var course Course
+	if err := GetCourseByID(user.Courses[len(user.Courses)-1], &course); err != nil {
+		t.Fatalf("Failed to get course: %v", err)
+	}
+	var lesson Lesson
+	if err := GetLessonByID(course.Lessons[0], &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	task, err := Step2Programming(&lesson.Steps[0])
+	if err != nil {
+		t.Fatalf("Expected programming step, got %v", err)
+	}
+	var files TaskFiles
+	if err := GetStepTaskFiles(task, &files); err != nil {
+		t.Fatalf("Failed to get task files: %v", err)
+	}
+	if files.StarterCode != "int main() {}" {
+		t.Errorf("Expected imported starter code, got %q", files.StarterCode)
+	}
+}
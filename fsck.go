@@ -0,0 +1,460 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* FsckReport collects problems found by 'FsckDBs'. */
+type FsckReport struct {
+	W        io.Writer
+	Problems int
+	Repaired int
+}
+
+func (r *FsckReport) Problemf(format string, args ...interface{}) {
+	r.Problems++
+	fmt.Fprintf(r.W, format+"\n", args...)
+}
+
+func FsckGet[T any](id database.ID, record *T, get func(database.ID, *T) error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+
+	return get(id, record)
+}
+
+/* FsckLoad reads every record of a DB. Records, which cannot be decoded, are reported as broken and not marked as valid. Gaps left by IDs of failed transactions are neither. */
+func FsckLoad[T any](report *FsckReport, db *database.DB, name string, get func(database.ID, *T) error, getID func(*T) database.ID) ([]T, []bool, []bool) {
+	defer trace.End(trace.Begin(""))
+
+	n := GetNextID(db)
+	records := make([]T, n)
+	valid := make([]bool, n)
+	broken := make([]bool, n)
+
+	for id := database.ID(0); id < n; id++ {
+		err := FsckGet(id, &records[id], get)
+		if recordID := getID(&records[id]); recordID != id {
+			if recordID != 0 {
+				report.Problemf("%s %d: has ID %d", name, id, recordID)
+				broken[id] = true
+			}
+			continue
+		}
+		if err != nil {
+			report.Problemf("%s %d: cannot be decoded: %v", name, id, err)
+			broken[id] = true
+			continue
+		}
+		valid[id] = true
+	}
+
+	return records, valid, broken
+}
+
+/* FsckLive returns which records are valid and not deleted. References to deleted records are as dangling as references to missing ones. */
+func FsckLive[T any](records []T, valid []bool, deleted func(*T) bool) []bool {
+	live := make([]bool, len(records))
+	for i := 0; i < len(records); i++ {
+		live[i] = (valid[i]) && (!deleted(&records[i]))
+	}
+	return live
+}
+
+func FsckIDValid(valid []bool, id database.ID) bool {
+	return (id >= 0) && (int(id) < len(valid)) && (valid[id])
+}
+
+/* FsckRemoveIDs removes IDs for which 'keep' returns false and reports each of them. Returns true if anything was removed. */
+func FsckRemoveIDs(report *FsckReport, ids *[]database.ID, keep func(database.ID) bool, format string, args ...interface{}) bool {
+	var removed bool
+
+	for i := 0; i < len(*ids); i++ {
+		if !keep((*ids)[i]) {
+			report.Problemf(format, append(args, (*ids)[i])...)
+			*ids = RemoveAt(*ids, i)
+			removed = true
+			i--
+		}
+	}
+
+	return removed
+}
+
+/* FsckDBs walks all DBs and reports undecodable records, dangling IDs including task files of programming steps, orphaned lessons, submissions, announcements, notifications, messages and task files and duplicate emails. If 'repair' is set, everything except duplicate emails and invalid subject and question owners is fixed in a single transaction and unused blobs are reclaimed. */
+func FsckDBs(w io.Writer, repair bool) (FsckReport, error) {
+	defer trace.End(trace.Begin(""))
+
+	report := FsckReport{W: w}
+	var tx Tx
+
+	users, usersValid, usersBroken := FsckLoad(&report, UsersDB, "user", GetUserByID, func(u *User) database.ID { return u.ID })
+	groups, groupsValid, groupsBroken := FsckLoad(&report, GroupsDB, "group", GetGroupByID, func(g *Group) database.ID { return g.ID })
+	courses, coursesValid, coursesBroken := FsckLoad(&report, CoursesDB, "course", GetCourseByID, func(c *Course) database.ID { return c.ID })
+	lessons, lessonsValid, lessonsBroken := FsckLoad(&report, LessonsDB, "lesson", GetLessonByID, func(l *Lesson) database.ID { return l.ID })
+	subjects, subjectsValid, subjectsBroken := FsckLoad(&report, SubjectsDB, "subject", GetSubjectByID, func(s *Subject) database.ID { return s.ID })
+	submissions, submissionsValid, submissionsBroken := FsckLoad(&report, SubmissionsDB, "submission", GetSubmissionByID, func(s *Submission) database.ID { return s.ID })
+	questions, questionsValid, questionsBroken := FsckLoad(&report, QuestionsDB, "question", GetBankQuestionByID, func(bq *BankQuestion) database.ID { return bq.ID })
+	announcements, announcementsValid, announcementsBroken := FsckLoad(&report, AnnouncementsDB, "announcement", GetAnnouncementByID, func(a *Announcement) database.ID { return a.ID })
+	notifications, notificationsValid, notificationsBroken := FsckLoad(&report, NotificationsDB, "notification", GetNotificationByID, func(n *Notification) database.ID { return n.ID })
+	messages, messagesValid, messagesBroken := FsckLoad(&report, MessagesDB, "message", GetMessageByID, func(m *Message) database.ID { return m.ID })
+	taskFiles, taskFilesValid, taskFilesBroken := FsckLoad(&report, TaskFilesDB, "task files", GetTaskFilesByID, func(f *TaskFiles) database.ID { return f.ID })
+
+	usersLive := FsckLive(users, usersValid, func(u *User) bool { return u.Flags == UserDeleted })
+	groupsLive := FsckLive(groups, groupsValid, func(g *Group) bool { return g.Flags == GroupDeleted })
+	coursesLive := FsckLive(courses, coursesValid, func(c *Course) bool { return c.Flags == CourseDeleted })
+	lessonsLive := FsckLive(lessons, lessonsValid, func(l *Lesson) bool { return l.Flags == LessonDeleted })
+	subjectsLive := FsckLive(subjects, subjectsValid, func(s *Subject) bool { return s.Flags == SubjectDeleted })
+	submissionsLive := FsckLive(submissions, submissionsValid, func(s *Submission) bool { return s.Flags == SubmissionDeleted })
+	questionsLive := FsckLive(questions, questionsValid, func(bq *BankQuestion) bool { return bq.Flags == BankQuestionDeleted })
+	taskFilesLive := FsckLive(taskFiles, taskFilesValid, func(f *TaskFiles) bool { return f.Flags == TaskFilesDeleted })
+
+	if repair {
+		deletes := [...]struct {
+			Broken []bool
+			Delete func(*Tx, database.ID) error
+		}{
+			{usersBroken, DeleteUserByIDTx},
+			{groupsBroken, DeleteGroupByIDTx},
+			{coursesBroken, DeleteCourseByIDTx},
+			{lessonsBroken, DeleteLessonByIDTx},
+			{subjectsBroken, DeleteSubjectByIDTx},
+			{submissionsBroken, DeleteSubmissionByIDTx},
+			{questionsBroken, DeleteBankQuestionByIDTx},
+			{announcementsBroken, DeleteAnnouncementByIDTx},
+			{notificationsBroken, DeleteNotificationByIDTx},
+			{messagesBroken, DeleteMessageByIDTx},
+			{taskFilesBroken, DeleteTaskFilesByIDTx},
+		}
+		for i := 0; i < len(deletes); i++ {
+			for id := 0; id < len(deletes[i].Broken); id++ {
+				if deletes[i].Broken[id] {
+					if err := deletes[i].Delete(&tx, database.ID(id)); err != nil {
+						return report, err
+					}
+					report.Repaired++
+				}
+			}
+		}
+	}
+
+	emails := make(map[string]database.ID)
+	for i := 0; i < len(users); i++ {
+		user := &users[i]
+		if (!usersValid[i]) || (user.Flags == UserDeleted) {
+			continue
+		}
+
+		if id, ok := emails[user.Email]; ok {
+			report.Problemf("user %d: has the same email %q as user %d", user.ID, user.Email, id)
+		} else {
+			emails[user.Email] = user.ID
+		}
+
+		if FsckRemoveIDs(&report, &user.Courses, func(id database.ID) bool { return FsckIDValid(coursesLive, id) }, "user %d: dangling course %d", user.ID) && (repair) {
+			if err := SaveUserTx(&tx, user); err != nil {
+				return report, err
+			}
+			report.Repaired++
+		}
+	}
+
+	for i := 0; i < len(groups); i++ {
+		group := &groups[i]
+		if (!groupsValid[i]) || (group.Flags == GroupDeleted) {
+			continue
+		}
+
+		if FsckRemoveIDs(&report, &group.Students, func(id database.ID) bool { return FsckIDValid(usersLive, id) }, "group %d: dangling student %d", group.ID) && (repair) {
+			if err := SaveGroupTx(&tx, group); err != nil {
+				return report, err
+			}
+			report.Repaired++
+		}
+	}
+
+	/* listed[i] is true if lesson 'i' is referenced by its container. */
+	listed := make([]bool, len(lessons))
+	lessonInContainer := func(containerID database.ID, containerType LessonContainerType) func(database.ID) bool {
+		return func(id database.ID) bool {
+			if (!FsckIDValid(lessonsLive, id)) || (lessons[id].ContainerID != containerID) || (lessons[id].ContainerType != containerType) {
+				return false
+			}
+			listed[id] = true
+			return true
+		}
+	}
+
+	for i := 0; i < len(courses); i++ {
+		course := &courses[i]
+		if (!coursesValid[i]) || (course.Flags == CourseDeleted) {
+			continue
+		}
+
+		removed := FsckRemoveIDs(&report, &course.Lessons, lessonInContainer(course.ID, LessonContainerCourse), "course %d: dangling lesson %d", course.ID)
+		if FsckRemoveIDs(&report, &course.CoAuthors, func(id database.ID) bool { return FsckIDValid(usersLive, id) }, "course %d: dangling co-author %d", course.ID) {
+			removed = true
+		}
+		if FsckRemoveIDs(&report, &course.Viewers, func(id database.ID) bool { return FsckIDValid(usersLive, id) }, "course %d: dangling viewer %d", course.ID) {
+			removed = true
+		}
+		if (removed) && (repair) {
+			if err := SaveCourseTx(&tx, course); err != nil {
+				return report, err
+			}
+			report.Repaired++
+		}
+	}
+
+	for i := 0; i < len(subjects); i++ {
+		subject := &subjects[i]
+		if (!subjectsValid[i]) || (subject.Flags == SubjectDeleted) {
+			continue
+		}
+
+		if !FsckIDValid(groupsLive, subject.GroupID) {
+			report.Problemf("subject %d: dangling group %d", subject.ID, subject.GroupID)
+		}
+		if !FsckIDValid(usersLive, subject.TeacherID) {
+			report.Problemf("subject %d: dangling teacher %d", subject.ID, subject.TeacherID)
+		}
+
+		if FsckRemoveIDs(&report, &subject.Lessons, lessonInContainer(subject.ID, LessonContainerSubject), "subject %d: dangling lesson %d", subject.ID) && (repair) {
+			if err := SaveSubjectTx(&tx, subject); err != nil {
+				return report, err
+			}
+			report.Repaired++
+		}
+	}
+
+	/* saveLessons[i] is true if lesson 'i' must be saved after repair. */
+	saveLessons := make([]bool, len(lessons))
+
+	for i := 0; i < len(lessons); i++ {
+		lesson := &lessons[i]
+		if (!lessonsValid[i]) || (lesson.Flags == LessonDeleted) {
+			continue
+		}
+
+		var containerDeleted bool
+		switch lesson.ContainerType {
+		case LessonContainerCourse:
+			containerDeleted = (FsckIDValid(coursesValid, lesson.ContainerID)) && (courses[lesson.ContainerID].Flags == CourseDeleted)
+		case LessonContainerSubject:
+			containerDeleted = (FsckIDValid(subjectsValid, lesson.ContainerID)) && (subjects[lesson.ContainerID].Flags == SubjectDeleted)
+		}
+		if (!listed[i]) && (!containerDeleted) {
+			report.Problemf("lesson %d: orphaned, not referenced by its container %d", lesson.ID, lesson.ContainerID)
+
+			/* NOTE(anton2920): lesson is deleted, so its submissions, messages and task files are orphaned too. */
+			lessonsLive[i] = false
+			if repair {
+				if err := DeleteLessonByIDTx(&tx, lesson.ID); err != nil {
+					return report, err
+				}
+				report.Repaired++
+			}
+			continue
+		}
+
+		if FsckRemoveIDs(&report, &lesson.Submissions, func(id database.ID) bool {
+			return (FsckIDValid(submissionsLive, id)) && (submissions[id].LessonID == lesson.ID)
+		}, "lesson %d: dangling submission %d", lesson.ID) {
+			saveLessons[i] = true
+		}
+
+		for j := 0; j < len(lesson.Steps); j++ {
+			if task, err := Step2Programming(&lesson.Steps[j]); (err == nil) && (task.Files != 0) {
+				if !FsckIDValid(taskFilesLive, task.Files) {
+					report.Problemf("lesson %d: step %d: dangling task files %d", lesson.ID, j, task.Files)
+					task.Files = 0
+					saveLessons[i] = true
+				}
+				continue
+			}
+
+			test, err := Step2Test(&lesson.Steps[j])
+			if (err != nil) || (len(test.Sources) == 0) {
+				continue
+			}
+
+			if len(test.Sources) != len(test.Questions) {
+				report.Problemf("lesson %d: step %d: has %d question sources for %d questions", lesson.ID, j, len(test.Sources), len(test.Questions))
+				LessonTestFitSources(test)
+				saveLessons[i] = true
+			}
+			for k := 0; k < len(test.Sources); k++ {
+				source := &test.Sources[k]
+				if (source.Version != 0) && (!FsckIDValid(questionsLive, source.ID)) {
+					report.Problemf("lesson %d: step %d: question %d: dangling bank question %d", lesson.ID, j, k, source.ID)
+					*source = QuestionSource{}
+					saveLessons[i] = true
+				}
+			}
+		}
+	}
+
+	for i := 0; i < len(submissions); i++ {
+		submission := &submissions[i]
+		if (!submissionsValid[i]) || (submission.Flags == SubmissionDeleted) {
+			continue
+		}
+
+		if !FsckIDValid(usersLive, submission.UserID) {
+			report.Problemf("submission %d: dangling user %d", submission.ID, submission.UserID)
+		}
+
+		if !FsckIDValid(lessonsLive, submission.LessonID) {
+			report.Problemf("submission %d: orphaned, dangling lesson %d", submission.ID, submission.LessonID)
+			if repair {
+				if err := DeleteSubmissionByIDTx(&tx, submission.ID); err != nil {
+					return report, err
+				}
+				report.Repaired++
+			}
+			continue
+		}
+
+		lesson := &lessons[submission.LessonID]
+		var found bool
+		for j := 0; j < len(lesson.Submissions); j++ {
+			if lesson.Submissions[j] == submission.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report.Problemf("submission %d: not referenced by lesson %d", submission.ID, lesson.ID)
+			lesson.Submissions = append(lesson.Submissions, submission.ID)
+			saveLessons[lesson.ID] = true
+		}
+	}
+
+	for i := 0; i < len(questions); i++ {
+		question := &questions[i]
+		if (!questionsValid[i]) || (question.Flags == BankQuestionDeleted) {
+			continue
+		}
+
+		if !FsckIDValid(usersLive, question.OwnerID) {
+			report.Problemf("question %d: dangling owner %d", question.ID, question.OwnerID)
+		}
+	}
+
+	for i := 0; i < len(announcements); i++ {
+		announcement := &announcements[i]
+		if (!announcementsValid[i]) || (announcement.Flags == AnnouncementDeleted) {
+			continue
+		}
+
+		if !FsckIDValid(subjectsLive, announcement.SubjectID) {
+			report.Problemf("announcement %d: orphaned, dangling subject %d", announcement.ID, announcement.SubjectID)
+			if repair {
+				if err := DeleteAnnouncementByIDTx(&tx, announcement.ID); err != nil {
+					return report, err
+				}
+				report.Repaired++
+			}
+		}
+	}
+
+	for i := 0; i < len(notifications); i++ {
+		notification := &notifications[i]
+		if (!notificationsValid[i]) || (notification.Flags == NotificationDeleted) {
+			continue
+		}
+
+		if !FsckIDValid(usersLive, notification.UserID) {
+			report.Problemf("notification %d: orphaned, dangling user %d", notification.ID, notification.UserID)
+			if repair {
+				if err := DeleteNotificationByIDTx(&tx, notification.ID); err != nil {
+					return report, err
+				}
+				report.Repaired++
+			}
+		}
+	}
+
+	for i := 0; i < len(messages); i++ {
+		message := &messages[i]
+		if (!messagesValid[i]) || (message.Flags == MessageDeleted) {
+			continue
+		}
+
+		if !FsckIDValid(lessonsLive, message.LessonID) {
+			report.Problemf("message %d: orphaned, dangling lesson %d", message.ID, message.LessonID)
+			if repair {
+				if err := DeleteMessageByIDTx(&tx, message.ID); err != nil {
+					return report, err
+				}
+				report.Repaired++
+			}
+		}
+	}
+
+	/* NOTE(anton2920): task files are never changed, so editing programming step creates new record and the old one is only reclaimed here. Steps copied into submissions keep referring to it too. */
+	referenced := make([]bool, len(taskFiles))
+	referenceFiles := func(step *Step) {
+		if task, err := Step2Programming(step); (err == nil) && (FsckIDValid(taskFilesLive, task.Files)) {
+			referenced[task.Files] = true
+		}
+	}
+	for i := 0; i < len(lessons); i++ {
+		if lessonsLive[i] {
+			for j := 0; j < len(lessons[i].Steps); j++ {
+				referenceFiles(&lessons[i].Steps[j])
+			}
+		}
+	}
+	for i := 0; i < len(submissions); i++ {
+		if submissionsLive[i] {
+			for j := 0; j < len(submissions[i].SubmittedSteps); j++ {
+				referenceFiles(&submissions[i].SubmittedSteps[j].Step)
+			}
+		}
+	}
+
+	for i := 0; i < len(taskFiles); i++ {
+		if (taskFilesLive[i]) && (!referenced[i]) {
+			report.Problemf("task files %d: orphaned, not referenced by any step", i)
+			if repair {
+				if err := DeleteTaskFilesByIDTx(&tx, database.ID(i)); err != nil {
+					return report, err
+				}
+				report.Repaired++
+			}
+		}
+	}
+
+	if repair {
+		for i := 0; i < len(lessons); i++ {
+			if saveLessons[i] {
+				if err := SaveLessonTx(&tx, &lessons[i]); err != nil {
+					return report, err
+				}
+				report.Repaired++
+			}
+		}
+
+		if err := CommitTx(&tx); err != nil {
+			return report, fmt.Errorf("failed to commit repairs: %w", err)
+		}
+
+		reclaimed, err := CompactBlobs()
+		if err != nil {
+			return report, fmt.Errorf("failed to compact blobs: %w", err)
+		}
+		if reclaimed > 0 {
+			fmt.Fprintf(w, "Reclaimed %d bytes of unused blobs\n", reclaimed)
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anton2920/gofa/net/http"
+)
+
+func testFsck(t *testing.T, repair bool, expectedProblems int) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	report, err := FsckDBs(&buf, repair)
+	if err != nil {
+		t.Fatalf("Failed to check DBs: %v", err)
+	}
+	if report.Problems != expectedProblems {
+		t.Errorf("Expected %d problems, got %d:\n%s", expectedProblems, report.Problems, buf.String())
+	}
+}
+
+func TestFsckDBs(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	testFsck(t, false, 0)
+
+	var group Group
+	if err := GetGroupByID(0, &group); err != nil {
+		t.Fatalf("Failed to get group: %v", err)
+	}
+	group.Students = append(group.Students, 100)
+	if err := SaveGroup(&group); err != nil {
+		t.Fatalf("Failed to save group: %v", err)
+	}
+
+	/* Submission, which was not added to its lesson. */
+	submission := Submission{LessonID: 2, UserID: 3}
+	if err := CreateSubmission(&submission); err != nil {
+		t.Fatalf("Failed to create submission: %v", err)
+	}
+
+	user := User{FirstName: "Copy", LastName: "Student", Email: "student@masters.com", Password: "student"}
+	if err := CreateUser(&user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	/* Test question linked to a bank question, which does not exist. */
+	var lesson Lesson
+	if err := GetLessonByID(0, &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	test, _ := Step2Test(&lesson.Steps[0])
+	test.Sources = make([]QuestionSource, len(test.Questions))
+	test.Sources[0] = QuestionSource{ID: 100, Version: 1}
+	if err := SaveLesson(&lesson); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+
+	testFsck(t, false, 4)
+	testFsck(t, true, 4)
+
+	/* Duplicate emails are not repaired automatically. */
+	testFsck(t, false, 1)
+
+	if err := GetLessonByID(0, &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	if test, _ := Step2Test(&lesson.Steps[0]); test.Sources[0] != (QuestionSource{}) {
+		t.Errorf("Expected dangling question source to be unlinked, got %v", test.Sources[0])
+	}
+
+	if err := GetLessonByID(2, &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	if (len(lesson.Submissions) != 2) || (lesson.Submissions[1] != submission.ID) {
+		t.Errorf("Expected submission %d to be added to lesson, got %v", submission.ID, lesson.Submissions)
+	}
+}
+
+func TestFsckDeletedReferences(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	/* NOTE(anton2920): records are deleted without updating records, which reference them. */
+	if err := DeleteUserByID(3); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	var tx Tx
+	if err := DeleteSubmissionByIDTx(&tx, 0); err != nil {
+		t.Fatalf("Failed to delete submission: %v", err)
+	}
+	if err := CommitTx(&tx); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	testFsck(t, false, 2)
+	testFsck(t, true, 2)
+	testFsck(t, false, 0)
+
+	var group Group
+	if err := GetGroupByID(0, &group); err != nil {
+		t.Fatalf("Failed to get group: %v", err)
+	}
+	if (len(group.Students) != 1) || (group.Students[0] != 2) {
+		t.Errorf("Expected deleted student to be removed from group, got %v", group.Students)
+	}
+
+	var lesson Lesson
+	if err := GetLessonByID(2, &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	if len(lesson.Submissions) != 0 {
+		t.Errorf("Expected deleted submission to be removed from lesson, got %v", lesson.Submissions)
+	}
+}
+
+func TestBackupRestoreDBs(t *testing.T) {
+	testCreateInitialDBs()
+
+	var buf bytes.Buffer
+	if err := BackupDBs(&buf); err != nil {
+		t.Fatalf("Failed to backup DBs: %v", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "db")
+	if _, err := RestoreDBs(dir, &buf); err != nil {
+		t.Fatalf("Failed to restore DBs: %v", err)
+	}
+
+	for i := 0; i < len(BackupFiles); i++ {
+		expected, err := os.ReadFile(GetPath(DBDirectory, BackupFiles[i]))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", BackupFiles[i], err)
+		}
+		restored, err := os.ReadFile(GetPath(dir, BackupFiles[i]))
+		if err != nil {
+			t.Fatalf("Failed to read restored %s: %v", BackupFiles[i], err)
+		}
+		if !bytes.Equal(expected, restored) {
+			t.Errorf("Restored %s differs from original", BackupFiles[i])
+		}
+	}
+
+	if _, err := RestoreDBs(dir, bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Errorf("Expected error for invalid archive")
+	}
+	if _, err := RestoreDBs(dir, io.LimitReader(&buf, 0)); err == nil {
+		t.Errorf("Expected error for empty archive")
+	}
+}
+
+func TestBackupHandler(t *testing.T) {
+	const endpoint = APIPrefix + "/backup"
+
+	testGetAuth(t, endpoint, testTokens[AdminID], http.StatusOK)
+	testGetAuth(t, endpoint, testTokens[1], http.StatusForbidden)
+	testGet(t, endpoint, http.StatusUnauthorized)
+
+	archives, err := filepath.Glob(DBDirectory + ".backup-*.tar.gz")
+	if err != nil {
+		t.Fatalf("Failed to find backups: %v", err)
+	}
+	if len(archives) != 1 {
+		t.Errorf("Expected one backup to be written, got %v", archives)
+	}
+	for i := 0; i < len(archives); i++ {
+		os.Remove(archives[i])
+	}
+}
+
+func TestFsckOrphanedTaskFiles(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	var lesson Lesson
+	if err := GetLessonByID(0, &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	task, err := Step2Programming(&lesson.Steps[1])
+	if err != nil {
+		t.Fatalf("Expected programming step, got %v", err)
+	}
+
+	/* NOTE(anton2920): every edit of files creates new record, so the first one is no longer referenced. */
+	for _, starterCode := range [...]string{"int main() {}", "int main(void) {}"} {
+		files := TaskFiles{StarterCode: starterCode}
+		if err := SaveStepTaskFiles(task, &files); err != nil {
+			t.Fatalf("Failed to save task files: %v", err)
+		}
+		if err := SaveLesson(&lesson); err != nil {
+			t.Fatalf("Failed to save lesson: %v", err)
+		}
+	}
+
+	testFsck(t, false, 1)
+	testFsck(t, true, 1)
+	testFsck(t, false, 0)
+
+	var files TaskFiles
+	if err := GetStepTaskFiles(task, &files); (err != nil) || (files.Flags == TaskFilesDeleted) || (files.StarterCode != "int main(void) {}") {
+		t.Errorf("Expected referenced task files to be kept, got %+v, %v", files, err)
+	}
+}
+
+func TestFsckOrphanedLessonSubmissions(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	/* NOTE(anton2920): subject lesson with submission is replaced, but not deleted. */
+	var subject Subject
+	if err := GetSubjectByID(1, &subject); err != nil {
+		t.Fatalf("Failed to get subject: %v", err)
+	}
+	subject.Lessons = RemoveAt(subject.Lessons, 0)
+	if err := SaveSubject(&subject); err != nil {
+		t.Fatalf("Failed to save subject: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := FsckDBs(&buf, true); err != nil {
+		t.Fatalf("Failed to repair DBs: %v", err)
+	}
+	testFsck(t, false, 0)
+
+	var submission Submission
+	if err := GetSubmissionByID(0, &submission); (err != nil) || (submission.Flags != SubmissionDeleted) {
+		t.Errorf("Expected submission of orphaned lesson to be deleted, got flags %d, %v", submission.Flags, err)
+	}
+}
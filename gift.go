@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	stdstrings "strings"
+
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* GIFT is a Moodle's plain text format for questions. Only multiple choice and true/false questions can be represented in SEMS. */
+
+const GIFTSpecialChars = "~=#{}:"
+
+func GIFTEscape(s string) string {
+	var buf stdstrings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\n':
+			buf.WriteString(`\n`)
+			continue
+		case '\\':
+			buf.WriteByte('\\')
+		default:
+			if stdstrings.IndexByte(GIFTSpecialChars, s[i]) >= 0 {
+				buf.WriteByte('\\')
+			}
+		}
+		buf.WriteByte(s[i])
+	}
+
+	return buf.String()
+}
+
+func GIFTUnescape(s string) string {
+	var buf stdstrings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if (s[i] == '\\') && (i+1 < len(s)) {
+			i++
+			if s[i] == 'n' {
+				buf.WriteByte('\n')
+			} else {
+				buf.WriteByte(s[i])
+			}
+			continue
+		}
+		buf.WriteByte(s[i])
+	}
+
+	return stdstrings.TrimSpace(buf.String())
+}
+
+/* GIFTFindUnescaped returns index of the first unescaped character from 'chars' in 's', or -1. */
+func GIFTFindUnescaped(s string, chars string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if stdstrings.IndexByte(chars, s[i]) >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+func ExportGIFTStep(w io.Writer, category string, es *ExchangeStep) error {
+	if es.Type != ExchangeStepTest {
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(w, "$CATEGORY: %s\n\n", category); err != nil {
+		return err
+	}
+
+	for i := 0; i < len(es.Questions); i++ {
+		question := &es.Questions[i]
+
+		if _, err := fmt.Fprintf(w, "%s {\n", GIFTEscape(question.Question)); err != nil {
+			return err
+		}
+		for j := 0; j < len(question.Answers); j++ {
+			var correct bool
+			for k := 0; k < len(question.CorrectAnswers); k++ {
+				if question.CorrectAnswers[k] == j {
+					correct = true
+					break
+				}
+			}
+
+			var prefix string
+			switch {
+			case (correct) && (len(question.CorrectAnswers) == 1):
+				prefix = "="
+			case correct:
+				prefix = "~%" + strconv.FormatFloat(100/float64(len(question.CorrectAnswers)), 'f', -1, 64) + "%"
+			case len(question.CorrectAnswers) == 1:
+				prefix = "~"
+			default:
+				prefix = "~%-100%"
+			}
+			if _, err := fmt.Fprintf(w, "\t%s%s\n", prefix, GIFTEscape(question.Answers[j])); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "}\n\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/* ExportGIFT writes test steps of a document. Every step is put into its own category. */
+func ExportGIFT(w io.Writer, doc *ExchangeDocument) error {
+	defer trace.End(trace.Begin(""))
+
+	var lessons []ExchangeLesson
+	var prefix string
+
+	if doc.Course != nil {
+		lessons = doc.Course.Lessons
+		prefix = GIFTCategoryName(doc.Course.Name) + "/"
+	} else if doc.Lesson != nil {
+		lessons = []ExchangeLesson{*doc.Lesson}
+	}
+
+	for i := 0; i < len(lessons); i++ {
+		lesson := &lessons[i]
+		for j := 0; j < len(lesson.Steps); j++ {
+			if err := ExportGIFTStep(w, prefix+GIFTCategoryName(lesson.Name)+"/"+GIFTCategoryName(lesson.Steps[j].Name), &lesson.Steps[j]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/* GIFTCategoryName replaces characters, which have special meaning in category paths. */
+func GIFTCategoryName(s string) string {
+	return stdstrings.NewReplacer("/", "-", "\n", " ").Replace(s)
+}
+
+/* ParseGIFTAnswers parses contents of '{...}' into a question. */
+func ParseGIFTAnswers(l Language, s string, question *ExchangeQuestion) error {
+	s = stdstrings.TrimSpace(s)
+
+	switch s {
+	case "T", "TRUE":
+		question.Answers = []string{"True", "False"}
+		question.CorrectAnswers = []int{0}
+		return nil
+	case "F", "FALSE":
+		question.Answers = []string{"True", "False"}
+		question.CorrectAnswers = []int{1}
+		return nil
+	}
+	if (len(s) == 0) || (s[0] == '#') {
+		return http.BadRequest("%s", Ls(l, "only multiple choice and true/false questions are supported"))
+	}
+
+	var wrong int
+	for len(s) > 0 {
+		if (s[0] != '=') && (s[0] != '~') {
+			return http.BadRequest("%s", Ls(l, "answer must start with '=' or '~'"))
+		}
+		correct := s[0] == '='
+
+		end := GIFTFindUnescaped(s[1:], "=~")
+		if end == -1 {
+			end = len(s)
+		} else {
+			end++
+		}
+		answer := s[1:end]
+		s = stdstrings.TrimSpace(s[end:])
+
+		if feedback := GIFTFindUnescaped(answer, "#"); feedback != -1 {
+			answer = answer[:feedback]
+		}
+		if stdstrings.Contains(answer, "->") {
+			return http.BadRequest("%s", Ls(l, "only multiple choice and true/false questions are supported"))
+		}
+		if (len(answer) > 0) && (answer[0] == '%') {
+			end := stdstrings.IndexByte(answer[1:], '%')
+			if end == -1 {
+				return http.BadRequest("%s", Ls(l, "invalid answer weight"))
+			}
+			weight, err := strconv.ParseFloat(answer[1:end+1], 64)
+			if err != nil {
+				return http.BadRequest("%s", Ls(l, "invalid answer weight"))
+			}
+			correct = weight > 0
+			answer = answer[end+2:]
+		}
+
+		if correct {
+			question.CorrectAnswers = append(question.CorrectAnswers, len(question.Answers))
+		} else {
+			wrong++
+		}
+		question.Answers = append(question.Answers, GIFTUnescape(answer))
+	}
+
+	/* NOTE(anton2920): answers without wrong ones are short answers, where student must type one of them. */
+	if wrong == 0 {
+		return http.BadRequest("%s", Ls(l, "only multiple choice and true/false questions are supported"))
+	}
+
+	return nil
+}
+
+/* ParseGIFTQuestion parses single question, which is a text block without blank lines. */
+func ParseGIFTQuestion(l Language, s string, question *ExchangeQuestion) error {
+	start := GIFTFindUnescaped(s, "{")
+	if start == -1 {
+		return http.BadRequest("%s", Ls(l, "question has no answers"))
+	}
+	end := GIFTFindUnescaped(s[start:], "}")
+	if end == -1 {
+		return http.BadRequest("%s", Ls(l, "question has no closing '}'"))
+	}
+	end += start
+
+	text := stdstrings.TrimSpace(s[:start])
+	if after := stdstrings.TrimSpace(s[end+1:]); len(after) > 0 {
+		/* Missing word format: answers are in the middle of a question. */
+		text += " _____ " + after
+	}
+
+	var title string
+	if stdstrings.HasPrefix(text, "::") {
+		if n := stdstrings.Index(text[2:], "::"); n != -1 {
+			title = GIFTUnescape(text[2 : n+2])
+			text = stdstrings.TrimSpace(text[n+4:])
+		}
+	}
+	if (len(text) > 0) && (text[0] == '[') {
+		if n := stdstrings.IndexByte(text, ']'); n != -1 {
+			text = text[n+1:]
+		}
+	}
+
+	question.Question = GIFTUnescape(text)
+	if len(question.Question) == 0 {
+		question.Question = title
+	}
+
+	return ParseGIFTAnswers(l, s[start+1:end], question)
+}
+
+/* ImportGIFT puts questions of every category into its own test step of a single lesson. */
+func ImportGIFT(l Language, data []byte, doc *ExchangeDocument) ImportErrors {
+	defer trace.End(trace.Begin(""))
+
+	var block stdstrings.Builder
+	var errs ImportErrors
+	var nquestions int
+
+	lesson := &ExchangeLesson{Name: Ls(l, "Imported questions"), Theory: fmt.Sprintf(Ls(l, "Imported from %s."), FormatGIFT)}
+	doc.Lesson = lesson
+
+	step := func(name string) *ExchangeStep {
+		if (len(lesson.Steps) == 0) || (len(lesson.Steps[len(lesson.Steps)-1].Questions) > 0) {
+			lesson.Steps = append(lesson.Steps, ExchangeStep{Type: ExchangeStepTest})
+		}
+		s := &lesson.Steps[len(lesson.Steps)-1]
+		s.Name = name
+		return s
+	}
+	flush := func() {
+		text := stdstrings.TrimSpace(block.String())
+		block.Reset()
+		if len(text) == 0 {
+			return
+		}
+
+		var question ExchangeQuestion
+		if err := ParseGIFTQuestion(l, text, &question); err != nil {
+			errs.Add(ImportItem("", l, "Question", nquestions), err)
+		} else {
+			var s *ExchangeStep
+			if len(lesson.Steps) == 0 {
+				s = step(Ls(l, "Test"))
+			} else {
+				s = &lesson.Steps[len(lesson.Steps)-1]
+			}
+			s.Questions = append(s.Questions, question)
+		}
+		nquestions++
+	}
+
+	scanner := bufio.NewScanner(stdstrings.NewReader(string(data)))
+	scanner.Buffer(make([]byte, 4096), MaxImportLen)
+	for scanner.Scan() {
+		line := stdstrings.TrimSpace(scanner.Text())
+
+		switch {
+		case len(line) == 0:
+			flush()
+		case stdstrings.HasPrefix(line, "//"):
+		case stdstrings.HasPrefix(line, "$CATEGORY:"):
+			flush()
+
+			category := stdstrings.TrimSpace(line[len("$CATEGORY:"):])
+			segments := stdstrings.Split(category, "/")
+			if (len(lesson.Steps) == 0) && (len(segments) > 1) {
+				lesson.Name = segments[len(segments)-2]
+			}
+			step(segments[len(segments)-1])
+		default:
+			block.WriteString(line)
+			block.WriteByte('\n')
+		}
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		errs.Add(Ls(l, "Document"), http.BadRequest(Ls(l, "failed to read document: %s"), err.Error()))
+	}
+
+	/* Categories without questions are not steps. */
+	for i := 0; i < len(lesson.Steps); i++ {
+		if len(lesson.Steps[i].Questions) == 0 {
+			lesson.Steps = RemoveAt(lesson.Steps, i)
+			i--
+		}
+	}
+	if (len(lesson.Steps) == 0) && (len(errs) == 0) {
+		errs.Add(Ls(l, "Document"), http.BadRequest("%s", Ls(l, "document contains no questions")))
+	}
+
+	return errs
+}
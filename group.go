@@ -1,14 +1,12 @@
 package main
 
 import (
-	"fmt"
 	"time"
 	"unsafe"
 
 	"github.com/anton2920/gofa/database"
 	"github.com/anton2920/gofa/net/http"
 	"github.com/anton2920/gofa/strings"
-	"github.com/anton2920/gofa/syscall"
 	"github.com/anton2920/gofa/trace"
 )
 
@@ -20,6 +18,7 @@ type Group struct {
 	Students  []database.ID
 	CreatedOn int64
 
+	Blob Blob
 	Data [1024]byte
 }
 
@@ -47,23 +46,26 @@ func UserInGroup(userID database.ID, group *Group) bool {
 	return false
 }
 
-func CreateGroup(group *Group) error {
+func CreateGroupTx(tx *Tx, group *Group) error {
 	defer trace.End(trace.Begin(""))
 
-	var err error
-
-	group.ID, err = database.IncrementNextID(GroupsDB)
-	if err != nil {
-		return fmt.Errorf("failed to increment group ID: %w", err)
-	}
+	group.ID = NewIDTx(tx, GroupsDB)
 
-	return SaveGroup(group)
+	return SaveGroupTx(tx, group)
 }
 
-func DBGroup2Group(group *Group) {
+func CreateGroup(group *Group) error {
 	defer trace.End(trace.Begin(""))
 
-	data := &group.Data[0]
+	var tx Tx
+	if err := CreateGroupTx(&tx, group); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func DBGroup2Group(group *Group, data *byte) {
+	defer trace.End(trace.Begin(""))
 
 	group.Name = database.Offset2String(group.Name, data)
 
@@ -74,44 +76,68 @@ func DBGroup2Group(group *Group) {
 func GetGroupByID(id database.ID, group *Group) error {
 	defer trace.End(trace.Begin(""))
 
-	if err := database.Read(GroupsDB, id, unsafe.Pointer(group), int(unsafe.Sizeof(*group))); err != nil {
+	if err := DBRead(GroupsDB, id, unsafe.Pointer(group), int(unsafe.Sizeof(*group))); err != nil {
 		return err
 	}
+	if group.ID != id {
+		return database.NotFound
+	}
 
-	DBGroup2Group(group)
+	data, err := GetBlobData(&group.Blob, group.Data[:])
+	if err != nil {
+		return err
+	}
+
+	DBGroup2Group(group, data)
 	return nil
 }
 
 func GetGroups(pos *int64, groups []Group) (int, error) {
 	defer trace.End(trace.Begin(""))
 
-	n, err := database.ReadMany(GroupsDB, pos, *(*[]byte)(unsafe.Pointer(&groups)), int(unsafe.Sizeof(groups[0])))
+	n, err := DBReadManyValid(GroupsDB, pos, groups, func(group *Group) database.ID { return group.ID })
 	if err != nil {
 		return 0, err
 	}
 
 	for i := 0; i < n; i++ {
-		DBGroup2Group(&groups[i])
+		data, err := GetBlobData(&groups[i].Blob, groups[i].Data[:])
+		if err != nil {
+			return 0, err
+		}
+		DBGroup2Group(&groups[i], data)
 	}
 	return n, nil
 }
 
-func DeleteGroupByID(id database.ID) error {
+func DeleteGroupByIDTx(tx *Tx, id database.ID) error {
 	defer trace.End(trace.Begin(""))
 
 	flags := GroupDeleted
 	var group Group
 
 	offset := int64(int(id)*int(unsafe.Sizeof(group))) + database.DataOffset + int64(unsafe.Offsetof(group.Flags))
-	_, err := syscall.Pwrite(GroupsDB.FD, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
-	if err != nil {
-		return fmt.Errorf("failed to delete group from DB: %w", err)
-	}
+	tx.WriteAt(GroupsDB, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
 
+	tx.OnCommit(func() { UnindexGroup(id) })
 	return nil
 }
 
-func SaveGroup(group *Group) error {
+func DeleteGroupByID(id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := DeleteGroupByIDTx(&tx, id); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func GroupDataSize(group *Group) int {
+	return DBStringSize(group.Name) + DBSliceSize(group.Students)
+}
+
+func SaveGroupTx(tx *Tx, group *Group) error {
 	defer trace.End(trace.Begin(""))
 
 	var groupDB Group
@@ -120,14 +146,35 @@ func SaveGroup(group *Group) error {
 	groupDB.ID = group.ID
 	groupDB.Flags = group.Flags
 
-	/* TODO(anton2920): save up to a sizeof(group.Data). */
-	data := unsafe.Slice(&groupDB.Data[0], len(groupDB.Data))
+	data, err := GetDataBuffer(groupDB.Data[:], GroupDataSize(group))
+	if err != nil {
+		return err
+	}
+
 	n += database.String2DBString(&groupDB.Name, group.Name, data, n)
 	n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&groupDB.Students)), *(*[]byte)(unsafe.Pointer(&group.Students)), int(unsafe.Sizeof(group.Students[0])), int(unsafe.Alignof(group.Students[0])), data, n)
 
 	groupDB.CreatedOn = group.CreatedOn
 
-	return database.Write(GroupsDB, groupDB.ID, unsafe.Pointer(&groupDB), int(unsafe.Sizeof(groupDB)))
+	if err := SaveBlob(&groupDB.Blob, groupDB.Data[:], data[:n]); err != nil {
+		return err
+	}
+
+	tx.Write(GroupsDB, groupDB.ID, unsafe.Pointer(&groupDB), int(unsafe.Sizeof(groupDB)))
+
+	indexed := *group
+	tx.OnCommit(func() { IndexGroup(&indexed) })
+	return nil
+}
+
+func SaveGroup(group *Group) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := SaveGroupTx(&tx, group); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
 }
 
 func DisplayGroupStudents(w *http.Response, l Language, group *Group) {
@@ -224,7 +271,7 @@ func GroupsPageHandler(w *http.Response, r *http.Request) error {
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -328,7 +375,7 @@ func GroupPageHandler(w *http.Response, r *http.Request) error {
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -447,7 +494,7 @@ func GroupCreateEditPageHandler(w *http.Response, r *http.Request, session *Sess
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -571,6 +618,8 @@ func GroupCreateHandler(w *http.Response, r *http.Request) error {
 		return http.ServerError(err)
 	}
 
+	Audit(r, session.ID, "create", "group", group.ID, "", AuditGroupSummary(&group))
+
 	w.Redirect("/groups", http.StatusSeeOther)
 	return nil
 }
@@ -603,6 +652,8 @@ func GroupDeleteHandler(w *http.Response, r *http.Request) error {
 		return http.ServerError(err)
 	}
 
+	Audit(r, session.ID, "delete", "group", groupID, AuditGroupSummary(&group), "")
+
 	w.Redirect("/groups", http.StatusSeeOther)
 	return nil
 }
@@ -631,6 +682,8 @@ func GroupEditHandler(w *http.Response, r *http.Request) error {
 		return http.ServerError(err)
 	}
 
+	before := AuditGroupSummary(&group)
+
 	name := r.Form.Get("Name")
 	if !strings.LengthInRange(name, MinGroupNameLen, MaxGroupNameLen) {
 		return GroupEditPageHandler(w, r, http.BadRequest(Ls(GL, "group name length must be between %d and %d characters long"), MinGroupNameLen, MaxGroupNameLen))
@@ -661,6 +714,8 @@ func GroupEditHandler(w *http.Response, r *http.Request) error {
 		return http.ServerError(err)
 	}
 
+	Audit(r, session.ID, "edit", "group", groupID, before, AuditGroupSummary(&group))
+
 	w.Redirect(w.PathID("/group/", groupID), http.StatusSeeOther)
 	return nil
 }
@@ -47,7 +47,8 @@ func DisplayBodyStart(w *http.Response) {
 	w.WriteString(`<body class="bg-body-secondary">`)
 }
 
-func DisplayHeader(w *http.Response, l Language) {
+/* DisplayHeader displays header with link to notifications if 'session' is not nil. */
+func DisplayHeader(w *http.Response, l Language, session *Session) {
 	if CSSEnabled {
 		w.WriteString(`<header class="navbar navbar-dark sticky-top bg-dark flex-md-nowrap p-0 shadow fixed-top">`)
 
@@ -55,6 +56,10 @@ func DisplayHeader(w *http.Response, l Language) {
 		w.WriteString(Ls(l, "Master's degree"))
 		w.WriteString(`</a>`)
 
+		if session != nil {
+			DisplayUnreadNotifications(w, l, session)
+		}
+
 		w.WriteString(`</header>`)
 	}
 }
@@ -80,17 +85,31 @@ func DisplaySidebarLink(w *http.Response, l Language, href string, text string)
 	w.WriteString(`</a>`)
 }
 
-func DisplaySidebarLinkIDName(w *http.Response, l Language, prefix string, id database.ID, text string, i int, name string) {
-	w.WriteString(`<a class="nav-link" href="`)
-	w.WriteString(prefix)
-	w.WriteString(`/`)
+func DisplaySidebarLessonLink(w *http.Response, l Language, id database.ID, i int, name string, state LessonState) {
+	if state == LessonStateLocked {
+		w.WriteString(`<span class="nav-link disabled">`)
+		w.WriteString(Ls(l, "Lesson"))
+		w.WriteString(` #`)
+		w.WriteInt(i + 1)
+		w.WriteString(`: `)
+		DisplayShortenedString(w, name, 25)
+		w.WriteString(` (`)
+		w.WriteString(Ls(l, "locked"))
+		w.WriteString(`)</span>`)
+		return
+	}
+
+	w.WriteString(`<a class="nav-link" href="/lesson/`)
 	w.WriteInt(int(id))
 	w.WriteString(`">`)
-	w.WriteString(Ls(l, text))
+	w.WriteString(Ls(l, "Lesson"))
 	w.WriteString(` #`)
 	w.WriteInt(i + 1)
 	w.WriteString(`: `)
 	DisplayShortenedString(w, name, 25)
+	if state == LessonStateCompleted {
+		w.WriteString(` &#10003;`)
+	}
 	w.WriteString(`</a>`)
 }
 
@@ -124,9 +143,13 @@ func DisplaySidebar(w *http.Response, l Language, session *Session) {
 				}
 				DisplaySidebarLink(w, l, "/groups", "Groups")
 				DisplaySidebarLink(w, l, "/courses", "Courses")
+				if UserIsTeacher(session.ID) {
+					DisplaySidebarLink(w, l, "/courses/library", "Library")
+				}
+				DisplaySidebarLink(w, l, "/questions", "Question bank")
 				DisplaySidebarLink(w, l, "/subjects", "Subjects")
 				if session.ID != AdminID {
-					DisplaySidebarLink(w, l, "/steps", "Steps")
+					DisplaySidebarLink(w, l, "/dashboard", "Dashboard")
 				}
 				w.WriteString(`<hr>`)
 				DisplaySidebarLink(w, l, APIPrefix+"/user/signout", "Sign out")
@@ -137,7 +160,8 @@ func DisplaySidebar(w *http.Response, l Language, session *Session) {
 	}
 }
 
-func DisplaySidebarWithLessons(w *http.Response, l Language, session *Session, lessons []database.ID) {
+/* DisplaySidebarWithLessons displays sidebar with links to lessons. If 'states' is not nil, locked lessons are not links and completed ones are marked. */
+func DisplaySidebarWithLessons(w *http.Response, l Language, session *Session, lessons []database.ID, states []LessonState) {
 	if CSSEnabled {
 		DisplaySidebarStart(w)
 		{
@@ -153,9 +177,13 @@ func DisplaySidebarWithLessons(w *http.Response, l Language, session *Session, l
 				}
 				DisplaySidebarLink(w, l, "/groups", "Groups")
 				DisplaySidebarLink(w, l, "/courses", "Courses")
+				if UserIsTeacher(session.ID) {
+					DisplaySidebarLink(w, l, "/courses/library", "Library")
+				}
+				DisplaySidebarLink(w, l, "/questions", "Question bank")
 				DisplaySidebarLink(w, l, "/subjects", "Subjects")
 				if session.ID != AdminID {
-					DisplaySidebarLink(w, l, "/steps", "Steps")
+					DisplaySidebarLink(w, l, "/dashboard", "Dashboard")
 				}
 				w.WriteString(`<hr>`)
 				for i := 0; i < len(lessons); i++ {
@@ -163,7 +191,12 @@ func DisplaySidebarWithLessons(w *http.Response, l Language, session *Session, l
 					if err := GetLessonByID(lessons[i], &lesson); err != nil {
 						/* TODO(anton2920): report error. */
 					}
-					DisplaySidebarLinkIDName(w, l, "/lesson", lessons[i], "Lesson", i, lesson.Name)
+
+					state := LessonStateUnlocked
+					if i < len(states) {
+						state = states[i]
+					}
+					DisplaySidebarLessonLink(w, l, lessons[i], i, lesson.Name, state)
 				}
 				w.WriteString(`<hr>`)
 				DisplaySidebarLink(w, l, APIPrefix+"/user/signout", "Sign out")
@@ -469,6 +502,22 @@ func DisplayInput(w *http.Response, t string, name, value string, required bool)
 	w.WriteString(`>`)
 }
 
+func DisplayNumberInput(w *http.Response, minValue, maxValue int, name string, value int, required bool) {
+	w.WriteString(` <input class="form-control" type="number" min="`)
+	w.WriteInt(minValue)
+	w.WriteString(`" max="`)
+	w.WriteInt(maxValue)
+	w.WriteString(`" name="`)
+	w.WriteString(name)
+	w.WriteString(`" value="`)
+	w.WriteInt(value)
+	w.WriteString(`"`)
+	if required {
+		w.WriteString(` required`)
+	}
+	w.WriteString(`>`)
+}
+
 func DisplayConstraintInput(w *http.Response, t string, minLength, maxLength int, name, value string, required bool) {
 	w.WriteString(` <input class="form-control" type="`)
 	w.WriteString(t)
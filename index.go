@@ -71,7 +71,7 @@ func IndexPageHandler(w *http.Response, r *http.Request) error {
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayIndexButtonsStart(w, GL, "Home page")
@@ -81,11 +81,13 @@ func IndexPageHandler(w *http.Response, r *http.Request) error {
 				DisplayIndexButton(w, GL, "/groups", "Groups", "Display information about groups, as well as create, edit and delete them")
 				DisplayIndexButton(w, GL, "/courses", "Courses", "Display information about courses, as well as create, edit and delete them")
 				DisplayIndexButton(w, GL, "/subjects", "Subjects", "Display information about subjects, as well as create, edit and delete them")
+				DisplayIndexButton(w, GL, "/submission/queue", "Verification queue", "Display submissions waiting for verification, being verified and verified recently")
+				DisplayIndexButton(w, GL, "/audit", "Audit log", "Display changes made by users")
 			} else {
 				DisplayIndexButton(w, GL, "/groups", "Groups", "Display information about groups you are a part of")
 				DisplayIndexButton(w, GL, "/courses", "Courses", "Display information about your courses, as well as create, edit and delete them")
 				DisplayIndexButton(w, GL, "/subjects", "Subjects", "Display information about subjects, that your groups are studying")
-				DisplayIndexButton(w, GL, "/steps", "Steps", "Display information about pending and completed steps")
+				DisplayIndexButton(w, GL, "/dashboard", "Dashboard", "Display your progress in subjects, unfinished submissions and submissions pending verification")
 			}
 		}
 		DisplayIndexButtonsEnd(w)
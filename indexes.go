@@ -0,0 +1,898 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/syscall"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* Indexes are secondary indexes over primary DBs. They live in memory, are stored to a file on clean shutdown and are rebuilt from DBs if that file is missing. */
+type Indexes struct {
+	Version int
+	Layout  string
+
+	UserByEmail           map[string]database.ID
+	UserGroups            map[database.ID][]database.ID
+	GroupSubjects         map[database.ID][]database.ID
+	TeacherSubjects       map[database.ID][]database.ID
+	UserLessonSubmissions map[database.ID]map[database.ID][]database.ID
+	UserSharedCourses     map[database.ID][]database.ID
+	CourseOwners          map[database.ID]database.ID
+	LibraryCourses        []database.ID
+	UserBankQuestions     map[database.ID][]database.ID
+	SubjectAnnouncements  map[database.ID][]database.ID
+	UserNotifications     map[database.ID][]database.ID
+	UnreadNotifications   map[database.ID][]database.ID
+	LessonMessages        map[database.ID][]database.ID
+	QuestionLessons       map[database.ID][]database.ID
+
+	/* NOTE(anton2920): these are used to remove stale entries when records change. */
+	UserEmails     map[database.ID]string
+	UserCourses    map[database.ID][]database.ID
+	GroupStudents  map[database.ID][]database.ID
+	SubjectOwners  map[database.ID]SubjectOwner
+	CourseShares   map[database.ID][]database.ID
+	QuestionOwners map[database.ID]database.ID
+
+	SubmissionOwners     map[database.ID]SubmissionOwner
+	AnnouncementSubjects map[database.ID]database.ID
+	NotificationOwners   map[database.ID]database.ID
+	MessageLessons       map[database.ID]database.ID
+	LessonQuestions      map[database.ID][]database.ID
+}
+
+type SubjectOwner struct {
+	GroupID   database.ID
+	TeacherID database.ID
+}
+
+type SubmissionOwner struct {
+	UserID   database.ID
+	LessonID database.ID
+}
+
+const IndexesFile = "Indexes.gob"
+
+/* IndexesVersion must be incremented every time meaning of indexes changes, so files stored by older versions are rebuilt instead of used. Changes of 'Indexes' fields are detected by 'IndexesLayout'. */
+const IndexesVersion = 1
+
+/* IndexesLayout describes names and types of all 'Indexes' fields. It's stored with indexes, so files stored by builds with different fields are rebuilt even if version was not incremented. */
+var IndexesLayout = TypeLayout(reflect.TypeOf(Indexes{}))
+
+var (
+	DBIndexes   Indexes
+	IndexesLock sync.RWMutex
+)
+
+/* TypeLayout returns description of type, which includes names and types of fields of all nested structs. */
+func TypeLayout(t reflect.Type) string {
+	var buf strings.Builder
+
+	switch t.Kind() {
+	default:
+		buf.WriteString(t.String())
+	case reflect.Map:
+		buf.WriteString("map[")
+		buf.WriteString(TypeLayout(t.Key()))
+		buf.WriteString("]")
+		buf.WriteString(TypeLayout(t.Elem()))
+	case reflect.Slice:
+		buf.WriteString("[]")
+		buf.WriteString(TypeLayout(t.Elem()))
+	case reflect.Struct:
+		buf.WriteString("struct{")
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if i > 0 {
+				buf.WriteString("; ")
+			}
+			buf.WriteString(f.Name)
+			buf.WriteString(" ")
+			buf.WriteString(TypeLayout(f.Type))
+		}
+		buf.WriteString("}")
+	}
+
+	return buf.String()
+}
+
+func ResetIndexes() {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.Lock()
+	DBIndexes = Indexes{
+		Version: IndexesVersion,
+		Layout:  IndexesLayout,
+
+		UserByEmail:           make(map[string]database.ID),
+		UserGroups:            make(map[database.ID][]database.ID),
+		GroupSubjects:         make(map[database.ID][]database.ID),
+		TeacherSubjects:       make(map[database.ID][]database.ID),
+		UserLessonSubmissions: make(map[database.ID]map[database.ID][]database.ID),
+		UserSharedCourses:     make(map[database.ID][]database.ID),
+		CourseOwners:          make(map[database.ID]database.ID),
+		UserBankQuestions:     make(map[database.ID][]database.ID),
+		SubjectAnnouncements:  make(map[database.ID][]database.ID),
+		UserNotifications:     make(map[database.ID][]database.ID),
+		UnreadNotifications:   make(map[database.ID][]database.ID),
+		LessonMessages:        make(map[database.ID][]database.ID),
+		QuestionLessons:       make(map[database.ID][]database.ID),
+
+		UserEmails:     make(map[database.ID]string),
+		UserCourses:    make(map[database.ID][]database.ID),
+		GroupStudents:  make(map[database.ID][]database.ID),
+		SubjectOwners:  make(map[database.ID]SubjectOwner),
+		CourseShares:   make(map[database.ID][]database.ID),
+		QuestionOwners: make(map[database.ID]database.ID),
+
+		SubmissionOwners:     make(map[database.ID]SubmissionOwner),
+		AnnouncementSubjects: make(map[database.ID]database.ID),
+		NotificationOwners:   make(map[database.ID]database.ID),
+		MessageLessons:       make(map[database.ID]database.ID),
+		LessonQuestions:      make(map[database.ID][]database.ID),
+	}
+	IndexesLock.Unlock()
+}
+
+/* InsertID inserts 'id' into sorted 'ids', if it's not already there. */
+func InsertID(ids []database.ID, id database.ID) []database.ID {
+	i := 0
+	for (i < len(ids)) && (ids[i] < id) {
+		i++
+	}
+	if (i < len(ids)) && (ids[i] == id) {
+		return ids
+	}
+
+	ids = append(ids, 0)
+	copy(ids[i+1:], ids[i:])
+	ids[i] = id
+	return ids
+}
+
+/* RemoveID removes 'id' from sorted 'ids'. */
+func RemoveID(ids []database.ID, id database.ID) []database.ID {
+	for i := 0; i < len(ids); i++ {
+		if ids[i] == id {
+			return RemoveAt(ids, i)
+		}
+	}
+	return ids
+}
+
+func IndexInsert(index map[database.ID][]database.ID, key database.ID, id database.ID) {
+	index[key] = InsertID(index[key], id)
+}
+
+func IndexRemove(index map[database.ID][]database.ID, key database.ID, id database.ID) {
+	ids := RemoveID(index[key], id)
+	if len(ids) == 0 {
+		delete(index, key)
+	} else {
+		index[key] = ids
+	}
+}
+
+func IndexUser(user *User) {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.Lock()
+	defer IndexesLock.Unlock()
+
+	if email, ok := DBIndexes.UserEmails[user.ID]; ok {
+		if DBIndexes.UserByEmail[email] == user.ID {
+			delete(DBIndexes.UserByEmail, email)
+		}
+		delete(DBIndexes.UserEmails, user.ID)
+	}
+
+	courses := DBIndexes.UserCourses[user.ID]
+	for i := 0; i < len(courses); i++ {
+		if DBIndexes.CourseOwners[courses[i]] == user.ID {
+			delete(DBIndexes.CourseOwners, courses[i])
+		}
+	}
+	delete(DBIndexes.UserCourses, user.ID)
+
+	if user.Flags != UserDeleted {
+		DBIndexes.UserByEmail[user.Email] = user.ID
+		DBIndexes.UserEmails[user.ID] = user.Email
+
+		for i := 0; i < len(user.Courses); i++ {
+			DBIndexes.CourseOwners[user.Courses[i]] = user.ID
+		}
+		DBIndexes.UserCourses[user.ID] = append([]database.ID(nil), user.Courses...)
+	}
+}
+
+func UnindexUser(id database.ID) {
+	IndexUser(&User{ID: id, Flags: UserDeleted})
+}
+
+func IndexGroup(group *Group) {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.Lock()
+	defer IndexesLock.Unlock()
+
+	students := DBIndexes.GroupStudents[group.ID]
+	for i := 0; i < len(students); i++ {
+		IndexRemove(DBIndexes.UserGroups, students[i], group.ID)
+	}
+	delete(DBIndexes.GroupStudents, group.ID)
+
+	if group.Flags != GroupDeleted {
+		for i := 0; i < len(group.Students); i++ {
+			IndexInsert(DBIndexes.UserGroups, group.Students[i], group.ID)
+		}
+		DBIndexes.GroupStudents[group.ID] = append([]database.ID(nil), group.Students...)
+	}
+}
+
+func UnindexGroup(id database.ID) {
+	IndexGroup(&Group{ID: id, Flags: GroupDeleted})
+}
+
+func IndexSubject(subject *Subject) {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.Lock()
+	defer IndexesLock.Unlock()
+
+	if owner, ok := DBIndexes.SubjectOwners[subject.ID]; ok {
+		IndexRemove(DBIndexes.GroupSubjects, owner.GroupID, subject.ID)
+		IndexRemove(DBIndexes.TeacherSubjects, owner.TeacherID, subject.ID)
+		delete(DBIndexes.SubjectOwners, subject.ID)
+	}
+
+	if subject.Flags != SubjectDeleted {
+		IndexInsert(DBIndexes.GroupSubjects, subject.GroupID, subject.ID)
+		IndexInsert(DBIndexes.TeacherSubjects, subject.TeacherID, subject.ID)
+		DBIndexes.SubjectOwners[subject.ID] = SubjectOwner{GroupID: subject.GroupID, TeacherID: subject.TeacherID}
+	}
+}
+
+func UnindexSubject(id database.ID) {
+	IndexSubject(&Subject{LessonContainer: LessonContainer{ID: id, Flags: SubjectDeleted}})
+}
+
+func IndexCourse(course *Course) {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.Lock()
+	defer IndexesLock.Unlock()
+
+	users := DBIndexes.CourseShares[course.ID]
+	for i := 0; i < len(users); i++ {
+		IndexRemove(DBIndexes.UserSharedCourses, users[i], course.ID)
+	}
+	delete(DBIndexes.CourseShares, course.ID)
+	DBIndexes.LibraryCourses = RemoveID(DBIndexes.LibraryCourses, course.ID)
+
+	if course.Flags != CourseDeleted {
+		users = nil
+		for i := 0; i < len(course.CoAuthors); i++ {
+			users = InsertID(users, course.CoAuthors[i])
+		}
+		for i := 0; i < len(course.Viewers); i++ {
+			users = InsertID(users, course.Viewers[i])
+		}
+		for i := 0; i < len(users); i++ {
+			IndexInsert(DBIndexes.UserSharedCourses, users[i], course.ID)
+		}
+		if len(users) > 0 {
+			DBIndexes.CourseShares[course.ID] = users
+		}
+
+		if (course.Published) && (course.Flags == CourseActive) {
+			DBIndexes.LibraryCourses = InsertID(DBIndexes.LibraryCourses, course.ID)
+		}
+	}
+}
+
+func UnindexCourse(id database.ID) {
+	IndexCourse(&Course{LessonContainer: LessonContainer{ID: id, Flags: CourseDeleted}})
+}
+
+func IndexSubmission(submission *Submission) {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.Lock()
+	defer IndexesLock.Unlock()
+
+	if owner, ok := DBIndexes.SubmissionOwners[submission.ID]; ok {
+		if lessons := DBIndexes.UserLessonSubmissions[owner.UserID]; lessons != nil {
+			IndexRemove(lessons, owner.LessonID, submission.ID)
+			if len(lessons) == 0 {
+				delete(DBIndexes.UserLessonSubmissions, owner.UserID)
+			}
+		}
+		delete(DBIndexes.SubmissionOwners, submission.ID)
+	}
+
+	if submission.Flags != SubmissionDeleted {
+		lessons := DBIndexes.UserLessonSubmissions[submission.UserID]
+		if lessons == nil {
+			lessons = make(map[database.ID][]database.ID)
+			DBIndexes.UserLessonSubmissions[submission.UserID] = lessons
+		}
+		IndexInsert(lessons, submission.LessonID, submission.ID)
+		DBIndexes.SubmissionOwners[submission.ID] = SubmissionOwner{UserID: submission.UserID, LessonID: submission.LessonID}
+	}
+}
+
+func UnindexSubmission(id database.ID) {
+	IndexSubmission(&Submission{ID: id, Flags: SubmissionDeleted})
+}
+
+func IndexBankQuestion(bq *BankQuestion) {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.Lock()
+	defer IndexesLock.Unlock()
+
+	if owner, ok := DBIndexes.QuestionOwners[bq.ID]; ok {
+		IndexRemove(DBIndexes.UserBankQuestions, owner, bq.ID)
+		delete(DBIndexes.QuestionOwners, bq.ID)
+	}
+
+	if bq.Flags != BankQuestionDeleted {
+		IndexInsert(DBIndexes.UserBankQuestions, bq.OwnerID, bq.ID)
+		DBIndexes.QuestionOwners[bq.ID] = bq.OwnerID
+	}
+}
+
+func UnindexBankQuestion(id database.ID) {
+	IndexBankQuestion(&BankQuestion{ID: id, Flags: BankQuestionDeleted})
+}
+
+func IndexAnnouncement(announcement *Announcement) {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.Lock()
+	defer IndexesLock.Unlock()
+
+	if subjectID, ok := DBIndexes.AnnouncementSubjects[announcement.ID]; ok {
+		IndexRemove(DBIndexes.SubjectAnnouncements, subjectID, announcement.ID)
+		delete(DBIndexes.AnnouncementSubjects, announcement.ID)
+	}
+
+	if announcement.Flags != AnnouncementDeleted {
+		IndexInsert(DBIndexes.SubjectAnnouncements, announcement.SubjectID, announcement.ID)
+		DBIndexes.AnnouncementSubjects[announcement.ID] = announcement.SubjectID
+	}
+}
+
+func UnindexAnnouncement(id database.ID) {
+	IndexAnnouncement(&Announcement{ID: id, Flags: AnnouncementDeleted})
+}
+
+func IndexNotification(notification *Notification) {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.Lock()
+	defer IndexesLock.Unlock()
+
+	if owner, ok := DBIndexes.NotificationOwners[notification.ID]; ok {
+		IndexRemove(DBIndexes.UserNotifications, owner, notification.ID)
+		IndexRemove(DBIndexes.UnreadNotifications, owner, notification.ID)
+		delete(DBIndexes.NotificationOwners, notification.ID)
+	}
+
+	if notification.Flags != NotificationDeleted {
+		IndexInsert(DBIndexes.UserNotifications, notification.UserID, notification.ID)
+		if notification.Flags == NotificationUnread {
+			IndexInsert(DBIndexes.UnreadNotifications, notification.UserID, notification.ID)
+		}
+		DBIndexes.NotificationOwners[notification.ID] = notification.UserID
+	}
+}
+
+func UnindexNotification(id database.ID) {
+	IndexNotification(&Notification{ID: id, Flags: NotificationDeleted})
+}
+
+func IndexMessage(message *Message) {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.Lock()
+	defer IndexesLock.Unlock()
+
+	if lessonID, ok := DBIndexes.MessageLessons[message.ID]; ok {
+		IndexRemove(DBIndexes.LessonMessages, lessonID, message.ID)
+		delete(DBIndexes.MessageLessons, message.ID)
+	}
+
+	if message.Flags != MessageDeleted {
+		IndexInsert(DBIndexes.LessonMessages, message.LessonID, message.ID)
+		DBIndexes.MessageLessons[message.ID] = message.LessonID
+	}
+}
+
+func UnindexMessage(id database.ID) {
+	IndexMessage(&Message{ID: id, Flags: MessageDeleted})
+}
+
+/* LessonQuestionIDs returns sorted IDs of bank questions linked to tests of a course lesson. */
+func LessonQuestionIDs(lesson *Lesson) []database.ID {
+	var ids []database.ID
+
+	if (lesson.Flags == LessonDeleted) || (lesson.ContainerType != LessonContainerCourse) {
+		return nil
+	}
+	for i := 0; i < len(lesson.Steps); i++ {
+		test, err := Step2Test(&lesson.Steps[i])
+		if err != nil {
+			continue
+		}
+		for j := 0; j < len(test.Sources); j++ {
+			if test.Sources[j].Version != 0 {
+				ids = InsertID(ids, test.Sources[j].ID)
+			}
+		}
+	}
+	return ids
+}
+
+/* IndexLesson indexes lesson by bank questions returned by 'LessonQuestionIDs'. They are computed by caller, because steps may point into buffers, which are reused before transaction is committed. */
+func IndexLesson(id database.ID, questions []database.ID) {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.Lock()
+	defer IndexesLock.Unlock()
+
+	old := DBIndexes.LessonQuestions[id]
+	for i := 0; i < len(old); i++ {
+		IndexRemove(DBIndexes.QuestionLessons, old[i], id)
+	}
+	delete(DBIndexes.LessonQuestions, id)
+
+	for i := 0; i < len(questions); i++ {
+		IndexInsert(DBIndexes.QuestionLessons, questions[i], id)
+	}
+	if len(questions) > 0 {
+		DBIndexes.LessonQuestions[id] = questions
+	}
+}
+
+func UnindexLesson(id database.ID) {
+	IndexLesson(id, nil)
+}
+
+func GetUserIDByEmail(email string) (database.ID, bool) {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.RLock()
+	id, ok := DBIndexes.UserByEmail[email]
+	IndexesLock.RUnlock()
+
+	return id, ok
+}
+
+func GetUserGroupIDs(userID database.ID) []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.RLock()
+	ids := append([]database.ID(nil), DBIndexes.UserGroups[userID]...)
+	IndexesLock.RUnlock()
+
+	return ids
+}
+
+/* GetStudentSubjectIDs returns IDs of subjects, in which user is a member of subject's group. */
+func GetStudentSubjectIDs(userID database.ID) []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	var ids []database.ID
+
+	IndexesLock.RLock()
+	groups := DBIndexes.UserGroups[userID]
+	for i := 0; i < len(groups); i++ {
+		subjects := DBIndexes.GroupSubjects[groups[i]]
+		for j := 0; j < len(subjects); j++ {
+			ids = InsertID(ids, subjects[j])
+		}
+	}
+	IndexesLock.RUnlock()
+
+	return ids
+}
+
+/* GetUserSubjectIDs returns IDs of subjects, in which user is either a teacher or a student. */
+func GetUserSubjectIDs(userID database.ID) []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	ids := GetStudentSubjectIDs(userID)
+
+	IndexesLock.RLock()
+	subjects := DBIndexes.TeacherSubjects[userID]
+	for i := 0; i < len(subjects); i++ {
+		ids = InsertID(ids, subjects[i])
+	}
+	IndexesLock.RUnlock()
+
+	return ids
+}
+
+func GetTeacherSubjectIDs(userID database.ID) []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.RLock()
+	ids := append([]database.ID(nil), DBIndexes.TeacherSubjects[userID]...)
+	IndexesLock.RUnlock()
+
+	return ids
+}
+
+/* GetUserSharedCourseIDs returns IDs of courses, in which user is either a co-author or a viewer. */
+func GetUserSharedCourseIDs(userID database.ID) []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.RLock()
+	ids := append([]database.ID(nil), DBIndexes.UserSharedCourses[userID]...)
+	IndexesLock.RUnlock()
+
+	return ids
+}
+
+func GetLibraryCourseIDs() []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.RLock()
+	ids := append([]database.ID(nil), DBIndexes.LibraryCourses...)
+	IndexesLock.RUnlock()
+
+	return ids
+}
+
+func GetCourseOwnerID(courseID database.ID) (database.ID, bool) {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.RLock()
+	id, ok := DBIndexes.CourseOwners[courseID]
+	IndexesLock.RUnlock()
+
+	return id, ok
+}
+
+func GetUserLessonSubmissionIDs(userID database.ID, lessonID database.ID) []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.RLock()
+	ids := append([]database.ID(nil), DBIndexes.UserLessonSubmissions[userID][lessonID]...)
+	IndexesLock.RUnlock()
+
+	return ids
+}
+
+func GetUserSubmissionIDs(userID database.ID) []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	var ids []database.ID
+
+	IndexesLock.RLock()
+	for _, submissions := range DBIndexes.UserLessonSubmissions[userID] {
+		for i := 0; i < len(submissions); i++ {
+			ids = InsertID(ids, submissions[i])
+		}
+	}
+	IndexesLock.RUnlock()
+
+	return ids
+}
+
+/* GetQuestionLessonIDs returns IDs of course lessons, which tests contain linked copies of a bank question. */
+func GetQuestionLessonIDs(questionID database.ID) []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.RLock()
+	ids := append([]database.ID(nil), DBIndexes.QuestionLessons[questionID]...)
+	IndexesLock.RUnlock()
+
+	return ids
+}
+
+func GetUserBankQuestionIDs(userID database.ID) []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.RLock()
+	ids := append([]database.ID(nil), DBIndexes.UserBankQuestions[userID]...)
+	IndexesLock.RUnlock()
+
+	return ids
+}
+
+func GetSubjectAnnouncementIDs(subjectID database.ID) []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.RLock()
+	ids := append([]database.ID(nil), DBIndexes.SubjectAnnouncements[subjectID]...)
+	IndexesLock.RUnlock()
+
+	return ids
+}
+
+func GetUserNotificationIDs(userID database.ID) []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.RLock()
+	ids := append([]database.ID(nil), DBIndexes.UserNotifications[userID]...)
+	IndexesLock.RUnlock()
+
+	return ids
+}
+
+func GetUserUnreadNotificationIDs(userID database.ID) []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.RLock()
+	ids := append([]database.ID(nil), DBIndexes.UnreadNotifications[userID]...)
+	IndexesLock.RUnlock()
+
+	return ids
+}
+
+func GetLessonMessageIDs(lessonID database.ID) []database.ID {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.RLock()
+	ids := append([]database.ID(nil), DBIndexes.LessonMessages[lessonID]...)
+	IndexesLock.RUnlock()
+
+	return ids
+}
+
+func GetUserUnreadNotificationsCount(userID database.ID) int {
+	defer trace.End(trace.Begin(""))
+
+	IndexesLock.RLock()
+	n := len(DBIndexes.UnreadNotifications[userID])
+	IndexesLock.RUnlock()
+
+	return n
+}
+
+/* GetAllIDs returns IDs of all records in DB, including deleted ones. */
+func GetAllIDs(db *database.DB) ([]database.ID, error) {
+	defer trace.End(trace.Begin(""))
+
+	n, err := database.GetNextID(db)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]database.ID, n)
+	for i := database.ID(0); i < n; i++ {
+		ids[i] = i
+	}
+	return ids, nil
+}
+
+func RebuildIndexes() error {
+	defer trace.End(trace.Begin(""))
+
+	ResetIndexes()
+
+	users := make([]User, 32)
+	var pos int64
+	for {
+		n, err := GetUsers(&pos, users)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			IndexUser(&users[i])
+		}
+	}
+
+	groups := make([]Group, 32)
+	pos = 0
+	for {
+		n, err := GetGroups(&pos, groups)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			IndexGroup(&groups[i])
+		}
+	}
+
+	courses := make([]Course, 32)
+	pos = 0
+	for {
+		n, err := GetCourses(&pos, courses)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			IndexCourse(&courses[i])
+		}
+	}
+
+	lessons := make([]Lesson, 32)
+	pos = 0
+	for {
+		n, err := GetLessons(&pos, lessons)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			IndexLesson(lessons[i].ID, LessonQuestionIDs(&lessons[i]))
+		}
+	}
+
+	subjects := make([]Subject, 32)
+	pos = 0
+	for {
+		n, err := GetSubjects(&pos, subjects)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			IndexSubject(&subjects[i])
+		}
+	}
+
+	submissions := make([]Submission, 32)
+	pos = 0
+	for {
+		n, err := GetSubmissions(&pos, submissions)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			IndexSubmission(&submissions[i])
+		}
+	}
+
+	bqs := make([]BankQuestion, 32)
+	pos = 0
+	for {
+		n, err := GetBankQuestions(&pos, bqs)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			IndexBankQuestion(&bqs[i])
+		}
+	}
+
+	announcements := make([]Announcement, 32)
+	pos = 0
+	for {
+		n, err := GetAnnouncements(&pos, announcements)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			IndexAnnouncement(&announcements[i])
+		}
+	}
+
+	notifications := make([]Notification, 32)
+	pos = 0
+	for {
+		n, err := GetNotifications(&pos, notifications)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			IndexNotification(&notifications[i])
+		}
+	}
+
+	messages := make([]Message, 32)
+	pos = 0
+	for {
+		n, err := GetMessages(&pos, messages)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			IndexMessage(&messages[i])
+		}
+	}
+
+	return nil
+}
+
+func StoreIndexesToFile(dir string, name string) error {
+	defer trace.End(trace.Begin(""))
+
+	buf := make([]byte, syscall.PATH_MAX)
+	n := PutPath(buf, dir, name)
+
+	f, err := os.Create(unsafe.String(unsafe.SliceData(buf), n))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := gob.NewEncoder(f)
+	IndexesLock.RLock()
+	defer IndexesLock.RUnlock()
+
+	if err := enc.Encode(&DBIndexes); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+/* RestoreIndexesFromFile loads indexes and removes the file, so indexes are rebuilt if server is not shut down cleanly. */
+func RestoreIndexesFromFile(dir string, name string) error {
+	defer trace.End(trace.Begin(""))
+
+	buf := make([]byte, syscall.PATH_MAX)
+	n := PutPath(buf, dir, name)
+	filename := unsafe.String(unsafe.SliceData(buf), n)
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ResetIndexes()
+
+	dec := gob.NewDecoder(f)
+	IndexesLock.Lock()
+	/* NOTE(anton2920): fields missing from file are left as is, so version and layout must be cleared for files without them. */
+	DBIndexes.Version = 0
+	DBIndexes.Layout = ""
+	err = dec.Decode(&DBIndexes)
+	version := DBIndexes.Version
+	layout := DBIndexes.Layout
+	IndexesLock.Unlock()
+	if err != nil {
+		return err
+	}
+	if version != IndexesVersion {
+		os.Remove(filename)
+		return fmt.Errorf("indexes file has version %d, expected %d", version, IndexesVersion)
+	}
+	if layout != IndexesLayout {
+		os.Remove(filename)
+		return fmt.Errorf("indexes file was stored with different fields")
+	}
+
+	return os.Remove(filename)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+	myurl "github.com/anton2920/gofa/net/url"
+)
+
+var testIndexSizes = [...]int{100, 1000, 10000}
+
+func TestRebuildIndexes(t *testing.T) {
+	testCreateInitialDBs()
+
+	var user User
+	if err := GetUserByID(2, &user); err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	user.Email = "student-new@masters.com"
+	if err := SaveUser(&user); err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+	if err := DeleteUserByID(3); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+
+	IndexesLock.RLock()
+	expected := DBIndexes
+	IndexesLock.RUnlock()
+
+	if err := RebuildIndexes(); err != nil {
+		t.Fatalf("Failed to rebuild indexes: %v", err)
+	}
+	if !reflect.DeepEqual(expected, DBIndexes) {
+		t.Errorf("Rebuilt indexes differ from maintained ones:\n%+v\n%+v", DBIndexes, expected)
+	}
+
+	if err := GetUserByEmail("student@masters.com", &user); err != database.NotFound {
+		t.Errorf("Expected old email to be removed from index, got %v", err)
+	}
+	if err := GetUserByEmail("student2@masters.com", &user); err != database.NotFound {
+		t.Errorf("Expected deleted user to be removed from index, got %v", err)
+	}
+	if err := GetUserByEmail("student-new@masters.com", &user); (err != nil) || (user.ID != 2) {
+		t.Errorf("Expected to find user with ID = 2, got %v", err)
+	}
+
+	if ids := GetStudentSubjectIDs(2); !reflect.DeepEqual(ids, []database.ID{0, 1}) {
+		t.Errorf("Expected student subjects [0 1], got %v", ids)
+	}
+	if ids := GetUserLessonSubmissionIDs(2, 2); !reflect.DeepEqual(ids, []database.ID{0}) {
+		t.Errorf("Expected submissions [0], got %v", ids)
+	}
+
+	var tx Tx
+	if err := DeleteSubmissionByIDTx(&tx, 0); err != nil {
+		t.Fatalf("Failed to delete submission: %v", err)
+	}
+	if err := CommitTx(&tx); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if ids := GetUserLessonSubmissionIDs(2, 2); len(ids) != 0 {
+		t.Errorf("Expected deleted submission to be removed from index, got %v", ids)
+	}
+
+	IndexesLock.RLock()
+	expected = DBIndexes
+	IndexesLock.RUnlock()
+	if err := RebuildIndexes(); err != nil {
+		t.Fatalf("Failed to rebuild indexes: %v", err)
+	}
+	if !reflect.DeepEqual(expected, DBIndexes) {
+		t.Errorf("Rebuilt indexes differ from maintained ones after submission deletion:\n%+v\n%+v", DBIndexes, expected)
+	}
+
+	testCreateInitialDBs()
+}
+
+func testCreateUsers(n int) {
+	for i := 0; i < n; i++ {
+		user := User{FirstName: "Test", LastName: "User", Email: fmt.Sprintf("user%d@masters.com", i), Password: "password"}
+		CreateUser(&user)
+	}
+}
+
+func testCreateSubjects(n int) {
+	group := Group{Name: "Empty group"}
+	CreateGroup(&group)
+
+	for i := 0; i < n; i++ {
+		subject := Subject{LessonContainer: LessonContainer{Name: "Subject"}, TeacherID: 1, GroupID: group.ID}
+		CreateSubject(&subject)
+	}
+}
+
+func BenchmarkGetUserByEmail(b *testing.B) {
+	for _, size := range testIndexSizes {
+		b.Run(fmt.Sprintf("users=%d", size), func(b *testing.B) {
+			testCreateInitialDBs()
+			testCreateUsers(size)
+
+			var user User
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := GetUserByEmail("student@masters.com", &user); err != nil {
+					b.Fatalf("Failed to get user by email: %v", err)
+				}
+			}
+		})
+	}
+	testCreateInitialDBs()
+}
+
+func BenchmarkDashboardPageHandler(b *testing.B) {
+	for _, size := range testIndexSizes {
+		b.Run(fmt.Sprintf("subjects=%d", size), func(b *testing.B) {
+			testCreateInitialDBs()
+			testCreateSubjects(size)
+
+			var r http.Request
+
+			r.Headers.Set("Cookie", fmt.Sprintf("Token=%s", testTokens[2]))
+			r.URL.Path = myurl.Path("/dashboard")
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var w http.Response
+				w.Status = http.StatusOK
+
+				RouterFunc(&w, &r)
+				if w.Status != http.StatusOK {
+					b.Fatalf("GET /dashboard -> %d, expected %d", w.Status, http.StatusOK)
+				}
+			}
+		})
+	}
+	testCreateInitialDBs()
+}
+
+func TestRestoreIndexesLayout(t *testing.T) {
+	testCreateInitialDBs()
+	defer RebuildIndexes()
+
+	dir := t.TempDir()
+
+	if err := StoreIndexesToFile(dir, IndexesFile); err != nil {
+		t.Fatalf("Failed to store indexes: %v", err)
+	}
+	if err := RestoreIndexesFromFile(dir, IndexesFile); err != nil {
+		t.Errorf("Expected indexes to be restored, got %v", err)
+	}
+
+	/* Indexes stored by a build with different fields, but the same version. */
+	IndexesLock.Lock()
+	DBIndexes.Layout = "struct{}"
+	IndexesLock.Unlock()
+	if err := StoreIndexesToFile(dir, IndexesFile); err != nil {
+		t.Fatalf("Failed to store indexes: %v", err)
+	}
+	if err := RestoreIndexesFromFile(dir, IndexesFile); err == nil {
+		t.Errorf("Expected indexes with different layout to be rejected")
+	}
+}
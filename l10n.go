@@ -22,9 +22,27 @@ var Language2String = [...]string{
 
 /* TODO(anton2920): remove '([A-Z]|[a-z])[a-z]+' duplicates. */
 var Localizations = l10n.Localizations{
+	"Accepted programming languages (none means any)": {
+		RU: "Допустимые языки программирования (если не выбраны, допустимы любые)",
+	},
+	"Access": {
+		RU: "Доступ",
+	},
+	"Action": {
+		RU: "Действие",
+	},
 	"Active": {
 		RU: "Активнен",
 	},
+	"Actor": {
+		RU: "Пользователь",
+	},
+	"Add random questions": {
+		RU: "Добавить случайные вопросы",
+	},
+	"Add selected questions": {
+		RU: "Добавить выбранные вопросы",
+	},
 	"Administration": {
 		RU: "Управление",
 	},
@@ -49,9 +67,30 @@ var Localizations = l10n.Localizations{
 	"Add test": {
 		RU: "Добавить тест",
 	},
+	"After": {
+		RU: "После",
+	},
 	"All": {
 		RU: "Все",
 	},
+	"All lessons are up to date with their courses": {
+		RU: "Все уроки соответствуют своим курсам",
+	},
+	"All steps": {
+		RU: "Все шаги",
+	},
+	"Analytics": {
+		RU: "Аналитика",
+	},
+	"Announcements": {
+		RU: "Объявления",
+	},
+	"Answer": {
+		RU: "Ответ",
+	},
+	"Answered correctly": {
+		RU: "Ответили верно",
+	},
 	"Answers": {
 		RU: "Ответы",
 		FR: "",
@@ -60,12 +99,60 @@ var Localizations = l10n.Localizations{
 		RU: "Ответы (пометьте галочкой правильные)",
 		FR: "",
 	},
+	"Any": {
+		RU: "Любая",
+	},
+	"Apply selected changes": {
+		RU: "Применить выбранные изменения",
+	},
+	"Audit log": {
+		RU: "Журнал аудита",
+	},
+	"Author": {
+		RU: "Автор",
+	},
+	"Average attempts per student": {
+		RU: "Среднее число попыток на учащегося",
+	},
+	"Average duration": {
+		RU: "Средняя длительность",
+	},
+	"Before": {
+		RU: "До",
+	},
+	"Best score": {
+		RU: "Лучший результат",
+	},
+	"Checked submissions": {
+		RU: "Проверенные решения",
+	},
+	"Checks": {
+		RU: "Проверки",
+	},
+	"Checks done": {
+		RU: "Выполнено проверок",
+	},
+	"Chosen": {
+		RU: "Выбран",
+	},
+	"Co-author": {
+		RU: "Соавтор",
+	},
+	"Completed": {
+		RU: "Завершено",
+	},
 	"Continue": {
 		RU: "Продолжить",
 	},
+	"Correct": {
+		RU: "Верный",
+	},
 	"Course": {
 		RU: "Курс",
 	},
+	"Course updates": {
+		RU: "Обновления курсов",
+	},
 	"Courses": {
 		RU: "Курсы",
 	},
@@ -83,6 +170,9 @@ var Localizations = l10n.Localizations{
 		RU: "Создать урок",
 		FR: "",
 	},
+	"Create question": {
+		RU: "Создать вопрос",
+	},
 	"Create subject": {
 		RU: "Создать предмет",
 	},
@@ -93,6 +183,9 @@ var Localizations = l10n.Localizations{
 		RU: "Дата создания",
 		FR: "",
 	},
+	"Dashboard": {
+		RU: "Панель учащегося",
+	},
 	"Delete": {
 		RU: "Удалить",
 	},
@@ -103,12 +196,21 @@ var Localizations = l10n.Localizations{
 		RU: "Описание",
 		FR: "",
 	},
+	"Difficulty": {
+		RU: "Сложность",
+	},
 	"Discard": {
 		RU: "Отменить",
 		FR: "",
 	},
-	"Display information about pending and completed steps": {
-		RU: "Просмотр информации о выданных и решённых заданиях",
+	"Discrimination index": {
+		RU: "Индекс дискриминативности",
+	},
+	"Discussion": {
+		RU: "Обсуждение",
+	},
+	"Display changes made by users": {
+		RU: "Просмотреть изменения, сделанные пользователями",
 	},
 	"Display information about courses, as well as create, edit and delete them": {
 		RU: "Просмотр информации о курсах, а также их создание, редактирование и удаление",
@@ -131,9 +233,24 @@ var Localizations = l10n.Localizations{
 	"Display information about users, as well as create, edit and delete them": {
 		RU: "Просмотр информации о пользователях, а также их создание, редактирование и удаление",
 	},
+	"Display submissions waiting for verification, being verified and verified recently": {
+		RU: "Просмотр решений, ожидающих проверки, проверяемых и недавно проверенных",
+	},
+	"Display your progress in subjects, unfinished submissions and submissions pending verification": {
+		RU: "Просмотр прогресса по предметам, незавершённых решений и решений, ожидающих проверки",
+	},
+	"Document": {
+		RU: "Документ",
+	},
 	"Draft": {
 		RU: "Черновик",
 	},
+	"Duration": {
+		RU: "Длительность",
+	},
+	"Easy": {
+		RU: "Лёгкая",
+	},
 	"Edit": {
 		RU: "Редактировать",
 	},
@@ -141,6 +258,9 @@ var Localizations = l10n.Localizations{
 		RU: "Редактирование группы",
 		FR: "",
 	},
+	"Edit question": {
+		RU: "Редактировать вопрос",
+	},
 	"Edit subject": {
 		RU: "Редактирование предмета",
 		FR: "",
@@ -157,6 +277,9 @@ var Localizations = l10n.Localizations{
 		RU: "Электронная почта",
 		FR: "",
 	},
+	"Entity": {
+		RU: "Объект",
+	},
 	"Error": {
 		RU: "Ошибка",
 	},
@@ -171,6 +294,21 @@ var Localizations = l10n.Localizations{
 		RU: "Примеры",
 		FR: "",
 	},
+	"Exit code": {
+		RU: "Код возврата",
+	},
+	"Export": {
+		RU: "Экспортировать",
+	},
+	"File name": {
+		RU: "Имя файла",
+	},
+	"Files": {
+		RU: "Файлы",
+	},
+	"Filter": {
+		RU: "Фильтровать",
+	},
 	"Finish": {
 		RU: "Отправить",
 		FR: "",
@@ -182,18 +320,54 @@ var Localizations = l10n.Localizations{
 		RU: "Имя",
 		FR: "",
 	},
+	"Fork": {
+		RU: "Создать копию",
+	},
+	"Format": {
+		RU: "Формат",
+	},
 	"Group": {
 		RU: "Группа",
 	},
 	"Groups": {
 		RU: "Группы",
 	},
+	"Hard": {
+		RU: "Сложная",
+	},
+	"Harness is hidden from students. It is compiled together with solution or run instead of it by interpreted languages. Before calling solution it must read secret from file descriptor 3 and close it, and harness of interpreted language must also remove its own file. Then it must print 'PASS secret name' or 'FAIL secret name: message' line for every test case. Output of each check lists names of test cases, which must pass.": {
+		RU: "Обвязка скрыта от студентов. Она компилируется вместе с решением или запускается вместо него в интерпретируемых языках и перед вызовом решения должна прочитать секрет из файлового дескриптора 3 и закрыть его, а обвязка на интерпретируемом языке также должна удалить свой файл. Затем она должна выводить строку 'PASS секрет имя' или 'FAIL секрет имя: сообщение' для каждого тестового случая. Выход каждой проверки перечисляет имена тестовых случаев, которые должны пройти.",
+	},
+	"Helper files are visible to students. To remove a file, clear its name and contents.": {
+		RU: "Вспомогательные файлы видны студентам. Чтобы удалить файл, очистите его имя и содержимое.",
+	},
+	"Hide": {
+		RU: "Скрыть",
+	},
 	"Home page": {
 		RU: "Главная страница",
 	},
 	"ID out of range": {
 		RU: "ID вне допустимого диапазона",
 	},
+	"Import": {
+		RU: "Импортировать",
+	},
+	"Import course": {
+		RU: "Импортировать курс",
+	},
+	"Import lessons": {
+		RU: "Импортировать уроки",
+	},
+	"Imported from %s.": {
+		RU: "Импортировано из %s.",
+	},
+	"Imported questions": {
+		RU: "Импортированные вопросы",
+	},
+	"In progress": {
+		RU: "В процессе",
+	},
 	"Info": {
 		RU: "Информация",
 		FR: "",
@@ -202,6 +376,15 @@ var Localizations = l10n.Localizations{
 		RU: "Входные данные",
 		FR: "",
 	},
+	"Interactor": {
+		RU: "Интерактор",
+	},
+	"Interactor is hidden from students. It runs alongside solution in interpreted language, reads test input from file descriptor 3, talks to solution through its standard input and output and exits with zero code if solution passed. Otherwise the first line of its standard error is displayed.": {
+		RU: "Интерактор скрыт от студентов. Он запускается вместе с решением на интерпретируемом языке, читает входные данные теста из файлового дескриптора 3, общается с решением через его стандартные ввод и вывод и завершается с нулевым кодом, если решение прошло. Иначе отображается первая строка его стандартного потока ошибок.",
+	},
+	"Languages": {
+		RU: "Языки",
+	},
 	"Last name": {
 		RU: "Фамилия",
 		FR: "",
@@ -212,27 +395,87 @@ var Localizations = l10n.Localizations{
 	"Lessons": {
 		RU: "Уроки",
 	},
+	"Lessons with course updates": {
+		RU: "Уроков с обновлениями курсов",
+	},
+	"Library": {
+		RU: "Библиотека",
+	},
+	"Locked": {
+		RU: "Заблокировано",
+	},
+	"Mark all as read": {
+		RU: "Отметить все как прочитанные",
+	},
+	"Mark as answer": {
+		RU: "Отметить как ответ",
+	},
 	"Master's degree": {
 		RU: "Магистерская диссертация",
 		FR: "Une maîtrise",
 	},
+	"Medium": {
+		RU: "Средняя",
+	},
+	"Most common failure": {
+		RU: "Самая частая ошибка",
+	},
 	"Name": {
 		RU: "Название",
 	},
+	"New announcement": {
+		RU: "Новое объявление",
+	},
+	"New lesson": {
+		RU: "Новый урок",
+	},
+	"New message in discussion": {
+		RU: "Новое сообщение в обсуждении",
+	},
+	"Newer": {
+		RU: "Более новые",
+	},
 	"Next": {
 		RU: "Далее",
 	},
+	"No changes": {
+		RU: "Изменений нет",
+	},
+	"Not started": {
+		RU: "Не начато",
+	},
 	"Note: answers marked with [x] are correct": {
 		RU: "Подсказка: правильные ответы помечены [x]",
 		FR: "",
 	},
+	"Note: submissions, which have already been started, keep steps they were started with": {
+		RU: "Примечание: начатые решения сохраняют задания, с которыми они были начаты",
+	},
+	"Notifications": {
+		RU: "Уведомления",
+	},
+	"Number of questions": {
+		RU: "Количество вопросов",
+	},
+	"Older": {
+		RU: "Более старые",
+	},
 	"Open": {
 		RU: "Открыть",
 	},
+	"Output": {
+		RU: "Выходные данные",
+	},
+	"Owner": {
+		RU: "Владелец",
+	},
 	"Pass": {
 		RU: "Приступить к выполнению",
 		FR: "",
 	},
+	"Pass rate": {
+		RU: "Доля прохождений",
+	},
 	"Password": {
 		RU: "Пароль",
 		FR: "",
@@ -241,6 +484,21 @@ var Localizations = l10n.Localizations{
 		RU: "Ожидается",
 		FR: "",
 	},
+	"Pending verification": {
+		RU: "Ожидают проверки",
+	},
+	"Pin": {
+		RU: "Закрепить",
+	},
+	"Position": {
+		RU: "Позиция",
+	},
+	"Position in queue": {
+		RU: "Позиция в очереди",
+	},
+	"Post": {
+		RU: "Опубликовать",
+	},
 	"Programming language": {
 		RU: "Язык программирования",
 		FR: "",
@@ -253,18 +511,69 @@ var Localizations = l10n.Localizations{
 		RU: "Профиль",
 		FR: "Profil",
 	},
+	"Publish to library": {
+		RU: "Опубликовать в библиотеке",
+	},
 	"Question": {
 		RU: "Вопрос",
 		FR: "",
 	},
+	"Question bank": {
+		RU: "Банк вопросов",
+	},
+	"Questions": {
+		RU: "Вопросы",
+	},
+	"Queued": {
+		RU: "В очереди",
+	},
+	"Queued at": {
+		RU: "Поставлено в очередь",
+	},
 	"Re-check": {
 		RU: "Перепроверить",
 		FR: "",
 	},
+	"Recently finished": {
+		RU: "Недавно завершённые",
+	},
+	"Rejudge": {
+		RU: "Перепроверить",
+	},
+	"Rejudged at": {
+		RU: "Перепроверено",
+	},
+	"Remove": {
+		RU: "Удалить",
+	},
+	"Remove from library": {
+		RU: "Удалить из библиотеки",
+	},
 	"Repeat password": {
 		RU: "Повторите пароль",
 		FR: "",
 	},
+	"Required score on previous lessons": {
+		RU: "Необходимый балл за предыдущие уроки",
+	},
+	"Required score on previous lessons, %": {
+		RU: "Необходимый балл за предыдущие уроки, %",
+	},
+	"Result": {
+		RU: "Результат",
+	},
+	"Review": {
+		RU: "Просмотреть",
+	},
+	"Run": {
+		RU: "Запустить",
+	},
+	"Running": {
+		RU: "Выполняется",
+	},
+	"Running for": {
+		RU: "Выполняется уже",
+	},
 	"Save": {
 		RU: "Сохранить",
 	},
@@ -272,6 +581,18 @@ var Localizations = l10n.Localizations{
 		RU: "Оценка",
 		FR: "",
 	},
+	"Score before rejudge": {
+		RU: "Баллы до перепроверки",
+	},
+	"Share": {
+		RU: "Поделиться",
+	},
+	"Sharing": {
+		RU: "Совместный доступ",
+	},
+	"Show": {
+		RU: "Показать",
+	},
 	"Sign in": {
 		RU: "Войти",
 		FR: "Se connecter",
@@ -284,9 +605,18 @@ var Localizations = l10n.Localizations{
 		RU: "Решение",
 		FR: "",
 	},
+	"Standard error": {
+		RU: "Стандартный поток ошибок",
+	},
+	"Standard output": {
+		RU: "Стандартный вывод",
+	},
 	"Started at": {
 		RU: "Приступил к выполнению",
 	},
+	"Starter code": {
+		RU: "Начальный код",
+	},
 	"Status": {
 		RU: "Статус",
 	},
@@ -294,10 +624,6 @@ var Localizations = l10n.Localizations{
 		RU: "Задание",
 		FR: "",
 	},
-	"Steps": {
-		RU: "Задания",
-		FR: "",
-	},
 	"Students": {
 		RU: "Студенты",
 		FR: "",
@@ -312,6 +638,9 @@ var Localizations = l10n.Localizations{
 		RU: "Решение",
 		FR: "",
 	},
+	"Submission is verified": {
+		RU: "Решение проверено",
+	},
 	"Submissions": {
 		RU: "Решения",
 		FR: "",
@@ -324,6 +653,15 @@ var Localizations = l10n.Localizations{
 		RU: "Решённый тест",
 		FR: "",
 	},
+	"Tag": {
+		RU: "Тег",
+	},
+	"Tags": {
+		RU: "Теги",
+	},
+	"Tags (comma-separated)": {
+		RU: "Теги (через запятую)",
+	},
 	"Teacher": {
 		RU: "Преподаватель",
 		FR: "",
@@ -332,10 +670,19 @@ var Localizations = l10n.Localizations{
 		RU: "Тест",
 		FR: "",
 	},
+	"Test harness": {
+		RU: "Тестовая обвязка",
+	},
 	"Tests": {
 		RU: "Тесты",
 		FR: "",
 	},
+	"There are no messages yet": {
+		RU: "Сообщений пока нет",
+	},
+	"Time": {
+		RU: "Время",
+	},
 	"Title": {
 		RU: "Название",
 		FR: "",
@@ -355,9 +702,27 @@ var Localizations = l10n.Localizations{
 		RU: "Тип",
 		FR: "",
 	},
+	"Unfinished submissions": {
+		RU: "Незавершённые решения",
+	},
+	"Unlink": {
+		RU: "Отвязать",
+	},
+	"Unmark answer": {
+		RU: "Снять отметку ответа",
+	},
 	"Unnamed": {
 		RU: "Безымянный",
 	},
+	"Unpin": {
+		RU: "Открепить",
+	},
+	"Update course lessons, which use this question": {
+		RU: "Обновить уроки курсов, использующие этот вопрос",
+	},
+	"Use current version of lesson steps": {
+		RU: "Использовать текущую версию шагов урока",
+	},
 	"User": {
 		RU: "Пользователь",
 		FR: "",
@@ -370,18 +735,78 @@ var Localizations = l10n.Localizations{
 		RU: "Проверка",
 		FR: "",
 	},
-	"You don't have any unfinished steps": {
-		RU: "У вас нет невыполненных заданий",
+	"Verification queue": {
+		RU: "Очередь проверки",
+	},
+	"Version": {
+		RU: "Версия",
+	},
+	"Viewer": {
+		RU: "Читатель",
 	},
 
+	"Waited": {
+		RU: "Ожидание",
+	},
+	"Waiting for": {
+		RU: "Ожидает уже",
+	},
+	"You are not studying any subjects": {
+		RU: "Вы не изучаете ни одного предмета",
+	},
+	"You don't have any notifications": {
+		RU: "У вас нет уведомлений",
+	},
+	"You don't have any submissions pending verification": {
+		RU: "У вас нет решений, ожидающих проверки",
+	},
+	"You don't have any unfinished submissions": {
+		RU: "У вас нет незавершённых решений",
+	},
+	"Your question bank is empty": {
+		RU: "Ваш банк вопросов пуст",
+	},
+	"%d of %d test cases passed, first failure: %s": {
+		RU: "пройдено %d из %d тестовых случаев, первая ошибка: %s",
+	},
 	"add at least one student": {
 		RU: "добавьте хотя бы одного студента",
 		FR: "",
 	},
+	"add at least two answers": {
+		RU: "добавьте хотя бы два ответа",
+	},
+	"added": {
+		RU: "добавлено",
+	},
+	"analytics is only available for lessons in subjects": {
+		RU: "аналитика доступна только для уроков в предметах",
+	},
+	"announcement length must be between %d and %d characters long": {
+		RU: "длина объявления должна быть от %d до %d символов",
+	},
+	"announcement with this ID does not exist": {
+		RU: "объявление с таким ID не существует",
+	},
+	"answer": {
+		RU: "ответ",
+	},
+	"answer %d: length must be between %d and %d characters long": {
+		RU: "ответ %d: длина должна быть между %d и %d символами",
+	},
+	"answer must start with '=' or '~'": {
+		RU: "ответ должен начинаться с '=' или '~'",
+	},
 	"by": {
 		RU: "от",
 		FR: "",
 	},
+	"changed": {
+		RU: "изменено",
+	},
+	"correct answer %d does not exist": {
+		RU: "правильного ответа %d не существует",
+	},
 	"course name length must be between %d and %d characters long": {
 		RU: "название курса должно содержать от %d до %d символов",
 	},
@@ -399,6 +824,24 @@ var Localizations = l10n.Localizations{
 		RU: "взять за основу",
 		FR: "",
 	},
+	"discussions are only available for lessons in subjects": {
+		RU: "обсуждения доступны только для уроков в предметах",
+	},
+	"document contains errors": {
+		RU: "документ содержит ошибки",
+	},
+	"document contains neither course nor lesson": {
+		RU: "документ не содержит ни курса, ни урока",
+	},
+	"document contains no questions": {
+		RU: "документ не содержит вопросов",
+	},
+	"document is too large, maximum size is %d bytes": {
+		RU: "документ слишком большой, максимальный размер %d байт",
+	},
+	"estimated time left, seconds": {
+		RU: "осталось примерно, секунд",
+	},
 	"example %d: %s": {
 		RU: "пример %d: %s",
 		FR: "",
@@ -415,6 +858,18 @@ var Localizations = l10n.Localizations{
 		RU: "неудалось собрать программу: %s %w",
 		FR: "",
 	},
+	"failed to create pipe: %v": {
+		RU: "не удалось создать канал: %v",
+	},
+	"failed to prepare interactor: %w": {
+		RU: "не удалось подготовить интерактор: %w",
+	},
+	"failed to read document: %s": {
+		RU: "не удалось прочитать документ: %s",
+	},
+	"failed to run interactor: %v": {
+		RU: "не удалось запустить интерактор: %v",
+	},
 	"failed to run program: exceeded timeout of %d seconds": {
 		RU: "неудалось выполнить программу: превышено время ожидания в %d секунд",
 		FR: "",
@@ -431,6 +886,9 @@ var Localizations = l10n.Localizations{
 		RU: "для",
 		FR: "",
 	},
+	"from question bank": {
+		RU: "из банка вопросов",
+	},
 	"give as is": {
 		RU: "выдать как есть",
 		FR: "",
@@ -447,6 +905,9 @@ var Localizations = l10n.Localizations{
 	"draft": {
 		RU: "черновик",
 	},
+	"hidden": {
+		RU: "скрыто",
+	},
 	"in progress": {
 		RU: "в процессе",
 		FR: "",
@@ -454,9 +915,27 @@ var Localizations = l10n.Localizations{
 	"index out of range": {
 		RU: "индекс вне допустимого диапазона",
 	},
+	"input length must not exceed %d characters": {
+		RU: "длина ввода не должна превышать %d символов",
+	},
+	"interactor exceeded timeout of %d seconds": {
+		RU: "интерактор превысил ограничение времени в %d секунд",
+	},
+	"interactor language is not available": {
+		RU: "язык интерактора недоступен",
+	},
+	"invalid answer weight": {
+		RU: "некорректный вес ответа",
+	},
 	"invalid ID for %q": {
 		RU: "некорректный ID для %q",
 	},
+	"invalid JSON: %s": {
+		RU: "некорректный JSON: %s",
+	},
+	"invalid XML: %s": {
+		RU: "некорректный XML: %s",
+	},
 	"length of the name must be between %d and %d characters": {
 		RU: "имя и фамилия должны содержать от %d до %d символов",
 	},
@@ -464,6 +943,9 @@ var Localizations = l10n.Localizations{
 		RU: "урок %d всё ещё черновик",
 		FR: "",
 	},
+	"lesson is too large, maximum size is %d bytes": {
+		RU: "урок слишком большой, максимальный размер составляет %d байт",
+	},
 	"lesson name length must be between %d and %d characters long": {
 		RU: "название урока должно содержать от %d до %d символов",
 	},
@@ -473,6 +955,36 @@ var Localizations = l10n.Localizations{
 	"lesson with this ID does not exist": {
 		RU: "урока с таким ID не существует",
 	},
+	"locked": {
+		RU: "закрыт",
+	},
+	"message length must be between %d and %d characters long": {
+		RU: "длина сообщения должна быть от %d до %d символов",
+	},
+	"message with this ID does not exist": {
+		RU: "сообщение с таким ID не существует",
+	},
+	"ms": {
+		RU: "мс",
+	},
+	"notification with this ID does not exist": {
+		RU: "уведомление с таким ID не существует",
+	},
+	"number of questions must be between %d and %d": {
+		RU: "количество вопросов должно быть между %d и %d",
+	},
+	"only %d questions in the bank match, %d requested": {
+		RU: "в банке подходят только %d вопросов, запрошено %d",
+	},
+	"only active courses can be forked": {
+		RU: "копировать можно только активные курсы",
+	},
+	"only active courses can be published": {
+		RU: "публиковать можно только активные курсы",
+	},
+	"only multiple choice and true/false questions are supported": {
+		RU: "поддерживаются только вопросы с выбором ответа и вопросы верно/неверно",
+	},
 	"or": {
 		RU: "или",
 		FR: "",
@@ -491,6 +1003,12 @@ var Localizations = l10n.Localizations{
 		RU: "ожидается",
 		FR: "",
 	},
+	"pinned": {
+		RU: "закреплено",
+	},
+	"programming language %q does not exist": {
+		RU: "язык программирования %q не существует",
+	},
 	"programming task %d is a draft": {
 		RU: "задание по программированию %d всё ещё черновик",
 	},
@@ -514,6 +1032,24 @@ var Localizations = l10n.Localizations{
 	"question %d: title length must be between %d and %d characters long": {
 		RU: "вопрос %d: название должно содержать от %d до %d символов",
 	},
+	"question can have at most %d tags": {
+		RU: "у вопроса может быть не более %d тегов",
+	},
+	"question has no answers": {
+		RU: "у вопроса нет ответов",
+	},
+	"question has no closing '}'": {
+		RU: "у вопроса нет закрывающей '}'",
+	},
+	"question title length must be between %d and %d characters long": {
+		RU: "длина заголовка вопроса должна быть между %d и %d символами",
+	},
+	"question with this ID does not exist": {
+		RU: "вопрос с таким ID не существует",
+	},
+	"removed": {
+		RU: "удалено",
+	},
 	"requested API endpoint does not exist": {
 		RU: "запрашиваемой команды не существует",
 		FR: "",
@@ -526,12 +1062,24 @@ var Localizations = l10n.Localizations{
 		RU: "запрашиваемой страницы не существует",
 		FR: "",
 	},
+	"required score must be between %d and %d": {
+		RU: "необходимый балл должен быть между %d и %d",
+	},
 	"score": {
 		RU: "оценка",
 	},
 	"second and latter characters of the name must be letters, spaces, dots, hyphens or apostrophes": {
 		RU: "второй и последующий символы имени/фамилии должны быть буквы, пробелы, точки, дефисы и апострофы",
 	},
+	"select at least one correct answer": {
+		RU: "выберите хотя бы один правильный ответ",
+	},
+	"select question difficulty": {
+		RU: "выберите сложность вопроса",
+	},
+	"selected language is not accepted by this task": {
+		RU: "выбранный язык не допускается в этом задании",
+	},
 	"selected language is not available": {
 		RU: "выбранный язык недоступен",
 	},
@@ -542,19 +1090,37 @@ var Localizations = l10n.Localizations{
 		RU: "задание %d всё ещё черновик",
 		FR: "",
 	},
+	"submission is still being verified": {
+		RU: "решение всё ещё проверяется",
+	},
+	"submission is too large, maximum size is %d bytes": {
+		RU: "решение слишком большое, максимальный размер составляет %d байт",
+	},
 	"subject name length must be between %d and %d characters long": {
 		RU: "название предмета должно содержать от %d до %d символов",
 	},
 	"subject with this ID does not exist": {
 		RU: "предмета с таким ID не существует",
 	},
+	"system": {
+		RU: "система",
+	},
+	"tag length must be between %d and %d characters long": {
+		RU: "длина тега должна быть между %d и %d символами",
+	},
 	"test %d is a draft": {
 		RU: "тест %d всё ещё черновик",
 	},
+	"test case %q was not reported": {
+		RU: "тестовый случай %q не был выполнен",
+	},
 	"test error": {
 		RU: "тестовая ошибка",
 		FR: "",
 	},
+	"test harness reported no test cases": {
+		RU: "тестовая обвязка не сообщила ни об одном тестовом случае",
+	},
 	"test panic": {
 		RU: "тестовая паника",
 		FR: "",
@@ -562,6 +1128,27 @@ var Localizations = l10n.Localizations{
 	"test name length must be between %d and %d characters long": {
 		RU: "имя теста должно содержать от %d до %d символов",
 	},
+	"this lesson is locked, score at least %d%% on previous lessons to unlock it": {
+		RU: "этот урок закрыт, наберите не менее %d%% за предыдущие уроки, чтобы открыть его",
+	},
+	"too many programs are running now, try again later": {
+		RU: "сейчас запущено слишком много программ, попробуйте позже",
+	},
+	"unavailable": {
+		RU: "недоступен",
+	},
+	"unsupported document format %q version %d": {
+		RU: "неподдерживаемый формат документа %q версии %d",
+	},
+	"unsupported format %q": {
+		RU: "неподдерживаемый формат %q",
+	},
+	"unsupported step type %q": {
+		RU: "неподдерживаемый тип задания %q",
+	},
+	"user already owns this course": {
+		RU: "пользователь уже является владельцем этого курса",
+	},
 	"user with this ID does not exist": {
 		RU: "пользователя с таким ID не существует",
 	},
@@ -575,6 +1162,9 @@ var Localizations = l10n.Localizations{
 		RU: "проверка",
 		FR: "",
 	},
+	"was": {
+		RU: "было",
+	},
 	"with": {
 		RU: "с",
 		FR: "",
@@ -591,6 +1181,12 @@ var Localizations = l10n.Localizations{
 	"whoops... Your permissions are insufficient": {
 		RU: "упс... Ваших прав недостаточно для просмотра этой страницы",
 	},
+	"wrong answer": {
+		RU: "неправильный ответ",
+	},
+	"you are running programs too often, try again in %d seconds": {
+		RU: "вы слишком часто запускаете программы, попробуйте снова через %d секунд",
+	},
 	"you have to pass at least one step": {
 		RU: "вы должны выполнить хотя бы одно задание",
 		FR: "",
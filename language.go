@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	sys "syscall"
+	"time"
+	"unsafe"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/jail"
+	"github.com/anton2920/gofa/log"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* ProgrammingLanguage describes how solutions are compiled and run. Index of a language in 'ProgrammingLanguages' is stored in submissions and tasks, so languages in config must only be appended or disabled. */
+type ProgrammingLanguage struct {
+	Name         string
+	Compiler     string
+	CompilerArgs []string
+	Runner       string
+	RunnerArgs   []string
+	SourceFile   string
+	Executable   string
+
+	/* TimeMultiplier multiplies compilation and run timeouts for slow languages. Zero means 1. */
+	TimeMultiplier int
+
+	/* VersionCommand is run inside jail by self-test and its first line of output is displayed next to language name. */
+	VersionCommand []string
+
+	/* HelloWorld is a program, which must print 'SelfTestOutput'. Languages without it are not tested. */
+	HelloWorld string
+
+	Disabled bool
+
+	Version   string `json:"-"`
+	Available bool   `json:"-"`
+}
+
+/* LanguagesFile contains JSON array of 'ProgrammingLanguage'. If it does not exist, built-in languages are used. */
+const LanguagesFile = "languages.json"
+
+/* MaxProgrammingLanguages is limited by the number of bits in 'StepCommon.Languages'. */
+const MaxProgrammingLanguages = int(8 * unsafe.Sizeof(StepCommon{}.Languages))
+
+/* Default timeouts in seconds, which are multiplied by 'TimeMultiplier' of a language. See 'Configuration'. */
+const (
+	CompileTimeout = 5
+	RunTimeout     = 2
+)
+
+const SelfTestOutput = "Hello, world!"
+
+var ProgrammingLanguages = []ProgrammingLanguage{
+	{Name: "c", Compiler: "cc", SourceFile: "main.c", Executable: "./a.out", VersionCommand: []string{"cc", "--version"}, HelloWorld: "#include <stdio.h>\nint main(void) { puts(\"Hello, world!\"); return 0; }\n", Available: true},
+	{Name: "c++", Compiler: "c++", SourceFile: "main.cpp", Executable: "./a.out", VersionCommand: []string{"c++", "--version"}, HelloWorld: "#include <iostream>\nint main() { std::cout << \"Hello, world!\" << std::endl; }\n", Available: true},
+	{Name: "go", Compiler: "sh", CompilerArgs: []string{"-c", "/usr/local/bin/go-build"}, SourceFile: "main.go", Executable: "./main", TimeMultiplier: 2, VersionCommand: []string{"go", "version"}, HelloWorld: "package main\n\nfunc main() { println(\"Hello, world!\") }\n", Available: true},
+	{Name: "php", Compiler: "php", CompilerArgs: []string{"-l"}, Runner: "php", SourceFile: "main.php", VersionCommand: []string{"php", "--version"}, HelloWorld: "<?php echo \"Hello, world!\\n\";\n", Available: true},
+	{Name: "python3", Compiler: "python3", CompilerArgs: []string{"-c", `import ast; ast.parse(open("main.py").read())`}, Runner: "python3", SourceFile: "main.py", VersionCommand: []string{"python3", "--version"}, HelloWorld: "print(\"Hello, world!\")\n", Available: true},
+}
+
+func ProgrammingLanguageVerify(lang *ProgrammingLanguage) error {
+	if lang.Name == "" {
+		return errors.New("name is empty")
+	}
+	if lang.SourceFile == "" {
+		return errors.New("source file is empty")
+	}
+	if (lang.Compiler == "") && (lang.Runner == "") {
+		return errors.New("either compiler or runner must be set")
+	}
+	if (lang.Runner == "") && (lang.Executable == "") {
+		return errors.New("executable must be set for languages without runner")
+	}
+	if lang.TimeMultiplier < 0 {
+		return errors.New("time multiplier must not be negative")
+	}
+	return nil
+}
+
+/* LoadProgrammingLanguages replaces built-in languages with ones from file. File must start with built-in languages in the same order, because their IDs are already stored in database. */
+func LoadProgrammingLanguages(filename string) error {
+	defer trace.End(trace.Begin(""))
+
+	var langs []ProgrammingLanguage
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &langs); err != nil {
+		return fmt.Errorf("failed to decode languages: %w", err)
+	}
+
+	if len(langs) == 0 {
+		return errors.New("no languages are defined")
+	}
+	if len(langs) > MaxProgrammingLanguages {
+		return fmt.Errorf("too many languages, maximum is %d", MaxProgrammingLanguages)
+	}
+	for i := 0; i < len(langs); i++ {
+		lang := &langs[i]
+
+		if err := ProgrammingLanguageVerify(lang); err != nil {
+			return fmt.Errorf("language %d: %w", i+1, err)
+		}
+		if (i < len(ProgrammingLanguages)) && (lang.Name != ProgrammingLanguages[i].Name) {
+			return fmt.Errorf("language %d: expected %q, new languages must be appended after built-in ones", i+1, ProgrammingLanguages[i].Name)
+		}
+		for j := 0; j < i; j++ {
+			if langs[j].Name == lang.Name {
+				return fmt.Errorf("language %d: duplicate name %q", i+1, lang.Name)
+			}
+		}
+		lang.Available = !lang.Disabled
+	}
+	if len(langs) < len(ProgrammingLanguages) {
+		return fmt.Errorf("expected at least %d languages, built-in languages may only be disabled", len(ProgrammingLanguages))
+	}
+
+	ProgrammingLanguages = langs
+	return nil
+}
+
+func ProgrammingLanguageTimeout(lang *ProgrammingLanguage, timeout int) int {
+	if lang.TimeMultiplier > 0 {
+		return timeout * lang.TimeMultiplier
+	}
+	return timeout
+}
+
+/* TODO(anton2920): rewrite without using standard library. */
+func ProgrammingLanguageProbeVersion(j jail.Jail, lang *ProgrammingLanguage) (string, error) {
+	defer trace.End(trace.Begin(""))
+
+	var buffer bytes.Buffer
+
+	cmd := exec.Command(lang.VersionCommand[0], lang.VersionCommand[1:]...)
+	cmd.Dir = "/tmp"
+	cmd.SysProcAttr = &sys.SysProcAttr{Setsid: true, Jail: int(j.ID)}
+	cmd.Stdout = &buffer
+	cmd.Stderr = &buffer
+
+	done := make(chan struct{})
+
+	var timeoutExceeded int32
+	go SubmissionVerifyProgramWatchdog(cmd, time.Duration(ProgrammingLanguageTimeout(lang, Config.CompileTimeout)), done, &timeoutExceeded)
+
+	err := cmd.Run()
+	close(done)
+
+	if atomic.LoadInt32(&timeoutExceeded) == 1 {
+		return "", errors.New("version command exceeded timeout")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to run version command: %s %w", buffer.String(), err)
+	}
+
+	version, _, _ := strings.Cut(strings.TrimSpace(buffer.String()), "\n")
+	return version, nil
+}
+
+/* ProgrammingLanguageSelfTest compiles and runs 'HelloWorld' program of a language and probes its version. */
+func ProgrammingLanguageSelfTest(lang *ProgrammingLanguage) error {
+	defer trace.End(trace.Begin(""))
+
+	var output bytes.Buffer
+	var runErr error
+
+	if lang.HelloWorld == "" {
+		return nil
+	}
+
+	if err := SubmissionVerifyProgrammingInJail(GL, lang, nil, lang.HelloWorld, func(j jail.Jail) {
+		if len(lang.VersionCommand) > 0 {
+			version, err := ProgrammingLanguageProbeVersion(j, lang)
+			if err != nil {
+				log.Warnf("Failed to get version of %q: %v", lang.Name, err)
+			}
+			lang.Version = version
+		}
+		runErr = SubmissionVerifyProgrammingRun(GL, j, lang, nil, "", &output)
+	}); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return runErr
+	}
+
+	if actualOutput := strings.TrimSpace(output.String()); actualOutput != SelfTestOutput {
+		return fmt.Errorf("expected %q, got %q", SelfTestOutput, actualOutput)
+	}
+	return nil
+}
+
+/* ProgrammingLanguagesSelfTest marks languages, which fail self-test, as unavailable. */
+func ProgrammingLanguagesSelfTest() {
+	defer trace.End(trace.Begin(""))
+
+	for i := 0; i < len(ProgrammingLanguages); i++ {
+		lang := &ProgrammingLanguages[i]
+		if !lang.Available {
+			continue
+		}
+
+		if err := ProgrammingLanguageSelfTest(lang); err != nil {
+			log.Warnf("Programming language %q failed self-test and is unavailable: %v", lang.Name, err)
+			lang.Available = false
+			continue
+		}
+		log.Infof("Programming language %q is available (%s)", lang.Name, lang.Version)
+	}
+}
+
+/* ProgrammingLanguageAccepted returns true if programming task accepts solutions in language. */
+func ProgrammingLanguageAccepted(task *StepProgramming, id database.ID) bool {
+	return (task.Languages == 0) || ((id < database.ID(MaxProgrammingLanguages)) && ((task.Languages & (1 << uint(id))) != 0))
+}
+
+func GetProgrammingLanguageByName(name string) (database.ID, bool) {
+	for i := 0; i < len(ProgrammingLanguages); i++ {
+		if ProgrammingLanguages[i].Name == name {
+			return database.ID(i), true
+		}
+	}
+	return -1, false
+}
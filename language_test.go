@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/anton2920/gofa/database"
+)
+
+func TestLoadProgrammingLanguages(t *testing.T) {
+	builtin := ProgrammingLanguages
+	defer func() { ProgrammingLanguages = builtin }()
+
+	dir := t.TempDir()
+	filename := GetPath(dir, LanguagesFile)
+
+	expectedFail := [...]string{
+		`[]`,
+		`{}`,
+		`[{"Name": "java", "SourceFile": "Main.java"}]`,
+		`[{"Name": "java", "Compiler": "javac", "SourceFile": "Main.java"}]`,
+		`[{"Name": "", "Runner": "java", "SourceFile": "Main.java"}]`,
+		`[{"Name": "java", "Runner": "java", "SourceFile": "Main.java", "TimeMultiplier": -1}]`,
+		`[{"Name": "java", "Runner": "java", "SourceFile": "Main.java"}, {"Name": "java", "Runner": "java", "SourceFile": "Main.java"}]`,
+		`[{"Name": "rust", "Compiler": "rustc", "SourceFile": "main.rs", "Executable": "./main"}]`,
+	}
+	for _, data := range expectedFail {
+		if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write languages file: %v", err)
+		}
+		if err := LoadProgrammingLanguages(filename); err == nil {
+			t.Errorf("Expected error for %s, got nothing", data)
+		}
+	}
+
+	langs := append([]ProgrammingLanguage{}, builtin...)
+	langs[0].Disabled = true
+	langs = append(langs, ProgrammingLanguage{Name: "rust", Compiler: "rustc", SourceFile: "main.rs", Executable: "./main", TimeMultiplier: 3})
+	langs = append(langs, ProgrammingLanguage{Name: "haskell", Compiler: "ghc", SourceFile: "main.hs", Executable: "./main", Disabled: true})
+	data, err := json.Marshal(langs)
+	if err != nil {
+		t.Fatalf("Failed to encode languages: %v", err)
+	}
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatalf("Failed to write languages file: %v", err)
+	}
+	if err := LoadProgrammingLanguages(filename); err != nil {
+		t.Fatalf("Failed to load languages: %v", err)
+	}
+	n := len(builtin)
+	if (len(ProgrammingLanguages) != n+2) || (ProgrammingLanguages[0].Available) || (!ProgrammingLanguages[n].Available) || (ProgrammingLanguages[n+1].Available) {
+		t.Fatalf("Unexpected languages %+v", ProgrammingLanguages)
+	}
+	if timeout := ProgrammingLanguageTimeout(&ProgrammingLanguages[n], RunTimeout); timeout != 3*RunTimeout {
+		t.Errorf("Expected timeout %d, got %d", 3*RunTimeout, timeout)
+	}
+	if id, ok := GetProgrammingLanguageByName("haskell"); (!ok) || (id != database.ID(n+1)) {
+		t.Errorf("Expected haskell to have ID %d, got %d", n+1, id)
+	}
+
+	/* NOTE(anton2920): IDs of built-in languages must not change. */
+	ProgrammingLanguages = builtin
+	langs[0], langs[1] = langs[1], langs[0]
+	if data, err = json.Marshal(langs); err != nil {
+		t.Fatalf("Failed to encode languages: %v", err)
+	}
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatalf("Failed to write languages file: %v", err)
+	}
+	if err := LoadProgrammingLanguages(filename); err == nil {
+		t.Errorf("Expected error for reordered built-in languages, got nothing")
+	}
+}
+
+func TestProgrammingLanguageAccepted(t *testing.T) {
+	var task StepProgramming
+
+	if !ProgrammingLanguageAccepted(&task, 3) {
+		t.Errorf("Expected any language to be accepted by unrestricted task")
+	}
+
+	task.Languages = 1 << 4
+	if !ProgrammingLanguageAccepted(&task, 4) {
+		t.Errorf("Expected language 4 to be accepted")
+	}
+	if ProgrammingLanguageAccepted(&task, 3) {
+		t.Errorf("Expected language 3 not to be accepted")
+	}
+	if ProgrammingLanguageAccepted(&task, database.ID(MaxProgrammingLanguages+4)) {
+		t.Errorf("Expected language outside of mask not to be accepted")
+	}
+}
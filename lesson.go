@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"unsafe"
 
 	"github.com/anton2920/gofa/database"
@@ -30,11 +29,26 @@ type (
 
 		/* TODO(anton2920): I don't like this. */
 		Draft bool
+
+		/* Languages is a bit mask of programming languages accepted by programming task, zero means any. It fits into padding, which is zeroed in old records. */
+		Languages uint16
+
+		/* Files is an ID of 'TaskFiles' of programming task, zero means none. It fits into padding too. */
+		Files database.ID
+	}
+	/* QuestionSource is a question in a question bank, which test question was taken from. Questions with zero Version are not linked. */
+	QuestionSource struct {
+		ID      database.ID
+		Version int32
 	}
+
 	StepTest struct {
 		StepCommon
 
 		Questions []Question
+
+		/* Sources are either empty or have the same length as 'Questions'. They fit into padding of 'Step' union, which is zeroed in old records. */
+		Sources []QuestionSource
 	}
 	StepProgramming struct {
 		StepCommon
@@ -54,11 +68,22 @@ type (
 		ContainerID   database.ID
 		ContainerType LessonContainerType
 
+		/* Version is incremented every time lesson in a course is published. */
+		Version int32
+
+		/* SourceID is a course lesson this one was copied from and SourceVersion is its version the copy was last synced with. Lessons with zero SourceVersion are not linked. */
+		SourceID      database.ID
+		SourceVersion int32
+
+		/* RequiredScore is a minimum score in percents student must get on every earlier subject lesson before this one unlocks. It fits into padding, which is zeroed in old records. */
+		RequiredScore int32
+
 		Name        string
 		Theory      string
 		Steps       []Step
 		Submissions []database.ID
 
+		Blob Blob
 		Data [16384]byte
 	}
 
@@ -94,7 +119,7 @@ const (
 
 const (
 	LessonActive int32 = iota
-	_
+	LessonDeleted
 	LessonDraft
 )
 
@@ -237,17 +262,22 @@ func RemoveCheckAtIndex(vs []Check, i int) []Check {
 	return vs[:len(vs)-1]
 }
 
-func CreateLesson(lesson *Lesson) error {
+func CreateLessonTx(tx *Tx, lesson *Lesson) error {
 	defer trace.End(trace.Begin(""))
 
-	var err error
+	lesson.ID = NewIDTx(tx, LessonsDB)
 
-	lesson.ID, err = database.IncrementNextID(LessonsDB)
-	if err != nil {
-		return fmt.Errorf("failed to increment lesson ID: %w", err)
-	}
+	return SaveLessonTx(tx, lesson)
+}
 
-	return SaveLesson(lesson)
+func CreateLesson(lesson *Lesson) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := CreateLessonTx(&tx, lesson); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
 }
 
 func DBStep2Step(step *Step, data *byte) {
@@ -278,6 +308,9 @@ func DBStep2Step(step *Step, data *byte) {
 				question.Answers[j] = database.Offset2String(question.Answers[j], data)
 			}
 		}
+
+		slice = database.Offset2Slice(*(*[]byte)(unsafe.Pointer(&test.Sources)), data)
+		test.Sources = *(*[]QuestionSource)(unsafe.Pointer(&slice))
 	case StepTypeProgramming:
 		task, _ := Step2Programming(step)
 
@@ -296,11 +329,9 @@ func DBStep2Step(step *Step, data *byte) {
 	}
 }
 
-func DBLesson2Lesson(lesson *Lesson) {
+func DBLesson2Lesson(lesson *Lesson, data *byte) {
 	defer trace.End(trace.Begin(""))
 
-	data := &lesson.Data[0]
-
 	lesson.Name = database.Offset2String(lesson.Name, data)
 	lesson.Theory = database.Offset2String(lesson.Theory, data)
 
@@ -318,31 +349,98 @@ func DBLesson2Lesson(lesson *Lesson) {
 func GetLessonByID(id database.ID, lesson *Lesson) error {
 	defer trace.End(trace.Begin(""))
 
-	if err := database.Read(LessonsDB, id, unsafe.Pointer(lesson), int(unsafe.Sizeof(*lesson))); err != nil {
+	if err := DBRead(LessonsDB, id, unsafe.Pointer(lesson), int(unsafe.Sizeof(*lesson))); err != nil {
+		return err
+	}
+	if lesson.ID != id {
+		return database.NotFound
+	}
+
+	data, err := GetBlobData(&lesson.Blob, lesson.Data[:])
+	if err != nil {
 		return err
 	}
 
-	DBLesson2Lesson(lesson)
+	DBLesson2Lesson(lesson, data)
 	return nil
 }
 
 func GetLessons(pos *int64, lessons []Lesson) (int, error) {
 	defer trace.End(trace.Begin(""))
 
-	n, err := database.ReadMany(LessonsDB, pos, *(*[]byte)(unsafe.Pointer(&lessons)), int(unsafe.Sizeof(lessons[0])))
+	n, err := DBReadManyValid(LessonsDB, pos, lessons, func(lesson *Lesson) database.ID { return lesson.ID })
 	if err != nil {
 		return 0, err
 	}
 
 	for i := 0; i < n; i++ {
-		DBLesson2Lesson(&lessons[i])
+		data, err := GetBlobData(&lessons[i].Blob, lessons[i].Data[:])
+		if err != nil {
+			return 0, err
+		}
+		DBLesson2Lesson(&lessons[i], data)
 	}
 	return n, nil
 }
 
+func DeleteLessonByIDTx(tx *Tx, id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	flags := LessonDeleted
+	var lesson Lesson
+
+	offset := int64(int(id)*int(unsafe.Sizeof(lesson))) + database.DataOffset + int64(unsafe.Offsetof(lesson.Flags))
+	tx.WriteAt(LessonsDB, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
+
+	tx.OnCommit(func() { UnindexLesson(id) })
+	return nil
+}
+
+func StepDataSize(step *Step) int {
+	defer trace.End(trace.Begin(""))
+
+	size := DBStringSize(step.Name)
+
+	switch step.Type {
+	default:
+		panic("invalid step type")
+	case StepTypeTest:
+		test, _ := Step2Test(step)
+
+		for i := 0; i < len(test.Questions); i++ {
+			question := &test.Questions[i]
+
+			size += DBStringSize(question.Name)
+			for j := 0; j < len(question.Answers); j++ {
+				size += DBStringSize(question.Answers[j])
+			}
+			size += DBSliceSize(question.Answers)
+			size += DBSliceSize(question.CorrectAnswers)
+		}
+		size += DBSliceSize(test.Questions)
+		size += DBSliceSize(test.Sources)
+	case StepTypeProgramming:
+		task, _ := Step2Programming(step)
+
+		size += DBStringSize(task.Description)
+		for i := 0; i < len(task.Checks); i++ {
+			for j := 0; j < len(task.Checks[i]); j++ {
+				check := &task.Checks[i][j]
+				size += DBStringSize(check.Input) + DBStringSize(check.Output)
+			}
+			size += DBSliceSize(task.Checks[i])
+		}
+	}
+
+	return size
+}
+
+/* Step2DBStep returns number of bytes written to 'data' starting at 'n'. */
 func Step2DBStep(ds *Step, ss *Step, data []byte, n int) int {
 	defer trace.End(trace.Begin(""))
 
+	start := n
+
 	ds.Draft = ss.Draft
 
 	n += database.String2DBString(&ds.Name, ss.Name, data, n)
@@ -372,12 +470,15 @@ func Step2DBStep(ds *Step, ss *Step, data []byte, n int) int {
 			n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&dq.CorrectAnswers)), *(*[]byte)(unsafe.Pointer(&sq.CorrectAnswers)), int(unsafe.Sizeof(sq.CorrectAnswers[0])), int(unsafe.Alignof(sq.CorrectAnswers[0])), data, n)
 		}
 		n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&dt.Questions)), *(*[]byte)(unsafe.Pointer(&dt.Questions)), int(unsafe.Sizeof(dt.Questions[0])), int(unsafe.Alignof(dt.Questions[0])), data, n)
+		n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&dt.Sources)), *(*[]byte)(unsafe.Pointer(&st.Sources)), int(unsafe.Sizeof(st.Sources[0])), int(unsafe.Alignof(st.Sources[0])), data, n)
 	case StepTypeProgramming:
 		st, _ := Step2Programming(ss)
 
 		ds.Type = StepTypeProgramming
 		dt, _ := Step2Programming(ds)
 
+		dt.Languages = st.Languages
+		dt.Files = st.Files
 		n += database.String2DBString(&dt.Description, st.Description, data, n)
 
 		for i := 0; i < len(st.Checks); i++ {
@@ -393,10 +494,25 @@ func Step2DBStep(ds *Step, ss *Step, data []byte, n int) int {
 		}
 	}
 
-	return n
+	return n - start
 }
 
-func SaveLesson(lesson *Lesson) error {
+func LessonDataSize(lesson *Lesson) int {
+	defer trace.End(trace.Begin(""))
+
+	var size int
+
+	for i := 0; i < len(lesson.Steps); i++ {
+		size += StepDataSize(&lesson.Steps[i])
+	}
+	size += DBStringSize(lesson.Name) + DBStringSize(lesson.Theory)
+	size += DBSliceSize(lesson.Steps)
+	size += DBSliceSize(lesson.Submissions)
+
+	return size
+}
+
+func SaveLessonTx(tx *Tx, lesson *Lesson) error {
 	defer trace.End(trace.Begin(""))
 
 	var lessonDB Lesson
@@ -406,9 +522,16 @@ func SaveLesson(lesson *Lesson) error {
 	lessonDB.Flags = lesson.Flags
 	lessonDB.ContainerID = lesson.ContainerID
 	lessonDB.ContainerType = lesson.ContainerType
+	lessonDB.Version = lesson.Version
+	lessonDB.SourceID = lesson.SourceID
+	lessonDB.SourceVersion = lesson.SourceVersion
+	lessonDB.RequiredScore = lesson.RequiredScore
+
+	data, err := GetDataBuffer(lessonDB.Data[:], LessonDataSize(lesson))
+	if err != nil {
+		return err
+	}
 
-	/* TODO(anton2920): save up to a sizeof(lesson.Data). */
-	data := unsafe.Slice(&lessonDB.Data[0], len(lessonDB.Data))
 	lessonDB.Steps = make([]Step, len(lesson.Steps))
 	for i := 0; i < len(lesson.Steps); i++ {
 		n += Step2DBStep(&lessonDB.Steps[i], &lesson.Steps[i], data, n)
@@ -419,7 +542,25 @@ func SaveLesson(lesson *Lesson) error {
 	n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&lessonDB.Steps)), *(*[]byte)(unsafe.Pointer(&lessonDB.Steps)), int(unsafe.Sizeof(lessonDB.Steps[0])), int(unsafe.Alignof(lessonDB.Steps[0])), data, n)
 	n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&lessonDB.Submissions)), *(*[]byte)(unsafe.Pointer(&lesson.Submissions)), int(unsafe.Sizeof(lesson.Submissions[0])), int(unsafe.Alignof(lesson.Submissions[0])), data, n)
 
-	return database.Write(LessonsDB, lessonDB.ID, unsafe.Pointer(&lessonDB), int(unsafe.Sizeof(lessonDB)))
+	if err := SaveBlob(&lessonDB.Blob, lessonDB.Data[:], data[:n]); err != nil {
+		return err
+	}
+
+	tx.Write(LessonsDB, lessonDB.ID, unsafe.Pointer(&lessonDB), int(unsafe.Sizeof(lessonDB)))
+
+	id, questions := lesson.ID, LessonQuestionIDs(lesson)
+	tx.OnCommit(func() { IndexLesson(id, questions) })
+	return nil
+}
+
+func SaveLesson(lesson *Lesson) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := SaveLessonTx(&tx, lesson); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
 }
 
 func StepStringType(l Language, s *Step) string {
@@ -524,6 +665,10 @@ func DisplayLessonSubmissions(w *http.Response, l Language, lesson *Lesson, user
 			}
 			if displayed {
 				w.WriteString(`</ul>`)
+
+				if lesson.ContainerType == LessonContainerSubject {
+					DisplayLessonRejudgeForm(w, l, lesson)
+				}
 			}
 		}
 	case SubjectUserStudent:
@@ -595,7 +740,9 @@ func LessonPageHandler(w *http.Response, r *http.Request) error {
 	const width = WidthLarge
 
 	var container *LessonContainer
+	var states []LessonState
 	var who SubjectUserType
+	var threads []int
 	var lesson Lesson
 
 	session, err := GetSessionFromRequest(r)
@@ -624,12 +771,12 @@ func LessonPageHandler(w *http.Response, r *http.Request) error {
 		if err := GetUserByID(session.ID, &user); err != nil {
 			return http.ServerError(err)
 		}
-		if !UserOwnsCourse(&user, lesson.ContainerID) {
-			return ForbiddenError
-		}
 		if err := GetCourseByID(lesson.ContainerID, &course); err != nil {
 			return http.ServerError(err)
 		}
+		if UserCourseAccess(&user, &course) == CourseAccessNone {
+			return ForbiddenError
+		}
 		container = &course.LessonContainer
 	case LessonContainerSubject:
 		var subject Subject
@@ -644,6 +791,19 @@ func LessonPageHandler(w *http.Response, r *http.Request) error {
 		if who == SubjectUserNone {
 			return ForbiddenError
 		}
+		if who == SubjectUserStudent {
+			states, err = GetUserLessonStates(session.ID, subject.Lessons)
+			if err != nil {
+				return http.ServerError(err)
+			}
+			if err := LessonCheckUnlocked(GL, subject.Lessons, states, &lesson); err != nil {
+				return err
+			}
+		}
+		threads, err = GetLessonThreadsCounts(&lesson, who)
+		if err != nil {
+			return http.ServerError(err)
+		}
 		container = &subject.LessonContainer
 	}
 
@@ -659,8 +819,8 @@ func LessonPageHandler(w *http.Response, r *http.Request) error {
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
-		DisplaySidebarWithLessons(w, GL, session, container.Lessons)
+		DisplayHeader(w, GL, session)
+		DisplaySidebarWithLessons(w, GL, session, container.Lessons, states)
 
 		DisplayMainStart(w)
 
@@ -678,12 +838,17 @@ func LessonPageHandler(w *http.Response, r *http.Request) error {
 			w.WriteString(`</h2>`)
 			w.WriteString(`<br>`)
 
+			DisplayLessonRequiredScore(w, GL, &lesson)
+
 			w.WriteString(`<h3>`)
 			w.WriteString(Ls(GL, "Theory"))
 			w.WriteString(`</h3>`)
 
 			DisplayFrameStart(w)
 			DisplayMarkdown(w, lesson.Theory)
+			if threads != nil {
+				DisplayDiscussionLink(w, GL, lesson.ID, LessonThread, threads[len(lesson.Steps)])
+			}
 			DisplayFrameEnd(w)
 
 			if len(lesson.Steps) > 0 {
@@ -715,11 +880,24 @@ func LessonPageHandler(w *http.Response, r *http.Request) error {
 					w.WriteString(StepStringType(GL, step))
 					w.WriteString(`</span>`)
 
+					if (who == SubjectUserAdmin) || (who == SubjectUserTeacher) {
+						w.WriteString(`<br>`)
+						DisplayStepAnalyticsLink(w, GL, lesson.ID, i)
+					}
+					if threads != nil {
+						w.WriteString(`<br>`)
+						DisplayDiscussionLink(w, GL, lesson.ID, i, threads[i])
+					}
+
 					DisplayFrameEnd(w)
 				}
 			}
 
 			DisplayLessonSubmissions(w, GL, &lesson, session.ID, who)
+
+			if (lesson.ContainerType == LessonContainerCourse) || (who == SubjectUserAdmin) || (who == SubjectUserTeacher) {
+				DisplayExportForm(w, GL, "/api/lesson/export", lesson.ID)
+			}
 		}
 		DisplayPageEnd(w)
 		DisplayMainEnd(w)
@@ -758,6 +936,9 @@ func StepDeepCopy(dst *Step, src *Step) {
 			dq.CorrectAnswers = make([]int, len(sq.CorrectAnswers))
 			copy(dq.CorrectAnswers, sq.CorrectAnswers)
 		}
+
+		ds.Sources = make([]QuestionSource, len(ss.Sources))
+		copy(ds.Sources, ss.Sources)
 	case StepTypeProgramming:
 		ss, _ := Step2Programming(src)
 
@@ -765,6 +946,8 @@ func StepDeepCopy(dst *Step, src *Step) {
 		ds, _ := Step2Programming(dst)
 
 		ds.Name = ss.Name
+		ds.Languages = ss.Languages
+		ds.Files = ss.Files
 		ds.Description = ss.Description
 
 		ds.Checks[CheckTypeExample] = make([]Check, len(ss.Checks[CheckTypeExample]))
@@ -775,7 +958,7 @@ func StepDeepCopy(dst *Step, src *Step) {
 	}
 }
 
-func LessonsDeepCopy(dst *[]database.ID, src []database.ID, containerID database.ID, containerType LessonContainerType) {
+func LessonsDeepCopyTx(tx *Tx, dst *[]database.ID, src []database.ID, containerID database.ID, containerType LessonContainerType) error {
 	defer trace.End(trace.Begin(""))
 
 	*dst = make([]database.ID, len(src))
@@ -784,13 +967,24 @@ func LessonsDeepCopy(dst *[]database.ID, src []database.ID, containerID database
 		var sl, dl Lesson
 
 		if err := GetLessonByID(src[i], &sl); err != nil {
-			/* TODO(anton2920): report error. */
+			return err
 		}
 
 		dl.Flags = sl.Flags
 		dl.ContainerID = containerID
 		dl.ContainerType = containerType
+		switch containerType {
+		case LessonContainerCourse:
+			/* NOTE(anton2920): forked courses are independent from their sources. */
+			dl.Version = 1
+		case LessonContainerSubject:
+			if sl.ContainerType == LessonContainerCourse {
+				dl.SourceID = sl.ID
+				dl.SourceVersion = sl.Version
+			}
+		}
 
+		dl.RequiredScore = sl.RequiredScore
 		dl.Name = sl.Name
 		dl.Theory = sl.Theory
 		dl.Steps = make([]Step, len(sl.Steps))
@@ -798,11 +992,23 @@ func LessonsDeepCopy(dst *[]database.ID, src []database.ID, containerID database
 			StepDeepCopy(&dl.Steps[j], &sl.Steps[j])
 		}
 
-		if err := CreateLesson(&dl); err != nil {
-			/* TODO(anton2920): report error. */
+		if err := CreateLessonTx(tx, &dl); err != nil {
+			return err
 		}
 		(*dst)[i] = dl.ID
 	}
+
+	return nil
+}
+
+func LessonsDeepCopy(dst *[]database.ID, src []database.ID, containerID database.ID, containerType LessonContainerType) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := LessonsDeepCopyTx(&tx, dst, src, containerID, containerType); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
 }
 
 func DisplayLessonsEditableList(w *http.Response, l Language, lessons []database.ID) {
@@ -849,11 +1055,21 @@ func DisplayLessonsEditableList(w *http.Response, l Language, lessons []database
 	}
 }
 
-func LessonFillFromRequest(vs url.Values, lesson *Lesson) {
+func LessonFillFromRequest(vs url.Values, lesson *Lesson) error {
 	defer trace.End(trace.Begin(""))
 
 	lesson.Name = vs.Get("Name")
 	lesson.Theory = vs.Get("Theory")
+
+	if vs.Get("RequiredScore") != "" {
+		requiredScore, err := vs.GetInt("RequiredScore")
+		if err != nil {
+			return err
+		}
+		lesson.RequiredScore = int32(requiredScore)
+	}
+
+	return nil
 }
 
 func LessonVerify(l Language, lesson *Lesson) error {
@@ -867,6 +1083,10 @@ func LessonVerify(l Language, lesson *Lesson) error {
 		return http.BadRequest(Ls(l, "lesson theory length must be between %d and %d characters long"), MinTheoryLen, MaxTheoryLen)
 	}
 
+	if (lesson.RequiredScore < MinRequiredScore) || (lesson.RequiredScore > MaxRequiredScore) {
+		return http.BadRequest(Ls(l, "required score must be between %d and %d"), MinRequiredScore, MaxRequiredScore)
+	}
+
 	for si := 0; si < len(lesson.Steps); si++ {
 		step := &lesson.Steps[si]
 
@@ -882,6 +1102,10 @@ func LessonVerify(l Language, lesson *Lesson) error {
 		}
 	}
 
+	if LessonDataSize(lesson) > MaxBlobLen {
+		return http.BadRequest(Ls(l, "lesson is too large, maximum size is %d bytes"), MaxBlobLen)
+	}
+
 	return nil
 }
 
@@ -930,6 +1154,7 @@ func LessonTestFillFromRequest(vs url.Values, test *StepTest) error {
 		question.CorrectAnswers = question.CorrectAnswers[:len(correctAnswers)]
 	}
 	test.Questions = test.Questions[:len(questions)]
+	LessonTestFitSources(test)
 
 	return nil
 }
@@ -983,7 +1208,7 @@ func LessonAddTestPageHandler(w *http.Response, r *http.Request, session *Sessio
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -1022,7 +1247,16 @@ func LessonAddTestPageHandler(w *http.Response, r *http.Request, session *Sessio
 				w.WriteString(Ls(GL, "Question"))
 				w.WriteString(` #`)
 				w.WriteInt(i + 1)
-				w.WriteString(`</b></p>`)
+				w.WriteString(`</b>`)
+				if (i < len(test.Sources)) && (test.Sources[i].Version != 0) {
+					w.WriteString(` (<a href="/question/`)
+					w.WriteInt(int(test.Sources[i].ID))
+					w.WriteString(`">`)
+					w.WriteString(Ls(GL, "from question bank"))
+					w.WriteString(`</a>) `)
+					DisplayIndexedCommand(w, GL, i, "Unlink")
+				}
+				w.WriteString(`</p>`)
 
 				DisplayLabel(w, GL, "Title")
 				DisplayConstraintInput(w, "text", MinQuestionLen, MaxQuestionLen, "Question", question.Name, true)
@@ -1089,6 +1323,9 @@ func LessonAddTestPageHandler(w *http.Response, r *http.Request, session *Sessio
 			DisplayCommand(w, GL, "Add another question")
 			w.WriteString(`<br><br>`)
 
+			DisplayLessonTestBank(w, GL, session.ID)
+			w.WriteString(`<br>`)
+
 			DisplaySubmit(w, GL, "NextPage", "Continue", true)
 		}
 		DisplayPageEnd(w)
@@ -1107,6 +1344,16 @@ func LessonProgrammingFillFromRequest(vs url.Values, task *StepProgramming) erro
 	task.Name = vs.Get("Name")
 	task.Description = vs.Get("Description")
 
+	task.Languages = 0
+	languages := vs.GetMany("Language")
+	for i := 0; i < len(languages); i++ {
+		id, err := GetValidID(languages[i], database.ID(len(ProgrammingLanguages)))
+		if err != nil {
+			return http.ClientError(err)
+		}
+		task.Languages |= 1 << uint(id)
+	}
+
 	for i := 0; i < len(CheckKeys); i++ {
 		checks := &task.Checks[i]
 
@@ -1128,12 +1375,32 @@ func LessonProgrammingFillFromRequest(vs url.Values, task *StepProgramming) erro
 		}
 	}
 
+	var files TaskFiles
+	if err := TaskFilesFillFromRequest(vs, &files); err != nil {
+		return err
+	}
+	if err := SaveStepTaskFiles(task, &files); err != nil {
+		return http.ServerError(err)
+	}
+
 	return nil
 }
 
 func LessonProgrammingVerify(task *StepProgramming) error {
 	defer trace.End(trace.Begin(""))
 
+	var files TaskFiles
+
+	if err := GetStepTaskFiles(task, &files); err != nil {
+		return http.ServerError(err)
+	}
+	return LessonProgrammingVerifyWithFiles(task, &files)
+}
+
+/* LessonProgrammingVerifyWithFiles verifies task, which has 'files' instead of ones referenced by 'task.Files'. */
+func LessonProgrammingVerifyWithFiles(task *StepProgramming, files *TaskFiles) error {
+	defer trace.End(trace.Begin(""))
+
 	if !strings.LengthInRange(task.Name, MinStepNameLen, MaxStepNameLen) {
 		return http.BadRequest("programming task name length must be between %d and %d characters long", MinStepNameLen, MaxStepNameLen)
 	}
@@ -1142,18 +1409,24 @@ func LessonProgrammingVerify(task *StepProgramming) error {
 		return http.BadRequest("programming task description length must be between %d and %d characters long", MinDescriptionLen, MaxDescriptionLen)
 	}
 
+	/* NOTE(anton2920): harness and interactor may not need any input and decide verdict themselves, so checks of such tasks may be empty. */
+	minCheckLen := MinCheckLen
+	if (files.Harness != "") || (files.Interactor != "") {
+		minCheckLen = 0
+	}
+
 	for i := 0; i < len(task.Checks); i++ {
 		checks := task.Checks[i]
 
 		for j := 0; j < len(checks); j++ {
 			check := &checks[j]
 
-			if !strings.LengthInRange(check.Input, MinCheckLen, MaxCheckLen) {
-				return http.BadRequest("%s %d: input length must be between %d and %d characters long", CheckKeys[i][CheckKeyDisplay], j+1, MinCheckLen, MaxCheckLen)
+			if !strings.LengthInRange(check.Input, minCheckLen, MaxCheckLen) {
+				return http.BadRequest("%s %d: input length must be between %d and %d characters long", CheckKeys[i][CheckKeyDisplay], j+1, minCheckLen, MaxCheckLen)
 			}
 
-			if !strings.LengthInRange(check.Output, MinCheckLen, MaxCheckLen) {
-				return http.BadRequest("%s %d: output length must be between %d and %d characters long", CheckKeys[i][CheckKeyDisplay], j+1, MinCheckLen, MaxCheckLen)
+			if !strings.LengthInRange(check.Output, minCheckLen, MaxCheckLen) {
+				return http.BadRequest("%s %d: output length must be between %d and %d characters long", CheckKeys[i][CheckKeyDisplay], j+1, minCheckLen, MaxCheckLen)
 			}
 		}
 	}
@@ -1161,7 +1434,7 @@ func LessonProgrammingVerify(task *StepProgramming) error {
 	return nil
 }
 
-func LessonAddProgrammingDisplayChecks(w *http.Response, l Language, task *StepProgramming, checkType CheckType) {
+func LessonAddProgrammingDisplayChecks(w *http.Response, l Language, task *StepProgramming, checkType CheckType, required bool) {
 	defer trace.End(trace.Begin(""))
 
 	checks := task.Checks[checkType]
@@ -1175,13 +1448,13 @@ func LessonAddProgrammingDisplayChecks(w *http.Response, l Language, task *StepP
 		w.WriteString(`<label>`)
 		w.WriteString(Ls(l, "Input"))
 		w.WriteString(`: `)
-		DisplayConstraintInlineTextarea(w, MinCheckLen, MaxCheckLen, CheckKeys[checkType][CheckKeyInput], check.Input, true)
+		DisplayConstraintInlineTextarea(w, MinCheckLen, MaxCheckLen, CheckKeys[checkType][CheckKeyInput], check.Input, required)
 		w.WriteString(`</label> `)
 
 		w.WriteString(`<label>`)
 		w.WriteString(Ls(l, "output"))
 		w.WriteString(`: `)
-		DisplayConstraintInlineTextarea(w, MinCheckLen, MaxCheckLen, CheckKeys[checkType][CheckKeyOutput], check.Output, true)
+		DisplayConstraintInlineTextarea(w, MinCheckLen, MaxCheckLen, CheckKeys[checkType][CheckKeyOutput], check.Output, required)
 		w.WriteString(`</label>`)
 
 		DisplayDoublyIndexedCommand(w, l, i, int(checkType), "-")
@@ -1199,11 +1472,44 @@ func LessonAddProgrammingDisplayChecks(w *http.Response, l Language, task *StepP
 	w.WriteString(`</ol>`)
 }
 
+func LessonAddProgrammingDisplayLanguages(w *http.Response, l Language, task *StepProgramming) {
+	defer trace.End(trace.Begin(""))
+
+	DisplayLabel(w, l, "Accepted programming languages (none means any)")
+	for i := 0; i < len(ProgrammingLanguages); i++ {
+		lang := &ProgrammingLanguages[i]
+
+		w.WriteString(`<label class="me-3"><input type="checkbox" name="Language" value="`)
+		w.WriteInt(i)
+		w.WriteString(`"`)
+		if (task.Languages & (1 << uint(i))) != 0 {
+			w.WriteString(` checked`)
+		}
+		w.WriteString(`> `)
+		w.WriteHTMLString(lang.Name)
+		if !lang.Available {
+			w.WriteString(` (`)
+			w.WriteString(Ls(l, "unavailable"))
+			w.WriteString(`)`)
+		}
+		w.WriteString(`</label>`)
+	}
+	w.WriteString(`<br><br>`)
+}
+
 func LessonAddProgrammingPageHandler(w *http.Response, r *http.Request, session *Session, container *LessonContainer, lesson *Lesson, task *StepProgramming, err error) error {
 	defer trace.End(trace.Begin(""))
 
 	const width = WidthLarge
 
+	var files TaskFiles
+	if r.Form.Get("CurrentPage") == "Programming" {
+		/* NOTE(anton2920): invalid files are not saved, so they are displayed from request to be fixed. */
+		TaskFilesFillFromRequest(r.Form, &files)
+	} else if err := GetStepTaskFiles(task, &files); err != nil {
+		return http.ServerError(err)
+	}
+
 	DisplayHTMLStart(w)
 
 	DisplayHeadStart(w)
@@ -1216,7 +1522,7 @@ func LessonAddProgrammingPageHandler(w *http.Response, r *http.Request, session
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -1247,20 +1553,25 @@ func LessonAddProgrammingPageHandler(w *http.Response, r *http.Request, session
 			DisplayConstraintTextarea(w, MinDescriptionLen, MaxDescriptionLen, "Description", task.Description, true)
 			w.WriteString(`<br>`)
 
+			LessonAddProgrammingDisplayLanguages(w, GL, task)
+
 			w.WriteString(`<h4>`)
 			w.WriteString(Ls(GL, "Examples"))
 			w.WriteString(`</h4>`)
-			LessonAddProgrammingDisplayChecks(w, GL, task, CheckTypeExample)
+			LessonAddProgrammingDisplayChecks(w, GL, task, CheckTypeExample, (files.Harness == "") && (files.Interactor == ""))
 			DisplayCommand(w, GL, "Add example")
 			w.WriteString(`<br><br>`)
 
 			w.WriteString(`<h4>`)
 			w.WriteString(Ls(GL, "Tests"))
 			w.WriteString(`</h4>`)
-			LessonAddProgrammingDisplayChecks(w, GL, task, CheckTypeTest)
+			LessonAddProgrammingDisplayChecks(w, GL, task, CheckTypeTest, (files.Harness == "") && (files.Interactor == ""))
 			DisplayCommand(w, GL, "Add test")
 			w.WriteString(`<br><br>`)
 
+			DisplayTaskFilesInputs(w, GL, &files)
+			w.WriteString(`<br>`)
+
 			DisplaySubmit(w, GL, "NextPage", "Continue", true)
 		}
 		DisplayPageEnd(w)
@@ -1320,7 +1631,7 @@ func LessonAddPageHandler(w *http.Response, r *http.Request, session *Session, c
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -1349,6 +1660,10 @@ func LessonAddPageHandler(w *http.Response, r *http.Request, session *Session, c
 			DisplayConstraintTextarea(w, MinTheoryLen, MaxTheoryLen, "Theory", lesson.Theory, true)
 			w.WriteString(`<br>`)
 
+			DisplayLabel(w, GL, "Required score on previous lessons, %")
+			DisplayNumberInput(w, MinRequiredScore, MaxRequiredScore, "RequiredScore", int(lesson.RequiredScore), false)
+			w.WriteString(`<br>`)
+
 			for i := 0; i < len(lesson.Steps); i++ {
 				step := &lesson.Steps[i]
 
@@ -1497,11 +1812,57 @@ func LessonAddHandleCommand(w *http.Response, r *http.Request, l Language, sessi
 			}
 		case Ls(l, "Add another question"):
 			test.Questions = append(test.Questions, Question{})
+			LessonTestFitSources(test)
 		case Ls(l, "Delete"):
 			test.Questions = RemoveQuestionAtIndex(test.Questions, pindex)
+			test.Sources = RemoveAt(test.Sources, pindex)
+		case Ls(l, "Unlink"):
+			if (pindex < 0) || (pindex >= len(test.Sources)) {
+				return http.ClientError(nil)
+			}
+			test.Sources[pindex] = QuestionSource{}
+		case Ls(l, "Add selected questions"):
+			ids := r.Form.GetMany("BankQuestionID")
+			for i := 0; i < len(ids); i++ {
+				var bq BankQuestion
+
+				id, err := GetValidID(ids[i], database.MaxValidID)
+				if err != nil {
+					return http.ClientError(err)
+				}
+				if err := GetBankQuestionByID(id, &bq); err != nil {
+					if err == database.NotFound {
+						return http.NotFound("%s", Ls(l, "question with this ID does not exist"))
+					}
+					return http.ServerError(err)
+				}
+				if (bq.OwnerID != session.ID) || (bq.Flags == BankQuestionDeleted) {
+					return ForbiddenError
+				}
+				if !LessonTestHasBankQuestion(test, bq.ID) {
+					LessonTestAddBankQuestion(test, &bq)
+				}
+			}
+		case Ls(l, "Add random questions"):
+			tag := NormalizeTag(r.Form.Get("BankTag"))
+
+			difficulty, err := GetValidIndex(r.Form.Get("BankDifficulty"), len(QuestionDifficulties))
+			if err != nil {
+				return http.ClientError(err)
+			}
+
+			count, err := r.Form.GetInt("BankCount")
+			if err != nil {
+				return http.ClientError(err)
+			}
+
+			if err := LessonTestDrawBankQuestions(l, test, session.ID, tag, QuestionDifficulty(difficulty), count); err != nil {
+				return LessonAddTestPageHandler(w, r, session, container, &lesson, test, err)
+			}
 		case "↑", "^|":
 			if ssindex == "" {
 				MoveQuestionUp(test.Questions, pindex)
+				MoveUp(test.Sources, pindex)
 			} else {
 				if (pindex < 0) || (pindex >= len(test.Questions)) {
 					return http.ClientError(nil)
@@ -1528,6 +1889,7 @@ func LessonAddHandleCommand(w *http.Response, r *http.Request, l Language, sessi
 		case "↓", "|v":
 			if ssindex == "" {
 				MoveQuestionDown(test.Questions, pindex)
+				MoveDown(test.Sources, pindex)
 			} else {
 				if (pindex < 0) || (pindex >= len(test.Questions)) {
 					return http.ClientError(nil)
@@ -1,16 +1,22 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"net"
 	"os"
 	"runtime"
 	"runtime/pprof"
+	"strconv"
 	"sync/atomic"
+	sys "syscall"
+	stdtime "time"
 	"unsafe"
 
 	"github.com/anton2920/gofa/bytes"
 	"github.com/anton2920/gofa/errors"
 	"github.com/anton2920/gofa/event"
+	"github.com/anton2920/gofa/jail"
 	"github.com/anton2920/gofa/log"
 	"github.com/anton2920/gofa/mime/multipart"
 	"github.com/anton2920/gofa/net/http"
@@ -43,6 +49,12 @@ func HandlePageRequest(w *http.Response, r *http.Request, path string) error {
 		switch path {
 		case "/":
 			return IndexPageHandler(w, r)
+		case "/audit":
+			return AuditPageHandler(w, r)
+		case "/dashboard":
+			return DashboardPageHandler(w, r)
+		case "/metrics":
+			return MetricsHandler(w, r)
 		case "/new":
 			return NewHandler(w, r)
 		case "/new2":
@@ -54,8 +66,12 @@ func HandlePageRequest(w *http.Response, r *http.Request, path string) error {
 			return CoursePageHandler(w, r)
 		case "s":
 			return CoursesPageHandler(w, r)
+		case "s/library":
+			return CoursesLibraryPageHandler(w, r)
 		case "/create", "/edit":
 			return CourseCreateEditPageHandler(w, r)
+		case "/import":
+			return CourseImportPageHandler(w, r)
 		}
 	case strings.StartsWith(path, "/group"):
 		switch path[len("/group"):] {
@@ -72,11 +88,28 @@ func HandlePageRequest(w *http.Response, r *http.Request, path string) error {
 		switch path[len("/lesson"):] {
 		default:
 			return LessonPageHandler(w, r)
+		case "/analytics":
+			return LessonAnalyticsPageHandler(w, r)
+		case "/discussion":
+			return LessonDiscussionPageHandler(w, r)
 		}
-	case strings.StartsWith(path, "/step"):
-		switch path[len("/step"):] {
+	case strings.StartsWith(path, "/notification"):
+		switch path[len("/notification"):] {
+		default:
+			return NotificationPageHandler(w, r)
+		case "s":
+			return NotificationsPageHandler(w, r)
+		}
+	case strings.StartsWith(path, "/question"):
+		switch path[len("/question"):] {
+		default:
+			return QuestionPageHandler(w, r)
 		case "s":
-			return StepsPageHandler(w, r)
+			return QuestionBankPageHandler(w, r)
+		case "/create":
+			return QuestionCreatePageHandler(w, r)
+		case "/edit":
+			return QuestionEditPageHandler(w, r)
 		}
 	case strings.StartsWith(path, "/subject"):
 		switch path[len("/subject"):] {
@@ -90,6 +123,8 @@ func HandlePageRequest(w *http.Response, r *http.Request, path string) error {
 			return SubjectEditPageHandler(w, r, nil)
 		case "/lessons":
 			return SubjectLessonsPageHandler(w, r)
+		case "/sync":
+			return SubjectSyncPageHandler(w, r)
 		}
 	case strings.StartsWith(path, "/submission"):
 		switch path[len("/submission"):] {
@@ -97,6 +132,10 @@ func HandlePageRequest(w *http.Response, r *http.Request, path string) error {
 			return SubmissionPageHandler(w, r)
 		case "/new":
 			return SubmissionNewPageHandler(w, r)
+		case "/events":
+			return SubmissionEventsHandler(w, r)
+		case "/queue":
+			return VerifyJobsPageHandler(w, r)
 		case "/results":
 			return SubmissionResultsPageHandler(w, r)
 		}
@@ -122,10 +161,29 @@ func HandleAPIRequest(w *http.Response, r *http.Request, path string) error {
 	defer trace.End(trace.Begin(""))
 
 	switch {
+	case strings.StartsWith(path, "/announcement"):
+		switch path[len("/announcement"):] {
+		case "/create":
+			return AnnouncementCreateHandler(w, r)
+		case "/delete":
+			return AnnouncementDeleteHandler(w, r)
+		}
+	case path == "/backup":
+		return BackupHandler(w, r)
 	case strings.StartsWith(path, "/course"):
 		switch path[len("/course"):] {
 		case "/delete":
 			return CourseDeleteHandler(w, r)
+		case "/export":
+			return CourseExportHandler(w, r)
+		case "/fork":
+			return CourseForkHandler(w, r)
+		case "/publish":
+			return CoursePublishHandler(w, r)
+		case "/share":
+			return CourseShareHandler(w, r)
+		case "/unshare":
+			return CourseUnshareHandler(w, r)
 		}
 	case strings.StartsWith(path, "/group"):
 		switch path[len("/group"):] {
@@ -136,6 +194,34 @@ func HandleAPIRequest(w *http.Response, r *http.Request, path string) error {
 		case "/edit":
 			return GroupEditHandler(w, r)
 		}
+	case strings.StartsWith(path, "/lesson"):
+		switch path[len("/lesson"):] {
+		case "/export":
+			return LessonExportHandler(w, r)
+		case "/rejudge":
+			return LessonRejudgeHandler(w, r)
+		}
+	case strings.StartsWith(path, "/message"):
+		switch path[len("/message"):] {
+		case "/create":
+			return MessageCreateHandler(w, r)
+		case "/moderate":
+			return MessageModerateHandler(w, r)
+		}
+	case strings.StartsWith(path, "/notification"):
+		switch path[len("/notification"):] {
+		case "/read":
+			return NotificationReadHandler(w, r)
+		}
+	case strings.StartsWith(path, "/question"):
+		switch path[len("/question"):] {
+		case "/create":
+			return QuestionCreateHandler(w, r)
+		case "/delete":
+			return QuestionDeleteHandler(w, r)
+		case "/edit":
+			return QuestionEditHandler(w, r)
+		}
 	case strings.StartsWith(path, "/subject"):
 		switch path[len("/subject"):] {
 		case "/create":
@@ -186,12 +272,21 @@ func HandleFSRequest(w *http.Response, r *http.Request, path string) error {
 func RouterFunc(w *http.Response, r *http.Request) (err error) {
 	defer trace.End(trace.Begin(""))
 
+	defer RequestDone()
+	if !RequestStart(w) {
+		return ShuttingDownError
+	}
+
+	defer MetricsObserveRequest(w, r, &err, MetricsNow())
+	defer AccessLogRequest(w, r, &err, MetricsNow())
 	defer func() {
 		if p := recover(); p != nil {
 			err = errors.NewPanic(p)
 		}
 	}()
 
+	SetSecurityHeaders(w)
+
 	switch r.Method {
 	case "GET":
 		if len(r.URL.RawQuery) > 0 {
@@ -228,6 +323,37 @@ func RouterFunc(w *http.Response, r *http.Request) (err error) {
 	}
 }
 
+/* GetPeerAddr returns address of the other end of a socket or empty string, if it's unknown. */
+func GetPeerAddr(fd int) string {
+	sa, err := sys.Getpeername(fd)
+	if err != nil {
+		return ""
+	}
+
+	switch sa := sa.(type) {
+	case *sys.SockaddrInet4:
+		return net.JoinHostPort(net.IP(sa.Addr[:]).String(), strconv.Itoa(sa.Port))
+	case *sys.SockaddrInet6:
+		return net.JoinHostPort(net.IP(sa.Addr[:]).String(), strconv.Itoa(sa.Port))
+	}
+	return ""
+}
+
+/* ServeConn serves requests from a connection. Router sees peer address of a connection through 'GetRequestIP'. Connection is tracked, so it can be shut down by 'Shutdown'. */
+func ServeConn(c *http.Conn) {
+	addr := GetPeerAddr(int(c.Socket))
+
+	ConnStart(c)
+	defer ConnDone(c)
+
+	http.Serve(c, func(w *http.Response, r *http.Request) error {
+		SetRequestAddr(r, addr)
+		defer DeleteRequestAddr(r)
+
+		return RouterFunc(w, r)
+	})
+}
+
 func GetDateHeader() []byte {
 	defer trace.End(trace.Begin(""))
 
@@ -262,6 +388,21 @@ func main() {
 		pprof.StartCPUProfile(f)
 		defer pprof.StopCPUProfile()
 	}
+
+	args, err := ParseConfig(&Config, os.Args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			return
+		}
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if len(args) > 0 {
+		if err := RunCommand(Config.DBDir, args[0], args[1:]); err != nil {
+			log.Fatalf("Failed to run command %q: %v", args[0], err)
+		}
+		return
+	}
+
 	log.Infof("Starting SEMS in %q mode... (%s)", BuildMode, runtime.Version())
 
 	WorkingDirectory, err = os.Getwd()
@@ -273,25 +414,65 @@ func main() {
 		log.Fatalf("Failed to load assets: %v", err)
 	}
 
-	if err = OpenDBs("db"); err != nil {
+	if err := LoadProgrammingLanguages(Config.LanguagesFile); err != nil {
+		if !os.IsNotExist(err) {
+			log.Fatalf("Failed to load programming languages: %v", err)
+		}
+		log.Infof("File %q does not exist, using built-in programming languages", Config.LanguagesFile)
+	}
+	ProgrammingLanguagesSelfTest()
+
+	/* NOTE(anton2920): after upgrade, previous process must flush DBs and sessions before they are opened. */
+	if err := WaitForParent(Config.DBDir, 2*stdtime.Duration(Config.ShutdownTimeout)); err != nil {
+		log.Fatalf("Failed to take over from previous process: %v", err)
+	}
+
+	if err = OpenDBs(Config.DBDir); err != nil {
 		log.Fatalf("Failed to open DBs: %v", err)
 	}
-	defer CloseDBs()
 
-	if err := RestoreSessionsFromFile(SessionsFile); err != nil {
+	if err := RestoreSessionsFromFile(Config.SessionsFile); err != nil {
 		log.Warnf("Failed to restore sessions from file: %v", err)
 	}
 
-	go SubmissionVerifyWorker()
+	AuditLog, err = OpenLogFile(Config.AuditFile)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer AuditLog.Close()
 
-	const address = "0.0.0.0:7072"
-	l, err := http.Listen(address)
+	AccessLog, err = OpenLogFile(Config.AccessLogFile)
 	if err != nil {
-		log.Fatalf("Failed to listen on port: %v", err)
+		log.Fatalf("Failed to open access log: %v", err)
+	}
+	defer AccessLog.Close()
+
+	jail.JailsRootDir = Config.JailsDir
+	go SubmissionVerifyWorker()
+	if err := SubmissionVerifyRequeue(); err != nil {
+		log.Errorf("Failed to requeue unverified submissions: %v", err)
 	}
-	defer l.Close()
 
-	log.Infof("Listening on %s...", address)
+	if TLSEnabled() {
+		if err := LoadTLSCertificate(Config.TLSCertFile, Config.TLSKeyFile); err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+	}
+
+	var ls Listeners
+	if err := Listen(&ls); err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	l := ls.HTTP
+	ServeListeners(&ls)
+
+	log.Infof("Listening on %s...", Config.Address)
+	if TLSEnabled() {
+		log.Infof("Listening on %s (TLS)...", Config.TLSAddress)
+	}
+	if Config.RedirectAddress != "" {
+		log.Infof("Redirecting from %s to HTTPS...", Config.RedirectAddress)
+	}
 
 	q, err := event.NewQueue()
 	if err != nil {
@@ -302,14 +483,15 @@ func main() {
 	_ = q.AddSocket(int32(l.Socket), event.RequestRead, event.TriggerEdge, nil)
 	_ = q.AddTimer(1, 1*time.Second, nil)
 
-	_ = syscall.IgnoreSignals(syscall.SIGINT, syscall.SIGTERM)
-	_ = q.AddSignals(syscall.SIGINT, syscall.SIGTERM)
+	_ = syscall.IgnoreSignals(syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR2)
+	_ = q.AddSignals(syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR2)
 
 	now := time.Now()
 	UpdateDateHeader(now)
 
 	events := make([]event.Event, 64)
 
+	var upgrade *UpgradeProcess
 	var quit bool
 	for !quit {
 		n, err := q.GetEvents(events)
@@ -328,20 +510,58 @@ func main() {
 				c, err := l.Accept()
 				if err != nil {
 					log.Errorf("Failed to accept new connection: %v", err)
+					continue
 				}
-				go http.Serve(c, RouterFunc)
+				go ServeConn(c)
 			case event.TypeTimer:
 				now += e.Data
 				UpdateDateHeader(now)
+
+				if upgrade != nil {
+					select {
+					default:
+					case err := <-upgrade.Ready:
+						if err != nil {
+							log.Errorf("Failed to upgrade: %v", err)
+							upgrade = nil
+							break
+						}
+						log.Infof("Handed listeners over to process %d, exitting...", upgrade.Cmd.Process.Pid)
+						quit = true
+					}
+				}
 			case event.TypeSignal:
-				log.Infof("Received signal %d, exitting...", e.Identifier)
-				quit = true
-				break
+				switch syscall.Signal(e.Identifier) {
+				case syscall.SIGHUP:
+					if TLSEnabled() {
+						if err := LoadTLSCertificate(Config.TLSCertFile, Config.TLSKeyFile); err != nil {
+							log.Errorf("Failed to reload TLS certificate, keeping old one: %v", err)
+						} else {
+							log.Infof("Reloaded TLS certificate")
+						}
+					}
+				case syscall.SIGUSR2:
+					if upgrade != nil {
+						log.Warnf("Upgrade to process %d is already in progress", upgrade.Cmd.Process.Pid)
+						break
+					}
+					upgrade, err = Upgrade(&ls)
+					if err != nil {
+						log.Errorf("Failed to upgrade: %v", err)
+						break
+					}
+					log.Infof("Started process %d, serving until it's ready...", upgrade.Cmd.Process.Pid)
+				default:
+					log.Infof("Received signal %d, exitting...", e.Identifier)
+					quit = true
+				}
 			}
 		}
 	}
 
-	if err := StoreSessionsToFile(SessionsFile); err != nil {
-		log.Warnf("Failed to store sessions to file: %v", err)
+	if !Shutdown(&ls) {
+		log.Warnf("DBs are left open, unfinished changes will be recovered from WAL on next start")
+	} else if err := CloseDBs(); err != nil {
+		log.Errorf("Failed to close DBs: %v", err)
 	}
 }
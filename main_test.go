@@ -124,7 +124,13 @@ func testPostInvalidFormAuth(t *testing.T, endpoint string, token string) {
 }
 
 func testWaitForJails() {
-	for len(SubmissionVerifyChannel) > 0 {
+	for {
+		VerifyJobs.Lock()
+		n := len(VerifyJobs.Queued) + len(VerifyJobs.Running)
+		VerifyJobs.Unlock()
+		if n == 0 {
+			break
+		}
 		time.Sleep(time.Millisecond * 10)
 	}
 
@@ -150,10 +156,15 @@ func TestMain(m *testing.M) {
 	if err := OpenDBs("db_test"); err != nil {
 		log.Fatalf("Failed to open DB: %v", err)
 	}
-	defer CloseDBs()
 
 	testCreateInitialDBs()
 
+	os.Remove("audit_test.log")
+	AuditLog, err = OpenLogFile("audit_test.log")
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+
 	jail.JailsRootDir = "./jails_test"
 	os.MkdirAll(jail.JailsRootDir+"/containers", 0755)
 	os.MkdirAll(jail.JailsRootDir+"/envs", 0755)
@@ -172,7 +183,15 @@ func TestMain(m *testing.M) {
 	code := m.Run()
 
 	testWaitForJails()
+
+	/* NOTE(anton2920): deferred calls don't run after 'os.Exit'. */
+	AuditLog.Close()
+	if err := CloseDBs(); err != nil {
+		log.Errorf("Failed to close DBs: %v", err)
+	}
+
 	os.RemoveAll("jails_test")
 	os.RemoveAll("db_test")
+	os.Remove("audit_test.log")
 	os.Exit(code)
 }
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unsafe"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* MetricsHistogram is a Prometheus histogram with 'MetricsBuckets' as upper bounds. Last count is for +Inf bucket. */
+type MetricsHistogram struct {
+	Counts [len(MetricsBuckets) + 1]int64
+	Sum    float64
+}
+
+type MetricsRequestKey struct {
+	Route  string
+	Method string
+}
+
+type MetricsVerificationKey struct {
+	Language string
+	Verdict  string
+}
+
+const (
+	VerdictPassed = "passed"
+	VerdictFailed = "failed"
+	VerdictError  = "error"
+)
+
+/* MetricsMaxRoutes limits number of request series. Requests to routes, which don't fit, are reported as 'other'. */
+const MetricsMaxRoutes = 256
+
+/* MetricsBuckets are upper bounds of duration histograms in seconds. */
+var MetricsBuckets = [...]float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+var Metrics struct {
+	sync.Mutex
+
+	Requests      map[MetricsRequestKey]*MetricsHistogram
+	Responses     map[string]int64
+	Verifications map[MetricsVerificationKey]*MetricsHistogram
+
+	SandboxFailures int64
+
+	/* NOTE(anton2920): indexed the same way as 'TxDBs' and 'SchemaDBs'. */
+	DBReads  [len(TxDBs)]MetricsHistogram
+	DBWrites [len(TxDBs)]MetricsHistogram
+}
+
+func init() {
+	Metrics.Requests = make(map[MetricsRequestKey]*MetricsHistogram)
+	Metrics.Responses = make(map[string]int64)
+	Metrics.Verifications = make(map[MetricsVerificationKey]*MetricsHistogram)
+}
+
+func (h *MetricsHistogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+
+	i := 0
+	for (i < len(MetricsBuckets)) && (seconds > MetricsBuckets[i]) {
+		i++
+	}
+	h.Counts[i]++
+	h.Sum += seconds
+}
+
+/* MetricsRoute replaces numeric path segments with ':id', so every page is reported once and not once per record. */
+func MetricsRoute(path string) string {
+	segments := strings.Split(path, "/")
+	for i := 0; i < len(segments); i++ {
+		if (len(segments[i]) > 0) && (strings.IndexFunc(segments[i], func(r rune) bool { return !unicode.IsDigit(r) }) == -1) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+/* MetricsMethod maps request method to one of a fixed set, so clients can't create series with arbitrary methods. */
+func MetricsMethod(method string) string {
+	switch method {
+	case "GET", "POST":
+		return method
+	}
+	return "other"
+}
+
+/* MetricsStatus returns status of response, which will be sent for request handled with provided error. */
+func MetricsStatus(w *http.Response, err error) http.Status {
+	if err == nil {
+		if w.Status == 0 {
+			return http.StatusOK
+		}
+		return w.Status
+	}
+	if httpError, ok := err.(http.Error); ok {
+		return httpError.Status
+	}
+	return http.StatusInternalServerError
+}
+
+/* MetricsNow is needed, because router uses different 'time' package. */
+func MetricsNow() time.Time {
+	return time.Now()
+}
+
+/* MetricsObserveRequest must be deferred by router, so 'err' is already set when it's called. */
+func MetricsObserveRequest(w *http.Response, r *http.Request, err *error, start time.Time) {
+	d := time.Since(start)
+
+	status := MetricsStatus(w, *err)
+	class := strconv.Itoa(int(status)/100) + "xx"
+
+	/* NOTE(anton2920): unknown paths are not reported one by one, otherwise anyone could create as many series as they want. */
+	route := "other"
+	if status != http.StatusNotFound {
+		route = MetricsRoute(string(r.URL.Path))
+	}
+	key := MetricsRequestKey{Route: route, Method: MetricsMethod(r.Method)}
+
+	Metrics.Lock()
+	h := Metrics.Requests[key]
+	if (h == nil) && (len(Metrics.Requests) >= MetricsMaxRoutes) {
+		key.Route = "other"
+		h = Metrics.Requests[key]
+	}
+	if h == nil {
+		h = new(MetricsHistogram)
+		Metrics.Requests[key] = h
+	}
+	h.Observe(d)
+	Metrics.Responses[class]++
+	Metrics.Unlock()
+}
+
+func MetricsObserveVerification(language string, verdict string, d time.Duration) {
+	key := MetricsVerificationKey{Language: language, Verdict: verdict}
+
+	Metrics.Lock()
+	h := Metrics.Verifications[key]
+	if h == nil {
+		h = new(MetricsHistogram)
+		Metrics.Verifications[key] = h
+	}
+	h.Observe(d)
+	Metrics.Unlock()
+}
+
+func MetricsSandboxFailure() {
+	Metrics.Lock()
+	Metrics.SandboxFailures++
+	Metrics.Unlock()
+}
+
+func MetricsDBIndex(db *database.DB) int {
+	for i := 0; i < len(TxDBs); i++ {
+		if *TxDBs[i] == db {
+			return i
+		}
+	}
+	return -1
+}
+
+func MetricsObserveDBRead(db *database.DB, d time.Duration) {
+	if i := MetricsDBIndex(db); i != -1 {
+		Metrics.Lock()
+		Metrics.DBReads[i].Observe(d)
+		Metrics.Unlock()
+	}
+}
+
+func MetricsObserveDBWrite(i int32, d time.Duration) {
+	Metrics.Lock()
+	Metrics.DBWrites[i].Observe(d)
+	Metrics.Unlock()
+}
+
+/* DBRead is 'database.Read', which is accounted in metrics. */
+func DBRead(db *database.DB, id database.ID, p unsafe.Pointer, size int) error {
+	start := time.Now()
+	err := database.Read(db, id, p, size)
+	MetricsObserveDBRead(db, time.Since(start))
+	return err
+}
+
+/* DBReadMany is 'database.ReadMany', which is accounted in metrics. */
+func DBReadMany(db *database.DB, pos *int64, buf []byte, size int) (int, error) {
+	start := time.Now()
+	n, err := database.ReadMany(db, pos, buf, size)
+	MetricsObserveDBRead(db, time.Since(start))
+	return n, err
+}
+
+func AppendMetricsHeader(buf []byte, name string, typ string, help string) []byte {
+	buf = append(buf, "# HELP "...)
+	buf = append(buf, name...)
+	buf = append(buf, ' ')
+	buf = append(buf, help...)
+	buf = append(buf, "\n# TYPE "...)
+	buf = append(buf, name...)
+	buf = append(buf, ' ')
+	buf = append(buf, typ...)
+	buf = append(buf, '\n')
+	return buf
+}
+
+/* AppendMetricsLabels appends pairs of label names and values. Values are escaped as Prometheus text format requires. */
+func AppendMetricsLabels(buf []byte, labels ...string) []byte {
+	for i := 0; i < len(labels); i += 2 {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, labels[i]...)
+		buf = append(buf, `="`...)
+		for _, c := range []byte(labels[i+1]) {
+			switch c {
+			case '\\', '"':
+				buf = append(buf, '\\', c)
+			case '\n':
+				buf = append(buf, `\n`...)
+			default:
+				buf = append(buf, c)
+			}
+		}
+		buf = append(buf, '"')
+	}
+	return buf
+}
+
+func AppendMetricsValue(buf []byte, name string, value float64, labels ...string) []byte {
+	buf = append(buf, name...)
+	if len(labels) > 0 {
+		buf = append(buf, '{')
+		buf = AppendMetricsLabels(buf, labels...)
+		buf = append(buf, '}')
+	}
+	buf = append(buf, ' ')
+	buf = strconv.AppendFloat(buf, value, 'g', -1, 64)
+	buf = append(buf, '\n')
+	return buf
+}
+
+func AppendMetricsHistogram(buf []byte, name string, h *MetricsHistogram, labels ...string) []byte {
+	var count int64
+
+	le := append(labels[:len(labels):len(labels)], "le", "")
+	for i := 0; i < len(h.Counts); i++ {
+		count += h.Counts[i]
+		if i < len(MetricsBuckets) {
+			le[len(le)-1] = strconv.FormatFloat(MetricsBuckets[i], 'g', -1, 64)
+		} else {
+			le[len(le)-1] = "+Inf"
+		}
+		buf = AppendMetricsValue(buf, name+"_bucket", float64(count), le...)
+	}
+	buf = AppendMetricsValue(buf, name+"_sum", h.Sum, labels...)
+	buf = AppendMetricsValue(buf, name+"_count", float64(count), labels...)
+	return buf
+}
+
+func AppendMetrics(buf []byte) []byte {
+	defer trace.End(trace.Begin(""))
+
+	SessionsLock.RLock()
+	sessions := len(Sessions)
+	SessionsLock.RUnlock()
+
+	VerifyJobs.Lock()
+	queued := len(VerifyJobs.Queued)
+	running := len(VerifyJobs.Running)
+	VerifyJobs.Unlock()
+
+	Metrics.Lock()
+	defer Metrics.Unlock()
+
+	buf = AppendMetricsHeader(buf, "sems_http_request_duration_seconds", "histogram", "Duration of HTTP requests by route and method.")
+	requests := make([]MetricsRequestKey, 0, len(Metrics.Requests))
+	for key := range Metrics.Requests {
+		requests = append(requests, key)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return (requests[i].Route < requests[j].Route) || ((requests[i].Route == requests[j].Route) && (requests[i].Method < requests[j].Method))
+	})
+	for i := 0; i < len(requests); i++ {
+		buf = AppendMetricsHistogram(buf, "sems_http_request_duration_seconds", Metrics.Requests[requests[i]], "route", requests[i].Route, "method", requests[i].Method)
+	}
+
+	buf = AppendMetricsHeader(buf, "sems_http_responses_total", "counter", "Number of HTTP responses by status class.")
+	classes := make([]string, 0, len(Metrics.Responses))
+	for class := range Metrics.Responses {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for i := 0; i < len(classes); i++ {
+		buf = AppendMetricsValue(buf, "sems_http_responses_total", float64(Metrics.Responses[classes[i]]), "class", classes[i])
+	}
+
+	buf = AppendMetricsHeader(buf, "sems_sessions_active", "gauge", "Number of active sessions.")
+	buf = AppendMetricsValue(buf, "sems_sessions_active", float64(sessions))
+
+	buf = AppendMetricsHeader(buf, "sems_verify_queue_depth", "gauge", "Number of submissions waiting for verification.")
+	buf = AppendMetricsValue(buf, "sems_verify_queue_depth", float64(queued))
+
+	buf = AppendMetricsHeader(buf, "sems_verify_running", "gauge", "Number of submissions being verified.")
+	buf = AppendMetricsValue(buf, "sems_verify_running", float64(running))
+
+	buf = AppendMetricsHeader(buf, "sems_verify_duration_seconds", "histogram", "Duration of verification of programming steps by language and verdict.")
+	verifications := make([]MetricsVerificationKey, 0, len(Metrics.Verifications))
+	for key := range Metrics.Verifications {
+		verifications = append(verifications, key)
+	}
+	sort.Slice(verifications, func(i, j int) bool {
+		return (verifications[i].Language < verifications[j].Language) || ((verifications[i].Language == verifications[j].Language) && (verifications[i].Verdict < verifications[j].Verdict))
+	})
+	for i := 0; i < len(verifications); i++ {
+		buf = AppendMetricsHistogram(buf, "sems_verify_duration_seconds", Metrics.Verifications[verifications[i]], "language", verifications[i].Language, "verdict", verifications[i].Verdict)
+	}
+
+	buf = AppendMetricsHeader(buf, "sems_sandbox_failures_total", "counter", "Number of failures to create, prepare or remove verification jail.")
+	buf = AppendMetricsValue(buf, "sems_sandbox_failures_total", float64(Metrics.SandboxFailures))
+
+	buf = AppendMetricsHeader(buf, "sems_db_read_duration_seconds", "histogram", "Duration of DB reads.")
+	for i := 0; i < len(Metrics.DBReads); i++ {
+		buf = AppendMetricsHistogram(buf, "sems_db_read_duration_seconds", &Metrics.DBReads[i], "db", SchemaDBs[i].Name)
+	}
+
+	buf = AppendMetricsHeader(buf, "sems_db_write_duration_seconds", "histogram", "Duration of DB record writes.")
+	for i := 0; i < len(Metrics.DBWrites); i++ {
+		buf = AppendMetricsHistogram(buf, "sems_db_write_duration_seconds", &Metrics.DBWrites[i], "db", SchemaDBs[i].Name)
+	}
+
+	return buf
+}
+
+/* MetricsHandler reports metrics in Prometheus text format. Prometheus is expected to scrape it from the same host, so only clients connected from loopback don't need to be signed in as admin. */
+func MetricsHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	if !net.ParseIP(GetRequestIP(r)).IsLoopback() {
+		session, err := GetSessionFromRequest(r)
+		if err != nil {
+			return UnauthorizedError
+		}
+		if session.ID != AdminID {
+			return ForbiddenError
+		}
+	}
+
+	w.Headers.Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(AppendMetrics(make([]byte, 0, 16*1024)))
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anton2920/gofa/net/http"
+)
+
+func TestMetricsRoute(t *testing.T) {
+	tests := [...]struct {
+		Path  string
+		Route string
+	}{
+		{"/", "/"},
+		{"/lesson/12", "/lesson/:id"},
+		{"/api/lesson/export", "/api/lesson/export"},
+		{"/subject/3/lesson/4", "/subject/:id/lesson/:id"},
+		{"/user/12a", "/user/12a"},
+	}
+
+	for _, test := range tests {
+		if route := MetricsRoute(test.Path); route != test.Route {
+			t.Errorf("Expected route %q for %q, got %q", test.Route, test.Path, route)
+		}
+	}
+}
+
+func TestMetricsMethod(t *testing.T) {
+	tests := [...]struct {
+		Method   string
+		Expected string
+	}{
+		{"GET", "GET"},
+		{"POST", "POST"},
+		{"PUT", "other"},
+		{"get", "other"},
+		{"X-RANDOM-1234", "other"},
+	}
+
+	for _, test := range tests {
+		if method := MetricsMethod(test.Method); method != test.Expected {
+			t.Errorf("Expected method %q for %q, got %q", test.Expected, test.Method, method)
+		}
+	}
+}
+
+func TestMetricsHistogram(t *testing.T) {
+	var h MetricsHistogram
+
+	h.Observe(500 * time.Microsecond)
+	h.Observe(time.Second)
+	h.Observe(time.Minute)
+
+	buf := string(AppendMetricsHistogram(nil, "test", &h, "label", `a"b`))
+	expected := [...]string{
+		`test_bucket{label="a\"b",le="0.001"} 1`,
+		`test_bucket{label="a\"b",le="0.5"} 1`,
+		`test_bucket{label="a\"b",le="1"} 2`,
+		`test_bucket{label="a\"b",le="+Inf"} 3`,
+		`test_count{label="a\"b"} 3`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(buf, line+"\n") {
+			t.Errorf("Expected histogram to contain %q, got:\n%s", line, buf)
+		}
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	var w http.Response
+	var r http.Request
+
+	testGetAuth(t, "/lesson/2", testTokens[1], http.StatusOK)
+	testGet(t, "/does/not/exist", http.StatusNotFound)
+
+	testGet(t, "/metrics", http.StatusUnauthorized)
+	testGetAuth(t, "/metrics", testTokens[1], http.StatusForbidden)
+	testGetAuth(t, "/metrics", testTokens[AdminID], http.StatusOK)
+
+	/* NOTE(anton2920): Prometheus scrapes metrics from the same host without session. */
+	r.URL.Path = "/metrics"
+	w.Status = http.StatusOK
+	SetRequestAddr(&r, "127.0.0.1:40000")
+	defer DeleteRequestAddr(&r)
+	if err := RouterFunc(&w, &r); (err != nil) || (w.Status != http.StatusOK) {
+		t.Fatalf("Failed to get metrics: %v, status %d", err, w.Status)
+	}
+
+	body := string(w.Body)
+	expected := [...]string{
+		`sems_http_request_duration_seconds_count{route="/lesson/:id",method=""}`,
+		`sems_http_request_duration_seconds_count{route="other",method=""}`,
+		`sems_http_responses_total{class="2xx"}`,
+		`sems_sessions_active `,
+		`sems_verify_queue_depth `,
+		`sems_sandbox_failures_total `,
+		`sems_db_read_duration_seconds_count{db="Lessons.db"}`,
+		`sems_db_write_duration_seconds_count{db="Users.db"}`,
+	}
+	for _, s := range expected {
+		if !strings.Contains(body, s) {
+			t.Errorf("Expected metrics to contain %q", s)
+		}
+	}
+}
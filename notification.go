@@ -0,0 +1,438 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/trace"
+)
+
+type Notification struct {
+	ID     database.ID
+	Flags  int32
+	UserID database.ID
+
+	Type NotificationType
+
+	/* ObjectID is an ID of subject, submission or lesson depending on 'Type'. */
+	ObjectID database.ID
+
+	/* Text is a name of an object notification is about. */
+	Text      string
+	CreatedOn int64
+
+	Blob Blob
+	Data [512]byte
+}
+
+type NotificationType int32
+
+const (
+	NotificationAnnouncement NotificationType = iota
+	NotificationSubmissionVerified
+	NotificationLessonPublished
+	NotificationDiscussion
+)
+
+const (
+	NotificationUnread int32 = iota
+	NotificationDeleted
+	NotificationRead
+)
+
+/* MaxDisplayedNotifications is a number of the most recent notifications displayed in inbox. */
+const MaxDisplayedNotifications = 100
+
+func CreateNotificationTx(tx *Tx, notification *Notification) error {
+	defer trace.End(trace.Begin(""))
+
+	notification.ID = NewIDTx(tx, NotificationsDB)
+
+	return SaveNotificationTx(tx, notification)
+}
+
+func CreateNotification(notification *Notification) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := CreateNotificationTx(&tx, notification); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func DBNotification2Notification(notification *Notification, data *byte) {
+	defer trace.End(trace.Begin(""))
+
+	notification.Text = database.Offset2String(notification.Text, data)
+}
+
+func GetNotificationByID(id database.ID, notification *Notification) error {
+	defer trace.End(trace.Begin(""))
+
+	if err := DBRead(NotificationsDB, id, unsafe.Pointer(notification), int(unsafe.Sizeof(*notification))); err != nil {
+		return err
+	}
+	if notification.ID != id {
+		return database.NotFound
+	}
+
+	data, err := GetBlobData(&notification.Blob, notification.Data[:])
+	if err != nil {
+		return err
+	}
+
+	DBNotification2Notification(notification, data)
+	return nil
+}
+
+func GetNotifications(pos *int64, notifications []Notification) (int, error) {
+	defer trace.End(trace.Begin(""))
+
+	n, err := DBReadManyValid(NotificationsDB, pos, notifications, func(notification *Notification) database.ID { return notification.ID })
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < n; i++ {
+		data, err := GetBlobData(&notifications[i].Blob, notifications[i].Data[:])
+		if err != nil {
+			return 0, err
+		}
+		DBNotification2Notification(&notifications[i], data)
+	}
+	return n, nil
+}
+
+func DeleteNotificationByIDTx(tx *Tx, id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	flags := NotificationDeleted
+	var notification Notification
+
+	offset := int64(int(id)*int(unsafe.Sizeof(notification))) + database.DataOffset + int64(unsafe.Offsetof(notification.Flags))
+	tx.WriteAt(NotificationsDB, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
+
+	tx.OnCommit(func() { UnindexNotification(id) })
+	return nil
+}
+
+func DeleteNotificationByID(id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := DeleteNotificationByIDTx(&tx, id); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func NotificationDataSize(notification *Notification) int {
+	return DBStringSize(notification.Text)
+}
+
+func SaveNotificationTx(tx *Tx, notification *Notification) error {
+	defer trace.End(trace.Begin(""))
+
+	var notificationDB Notification
+	var n int
+
+	notificationDB.ID = notification.ID
+	notificationDB.Flags = notification.Flags
+	notificationDB.UserID = notification.UserID
+	notificationDB.Type = notification.Type
+	notificationDB.ObjectID = notification.ObjectID
+
+	data, err := GetDataBuffer(notificationDB.Data[:], NotificationDataSize(notification))
+	if err != nil {
+		return err
+	}
+
+	n += database.String2DBString(&notificationDB.Text, notification.Text, data, n)
+
+	notificationDB.CreatedOn = notification.CreatedOn
+
+	if err := SaveBlob(&notificationDB.Blob, notificationDB.Data[:], data[:n]); err != nil {
+		return err
+	}
+
+	tx.Write(NotificationsDB, notificationDB.ID, unsafe.Pointer(&notificationDB), int(unsafe.Sizeof(notificationDB)))
+
+	indexed := *notification
+	tx.OnCommit(func() { IndexNotification(&indexed) })
+	return nil
+}
+
+func SaveNotification(notification *Notification) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := SaveNotificationTx(&tx, notification); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+/* NotifyUsersTx creates the same unread notification for every user. */
+func NotifyUsersTx(tx *Tx, userIDs []database.ID, typ NotificationType, objectID database.ID, text string) error {
+	defer trace.End(trace.Begin(""))
+
+	now := time.Now().Unix()
+	for i := 0; i < len(userIDs); i++ {
+		notification := Notification{UserID: userIDs[i], Type: typ, ObjectID: objectID, Text: text, CreatedOn: now}
+		if err := CreateNotificationTx(tx, &notification); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NotifySubjectStudentsTx(tx *Tx, subject *Subject, typ NotificationType, objectID database.ID, text string) error {
+	defer trace.End(trace.Begin(""))
+
+	var group Group
+	if err := GetGroupByID(subject.GroupID, &group); err != nil {
+		return err
+	}
+	return NotifyUsersTx(tx, group.Students, typ, objectID, text)
+}
+
+/* NotifyLessonsPublished notifies students of a subject about new lessons, which are not drafts. */
+func NotifyLessonsPublished(subject *Subject, lessons []database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	var lesson Lesson
+	var tx Tx
+
+	for i := 0; i < len(lessons); i++ {
+		if err := GetLessonByID(lessons[i], &lesson); err != nil {
+			return err
+		}
+		if lesson.Flags != LessonActive {
+			continue
+		}
+		if err := NotifySubjectStudentsTx(&tx, subject, NotificationLessonPublished, lesson.ID, subject.Name+": "+lesson.Name); err != nil {
+			return err
+		}
+	}
+	return CommitTx(&tx)
+}
+
+func NotifySubmissionVerifiedTx(tx *Tx, submission *Submission) error {
+	defer trace.End(trace.Begin(""))
+
+	var subject Subject
+	var lesson Lesson
+
+	if err := GetLessonByID(submission.LessonID, &lesson); err != nil {
+		return err
+	}
+	if err := GetSubjectByID(lesson.ContainerID, &subject); err != nil {
+		return err
+	}
+	return NotifyUsersTx(tx, []database.ID{submission.UserID}, NotificationSubmissionVerified, submission.ID, subject.Name+": "+lesson.Name)
+}
+
+func NotificationLink(notification *Notification) string {
+	switch notification.Type {
+	default:
+		panic("invalid notification type")
+	case NotificationAnnouncement:
+		return "/subject"
+	case NotificationSubmissionVerified:
+		return "/submission"
+	case NotificationLessonPublished, NotificationDiscussion:
+		return "/lesson"
+	}
+}
+
+func NotificationTitle(l Language, notification *Notification) string {
+	switch notification.Type {
+	default:
+		panic("invalid notification type")
+	case NotificationAnnouncement:
+		return Ls(l, "New announcement")
+	case NotificationSubmissionVerified:
+		return Ls(l, "Submission is verified")
+	case NotificationLessonPublished:
+		return Ls(l, "New lesson")
+	case NotificationDiscussion:
+		return Ls(l, "New message in discussion")
+	}
+}
+
+func DisplayUnreadNotifications(w *http.Response, l Language, session *Session) {
+	unread := GetUserUnreadNotificationsCount(session.ID)
+
+	w.WriteString(`<a class="nav-link text-white px-3" href="/notifications">`)
+	w.WriteString(Ls(l, "Notifications"))
+	if unread > 0 {
+		w.WriteString(` <span class="badge rounded-pill bg-danger">`)
+		w.WriteInt(unread)
+		w.WriteString(`</span>`)
+	}
+	w.WriteString(`</a>`)
+}
+
+func NotificationsPageHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	const width = WidthLarge
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	ids := GetUserNotificationIDs(session.ID)
+
+	DisplayHTMLStart(w)
+
+	DisplayHeadStart(w)
+	{
+		w.WriteString(`<title>`)
+		w.WriteString(Ls(GL, "Notifications"))
+		w.WriteString(`</title>`)
+	}
+	DisplayHeadEnd(w)
+
+	DisplayBodyStart(w)
+	{
+		DisplayHeader(w, GL, session)
+		DisplaySidebar(w, GL, session)
+
+		DisplayMainStart(w)
+
+		DisplayCrumbsStart(w, width)
+		{
+			DisplayCrumbsItem(w, GL, "Notifications")
+		}
+		DisplayCrumbsEnd(w)
+
+		DisplayPageStart(w, width)
+		{
+			w.WriteString(`<h2 class="text-center">`)
+			w.WriteString(Ls(GL, "Notifications"))
+			w.WriteString(`</h2>`)
+			w.WriteString(`<br>`)
+
+			if len(ids) == 0 {
+				w.WriteString(`<h4>`)
+				w.WriteString(Ls(GL, "You don't have any notifications"))
+				w.WriteString(`</h4>`)
+			} else {
+				if GetUserUnreadNotificationsCount(session.ID) > 0 {
+					w.WriteString(`<form method="POST" action="/api/notification/read">`)
+					DisplayButton(w, GL, "", "Mark all as read")
+					w.WriteString(`</form>`)
+					w.WriteString(`<br>`)
+				}
+
+				w.WriteString(`<ul>`)
+				for i := len(ids) - 1; i >= max(0, len(ids)-MaxDisplayedNotifications); i-- {
+					var notification Notification
+					if err := GetNotificationByID(ids[i], &notification); err != nil {
+						return http.ServerError(err)
+					}
+
+					w.WriteString(`<li>`)
+					if notification.Flags == NotificationUnread {
+						w.WriteString(`<b>`)
+					}
+					DisplayFormattedTime(w, notification.CreatedOn)
+					w.WriteString(` <a href="/notification/`)
+					w.WriteInt(int(notification.ID))
+					w.WriteString(`">`)
+					w.WriteString(NotificationTitle(GL, &notification))
+					w.WriteString(`: «`)
+					w.WriteHTMLString(notification.Text)
+					w.WriteString(`»</a>`)
+					if notification.Flags == NotificationUnread {
+						w.WriteString(`</b>`)
+					}
+					w.WriteString(`</li>`)
+				}
+				w.WriteString(`</ul>`)
+			}
+		}
+		DisplayPageEnd(w)
+		DisplayMainEnd(w)
+	}
+	DisplayBodyEnd(w)
+
+	DisplayHTMLEnd(w)
+	return nil
+}
+
+/* NotificationPageHandler marks notification as read and redirects to the page it's about. */
+func NotificationPageHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var notification Notification
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	id, err := GetIDFromURL(GL, r.URL, "/notification/")
+	if err != nil {
+		return err
+	}
+	if err := GetNotificationByID(id, &notification); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "notification with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if notification.Flags == NotificationDeleted {
+		return http.NotFound("%s", Ls(GL, "notification with this ID does not exist"))
+	}
+	if notification.UserID != session.ID {
+		return ForbiddenError
+	}
+
+	if notification.Flags == NotificationUnread {
+		notification.Flags = NotificationRead
+		if err := SaveNotification(&notification); err != nil {
+			return http.ServerError(err)
+		}
+	}
+
+	w.Redirect(w.PathID(NotificationLink(&notification)+"/", notification.ObjectID), http.StatusSeeOther)
+	return nil
+}
+
+func NotificationReadHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var notification Notification
+	var tx Tx
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	ids := GetUserUnreadNotificationIDs(session.ID)
+	for i := 0; i < len(ids); i++ {
+		if err := GetNotificationByID(ids[i], &notification); err != nil {
+			return http.ServerError(err)
+		}
+		notification.Flags = NotificationRead
+		if err := SaveNotificationTx(&tx, &notification); err != nil {
+			return http.ServerError(err)
+		}
+	}
+	if err := CommitTx(&tx); err != nil {
+		return http.ServerError(err)
+	}
+
+	Audit(r, session.ID, "read", "notifications", session.ID, fmt.Sprintf("%d unread", len(ids)), "")
+
+	w.Redirect("/notifications", http.StatusSeeOther)
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+)
+
+func testExpectUnreadNotifications(t *testing.T, userID database.ID, expected int) {
+	t.Helper()
+
+	if n := GetUserUnreadNotificationsCount(userID); n != expected {
+		t.Errorf("Expected user %d to have %d unread notifications, got %d", userID, expected, n)
+	}
+}
+
+func TestNotificationHandlers(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	var submission Submission
+	if err := GetSubmissionByID(0, &submission); err != nil {
+		t.Fatalf("Failed to get submission: %v", err)
+	}
+
+	var tx Tx
+	if err := NotifySubmissionVerifiedTx(&tx, &submission); err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+	if err := CommitTx(&tx); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	testExpectUnreadNotifications(t, 2, 1)
+
+	ids := GetUserNotificationIDs(2)
+	if len(ids) != 1 {
+		t.Fatalf("Expected 1 notification, got %d", len(ids))
+	}
+	id := strconv.Itoa(int(ids[0]))
+
+	testGetAuth(t, "/notifications", testTokens[2], http.StatusOK)
+	testGetAuth(t, "/notifications", testTokens[3], http.StatusOK)
+	testGetAuth(t, "/notification/"+id, testTokens[3], http.StatusForbidden)
+	testGetAuth(t, "/notification/100", testTokens[2], http.StatusNotFound)
+	testGetAuth(t, "/notification/"+id, testTokens[2], http.StatusSeeOther)
+	testExpectUnreadNotifications(t, 2, 0)
+
+	var subject Subject
+	if err := GetSubjectByID(1, &subject); err != nil {
+		t.Fatalf("Failed to get subject: %v", err)
+	}
+	if err := NotifyLessonsPublished(&subject, subject.Lessons); err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+	testExpectUnreadNotifications(t, 2, 1)
+	testExpectUnreadNotifications(t, 3, 1)
+	testExpectUnreadNotifications(t, 1, 0)
+
+	testPostAuth(t, "/api/notification/read", testTokens[2], nil, http.StatusSeeOther)
+	testExpectUnreadNotifications(t, 2, 0)
+	testExpectUnreadNotifications(t, 3, 1)
+	if ids := GetUserNotificationIDs(2); len(ids) != 2 {
+		t.Errorf("Expected read notifications to stay in inbox, got %d", len(ids))
+	}
+}
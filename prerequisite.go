@@ -0,0 +1,125 @@
+package main
+
+import (
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* LessonState is a state of a subject lesson for a student. */
+type LessonState int32
+
+const (
+	LessonStateUnlocked LessonState = iota
+	LessonStateLocked
+	LessonStateCompleted
+)
+
+const (
+	MinRequiredScore = 0
+	MaxRequiredScore = 100
+)
+
+/* GetUserLessonBestScore returns the best score in percents among checked submissions of a user. Second value is false if there are no such submissions. */
+func GetUserLessonBestScore(userID database.ID, lessonID database.ID) (int, bool, error) {
+	defer trace.End(trace.Begin(""))
+
+	var submission Submission
+	var checked bool
+	var best int
+
+	ids := GetUserLessonSubmissionIDs(userID, lessonID)
+	for i := 0; i < len(ids); i++ {
+		if err := GetSubmissionByID(ids[i], &submission); err != nil {
+			return 0, false, err
+		}
+		if (submission.Flags != SubmissionActive) || (submission.Status != SubmissionCheckDone) {
+			continue
+		}
+
+		percent := GetSubmissionPercent(&submission)
+		if (!checked) || (percent > best) {
+			best = percent
+		}
+		checked = true
+	}
+
+	return best, checked, nil
+}
+
+/* GetUserLessonStates returns states of subject lessons for a student. Lesson is locked if it has 'RequiredScore' and student has not reached it on every earlier lesson with steps. Lessons without steps never block next ones. */
+func GetUserLessonStates(userID database.ID, lessons []database.ID) ([]LessonState, error) {
+	defer trace.End(trace.Begin(""))
+
+	var lesson Lesson
+
+	states := make([]LessonState, len(lessons))
+
+	/* NOTE(anton2920): minimum of best scores on earlier lessons. */
+	minScore := MaxRequiredScore
+
+	for i := 0; i < len(lessons); i++ {
+		if err := GetLessonByID(lessons[i], &lesson); err != nil {
+			return nil, err
+		}
+		if len(lesson.Steps) == 0 {
+			if int(lesson.RequiredScore) > minScore {
+				states[i] = LessonStateLocked
+			}
+			continue
+		}
+
+		score, checked, err := GetUserLessonBestScore(userID, lesson.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if int(lesson.RequiredScore) > minScore {
+			states[i] = LessonStateLocked
+		} else if checked {
+			states[i] = LessonStateCompleted
+		}
+		minScore = min(minScore, score)
+	}
+
+	return states, nil
+}
+
+/* GetStudentLessonStates returns states of subject lessons if user is a student there and nil otherwise. */
+func GetStudentLessonStates(userID database.ID, subject *Subject) []LessonState {
+	defer trace.End(trace.Begin(""))
+
+	who, err := WhoIsUserInSubject(userID, subject)
+	if (err != nil) || (who != SubjectUserStudent) {
+		return nil
+	}
+
+	states, err := GetUserLessonStates(userID, subject.Lessons)
+	if err != nil {
+		/* TODO(anton2920): report error. */
+		return nil
+	}
+	return states
+}
+
+/* LessonCheckUnlocked returns error if lesson is locked according to 'states' returned by 'GetUserLessonStates'. */
+func LessonCheckUnlocked(l Language, lessons []database.ID, states []LessonState, lesson *Lesson) error {
+	for i := 0; i < len(lessons); i++ {
+		if (lessons[i] == lesson.ID) && (states[i] == LessonStateLocked) {
+			return http.Forbidden(Ls(l, "this lesson is locked, score at least %d%% on previous lessons to unlock it"), lesson.RequiredScore)
+		}
+	}
+	return nil
+}
+
+func DisplayLessonRequiredScore(w *http.Response, l Language, lesson *Lesson) {
+	if lesson.RequiredScore == 0 {
+		return
+	}
+
+	w.WriteString(`<p>`)
+	w.WriteString(Ls(l, "Required score on previous lessons"))
+	w.WriteString(`: `)
+	w.WriteInt(int(lesson.RequiredScore))
+	w.WriteString(`%</p>`)
+}
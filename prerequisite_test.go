@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+)
+
+func testExpectLessonStates(t *testing.T, userID database.ID, lessons []database.ID, expected []LessonState) {
+	t.Helper()
+
+	states, err := GetUserLessonStates(userID, lessons)
+	if err != nil {
+		t.Fatalf("Failed to get lesson states: %v", err)
+	}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("User %d: expected lesson states %v, got %v", userID, expected, states)
+	}
+}
+
+func TestLessonPrerequisites(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	lesson := Lesson{ContainerID: 1, ContainerType: LessonContainerSubject, RequiredScore: 50, Name: "Locked lesson", Theory: "Theory", Steps: make([]Step, 1)}
+	if err := CreateLesson(&lesson); err != nil {
+		t.Fatalf("Failed to create lesson: %v", err)
+	}
+
+	var subject Subject
+	if err := GetSubjectByID(1, &subject); err != nil {
+		t.Fatalf("Failed to get subject: %v", err)
+	}
+	subject.Lessons = append(subject.Lessons, lesson.ID)
+	if err := SaveSubject(&subject); err != nil {
+		t.Fatalf("Failed to save subject: %v", err)
+	}
+
+	/* Student 2 has checked submission of the first lesson, student 3 has none. */
+	testExpectLessonStates(t, 2, subject.Lessons, []LessonState{LessonStateCompleted, LessonStateUnlocked})
+	testExpectLessonStates(t, 3, subject.Lessons, []LessonState{LessonStateUnlocked, LessonStateLocked})
+
+	id := strconv.Itoa(int(lesson.ID))
+	testGetAuth(t, "/lesson/"+id, testTokens[2], http.StatusOK)
+	testGetAuth(t, "/lesson/"+id, testTokens[3], http.StatusForbidden)
+	testGetAuth(t, "/lesson/"+id, testTokens[1], http.StatusOK)
+	testGetAuth(t, "/subject/1", testTokens[3], http.StatusOK)
+
+	testPostAuth(t, "/submission/new", testTokens[3], url.Values{"ID": {id}}, http.StatusForbidden)
+	testPostAuth(t, "/submission/new", testTokens[2], url.Values{"ID": {id}}, http.StatusOK)
+
+	/* Submissions, which are not checked yet, do not count. */
+	var submission Submission
+	if err := GetSubmissionByID(0, &submission); err != nil {
+		t.Fatalf("Failed to get submission: %v", err)
+	}
+	submission.Status = SubmissionCheckPending
+	if err := SaveSubmission(&submission); err != nil {
+		t.Fatalf("Failed to save submission: %v", err)
+	}
+	testExpectLessonStates(t, 2, subject.Lessons, []LessonState{LessonStateUnlocked, LessonStateLocked})
+
+	if err := GetLessonByID(lesson.ID, &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	lesson.RequiredScore = 0
+	if err := SaveLesson(&lesson); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+	testExpectLessonStates(t, 3, subject.Lessons, []LessonState{LessonStateUnlocked, LessonStateUnlocked})
+	testGetAuth(t, "/lesson/"+id, testTokens[3], http.StatusOK)
+}
+
+func TestLessonRequiredScoreVerify(t *testing.T) {
+	lesson := Lesson{Name: "Lesson", Theory: "Theory"}
+
+	for _, score := range [...]int32{MinRequiredScore, 50, MaxRequiredScore} {
+		lesson.RequiredScore = score
+		if err := LessonVerify(GL, &lesson); err != nil {
+			t.Errorf("Expected required score %d to be valid, got %v", score, err)
+		}
+	}
+	for _, score := range [...]int32{MinRequiredScore - 1, MaxRequiredScore + 1} {
+		lesson.RequiredScore = score
+		if err := LessonVerify(GL, &lesson); err == nil {
+			t.Errorf("Expected required score %d to be invalid", score)
+		}
+	}
+}
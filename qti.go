@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	stdstrings "strings"
+
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* QTI* types describe subset of IMS QTI 1.2, which is needed for single and multiple choice questions. */
+type (
+	QTIMaterial struct {
+		Text string `xml:"mattext"`
+	}
+	QTIResponseLabel struct {
+		Ident    string      `xml:"ident,attr"`
+		Material QTIMaterial `xml:"material"`
+	}
+	QTIResponseLid struct {
+		Ident       string             `xml:"ident,attr"`
+		Cardinality string             `xml:"rcardinality,attr"`
+		Labels      []QTIResponseLabel `xml:"render_choice>response_label"`
+	}
+	QTIPresentation struct {
+		Material    QTIMaterial     `xml:"material"`
+		ResponseLid *QTIResponseLid `xml:"response_lid"`
+	}
+
+	QTIVarEqual struct {
+		RespIdent string `xml:"respident,attr"`
+		Value     string `xml:",chardata"`
+	}
+	QTICondition struct {
+		VarEqual []QTIVarEqual  `xml:"varequal"`
+		And      *QTICondition  `xml:"and"`
+		Or       *QTICondition  `xml:"or"`
+		Not      []QTICondition `xml:"not"`
+	}
+	QTISetVar struct {
+		Action string `xml:"action,attr"`
+		Value  string `xml:",chardata"`
+	}
+	QTIRespCondition struct {
+		Condition QTICondition `xml:"conditionvar"`
+		SetVar    []QTISetVar  `xml:"setvar"`
+	}
+
+	QTIItem struct {
+		Ident          string             `xml:"ident,attr"`
+		Title          string             `xml:"title,attr"`
+		Presentation   QTIPresentation    `xml:"presentation"`
+		RespConditions []QTIRespCondition `xml:"resprocessing>respcondition"`
+	}
+	QTISection struct {
+		Ident string    `xml:"ident,attr"`
+		Title string    `xml:"title,attr"`
+		Items []QTIItem `xml:"item"`
+	}
+	QTIAssessment struct {
+		Ident    string       `xml:"ident,attr"`
+		Title    string       `xml:"title,attr"`
+		Sections []QTISection `xml:"section"`
+	}
+	QTIDocument struct {
+		XMLName    xml.Name       `xml:"questestinterop"`
+		Assessment *QTIAssessment `xml:"assessment"`
+		Sections   []QTISection   `xml:"section"`
+		Items      []QTIItem      `xml:"item"`
+	}
+)
+
+const QTIResponseIdent = "RESPONSE"
+
+/* Correct appends values of all 'varequal's, which are not negated. */
+func (c *QTICondition) Correct(values []string) []string {
+	for i := 0; i < len(c.VarEqual); i++ {
+		values = append(values, stdstrings.TrimSpace(c.VarEqual[i].Value))
+	}
+	if c.And != nil {
+		values = c.And.Correct(values)
+	}
+	if c.Or != nil {
+		values = c.Or.Correct(values)
+	}
+	return values
+}
+
+func Question2QTIItem(question *ExchangeQuestion, ident string, item *QTIItem) {
+	item.Ident = ident
+	item.Title = question.Question
+	item.Presentation.Material.Text = question.Question
+
+	lid := &QTIResponseLid{Ident: QTIResponseIdent, Cardinality: "Single"}
+	if len(question.CorrectAnswers) > 1 {
+		lid.Cardinality = "Multiple"
+	}
+	lid.Labels = make([]QTIResponseLabel, len(question.Answers))
+	for i := 0; i < len(question.Answers); i++ {
+		lid.Labels[i] = QTIResponseLabel{Ident: "A" + strconv.Itoa(i), Material: QTIMaterial{Text: question.Answers[i]}}
+	}
+	item.Presentation.ResponseLid = lid
+
+	/* Response is correct if all correct answers and none of the wrong ones are selected. */
+	var cond QTICondition
+	for i := 0; i < len(question.Answers); i++ {
+		var correct bool
+		for j := 0; j < len(question.CorrectAnswers); j++ {
+			if question.CorrectAnswers[j] == i {
+				correct = true
+				break
+			}
+		}
+
+		v := QTIVarEqual{RespIdent: QTIResponseIdent, Value: lid.Labels[i].Ident}
+		if correct {
+			cond.VarEqual = append(cond.VarEqual, v)
+		} else if lid.Cardinality == "Multiple" {
+			cond.Not = append(cond.Not, QTICondition{VarEqual: []QTIVarEqual{v}})
+		}
+	}
+
+	rc := QTIRespCondition{SetVar: []QTISetVar{{Action: "Set", Value: "100"}}}
+	if lid.Cardinality == "Multiple" {
+		rc.Condition.And = &cond
+	} else {
+		rc.Condition = cond
+	}
+	item.RespConditions = []QTIRespCondition{rc}
+}
+
+/* ExportQTI writes test steps of a document as sections of a single assessment. */
+func ExportQTI(w io.Writer, doc *ExchangeDocument) error {
+	defer trace.End(trace.Begin(""))
+
+	var lessons []ExchangeLesson
+	var qti QTIDocument
+
+	qti.Assessment = &QTIAssessment{Ident: "A0"}
+	if doc.Course != nil {
+		lessons = doc.Course.Lessons
+		qti.Assessment.Title = doc.Course.Name
+	} else if doc.Lesson != nil {
+		lessons = []ExchangeLesson{*doc.Lesson}
+		qti.Assessment.Title = doc.Lesson.Name
+	}
+
+	for i := 0; i < len(lessons); i++ {
+		lesson := &lessons[i]
+		for j := 0; j < len(lesson.Steps); j++ {
+			step := &lesson.Steps[j]
+			if step.Type != ExchangeStepTest {
+				continue
+			}
+
+			section := QTISection{Ident: fmt.Sprintf("S%d_%d", i, j), Title: step.Name}
+			if doc.Course != nil {
+				section.Title = lesson.Name + ": " + step.Name
+			}
+			section.Items = make([]QTIItem, len(step.Questions))
+			for k := 0; k < len(step.Questions); k++ {
+				Question2QTIItem(&step.Questions[k], fmt.Sprintf("I%d_%d_%d", i, j, k), &section.Items[k])
+			}
+			qti.Assessment.Sections = append(qti.Assessment.Sections, section)
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(&qti); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func QTIItem2Question(l Language, item *QTIItem, question *ExchangeQuestion) error {
+	lid := item.Presentation.ResponseLid
+	if (lid == nil) || (len(lid.Labels) == 0) {
+		return http.BadRequest("%s", Ls(l, "only multiple choice and true/false questions are supported"))
+	}
+
+	question.Question = stdstrings.TrimSpace(item.Presentation.Material.Text)
+	if len(question.Question) == 0 {
+		question.Question = item.Title
+	}
+
+	var correct []string
+	for i := 0; i < len(item.RespConditions); i++ {
+		rc := &item.RespConditions[i]
+		for j := 0; j < len(rc.SetVar); j++ {
+			if score, err := strconv.ParseFloat(stdstrings.TrimSpace(rc.SetVar[j].Value), 64); (err == nil) && (score > 0) {
+				correct = rc.Condition.Correct(correct)
+				break
+			}
+		}
+	}
+
+	for i := 0; i < len(lid.Labels); i++ {
+		label := &lid.Labels[i]
+		question.Answers = append(question.Answers, stdstrings.TrimSpace(label.Material.Text))
+		for j := 0; j < len(correct); j++ {
+			if correct[j] == label.Ident {
+				question.CorrectAnswers = append(question.CorrectAnswers, i)
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func QTISection2Step(l Language, section *QTISection, step *ExchangeStep, nquestions *int, errs *ImportErrors) {
+	step.Type = ExchangeStepTest
+	step.Name = section.Title
+
+	for i := 0; i < len(section.Items); i++ {
+		var question ExchangeQuestion
+		if err := QTIItem2Question(l, &section.Items[i], &question); err != nil {
+			errs.Add(ImportItem("", l, "Question", *nquestions), err)
+		} else {
+			step.Questions = append(step.Questions, question)
+		}
+		*nquestions++
+	}
+}
+
+/* ImportQTI puts questions of every section into its own test step of a single lesson. */
+func ImportQTI(l Language, data []byte, doc *ExchangeDocument) ImportErrors {
+	defer trace.End(trace.Begin(""))
+
+	var errs ImportErrors
+	var qti QTIDocument
+	var nquestions int
+
+	if err := xml.Unmarshal(data, &qti); err != nil {
+		errs.Add(Ls(l, "Document"), http.BadRequest(Ls(l, "invalid XML: %s"), err.Error()))
+		return errs
+	}
+
+	lesson := &ExchangeLesson{Name: Ls(l, "Imported questions"), Theory: fmt.Sprintf(Ls(l, "Imported from %s."), FormatQTI)}
+	doc.Lesson = lesson
+
+	sections := qti.Sections
+	if qti.Assessment != nil {
+		if len(qti.Assessment.Title) > 0 {
+			lesson.Name = qti.Assessment.Title
+		}
+		sections = append(sections, qti.Assessment.Sections...)
+	}
+	if len(qti.Items) > 0 {
+		sections = append(sections, QTISection{Items: qti.Items})
+	}
+
+	for i := 0; i < len(sections); i++ {
+		var step ExchangeStep
+		QTISection2Step(l, &sections[i], &step, &nquestions, &errs)
+		if len(step.Questions) > 0 {
+			if len(step.Name) == 0 {
+				step.Name = fmt.Sprintf("%s %d", Ls(l, "Test"), len(lesson.Steps)+1)
+			}
+			lesson.Steps = append(lesson.Steps, step)
+		}
+	}
+	if (len(lesson.Steps) == 0) && (len(errs) == 0) {
+		errs.Add(Ls(l, "Document"), http.BadRequest("%s", Ls(l, "document contains no questions")))
+	}
+
+	return errs
+}
@@ -0,0 +1,1109 @@
+package main
+
+import (
+	"math/rand"
+	stdstrings "strings"
+	"time"
+	"unsafe"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/net/url"
+	"github.com/anton2920/gofa/strings"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* BankQuestion is a question in a personal question bank of its owner. Test steps can take copies of it, which are linked with 'QuestionSource'. */
+type BankQuestion struct {
+	ID      database.ID
+	Flags   int32
+	OwnerID database.ID
+
+	Difficulty QuestionDifficulty
+
+	/* Version is incremented every time question is edited. */
+	Version int32
+
+	Question  Question
+	Tags      []string
+	CreatedOn int64
+
+	Blob Blob
+	Data [2048]byte
+}
+
+type QuestionDifficulty int32
+
+/* QuestionDifficultyAny is only used in filters. */
+const (
+	QuestionDifficultyAny QuestionDifficulty = iota
+	QuestionDifficultyEasy
+	QuestionDifficultyMedium
+	QuestionDifficultyHard
+)
+
+var QuestionDifficulties = [...]string{
+	QuestionDifficultyAny:    "Any",
+	QuestionDifficultyEasy:   "Easy",
+	QuestionDifficultyMedium: "Medium",
+	QuestionDifficultyHard:   "Hard",
+}
+
+const (
+	BankQuestionActive int32 = iota
+	BankQuestionDeleted
+)
+
+const (
+	MinTagLen = 1
+	MaxTagLen = 32
+	MaxTags   = 8
+
+	MaxDrawCount = 50
+)
+
+func CreateBankQuestionTx(tx *Tx, bq *BankQuestion) error {
+	defer trace.End(trace.Begin(""))
+
+	bq.ID = NewIDTx(tx, QuestionsDB)
+
+	return SaveBankQuestionTx(tx, bq)
+}
+
+func CreateBankQuestion(bq *BankQuestion) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := CreateBankQuestionTx(&tx, bq); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func DBBankQuestion2BankQuestion(bq *BankQuestion, data *byte) {
+	defer trace.End(trace.Begin(""))
+
+	question := &bq.Question
+	question.Name = database.Offset2String(question.Name, data)
+
+	slice := database.Offset2Slice(*(*[]byte)(unsafe.Pointer(&question.Answers)), data)
+	question.Answers = *(*[]string)(unsafe.Pointer(&slice))
+	for i := 0; i < len(question.Answers); i++ {
+		question.Answers[i] = database.Offset2String(question.Answers[i], data)
+	}
+
+	slice = database.Offset2Slice(*(*[]byte)(unsafe.Pointer(&question.CorrectAnswers)), data)
+	question.CorrectAnswers = *(*[]int)(unsafe.Pointer(&slice))
+
+	slice = database.Offset2Slice(*(*[]byte)(unsafe.Pointer(&bq.Tags)), data)
+	bq.Tags = *(*[]string)(unsafe.Pointer(&slice))
+	for i := 0; i < len(bq.Tags); i++ {
+		bq.Tags[i] = database.Offset2String(bq.Tags[i], data)
+	}
+}
+
+func GetBankQuestionByID(id database.ID, bq *BankQuestion) error {
+	defer trace.End(trace.Begin(""))
+
+	if err := DBRead(QuestionsDB, id, unsafe.Pointer(bq), int(unsafe.Sizeof(*bq))); err != nil {
+		return err
+	}
+	if bq.ID != id {
+		return database.NotFound
+	}
+
+	data, err := GetBlobData(&bq.Blob, bq.Data[:])
+	if err != nil {
+		return err
+	}
+
+	DBBankQuestion2BankQuestion(bq, data)
+	return nil
+}
+
+func GetBankQuestions(pos *int64, bqs []BankQuestion) (int, error) {
+	defer trace.End(trace.Begin(""))
+
+	n, err := DBReadManyValid(QuestionsDB, pos, bqs, func(bq *BankQuestion) database.ID { return bq.ID })
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < n; i++ {
+		data, err := GetBlobData(&bqs[i].Blob, bqs[i].Data[:])
+		if err != nil {
+			return 0, err
+		}
+		DBBankQuestion2BankQuestion(&bqs[i], data)
+	}
+	return n, nil
+}
+
+func DeleteBankQuestionByIDTx(tx *Tx, id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	flags := BankQuestionDeleted
+	var bq BankQuestion
+
+	offset := int64(int(id)*int(unsafe.Sizeof(bq))) + database.DataOffset + int64(unsafe.Offsetof(bq.Flags))
+	tx.WriteAt(QuestionsDB, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
+
+	tx.OnCommit(func() { UnindexBankQuestion(id) })
+	return nil
+}
+
+func DeleteBankQuestionByID(id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := DeleteBankQuestionByIDTx(&tx, id); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func BankQuestionDataSize(bq *BankQuestion) int {
+	defer trace.End(trace.Begin(""))
+
+	question := &bq.Question
+	size := DBStringSize(question.Name)
+	for i := 0; i < len(question.Answers); i++ {
+		size += DBStringSize(question.Answers[i])
+	}
+	size += DBSliceSize(question.Answers)
+	size += DBSliceSize(question.CorrectAnswers)
+
+	for i := 0; i < len(bq.Tags); i++ {
+		size += DBStringSize(bq.Tags[i])
+	}
+	size += DBSliceSize(bq.Tags)
+
+	return size
+}
+
+func SaveBankQuestionTx(tx *Tx, bq *BankQuestion) error {
+	defer trace.End(trace.Begin(""))
+
+	var bqDB BankQuestion
+	var n int
+
+	bqDB.ID = bq.ID
+	bqDB.Flags = bq.Flags
+	bqDB.OwnerID = bq.OwnerID
+	bqDB.Difficulty = bq.Difficulty
+	bqDB.Version = bq.Version
+
+	data, err := GetDataBuffer(bqDB.Data[:], BankQuestionDataSize(bq))
+	if err != nil {
+		return err
+	}
+
+	sq := &bq.Question
+	dq := &bqDB.Question
+
+	n += database.String2DBString(&dq.Name, sq.Name, data, n)
+	dq.Answers = make([]string, len(sq.Answers))
+	for i := 0; i < len(sq.Answers); i++ {
+		n += database.String2DBString(&dq.Answers[i], sq.Answers[i], data, n)
+	}
+	n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&dq.Answers)), *(*[]byte)(unsafe.Pointer(&dq.Answers)), int(unsafe.Sizeof(dq.Answers[0])), int(unsafe.Alignof(dq.Answers[0])), data, n)
+	n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&dq.CorrectAnswers)), *(*[]byte)(unsafe.Pointer(&sq.CorrectAnswers)), int(unsafe.Sizeof(sq.CorrectAnswers[0])), int(unsafe.Alignof(sq.CorrectAnswers[0])), data, n)
+
+	bqDB.Tags = make([]string, len(bq.Tags))
+	for i := 0; i < len(bq.Tags); i++ {
+		n += database.String2DBString(&bqDB.Tags[i], bq.Tags[i], data, n)
+	}
+	n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&bqDB.Tags)), *(*[]byte)(unsafe.Pointer(&bqDB.Tags)), int(unsafe.Sizeof(bqDB.Tags[0])), int(unsafe.Alignof(bqDB.Tags[0])), data, n)
+
+	bqDB.CreatedOn = bq.CreatedOn
+
+	if err := SaveBlob(&bqDB.Blob, bqDB.Data[:], data[:n]); err != nil {
+		return err
+	}
+
+	tx.Write(QuestionsDB, bqDB.ID, unsafe.Pointer(&bqDB), int(unsafe.Sizeof(bqDB)))
+
+	indexed := BankQuestion{ID: bq.ID, Flags: bq.Flags, OwnerID: bq.OwnerID}
+	tx.OnCommit(func() { IndexBankQuestion(&indexed) })
+	return nil
+}
+
+func SaveBankQuestion(bq *BankQuestion) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := SaveBankQuestionTx(&tx, bq); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+/* NormalizeTag returns tag in the form it's stored in. Tags are case-insensitive, so they are stored in lower case. */
+func NormalizeTag(tag string) string {
+	return stdstrings.ToLower(stdstrings.TrimSpace(tag))
+}
+
+/* ParseTags splits comma-separated list of tags. */
+func ParseTags(s string) []string {
+	var tags []string
+
+	parts := stdstrings.Split(s, ",")
+	for i := 0; i < len(parts); i++ {
+		tag := NormalizeTag(parts[i])
+		if len(tag) == 0 {
+			continue
+		}
+
+		var found bool
+		for j := 0; j < len(tags); j++ {
+			if tags[j] == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+func BankQuestionHasTag(bq *BankQuestion, tag string) bool {
+	for i := 0; i < len(bq.Tags); i++ {
+		if bq.Tags[i] == tag {
+			return true
+		}
+	}
+	return false
+}
+
+/* BankQuestionMatches reports whether question satisfies filter. Empty tag and 'QuestionDifficultyAny' match every question. */
+func BankQuestionMatches(bq *BankQuestion, tag string, difficulty QuestionDifficulty) bool {
+	if (len(tag) > 0) && (!BankQuestionHasTag(bq, tag)) {
+		return false
+	}
+	return (difficulty == QuestionDifficultyAny) || (bq.Difficulty == difficulty)
+}
+
+/* GetUserBankQuestions returns questions from user's bank, which match filter. */
+func GetUserBankQuestions(userID database.ID, tag string, difficulty QuestionDifficulty) ([]BankQuestion, error) {
+	defer trace.End(trace.Begin(""))
+
+	var bqs []BankQuestion
+
+	ids := GetUserBankQuestionIDs(userID)
+	for i := 0; i < len(ids); i++ {
+		var bq BankQuestion
+
+		if err := GetBankQuestionByID(ids[i], &bq); err != nil {
+			return nil, err
+		}
+		if (bq.Flags == BankQuestionDeleted) || (!BankQuestionMatches(&bq, tag, difficulty)) {
+			continue
+		}
+		bqs = append(bqs, bq)
+	}
+
+	return bqs, nil
+}
+
+func BankQuestion2Question(dst *Question, bq *BankQuestion) {
+	src := &bq.Question
+
+	dst.Name = src.Name
+
+	dst.Answers = make([]string, len(src.Answers))
+	copy(dst.Answers, src.Answers)
+
+	dst.CorrectAnswers = make([]int, len(src.CorrectAnswers))
+	copy(dst.CorrectAnswers, src.CorrectAnswers)
+}
+
+/* LessonTestFitSources keeps 'Sources' of a test either empty or of the same length as 'Questions'. */
+func LessonTestFitSources(test *StepTest) {
+	if len(test.Sources) == 0 {
+		return
+	}
+	for len(test.Sources) < len(test.Questions) {
+		test.Sources = append(test.Sources, QuestionSource{})
+	}
+	test.Sources = test.Sources[:len(test.Questions)]
+}
+
+func LessonTestHasBankQuestion(test *StepTest, id database.ID) bool {
+	for i := 0; i < len(test.Sources); i++ {
+		if (test.Sources[i].Version != 0) && (test.Sources[i].ID == id) {
+			return true
+		}
+	}
+	return false
+}
+
+/* LessonTestAddBankQuestion appends linked copy of a bank question to test. */
+func LessonTestAddBankQuestion(test *StepTest, bq *BankQuestion) {
+	for len(test.Sources) < len(test.Questions) {
+		test.Sources = append(test.Sources, QuestionSource{})
+	}
+
+	var question Question
+	BankQuestion2Question(&question, bq)
+
+	test.Questions = append(test.Questions, question)
+	test.Sources = append(test.Sources, QuestionSource{ID: bq.ID, Version: bq.Version})
+}
+
+/* LessonTestDrawBankQuestions appends 'count' random questions from user's bank, which match filter and are not in test yet. */
+func LessonTestDrawBankQuestions(l Language, test *StepTest, userID database.ID, tag string, difficulty QuestionDifficulty, count int) error {
+	defer trace.End(trace.Begin(""))
+
+	if (count < 1) || (count > MaxDrawCount) {
+		return http.BadRequest(Ls(l, "number of questions must be between %d and %d"), 1, MaxDrawCount)
+	}
+
+	bqs, err := GetUserBankQuestions(userID, tag, difficulty)
+	if err != nil {
+		return http.ServerError(err)
+	}
+	for i := 0; i < len(bqs); i++ {
+		if LessonTestHasBankQuestion(test, bqs[i].ID) {
+			bqs = RemoveAt(bqs, i)
+			i--
+		}
+	}
+	if len(bqs) < count {
+		return http.BadRequest(Ls(l, "only %d questions in the bank match, %d requested"), len(bqs), count)
+	}
+
+	rand.Shuffle(len(bqs), func(i, j int) { bqs[i], bqs[j] = bqs[j], bqs[i] })
+	for i := 0; i < count; i++ {
+		LessonTestAddBankQuestion(test, &bqs[i])
+	}
+
+	return nil
+}
+
+/*
+ * BankQuestionUpdateLessonsTx replaces linked copies of a question in course lessons with its current version. Published lessons get new version, so subjects can sync them.
+ * Only courses 'user' may edit are updated, forks and imports of other users stay as they are. Subject lessons are not touched, because students may have already submitted them.
+ */
+func BankQuestionUpdateLessonsTx(tx *Tx, bq *BankQuestion, user *User) (int, error) {
+	defer trace.End(trace.Begin(""))
+
+	var updated int
+
+	ids := GetQuestionLessonIDs(bq.ID)
+	for i := 0; i < len(ids); i++ {
+		var lesson Lesson
+		var course Course
+
+		if err := GetLessonByID(ids[i], &lesson); err != nil {
+			return 0, err
+		}
+		if (lesson.Flags == LessonDeleted) || (lesson.ContainerType != LessonContainerCourse) {
+			continue
+		}
+		if err := GetCourseByID(lesson.ContainerID, &course); err != nil {
+			if err == database.NotFound {
+				continue
+			}
+			return 0, err
+		}
+		if (course.Flags == CourseDeleted) || (UserCourseAccess(user, &course) < CourseAccessCoAuthor) {
+			continue
+		}
+
+		var changed bool
+		for j := 0; j < len(lesson.Steps); j++ {
+			test, err := Step2Test(&lesson.Steps[j])
+			if err != nil {
+				continue
+			}
+			for k := 0; k < len(test.Sources); k++ {
+				source := &test.Sources[k]
+				if (source.Version == 0) || (source.ID != bq.ID) || (source.Version == bq.Version) {
+					continue
+				}
+
+				BankQuestion2Question(&test.Questions[k], bq)
+				source.Version = bq.Version
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		if lesson.Flags == LessonActive {
+			lesson.Version++
+		}
+		if err := SaveLessonTx(tx, &lesson); err != nil {
+			return 0, err
+		}
+		updated++
+	}
+
+	return updated, nil
+}
+
+func BankQuestionFillFromRequest(vs url.Values, bq *BankQuestion) error {
+	defer trace.End(trace.Begin(""))
+
+	question := &bq.Question
+	question.Name = vs.Get("Question")
+	question.Answers = vs.GetMany("Answer")
+
+	correctAnswers := vs.GetMany("CorrectAnswer")
+	question.CorrectAnswers = question.CorrectAnswers[:0]
+	for i := 0; i < len(correctAnswers); i++ {
+		correctAnswer, err := GetValidIndex(correctAnswers[i], len(question.Answers))
+		if err != nil {
+			return err
+		}
+		question.CorrectAnswers = append(question.CorrectAnswers, correctAnswer)
+	}
+
+	bq.Tags = ParseTags(vs.Get("Tags"))
+
+	if vs.Get("Difficulty") != "" {
+		difficulty, err := GetValidIndex(vs.Get("Difficulty"), len(QuestionDifficulties))
+		if err != nil {
+			return err
+		}
+		bq.Difficulty = QuestionDifficulty(difficulty)
+	}
+
+	return nil
+}
+
+func BankQuestionVerify(l Language, bq *BankQuestion) error {
+	defer trace.End(trace.Begin(""))
+
+	question := &bq.Question
+
+	if !strings.LengthInRange(question.Name, MinQuestionLen, MaxQuestionLen) {
+		return http.BadRequest(Ls(l, "question title length must be between %d and %d characters long"), MinQuestionLen, MaxQuestionLen)
+	}
+
+	if len(question.Answers) < 2 {
+		return http.BadRequest("%s", Ls(l, "add at least two answers"))
+	}
+	for i := 0; i < len(question.Answers); i++ {
+		if !strings.LengthInRange(question.Answers[i], MinAnswerLen, MaxAnswerLen) {
+			return http.BadRequest(Ls(l, "answer %d: length must be between %d and %d characters long"), i+1, MinAnswerLen, MaxAnswerLen)
+		}
+	}
+	if len(question.CorrectAnswers) == 0 {
+		return http.BadRequest("%s", Ls(l, "select at least one correct answer"))
+	}
+
+	if len(bq.Tags) > MaxTags {
+		return http.BadRequest(Ls(l, "question can have at most %d tags"), MaxTags)
+	}
+	for i := 0; i < len(bq.Tags); i++ {
+		if !strings.LengthInRange(bq.Tags[i], MinTagLen, MaxTagLen) {
+			return http.BadRequest(Ls(l, "tag length must be between %d and %d characters long"), MinTagLen, MaxTagLen)
+		}
+	}
+
+	if (bq.Difficulty <= QuestionDifficultyAny) || (int(bq.Difficulty) >= len(QuestionDifficulties)) {
+		return http.BadRequest("%s", Ls(l, "select question difficulty"))
+	}
+
+	return nil
+}
+
+func DisplayQuestionDifficultySelect(w *http.Response, l Language, name string, selected QuestionDifficulty, any bool) {
+	w.WriteString(`<select class="form-select" name="`)
+	w.WriteString(name)
+	w.WriteString(`">`)
+	for i := 0; i < len(QuestionDifficulties); i++ {
+		if (QuestionDifficulty(i) == QuestionDifficultyAny) && (!any) {
+			continue
+		}
+
+		w.WriteString(`<option value="`)
+		w.WriteInt(i)
+		w.WriteString(`"`)
+		if QuestionDifficulty(i) == selected {
+			w.WriteString(` selected`)
+		}
+		w.WriteString(`>`)
+		w.WriteString(Ls(l, QuestionDifficulties[i]))
+		w.WriteString(`</option>`)
+	}
+	w.WriteString(`</select>`)
+}
+
+func DisplayBankQuestionTitle(w *http.Response, l Language, bq *BankQuestion) {
+	w.WriteHTMLString(bq.Question.Name)
+	w.WriteString(` (ID: `)
+	w.WriteInt(int(bq.ID))
+	w.WriteString(`)`)
+	DisplayDeleted(w, l, bq.Flags == BankQuestionDeleted)
+}
+
+/* DisplayLessonTestBank displays controls for taking questions from user's bank into test. */
+func DisplayLessonTestBank(w *http.Response, l Language, userID database.ID) {
+	bqs, err := GetUserBankQuestions(userID, "", QuestionDifficultyAny)
+	if err != nil {
+		/* TODO(anton2920): report error. */
+	}
+
+	DisplayFrameStart(w)
+
+	w.WriteString(`<p><b>`)
+	w.WriteString(Ls(l, "Question bank"))
+	w.WriteString(`</b></p>`)
+
+	if len(bqs) == 0 {
+		w.WriteString(`<p>`)
+		w.WriteString(Ls(l, "Your question bank is empty"))
+		w.WriteString(`. <a href="/questions">`)
+		w.WriteString(Ls(l, "Create question"))
+		w.WriteString(`</a></p>`)
+	} else {
+		DisplayLabel(w, l, "Questions")
+		w.WriteString(`<select class="form-select" name="BankQuestionID" multiple>`)
+		for i := 0; i < len(bqs); i++ {
+			bq := &bqs[i]
+
+			w.WriteString(`<option value="`)
+			w.WriteInt(int(bq.ID))
+			w.WriteString(`">`)
+			DisplayShortenedString(w, bq.Question.Name, 50)
+			if len(bq.Tags) > 0 {
+				w.WriteString(` [`)
+				w.WriteHTMLString(stdstrings.Join(bq.Tags, ", "))
+				w.WriteString(`]`)
+			}
+			w.WriteString(`</option>`)
+		}
+		w.WriteString(`</select>`)
+		DisplayCommand(w, l, "Add selected questions")
+		w.WriteString(`<br><br>`)
+
+		DisplayLabel(w, l, "Tag")
+		DisplayConstraintInput(w, "text", MinTagLen, MaxTagLen, "BankTag", "", false)
+		w.WriteString(`<br>`)
+
+		DisplayLabel(w, l, "Difficulty")
+		DisplayQuestionDifficultySelect(w, l, "BankDifficulty", QuestionDifficultyAny, true)
+		w.WriteString(`<br>`)
+
+		DisplayLabel(w, l, "Number of questions")
+		DisplayNumberInput(w, 1, MaxDrawCount, "BankCount", 1, false)
+		DisplayCommand(w, l, "Add random questions")
+	}
+
+	DisplayFrameEnd(w)
+}
+
+func QuestionBankPageHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	const width = WidthLarge
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	tag := NormalizeTag(r.URL.Query.Get("Tag"))
+	difficulty := QuestionDifficultyAny
+	if r.URL.Query.Get("Difficulty") != "" {
+		d, err := GetValidIndex(r.URL.Query.Get("Difficulty"), len(QuestionDifficulties))
+		if err != nil {
+			return http.ClientError(err)
+		}
+		difficulty = QuestionDifficulty(d)
+	}
+
+	bqs, err := GetUserBankQuestions(session.ID, tag, difficulty)
+	if err != nil {
+		return http.ServerError(err)
+	}
+
+	DisplayHTMLStart(w)
+
+	DisplayHeadStart(w)
+	{
+		w.WriteString(`<title>`)
+		w.WriteString(Ls(GL, "Question bank"))
+		w.WriteString(`</title>`)
+	}
+	DisplayHeadEnd(w)
+
+	DisplayBodyStart(w)
+	{
+		DisplayHeader(w, GL, session)
+		DisplaySidebar(w, GL, session)
+
+		DisplayMainStart(w)
+
+		DisplayCrumbsStart(w, width)
+		{
+			DisplayCrumbsItem(w, GL, "Question bank")
+		}
+		DisplayCrumbsEnd(w)
+
+		DisplayPageStart(w, width)
+		{
+			w.WriteString(`<h2 class="text-center">`)
+			w.WriteString(Ls(GL, "Question bank"))
+			w.WriteString(`</h2>`)
+			w.WriteString(`<br>`)
+
+			w.WriteString(`<form class="d-flex gap-2 mb-2" method="GET" action="/questions">`)
+			DisplayConstraintInput(w, "text", MinTagLen, MaxTagLen, "Tag", tag, false)
+			DisplayQuestionDifficultySelect(w, GL, "Difficulty", difficulty, true)
+			DisplayButton(w, GL, "", "Filter")
+			w.WriteString(`</form>`)
+
+			DisplayTableStart(w, GL, []string{"ID", "Question", "Tags", "Difficulty", "Version"})
+			{
+				for i := 0; i < len(bqs); i++ {
+					bq := &bqs[i]
+
+					DisplayTableRowLinkIDStart(w, "/question", bq.ID)
+
+					DisplayTableItemShortenedString(w, bq.Question.Name, 50)
+					DisplayTableItemString(w, stdstrings.Join(bq.Tags, ", "))
+					DisplayTableItemString(w, Ls(GL, QuestionDifficulties[bq.Difficulty]))
+					DisplayTableItemInt(w, int(bq.Version))
+
+					DisplayTableRowEnd(w)
+				}
+			}
+			DisplayTableEnd(w)
+
+			w.WriteString(`<form method="POST" action="/question/create">`)
+			DisplaySubmit(w, GL, "", "Create question", true)
+			w.WriteString(`</form>`)
+		}
+		DisplayPageEnd(w)
+		DisplayMainEnd(w)
+	}
+	DisplayBodyEnd(w)
+
+	DisplayHTMLEnd(w)
+	return nil
+}
+
+func QuestionPageHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	const width = WidthLarge
+
+	var bq BankQuestion
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	id, err := GetIDFromURL(GL, r.URL, "/question/")
+	if err != nil {
+		return err
+	}
+	if err := GetBankQuestionByID(id, &bq); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "question with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if bq.OwnerID != session.ID {
+		return ForbiddenError
+	}
+
+	DisplayHTMLStart(w)
+
+	DisplayHeadStart(w)
+	{
+		w.WriteString(`<title>`)
+		DisplayBankQuestionTitle(w, GL, &bq)
+		w.WriteString(`</title>`)
+	}
+	DisplayHeadEnd(w)
+
+	DisplayBodyStart(w)
+	{
+		DisplayHeader(w, GL, session)
+		DisplaySidebar(w, GL, session)
+
+		DisplayMainStart(w)
+
+		DisplayCrumbsStart(w, width)
+		{
+			DisplayCrumbsLink(w, GL, "/questions", "Question bank")
+			DisplayCrumbsItemStart(w)
+			DisplayBankQuestionTitle(w, GL, &bq)
+			DisplayCrumbsItemEnd(w)
+		}
+		DisplayCrumbsEnd(w)
+
+		DisplayPageStart(w, width)
+		{
+			w.WriteString(`<h2>`)
+			DisplayBankQuestionTitle(w, GL, &bq)
+			w.WriteString(`</h2>`)
+			w.WriteString(`<br>`)
+
+			w.WriteString(`<h3>`)
+			w.WriteString(Ls(GL, "Info"))
+			w.WriteString(`</h3>`)
+
+			w.WriteString(`<p>`)
+			w.WriteString(Ls(GL, "Difficulty"))
+			w.WriteString(`: `)
+			w.WriteString(Ls(GL, QuestionDifficulties[bq.Difficulty]))
+			w.WriteString(`</p>`)
+
+			w.WriteString(`<p>`)
+			w.WriteString(Ls(GL, "Tags"))
+			w.WriteString(`: `)
+			w.WriteHTMLString(stdstrings.Join(bq.Tags, ", "))
+			w.WriteString(`</p>`)
+
+			w.WriteString(`<p>`)
+			w.WriteString(Ls(GL, "Version"))
+			w.WriteString(`: `)
+			w.WriteInt(int(bq.Version))
+			w.WriteString(`</p>`)
+
+			w.WriteString(`<p>`)
+			w.WriteString(Ls(GL, "Created on"))
+			w.WriteString(`: `)
+			DisplayFormattedTime(w, bq.CreatedOn)
+			w.WriteString(`</p>`)
+
+			if bq.Flags != BankQuestionDeleted {
+				w.WriteString(`<div>`)
+				w.WriteString(`<form style="display:inline" method="POST" action="/question/edit">`)
+				DisplayHiddenID(w, "ID", bq.ID)
+				DisplayButton(w, GL, "", "Edit")
+				w.WriteString(`</form>`)
+
+				w.WriteString(` <form style="display:inline" method="POST" action="/api/question/delete">`)
+				DisplayHiddenID(w, "ID", bq.ID)
+				DisplayButton(w, GL, "", "Delete")
+				w.WriteString(`</form>`)
+				w.WriteString(`</div>`)
+				w.WriteString(`<br>`)
+			}
+
+			w.WriteString(`<h3>`)
+			w.WriteString(Ls(GL, "Answers"))
+			w.WriteString(`</h3>`)
+			w.WriteString(`<ol>`)
+			for i := 0; i < len(bq.Question.Answers); i++ {
+				var correct bool
+				for j := 0; j < len(bq.Question.CorrectAnswers); j++ {
+					if bq.Question.CorrectAnswers[j] == i {
+						correct = true
+						break
+					}
+				}
+
+				w.WriteString(`<li>`)
+				if correct {
+					w.WriteString(`<b>`)
+				}
+				w.WriteHTMLString(bq.Question.Answers[i])
+				if correct {
+					w.WriteString(`</b>`)
+				}
+				w.WriteString(`</li>`)
+			}
+			w.WriteString(`</ol>`)
+		}
+		DisplayPageEnd(w)
+		DisplayMainEnd(w)
+	}
+	DisplayBodyEnd(w)
+
+	DisplayHTMLEnd(w)
+	return nil
+}
+
+func QuestionCreateEditPageHandler(w *http.Response, r *http.Request, session *Session, bq *BankQuestion, endpoint string, title string, action string, err error) error {
+	defer trace.End(trace.Begin(""))
+
+	const width = WidthMedium
+
+	DisplayHTMLStart(w)
+
+	DisplayHeadStart(w)
+	{
+		w.WriteString(`<title>`)
+		w.WriteString(Ls(GL, title))
+		w.WriteString(`</title>`)
+
+		if CSSEnabled {
+			w.WriteString(`<style>.input-field{ padding: .375rem .75rem; width: 70%; font-size: 1rem; font-weight: 400; line-height: 1.5; color: var(--bs-body-color); -webkit-appearance: none; -moz-appearance: none; appearance: none; background-color: var(--bs-body-bg); background-clip: padding-box; border: var(--bs-border-width) solid var(--bs-border-color); border-radius: var(--bs-border-radius); transition: border-color .15s ease-in-out, box-shadow .15s ease-in-out; margin-left: 5px; } </style>`)
+		}
+	}
+	DisplayHeadEnd(w)
+
+	DisplayBodyStart(w)
+	{
+		DisplayHeader(w, GL, session)
+		DisplaySidebar(w, GL, session)
+
+		DisplayMainStart(w)
+
+		DisplayCrumbsStart(w, width)
+		{
+			DisplayCrumbsLink(w, GL, "/questions", "Question bank")
+			if title == "Edit question" {
+				DisplayCrumbsLinkIDStart(w, "/question", bq.ID)
+				DisplayBankQuestionTitle(w, GL, bq)
+				DisplayCrumbsLinkEnd(w)
+			}
+			DisplayCrumbsItem(w, GL, title)
+		}
+		DisplayCrumbsEnd(w)
+
+		DisplayFormPageStart(w, r, GL, width, title, endpoint, err)
+		{
+			question := &bq.Question
+
+			DisplayLabel(w, GL, "Title")
+			DisplayConstraintInput(w, "text", MinQuestionLen, MaxQuestionLen, "Question", question.Name, true)
+			w.WriteString(`<br>`)
+
+			w.WriteString(`<p>`)
+			w.WriteString(Ls(GL, "Answers (mark the correct ones)"))
+			w.WriteString(`:</p>`)
+			w.WriteString(`<ol>`)
+			for len(question.Answers) < 2 {
+				question.Answers = append(question.Answers, "")
+			}
+			for i := 0; i < len(question.Answers); i++ {
+				w.WriteString(`<li>`)
+
+				w.WriteString(`<input type="checkbox" name="CorrectAnswer" value="`)
+				w.WriteInt(i)
+				w.WriteString(`"`)
+				for j := 0; j < len(question.CorrectAnswers); j++ {
+					if question.CorrectAnswers[j] == i {
+						w.WriteString(` checked`)
+						break
+					}
+				}
+				w.WriteString(`>`)
+
+				w.WriteString(` <input class="input-field" type="text" minlength="`)
+				w.WriteInt(MinAnswerLen)
+				w.WriteString(`" maxlength="`)
+				w.WriteInt(MaxAnswerLen)
+				w.WriteString(`" name="Answer" value="`)
+				w.WriteHTMLString(question.Answers[i])
+				w.WriteString(`" required>`)
+
+				w.WriteString(`</li>`)
+			}
+			w.WriteString(`</ol>`)
+			DisplayCommand(w, GL, "Add another answer")
+			w.WriteString(`<br><br>`)
+
+			DisplayLabel(w, GL, "Tags (comma-separated)")
+			DisplayInput(w, "text", "Tags", stdstrings.Join(bq.Tags, ", "), false)
+			w.WriteString(`<br>`)
+
+			DisplayLabel(w, GL, "Difficulty")
+			DisplayQuestionDifficultySelect(w, GL, "Difficulty", bq.Difficulty, false)
+			w.WriteString(`<br>`)
+
+			if title == "Edit question" {
+				w.WriteString(`<div class="form-check mb-3">`)
+				w.WriteString(`<input class="form-check-input" type="checkbox" name="UpdateLessons" value="1" id="UpdateLessons"`)
+				if r.Form.Get("UpdateLessons") != "" {
+					w.WriteString(` checked`)
+				}
+				w.WriteString(`>`)
+				w.WriteString(`<label class="form-check-label" for="UpdateLessons">`)
+				w.WriteString(Ls(GL, "Update course lessons, which use this question"))
+				w.WriteString(`</label>`)
+				w.WriteString(`</div>`)
+			}
+
+			DisplaySubmit(w, GL, "", action, true)
+		}
+		DisplayFormPageEnd(w)
+		DisplayMainEnd(w)
+	}
+	DisplayBodyEnd(w)
+
+	DisplayHTMLEnd(w)
+	return nil
+}
+
+func QuestionCreatePageHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	bq := BankQuestion{Difficulty: QuestionDifficultyMedium}
+	return QuestionCreateEditPageHandler(w, r, session, &bq, APIPrefix+"/question/create", "Create question", "Create", nil)
+}
+
+func QuestionEditPageHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var bq BankQuestion
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	questionID, err := r.Form.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if err := GetBankQuestionByID(questionID, &bq); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "question with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if (bq.OwnerID != session.ID) || (bq.Flags == BankQuestionDeleted) {
+		return ForbiddenError
+	}
+
+	return QuestionCreateEditPageHandler(w, r, session, &bq, APIPrefix+"/question/edit", "Edit question", "Save", nil)
+}
+
+func QuestionCreateHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var bq BankQuestion
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	if err := BankQuestionFillFromRequest(r.Form, &bq); err != nil {
+		return http.ClientError(err)
+	}
+	if r.Form.Get("Command") == Ls(GL, "Add another answer") {
+		bq.Question.Answers = append(bq.Question.Answers, "")
+		return QuestionCreateEditPageHandler(w, r, session, &bq, APIPrefix+"/question/create", "Create question", "Create", nil)
+	}
+	if err := BankQuestionVerify(GL, &bq); err != nil {
+		return QuestionCreateEditPageHandler(w, r, session, &bq, APIPrefix+"/question/create", "Create question", "Create", err)
+	}
+
+	bq.OwnerID = session.ID
+	bq.Version = 1
+	bq.CreatedOn = time.Now().Unix()
+
+	if err := CreateBankQuestion(&bq); err != nil {
+		return http.ServerError(err)
+	}
+
+	Audit(r, session.ID, "create", "question", bq.ID, "", AuditQuestionSummary(&bq))
+
+	w.Redirect(w.PathID("/question/", bq.ID), http.StatusSeeOther)
+	return nil
+}
+
+func QuestionEditHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var bq BankQuestion
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	questionID, err := r.Form.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if err := GetBankQuestionByID(questionID, &bq); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "question with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if (bq.OwnerID != session.ID) || (bq.Flags == BankQuestionDeleted) {
+		return ForbiddenError
+	}
+
+	before := AuditQuestionSummary(&bq)
+	if err := BankQuestionFillFromRequest(r.Form, &bq); err != nil {
+		return http.ClientError(err)
+	}
+	if r.Form.Get("Command") == Ls(GL, "Add another answer") {
+		bq.Question.Answers = append(bq.Question.Answers, "")
+		return QuestionCreateEditPageHandler(w, r, session, &bq, APIPrefix+"/question/edit", "Edit question", "Save", nil)
+	}
+	if err := BankQuestionVerify(GL, &bq); err != nil {
+		return QuestionCreateEditPageHandler(w, r, session, &bq, APIPrefix+"/question/edit", "Edit question", "Save", err)
+	}
+	bq.Version++
+
+	var tx Tx
+	if err := SaveBankQuestionTx(&tx, &bq); err != nil {
+		return http.ServerError(err)
+	}
+	if r.Form.Get("UpdateLessons") != "" {
+		var user User
+		if err := GetUserByID(session.ID, &user); err != nil {
+			return http.ServerError(err)
+		}
+		if _, err := BankQuestionUpdateLessonsTx(&tx, &bq, &user); err != nil {
+			return http.ServerError(err)
+		}
+	}
+	if err := CommitTx(&tx); err != nil {
+		return http.ServerError(err)
+	}
+
+	Audit(r, session.ID, "edit", "question", bq.ID, before, AuditQuestionSummary(&bq))
+
+	w.Redirect(w.PathID("/question/", bq.ID), http.StatusSeeOther)
+	return nil
+}
+
+/* QuestionDeleteHandler removes question from bank. Its copies in lessons stay as they are. */
+func QuestionDeleteHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var bq BankQuestion
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	questionID, err := r.Form.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if err := GetBankQuestionByID(questionID, &bq); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "question with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if bq.OwnerID != session.ID {
+		return ForbiddenError
+	}
+
+	if err := DeleteBankQuestionByID(questionID); err != nil {
+		return http.ServerError(err)
+	}
+
+	Audit(r, session.ID, "delete", "question", questionID, AuditQuestionSummary(&bq), "")
+
+	w.Redirect("/questions", http.StatusSeeOther)
+	return nil
+}
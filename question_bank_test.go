@@ -0,0 +1,247 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+)
+
+func testGetLessonTest(t *testing.T, lessonID database.ID, stepIndex int) *StepTest {
+	t.Helper()
+
+	var lesson Lesson
+	if err := GetLessonByID(lessonID, &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	if stepIndex >= len(lesson.Steps) {
+		t.Fatalf("Expected lesson %d to have step %d, got %d steps", lessonID, stepIndex, len(lesson.Steps))
+	}
+
+	test, err := Step2Test(&lesson.Steps[stepIndex])
+	if err != nil {
+		t.Fatalf("Expected step %d to be a test: %v", stepIndex, err)
+	}
+	return test
+}
+
+func TestParseTags(t *testing.T) {
+	tests := [...]struct {
+		Input    string
+		Expected []string
+	}{
+		{"", nil},
+		{" , ,", nil},
+		{"Go", []string{"go"}},
+		{"go, SQL ,go,, web", []string{"go", "sql", "web"}},
+	}
+
+	for _, test := range tests {
+		if tags := ParseTags(test.Input); !reflect.DeepEqual(tags, test.Expected) {
+			t.Errorf("ParseTags(%q): expected %v, got %v", test.Input, test.Expected, tags)
+		}
+	}
+}
+
+func TestQuestionBankPageHandler(t *testing.T) {
+	testCreateInitialDBs()
+
+	testGetAuth(t, "/questions", testTokens[1], http.StatusOK)
+	testGetAuth(t, "/questions?Tag=go&Difficulty=2", testTokens[1], http.StatusOK)
+	testGetAuth(t, "/questions?Difficulty=a", testTokens[1], http.StatusBadRequest)
+	testGet(t, "/questions", http.StatusUnauthorized)
+
+	testGetAuth(t, "/question/0", testTokens[1], http.StatusOK)
+	testGetAuth(t, "/question/3", testTokens[1], http.StatusForbidden)
+	testGetAuth(t, "/question/10", testTokens[1], http.StatusNotFound)
+	testGetAuth(t, "/question/a", testTokens[1], http.StatusBadRequest)
+
+	bqs, err := GetUserBankQuestions(1, "go", QuestionDifficultyAny)
+	if (err != nil) || (len(bqs) != 2) {
+		t.Errorf("Expected 2 questions tagged 'go', got %d (%v)", len(bqs), err)
+	}
+	bqs, err = GetUserBankQuestions(1, "", QuestionDifficultyHard)
+	if (err != nil) || (len(bqs) != 1) || (bqs[0].ID != 2) {
+		t.Errorf("Expected hard question 2, got %v (%v)", bqs, err)
+	}
+}
+
+func TestQuestionCreateEditDeleteHandlers(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	valid := url.Values{"Question": {"What is a channel?"}, "Answer": {"Pipe", "Mutex"}, "CorrectAnswer": {"0"}, "Tags": {"Go, Concurrency"}, "Difficulty": {"2"}}
+
+	testPostAuth(t, "/question/create", testTokens[1], nil, http.StatusOK)
+	testPostAuth(t, APIPrefix+"/question/create", testTokens[1], url.Values{"Question": {"Q"}, "Answer": {"A"}, "Command": {Ls(GL, "Add another answer")}}, http.StatusOK)
+	testPostAuth(t, APIPrefix+"/question/create", testTokens[1], valid, http.StatusSeeOther)
+	testPost(t, APIPrefix+"/question/create", valid, http.StatusUnauthorized)
+
+	expectedBadRequest := [...]url.Values{
+		{"Question": {""}, "Answer": {"Pipe", "Mutex"}, "CorrectAnswer": {"0"}, "Difficulty": {"2"}},
+		{"Question": {"Q"}, "Answer": {"Pipe"}, "CorrectAnswer": {"0"}, "Difficulty": {"2"}},
+		{"Question": {"Q"}, "Answer": {"Pipe", ""}, "CorrectAnswer": {"0"}, "Difficulty": {"2"}},
+		{"Question": {"Q"}, "Answer": {"Pipe", "Mutex"}, "Difficulty": {"2"}},
+		{"Question": {"Q"}, "Answer": {"Pipe", "Mutex"}, "CorrectAnswer": {"2"}, "Difficulty": {"2"}},
+		{"Question": {"Q"}, "Answer": {"Pipe", "Mutex"}, "CorrectAnswer": {"0"}, "Difficulty": {"0"}},
+		{"Question": {"Q"}, "Answer": {"Pipe", "Mutex"}, "CorrectAnswer": {"0"}, "Difficulty": {"4"}},
+		{"Question": {"Q"}, "Answer": {"Pipe", "Mutex"}, "CorrectAnswer": {"0"}, "Difficulty": {"2"}, "Tags": {testString(MaxTagLen + 1)}},
+		{"Question": {"Q"}, "Answer": {"Pipe", "Mutex"}, "CorrectAnswer": {"0"}, "Difficulty": {"2"}, "Tags": {"a,b,c,d,e,f,g,h,i"}},
+	}
+	for _, test := range expectedBadRequest {
+		testPostAuth(t, APIPrefix+"/question/create", testTokens[1], test, http.StatusBadRequest)
+	}
+
+	ids := GetUserBankQuestionIDs(1)
+	if len(ids) != 4 {
+		t.Fatalf("Expected teacher to have 4 questions, got %v", ids)
+	}
+	var bq BankQuestion
+	if err := GetBankQuestionByID(ids[3], &bq); err != nil {
+		t.Fatalf("Failed to get question: %v", err)
+	}
+	if (bq.OwnerID != 1) || (bq.Version != 1) || (bq.Difficulty != QuestionDifficultyMedium) || (!reflect.DeepEqual(bq.Tags, []string{"go", "concurrency"})) {
+		t.Errorf("Unexpected created question %+v", bq)
+	}
+
+	edit := url.Values{"ID": {"0"}, "Question": {"What is a goroutine in Go?"}, "Answer": {"Lightweight thread", "Process"}, "CorrectAnswer": {"0"}, "Tags": {"go"}, "Difficulty": {"1"}}
+	testPostAuth(t, "/question/edit", testTokens[1], url.Values{"ID": {"0"}}, http.StatusOK)
+	testPostAuth(t, "/question/edit", testTokens[AdminID], url.Values{"ID": {"0"}}, http.StatusForbidden)
+	testPostAuth(t, APIPrefix+"/question/edit", testTokens[AdminID], edit, http.StatusForbidden)
+	testPostAuth(t, APIPrefix+"/question/edit", testTokens[1], url.Values{"ID": {"10"}}, http.StatusNotFound)
+	testPostAuth(t, APIPrefix+"/question/edit", testTokens[1], edit, http.StatusSeeOther)
+
+	if err := GetBankQuestionByID(0, &bq); err != nil {
+		t.Fatalf("Failed to get question: %v", err)
+	}
+	if (bq.Version != 2) || (bq.Question.Name != "What is a goroutine in Go?") {
+		t.Errorf("Expected edited question to have version 2, got %+v", bq)
+	}
+
+	testPostAuth(t, APIPrefix+"/question/delete", testTokens[AdminID], url.Values{"ID": {"0"}}, http.StatusForbidden)
+	testPostAuth(t, APIPrefix+"/question/delete", testTokens[1], url.Values{"ID": {"0"}}, http.StatusSeeOther)
+	testPostAuth(t, APIPrefix+"/question/edit", testTokens[1], edit, http.StatusForbidden)
+	if ids := GetUserBankQuestionIDs(1); len(ids) != 3 {
+		t.Errorf("Expected deleted question to be unindexed, got %v", ids)
+	}
+}
+
+func TestLessonTestBankQuestions(t *testing.T) {
+	const endpoint = "/course/edit"
+
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	token := testTokens[1]
+	prefix := url.Values{"ID": {"1"}, "LessonIndex": {"0"}, "StepIndex": {"0"}, "CurrentPage": {"Test"}}
+	with := func(vs url.Values) url.Values {
+		for k, v := range prefix {
+			vs[k] = v
+		}
+		return vs
+	}
+
+	testPostAuth(t, endpoint, token, url.Values{"ID": {"1"}, "LessonIndex": {"0"}, "CurrentPage": {"Lesson"}, "NextPage": {Ls(GL, "Add test")}}, http.StatusOK)
+
+	/* Other teachers' questions cannot be added. */
+	testPostAuth(t, endpoint, token, with(url.Values{"Question": {""}, "BankQuestionID": {"3"}, "Command": {Ls(GL, "Add selected questions")}}), http.StatusForbidden)
+	testPostAuth(t, endpoint, token, with(url.Values{"Question": {""}, "BankQuestionID": {"10"}, "Command": {Ls(GL, "Add selected questions")}}), http.StatusNotFound)
+
+	/* Empty question is not linked, questions 0 and 2 are. Adding question 2 again does nothing. */
+	testPostAuth(t, endpoint, token, with(url.Values{"Question": {""}, "BankQuestionID": {"0", "2"}, "Command": {Ls(GL, "Add selected questions")}}), http.StatusOK)
+	testPostAuth(t, endpoint, token, with(url.Values{"Question": {"", "What is a goroutine?", "Which isolation level prevents phantom reads?"}, "Answer1": {"Lightweight thread", "Process"}, "CorrectAnswer1": {"0"}, "Answer2": {"Read committed", "Serializable"}, "CorrectAnswer2": {"1"}, "BankQuestionID": {"2"}, "Command": {Ls(GL, "Add selected questions")}}), http.StatusOK)
+
+	test := testGetLessonTest(t, 1, 0)
+	expected := []QuestionSource{{}, {ID: 0, Version: 1}, {ID: 2, Version: 1}}
+	if !reflect.DeepEqual(test.Sources, expected) {
+		t.Fatalf("Expected sources %v, got %v", expected, test.Sources)
+	}
+
+	/* Sources follow questions when they are moved and deleted. */
+	questions := url.Values{"Question": {"", "What is a goroutine?", "Which isolation level prevents phantom reads?"}, "Answer1": {"Lightweight thread", "Process"}, "CorrectAnswer1": {"0"}, "Answer2": {"Read committed", "Serializable"}, "CorrectAnswer2": {"1"}}
+	questions.Set("Command0", Ls(GL, "Delete"))
+	testPostAuth(t, endpoint, token, with(questions), http.StatusOK)
+	test = testGetLessonTest(t, 1, 0)
+	expected = []QuestionSource{{ID: 0, Version: 1}, {ID: 2, Version: 1}}
+	if !reflect.DeepEqual(test.Sources, expected) {
+		t.Fatalf("Expected sources %v, got %v", expected, test.Sources)
+	}
+
+	questions = url.Values{"Question": {"What is a goroutine?", "Which isolation level prevents phantom reads?"}, "Answer0": {"Lightweight thread", "Process"}, "CorrectAnswer0": {"0"}, "Answer1": {"Read committed", "Serializable"}, "CorrectAnswer1": {"1"}}
+	questions.Set("Command1", Ls(GL, "^|"))
+	testPostAuth(t, endpoint, token, with(questions), http.StatusOK)
+	test = testGetLessonTest(t, 1, 0)
+	if (test.Questions[0].Name != "Which isolation level prevents phantom reads?") || (test.Sources[0].ID != 2) {
+		t.Fatalf("Expected source to move with question, got %v", test.Sources)
+	}
+
+	/* Random draw only takes questions, which are not in test yet. */
+	questions = url.Values{"Question": {"Which isolation level prevents phantom reads?", "What is a goroutine?"}, "Answer0": {"Read committed", "Serializable"}, "CorrectAnswer0": {"1"}, "Answer1": {"Lightweight thread", "Process"}, "CorrectAnswer1": {"0"}}
+	draw := func(tag string, difficulty string, count string, status http.Status) {
+		t.Helper()
+
+		vs := with(url.Values{"BankTag": {tag}, "BankDifficulty": {difficulty}, "BankCount": {count}, "Command": {Ls(GL, "Add random questions")}})
+		for k, v := range questions {
+			vs[k] = v
+		}
+		testPostAuth(t, endpoint, token, vs, status)
+	}
+	draw("go", "0", "2", http.StatusBadRequest)
+	draw("go", "0", "0", http.StatusBadRequest)
+	draw("go", "a", "1", http.StatusBadRequest)
+	draw("go", "0", "a", http.StatusBadRequest)
+	draw("GO", "0", "1", http.StatusOK)
+
+	test = testGetLessonTest(t, 1, 0)
+	if (len(test.Questions) != 3) || (test.Sources[2] != QuestionSource{ID: 1, Version: 1}) || (test.Questions[2].Name != "What does defer do?") {
+		t.Fatalf("Expected question 1 to be drawn, got %v", test.Sources)
+	}
+
+	/* Edits in bank are propagated to course lessons only if requested. */
+	testPostAuth(t, APIPrefix+"/question/edit", token, url.Values{"ID": {"2"}, "Question": {"Which level prevents phantoms?"}, "Answer": {"Read committed", "Serializable"}, "CorrectAnswer": {"1"}, "Difficulty": {"3"}}, http.StatusSeeOther)
+	if test = testGetLessonTest(t, 1, 0); test.Questions[0].Name != "Which isolation level prevents phantom reads?" {
+		t.Errorf("Expected question not to be updated, got %q", test.Questions[0].Name)
+	}
+
+	/* Copy of a question in a course, which teacher can't edit, e.g. a fork. */
+	var other Lesson
+	if err := GetLessonByID(0, &other); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	otherTest, _ := Step2Test(&other.Steps[0])
+	otherTest.Sources = make([]QuestionSource, len(otherTest.Questions))
+	otherTest.Sources[0] = QuestionSource{ID: 2, Version: 1}
+	otherName := otherTest.Questions[0].Name
+	if err := SaveLesson(&other); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+	if ids := GetQuestionLessonIDs(2); (len(ids) != 2) || (ids[0] != 0) {
+		t.Errorf("Expected question to be indexed for lessons [0 1], got %v", ids)
+	}
+
+	testPostAuth(t, APIPrefix+"/question/edit", token, url.Values{"ID": {"2"}, "Question": {"Which level prevents phantoms?"}, "Answer": {"Read committed", "Serializable", "Snapshot"}, "CorrectAnswer": {"1"}, "Difficulty": {"3"}, "UpdateLessons": {"1"}}, http.StatusSeeOther)
+	if err := GetLessonByID(0, &other); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	if otherTest, _ = Step2Test(&other.Steps[0]); (otherTest.Questions[0].Name != otherName) || (otherTest.Sources[0].Version != 1) {
+		t.Errorf("Expected question in course of other user not to be updated, got %q", otherTest.Questions[0].Name)
+	}
+	test = testGetLessonTest(t, 1, 0)
+	if (test.Questions[0].Name != "Which level prevents phantoms?") || (len(test.Questions[0].Answers) != 3) || (test.Sources[0].Version != 3) {
+		t.Errorf("Expected question to be updated to version 3, got %+v %v", test.Questions[0], test.Sources[0])
+	}
+	if test.Questions[1].Name != "What is a goroutine?" {
+		t.Errorf("Expected other questions to stay the same, got %q", test.Questions[1].Name)
+	}
+
+	/* Unlinked questions are not updated. */
+	questions = url.Values{"Question": {"Which level prevents phantoms?", "What is a goroutine?", "What does defer do?"}, "Answer0": {"Read committed", "Serializable", "Snapshot"}, "CorrectAnswer0": {"1"}, "Answer1": {"Lightweight thread", "Process"}, "CorrectAnswer1": {"0"}, "Answer2": {"Delays call until function returns", "Starts goroutine"}, "CorrectAnswer2": {"0"}}
+	questions.Set("Command0", Ls(GL, "Unlink"))
+	testPostAuth(t, endpoint, token, with(questions), http.StatusOK)
+	testPostAuth(t, APIPrefix+"/question/edit", token, url.Values{"ID": {"2"}, "Question": {"Changed again"}, "Answer": {"Read committed", "Serializable"}, "CorrectAnswer": {"1"}, "Difficulty": {"3"}, "UpdateLessons": {"1"}}, http.StatusSeeOther)
+	if test = testGetLessonTest(t, 1, 0); (test.Questions[0].Name != "Which level prevents phantoms?") || (test.Sources[0] != QuestionSource{}) {
+		t.Errorf("Expected unlinked question not to be updated, got %q", test.Questions[0].Name)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* SubmittedStepRefreshable reports whether step from lesson can replace one embedded into submitted step without invalidating student's answers. */
+func SubmittedStepRefreshable(submittedStep *SubmittedStep, step *Step) bool {
+	defer trace.End(trace.Begin(""))
+
+	if StepType(submittedStep.Type) != step.Type {
+		return false
+	}
+
+	switch step.Type {
+	default:
+		panic("invalid step type")
+	case StepTypeTest:
+		submittedTest, _ := Submitted2Test(submittedStep)
+		test, _ := Step2Test(step)
+
+		if len(submittedTest.SubmittedQuestions) != len(test.Questions) {
+			return false
+		}
+		for i := 0; i < len(test.Questions); i++ {
+			selectedAnswers := submittedTest.SubmittedQuestions[i].SelectedAnswers
+			for j := 0; j < len(selectedAnswers); j++ {
+				if (selectedAnswers[j] < 0) || (selectedAnswers[j] >= len(test.Questions[i].Answers)) {
+					return false
+				}
+			}
+		}
+	case StepTypeProgramming:
+		/* NOTE(anton2920): solution is simply run against new checks. */
+	}
+	return true
+}
+
+/* SubmissionRejudge resets verification status of step 'si' of a submission (or of all its steps if 'si' is -1), so verifier checks it again. If 'refresh' is set, embedded steps are replaced with current ones from lesson when possible. Returns number of steps, which could not be refreshed. */
+func SubmissionRejudge(submission *Submission, lesson *Lesson, si int, refresh bool) int {
+	defer trace.End(trace.Begin(""))
+
+	if submission.Status == SubmissionCheckDone {
+		score, maximum := GetSubmissionScore(submission)
+		submission.PreviousScore = int32(score)
+		submission.PreviousMaximum = int32(maximum)
+	}
+	submission.RejudgedAt = time.Now().Unix()
+	submission.Status = SubmissionCheckPending
+
+	var stale int
+	for i := 0; i < len(submission.SubmittedSteps); i++ {
+		submittedStep := &submission.SubmittedSteps[i]
+		if ((si != -1) && (i != si)) || (submittedStep.Flags == SubmittedStepSkipped) {
+			continue
+		}
+
+		if refresh {
+			if (i < len(lesson.Steps)) && (SubmittedStepRefreshable(submittedStep, &lesson.Steps[i])) {
+				StepDeepCopy(&submittedStep.Step, &lesson.Steps[i])
+			} else {
+				stale++
+			}
+		}
+		submittedStep.Status = SubmissionCheckPending
+		submittedStep.Error = ""
+	}
+	return stale
+}
+
+func DisplaySubmissionRejudgeInfo(w *http.Response, l Language, submission *Submission) {
+	if submission.RejudgedAt == 0 {
+		return
+	}
+
+	w.WriteString(`<p>`)
+	w.WriteString(Ls(l, "Rejudged at"))
+	w.WriteString(`: `)
+	DisplayFormattedTime(w, submission.RejudgedAt)
+	w.WriteString(`</p>`)
+
+	w.WriteString(`<p>`)
+	w.WriteString(Ls(l, "Score before rejudge"))
+	w.WriteString(`: `)
+	w.WriteInt(int(submission.PreviousScore))
+	w.WriteString(`/`)
+	w.WriteInt(int(submission.PreviousMaximum))
+	w.WriteString(`</p>`)
+}
+
+func DisplaySubmissionRejudgeRefresh(w *http.Response, l Language) {
+	w.WriteString(`<div class="form-check mb-2">`)
+	w.WriteString(`<input class="form-check-input" type="checkbox" name="Refresh" value="1" id="Refresh">`)
+	w.WriteString(`<label class="form-check-label" for="Refresh">`)
+	w.WriteString(Ls(l, "Use current version of lesson steps"))
+	w.WriteString(`</label>`)
+	w.WriteString(`</div>`)
+}
+
+func DisplayLessonRejudgeForm(w *http.Response, l Language, lesson *Lesson) {
+	w.WriteString(`<form class="mb-2" method="POST" action="/api/lesson/rejudge">`)
+	DisplayHiddenID(w, "ID", lesson.ID)
+
+	w.WriteString(`<div class="d-flex gap-2 mb-2">`)
+	w.WriteString(`<select class="form-select" name="StepIndex">`)
+	w.WriteString(`<option value="">`)
+	w.WriteString(Ls(l, "All steps"))
+	w.WriteString(`</option>`)
+	for i := 0; i < len(lesson.Steps); i++ {
+		w.WriteString(`<option value="`)
+		w.WriteInt(i)
+		w.WriteString(`">`)
+		w.WriteString(Ls(l, "Step"))
+		w.WriteString(` #`)
+		w.WriteInt(i + 1)
+		w.WriteString(`: `)
+		w.WriteHTMLString(lesson.Steps[i].Name)
+		w.WriteString(`</option>`)
+	}
+	w.WriteString(`</select>`)
+	DisplayButton(w, l, "", "Rejudge")
+	w.WriteString(`</div>`)
+
+	DisplaySubmissionRejudgeRefresh(w, l)
+	w.WriteString(`</form>`)
+}
+
+/* LessonRejudgeHandler rejudges all verified submissions of a subject lesson. Submissions, which are still being verified, are left alone. */
+func LessonRejudgeHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var submission Submission
+	var subject Subject
+	var lesson Lesson
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	lessonID, err := r.Form.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if err := GetLessonByID(lessonID, &lesson); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "lesson with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if lesson.ContainerType != LessonContainerSubject {
+		return http.ClientError(nil)
+	}
+
+	if err := GetSubjectByID(lesson.ContainerID, &subject); err != nil {
+		return http.ServerError(err)
+	}
+	who, err := WhoIsUserInSubject(session.ID, &subject)
+	if err != nil {
+		return http.ServerError(err)
+	}
+	if (who != SubjectUserAdmin) && (who != SubjectUserTeacher) {
+		return ForbiddenError
+	}
+
+	si := -1
+	if s := r.Form.Get("StepIndex"); s != "" {
+		si, err = GetValidIndex(s, len(lesson.Steps))
+		if err != nil {
+			return http.ClientError(err)
+		}
+	}
+	refresh := r.Form.Get("Refresh") != ""
+
+	var tx Tx
+	var ids []database.ID
+	for i := 0; i < len(lesson.Submissions); i++ {
+		if err := GetSubmissionByID(lesson.Submissions[i], &submission); err != nil {
+			return http.ServerError(err)
+		}
+		if (submission.Flags != SubmissionActive) || (submission.Status != SubmissionCheckDone) || (si >= len(submission.SubmittedSteps)) {
+			continue
+		}
+
+		SubmissionRejudge(&submission, &lesson, si, refresh)
+		if err := SaveSubmissionTx(&tx, &submission); err != nil {
+			return http.ServerError(err)
+		}
+		ids = append(ids, submission.ID)
+	}
+	if err := CommitTx(&tx); err != nil {
+		return http.ServerError(err)
+	}
+	SubmissionVerifyEnqueue(ids...)
+
+	Audit(r, session.ID, "rejudge", "lesson", lesson.ID, "", fmt.Sprintf("step %d, refresh %t, %d submissions", si, refresh, len(ids)))
+
+	w.Redirect(w.PathID("/lesson/", lesson.ID), http.StatusSeeOther)
+	return nil
+}
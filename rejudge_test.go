@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/anton2920/gofa/net/http"
+)
+
+func testRejudgeTestStep(step *Step, correctAnswers ...int) {
+	step.Type = StepTypeTest
+	test, _ := Step2Test(step)
+	test.Name = "Test"
+	test.Questions = make([]Question, len(correctAnswers))
+	for i := 0; i < len(correctAnswers); i++ {
+		test.Questions[i].Name = "Question"
+		test.Questions[i].Answers = []string{"a", "b", "c"}
+		test.Questions[i].CorrectAnswers = []int{correctAnswers[i]}
+	}
+}
+
+func TestSubmissionRejudge(t *testing.T) {
+	var lesson Lesson
+	var submission Submission
+
+	lesson.Steps = make([]Step, 2)
+	testRejudgeTestStep(&lesson.Steps[0], 1, 2)
+	testRejudgeTestStep(&lesson.Steps[1], 0)
+
+	submission.Status = SubmissionCheckDone
+	submission.SubmittedSteps = make([]SubmittedStep, 2)
+	for i := 0; i < len(submission.SubmittedSteps); i++ {
+		submittedStep := &submission.SubmittedSteps[i]
+		submittedStep.Type = SubmittedTypeTest
+		submittedStep.Flags = SubmittedStepPassed
+		submittedStep.Status = SubmissionCheckDone
+	}
+
+	/* NOTE(anton2920): student answered according to wrong answer key. */
+	submittedTest, _ := Submitted2Test(&submission.SubmittedSteps[0])
+	testRejudgeTestStep(&submittedTest.Step, 0, 2)
+	submittedTest.SubmittedQuestions = []SubmittedQuestion{{SelectedAnswers: []int{0}}, {SelectedAnswers: []int{2}}}
+	SubmissionVerifyTest(submittedTest)
+
+	/* NOTE(anton2920): lesson step has fewer questions now, so it can't be refreshed. */
+	submittedTest, _ = Submitted2Test(&submission.SubmittedSteps[1])
+	testRejudgeTestStep(&submittedTest.Step, 0, 0)
+	submittedTest.SubmittedQuestions = []SubmittedQuestion{{SelectedAnswers: []int{0}}, {SelectedAnswers: []int{0}}}
+	SubmissionVerifyTest(submittedTest)
+
+	if stale := SubmissionRejudge(&submission, &lesson, -1, true); stale != 1 {
+		t.Errorf("Expected 1 step to be left stale, got %d", stale)
+	}
+	if (submission.PreviousScore != 4) || (submission.PreviousMaximum != 4) || (submission.RejudgedAt == 0) {
+		t.Errorf("Expected previous score 4/4, got %d/%d", submission.PreviousScore, submission.PreviousMaximum)
+	}
+	if submission.Status != SubmissionCheckPending {
+		t.Errorf("Expected submission to be pending, got %d", submission.Status)
+	}
+	for i := 0; i < len(submission.SubmittedSteps); i++ {
+		if submission.SubmittedSteps[i].Status != SubmissionCheckPending {
+			t.Errorf("Expected step %d to be pending, got %d", i, submission.SubmittedSteps[i].Status)
+		}
+	}
+
+	submission.Status = SubmissionCheckInProgress
+	SubmissionVerify(&submission)
+	submission.Status = SubmissionCheckDone
+
+	if score, maximum := GetSubmissionScore(&submission); (score != 3) || (maximum != 4) {
+		t.Errorf("Expected score 3/4 after rejudge, got %d/%d", score, maximum)
+	}
+
+	submission.SubmittedSteps[1].Status = SubmissionCheckDone
+	submission.SubmittedSteps[1].Flags = SubmittedStepSkipped
+	SubmissionRejudge(&submission, &lesson, 0, false)
+	if (submission.PreviousScore != 3) || (submission.PreviousMaximum != 4) {
+		t.Errorf("Expected previous score 3/4, got %d/%d", submission.PreviousScore, submission.PreviousMaximum)
+	}
+	if (submission.SubmittedSteps[0].Status != SubmissionCheckPending) || (submission.SubmittedSteps[1].Status != SubmissionCheckDone) {
+		t.Errorf("Expected only first step to be pending")
+	}
+}
+
+func TestSubmittedStepRefreshable(t *testing.T) {
+	var step, other Step
+	var submittedStep SubmittedStep
+
+	testRejudgeTestStep(&step, 0, 1)
+	submittedStep.Type = SubmittedTypeTest
+	submittedTest, _ := Submitted2Test(&submittedStep)
+	submittedTest.SubmittedQuestions = []SubmittedQuestion{{SelectedAnswers: []int{2}}, {SelectedAnswers: []int{0, 1}}}
+
+	if !SubmittedStepRefreshable(&submittedStep, &step) {
+		t.Errorf("Expected step to be refreshable")
+	}
+
+	test, _ := Step2Test(&step)
+	test.Questions[0].Answers = test.Questions[0].Answers[:2]
+	if SubmittedStepRefreshable(&submittedStep, &step) {
+		t.Errorf("Expected step with removed selected answer not to be refreshable")
+	}
+
+	other.Type = StepTypeProgramming
+	if SubmittedStepRefreshable(&submittedStep, &other) {
+		t.Errorf("Expected step of different type not to be refreshable")
+	}
+}
+
+func TestLessonRejudgeHandler(t *testing.T) {
+	const endpoint = APIPrefix + "/lesson/rejudge"
+
+	testCreateInitialDBs()
+
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"ID": {"2"}}, http.StatusSeeOther)
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"ID": {"2"}, "StepIndex": {"0"}, "Refresh": {"1"}}, http.StatusSeeOther)
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"ID": {"2"}, "StepIndex": {"a"}}, http.StatusBadRequest)
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"ID": {"2"}, "StepIndex": {"100"}}, http.StatusBadRequest)
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"0"}}, http.StatusBadRequest)
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"a"}}, http.StatusBadRequest)
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"100"}}, http.StatusNotFound)
+	testPostAuth(t, endpoint, testTokens[2], url.Values{"ID": {"2"}}, http.StatusForbidden)
+	testPostInvalidFormAuth(t, endpoint, testTokens[AdminID])
+
+	testPost(t, endpoint, url.Values{"ID": {"2"}}, http.StatusUnauthorized)
+}
+
+func TestSubmissionResultsRecheck(t *testing.T) {
+	const endpoint = "/submission/results"
+
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	var submission Submission
+	if err := GetSubmissionByID(0, &submission); err != nil {
+		t.Fatalf("Failed to get submission: %v", err)
+	}
+	submission.Status = SubmissionCheckInProgress
+	if err := SaveSubmission(&submission); err != nil {
+		t.Fatalf("Failed to save submission: %v", err)
+	}
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"ID": {"0"}, "Command0": {Ls(GL, "Re-check")}}, http.StatusBadRequest)
+
+	submission.Status = SubmissionCheckDone
+	if err := SaveSubmission(&submission); err != nil {
+		t.Fatalf("Failed to save submission: %v", err)
+	}
+	testPostAuth(t, endpoint, testTokens[2], url.Values{"ID": {"0"}, "Command0": {Ls(GL, "Re-check")}}, http.StatusForbidden)
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"ID": {"0"}, "Command0": {Ls(GL, "Re-check")}}, http.StatusSeeOther)
+}
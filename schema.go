@@ -0,0 +1,723 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unsafe"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/log"
+	"github.com/anton2920/gofa/syscall"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* Migration upgrades records of a single DB from one schema version to the next one. */
+type Migration struct {
+	OldSize int
+	NewSize int
+
+	/* Convert fills new record 'dst' from old record 'src'. 'dst' is zeroed. If it's nil, layout of this DB did not change and only version is updated. */
+	Convert func(dst unsafe.Pointer, src unsafe.Pointer)
+}
+
+type SchemaDB struct {
+	Name string
+
+	/* Migrations[i] upgrades DB from version i to version i+1. */
+	Migrations []Migration
+}
+
+type SchemaVersions [len(TxDBs)]int32
+
+/*
+ * SchemaFile stores versions of all DBs in one place. Header of DB files is owned by 'database' and records start right after it,
+ * so version can't be put there without shifting every record. DBs are only valid together with blobs and each other, so
+ * they are backed up and restored as a whole directory, which always includes this file (see 'BackupFiles'). DB file, which does not match its version
+ * here, is detected by 'CheckDBFile'.
+ */
+const SchemaFile = "Schema.db"
+
+/* SchemaVersion is a version of record layouts used by this build. Every time any record layout changes, it must be incremented and migration must be added for every DB. */
+const SchemaVersion = 5
+
+/* SchemaDBs must be in the same order as 'TxDBs'. */
+var SchemaDBs = [len(TxDBs)]SchemaDB{
+	{"Users.db", []Migration{
+		{int(unsafe.Sizeof(UserV0{})), int(unsafe.Sizeof(User{})), MigrateUserV0},
+		{int(unsafe.Sizeof(User{})), int(unsafe.Sizeof(User{})), nil},
+		{int(unsafe.Sizeof(User{})), int(unsafe.Sizeof(User{})), nil},
+		{int(unsafe.Sizeof(User{})), int(unsafe.Sizeof(User{})), nil},
+		{int(unsafe.Sizeof(User{})), int(unsafe.Sizeof(User{})), nil},
+	}},
+	{"Groups.db", []Migration{
+		{int(unsafe.Sizeof(GroupV0{})), int(unsafe.Sizeof(Group{})), MigrateGroupV0},
+		{int(unsafe.Sizeof(Group{})), int(unsafe.Sizeof(Group{})), nil},
+		{int(unsafe.Sizeof(Group{})), int(unsafe.Sizeof(Group{})), nil},
+		{int(unsafe.Sizeof(Group{})), int(unsafe.Sizeof(Group{})), nil},
+		{int(unsafe.Sizeof(Group{})), int(unsafe.Sizeof(Group{})), nil},
+	}},
+	{"Courses.db", []Migration{
+		{int(unsafe.Sizeof(CourseV0{})), int(unsafe.Sizeof(CourseV1{})), MigrateCourseV0},
+		{int(unsafe.Sizeof(CourseV1{})), int(unsafe.Sizeof(CourseV1{})), nil},
+		{int(unsafe.Sizeof(CourseV1{})), int(unsafe.Sizeof(Course{})), MigrateCourseV2},
+		{int(unsafe.Sizeof(Course{})), int(unsafe.Sizeof(Course{})), nil},
+		{int(unsafe.Sizeof(Course{})), int(unsafe.Sizeof(Course{})), nil},
+	}},
+	{"Lessons.db", []Migration{
+		{int(unsafe.Sizeof(LessonV0{})), int(unsafe.Sizeof(LessonV1{})), MigrateLessonV0},
+		{int(unsafe.Sizeof(LessonV1{})), int(unsafe.Sizeof(Lesson{})), MigrateLessonV1},
+		{int(unsafe.Sizeof(Lesson{})), int(unsafe.Sizeof(Lesson{})), nil},
+		{int(unsafe.Sizeof(Lesson{})), int(unsafe.Sizeof(Lesson{})), nil},
+		{int(unsafe.Sizeof(Lesson{})), int(unsafe.Sizeof(Lesson{})), nil},
+	}},
+	{"Subjects.db", []Migration{
+		{int(unsafe.Sizeof(SubjectV0{})), int(unsafe.Sizeof(Subject{})), MigrateSubjectV0},
+		{int(unsafe.Sizeof(Subject{})), int(unsafe.Sizeof(Subject{})), nil},
+		{int(unsafe.Sizeof(Subject{})), int(unsafe.Sizeof(Subject{})), nil},
+		{int(unsafe.Sizeof(Subject{})), int(unsafe.Sizeof(Subject{})), nil},
+		{int(unsafe.Sizeof(Subject{})), int(unsafe.Sizeof(Subject{})), nil},
+	}},
+	{"Submissions.db", []Migration{
+		{int(unsafe.Sizeof(SubmissionV0{})), int(unsafe.Sizeof(SubmissionV4{})), MigrateSubmissionV0},
+		{int(unsafe.Sizeof(SubmissionV4{})), int(unsafe.Sizeof(SubmissionV4{})), nil},
+		{int(unsafe.Sizeof(SubmissionV4{})), int(unsafe.Sizeof(SubmissionV4{})), nil},
+		{int(unsafe.Sizeof(SubmissionV4{})), int(unsafe.Sizeof(SubmissionV4{})), nil},
+		{int(unsafe.Sizeof(SubmissionV4{})), int(unsafe.Sizeof(Submission{})), MigrateSubmissionV4},
+	}},
+	{"Questions.db", []Migration{
+		{int(unsafe.Sizeof(BankQuestion{})), int(unsafe.Sizeof(BankQuestion{})), nil},
+		{int(unsafe.Sizeof(BankQuestion{})), int(unsafe.Sizeof(BankQuestion{})), nil},
+		{int(unsafe.Sizeof(BankQuestion{})), int(unsafe.Sizeof(BankQuestion{})), nil},
+		{int(unsafe.Sizeof(BankQuestion{})), int(unsafe.Sizeof(BankQuestion{})), nil},
+		{int(unsafe.Sizeof(BankQuestion{})), int(unsafe.Sizeof(BankQuestion{})), nil},
+	}},
+	{"Announcements.db", []Migration{
+		{int(unsafe.Sizeof(Announcement{})), int(unsafe.Sizeof(Announcement{})), nil},
+		{int(unsafe.Sizeof(Announcement{})), int(unsafe.Sizeof(Announcement{})), nil},
+		{int(unsafe.Sizeof(Announcement{})), int(unsafe.Sizeof(Announcement{})), nil},
+		{int(unsafe.Sizeof(Announcement{})), int(unsafe.Sizeof(Announcement{})), nil},
+		{int(unsafe.Sizeof(Announcement{})), int(unsafe.Sizeof(Announcement{})), nil},
+	}},
+	{"Notifications.db", []Migration{
+		{int(unsafe.Sizeof(Notification{})), int(unsafe.Sizeof(Notification{})), nil},
+		{int(unsafe.Sizeof(Notification{})), int(unsafe.Sizeof(Notification{})), nil},
+		{int(unsafe.Sizeof(Notification{})), int(unsafe.Sizeof(Notification{})), nil},
+		{int(unsafe.Sizeof(Notification{})), int(unsafe.Sizeof(Notification{})), nil},
+		{int(unsafe.Sizeof(Notification{})), int(unsafe.Sizeof(Notification{})), nil},
+	}},
+	{"Messages.db", []Migration{
+		{int(unsafe.Sizeof(Message{})), int(unsafe.Sizeof(Message{})), nil},
+		{int(unsafe.Sizeof(Message{})), int(unsafe.Sizeof(Message{})), nil},
+		{int(unsafe.Sizeof(Message{})), int(unsafe.Sizeof(Message{})), nil},
+		{int(unsafe.Sizeof(Message{})), int(unsafe.Sizeof(Message{})), nil},
+		{int(unsafe.Sizeof(Message{})), int(unsafe.Sizeof(Message{})), nil},
+	}},
+	{"TaskFiles.db", []Migration{
+		{int(unsafe.Sizeof(TaskFilesV3{})), int(unsafe.Sizeof(TaskFilesV3{})), nil},
+		{int(unsafe.Sizeof(TaskFilesV3{})), int(unsafe.Sizeof(TaskFilesV3{})), nil},
+		{int(unsafe.Sizeof(TaskFilesV3{})), int(unsafe.Sizeof(TaskFilesV3{})), nil},
+		{int(unsafe.Sizeof(TaskFilesV3{})), int(unsafe.Sizeof(TaskFiles{})), MigrateTaskFilesV3},
+		{int(unsafe.Sizeof(TaskFiles{})), int(unsafe.Sizeof(TaskFiles{})), nil},
+	}},
+}
+
+/* Record layouts of schema version 0, before 'Blob' was added. */
+type (
+	UserV0 struct {
+		ID    database.ID
+		Flags int32
+
+		FirstName string
+		LastName  string
+		Email     string
+		Password  string
+		Courses   []database.ID
+		CreatedOn int64
+
+		Data [1024]byte
+	}
+
+	GroupV0 struct {
+		ID    database.ID
+		Flags int32
+
+		Name      string
+		Students  []database.ID
+		CreatedOn int64
+
+		Data [1024]byte
+	}
+
+	CourseV0 struct {
+		LessonContainer
+
+		Data [1024]byte
+	}
+
+	LessonV0 struct {
+		ID            database.ID
+		Flags         int32
+		ContainerID   database.ID
+		ContainerType LessonContainerType
+
+		Name        string
+		Theory      string
+		Steps       []Step
+		Submissions []database.ID
+
+		Data [16384]byte
+	}
+
+	SubjectV0 struct {
+		LessonContainer
+
+		TeacherID database.ID
+		GroupID   database.ID
+		CreatedOn int64
+
+		Data [1024]byte
+	}
+
+	SubmissionV0 struct {
+		ID       database.ID
+		Flags    int32
+		UserID   database.ID
+		LessonID database.ID
+
+		Status SubmissionCheckStatus
+
+		StartedAt      int64
+		FinishedAt     int64
+		SubmittedSteps []SubmittedStep
+
+		Data [16384]byte
+	}
+)
+
+/* Record layouts of schema version 1. */
+type (
+	/* LessonV1 is a layout before course versioning was added. */
+	LessonV1 struct {
+		ID            database.ID
+		Flags         int32
+		ContainerID   database.ID
+		ContainerType LessonContainerType
+
+		Name        string
+		Theory      string
+		Steps       []Step
+		Submissions []database.ID
+
+		Blob Blob
+		Data [16384]byte
+	}
+
+	/* CourseV1 is a layout before sharing was added, it didn't change in schema version 2. */
+	CourseV1 struct {
+		LessonContainer
+
+		Blob Blob
+		Data [1024]byte
+	}
+)
+
+/* Record layouts of schema version 3. */
+type (
+	/* TaskFilesV3 is a layout before interactors were added. */
+	TaskFilesV3 struct {
+		ID    database.ID
+		Flags int32
+
+		StarterCode string
+		Files       []TaskFile
+		HarnessFile string
+		Harness     string
+
+		Blob Blob
+		Data [4096]byte
+	}
+)
+
+/* Record layouts of schema version 4. */
+type (
+	/* SubmissionV4 is a layout before rejudging was added, it didn't change since schema version 1. */
+	SubmissionV4 struct {
+		ID       database.ID
+		Flags    int32
+		UserID   database.ID
+		LessonID database.ID
+
+		Status SubmissionCheckStatus
+
+		StartedAt      int64
+		FinishedAt     int64
+		SubmittedSteps []SubmittedStep
+
+		Blob Blob
+		Data [16384]byte
+	}
+)
+
+/* NOTE(anton2920): strings and slices are still offsets into 'Data' here, so they are copied as is. */
+
+func MigrateUserV0(dst unsafe.Pointer, src unsafe.Pointer) {
+	user := (*User)(dst)
+	old := (*UserV0)(src)
+
+	user.ID = old.ID
+	user.Flags = old.Flags
+	user.FirstName = old.FirstName
+	user.LastName = old.LastName
+	user.Email = old.Email
+	user.Password = old.Password
+	user.Courses = old.Courses
+	user.CreatedOn = old.CreatedOn
+	user.Data = old.Data
+}
+
+func MigrateGroupV0(dst unsafe.Pointer, src unsafe.Pointer) {
+	group := (*Group)(dst)
+	old := (*GroupV0)(src)
+
+	group.ID = old.ID
+	group.Flags = old.Flags
+	group.Name = old.Name
+	group.Students = old.Students
+	group.CreatedOn = old.CreatedOn
+	group.Data = old.Data
+}
+
+func MigrateCourseV0(dst unsafe.Pointer, src unsafe.Pointer) {
+	course := (*CourseV1)(dst)
+	old := (*CourseV0)(src)
+
+	course.LessonContainer = old.LessonContainer
+	course.Data = old.Data
+}
+
+func MigrateCourseV2(dst unsafe.Pointer, src unsafe.Pointer) {
+	course := (*Course)(dst)
+	old := (*CourseV1)(src)
+
+	course.LessonContainer = old.LessonContainer
+	course.Blob = old.Blob
+	course.Data = old.Data
+}
+
+func MigrateLessonV0(dst unsafe.Pointer, src unsafe.Pointer) {
+	lesson := (*LessonV1)(dst)
+	old := (*LessonV0)(src)
+
+	lesson.ID = old.ID
+	lesson.Flags = old.Flags
+	lesson.ContainerID = old.ContainerID
+	lesson.ContainerType = old.ContainerType
+	lesson.Name = old.Name
+	lesson.Theory = old.Theory
+	lesson.Steps = old.Steps
+	lesson.Submissions = old.Submissions
+	lesson.Data = old.Data
+}
+
+/* MigrateLessonV1 treats existing course lessons as published once. Existing copies in subjects stay unlinked, because their source is unknown. */
+func MigrateLessonV1(dst unsafe.Pointer, src unsafe.Pointer) {
+	lesson := (*Lesson)(dst)
+	old := (*LessonV1)(src)
+
+	lesson.ID = old.ID
+	lesson.Flags = old.Flags
+	lesson.ContainerID = old.ContainerID
+	lesson.ContainerType = old.ContainerType
+	if lesson.ContainerType == LessonContainerCourse {
+		lesson.Version = 1
+	}
+	lesson.Name = old.Name
+	lesson.Theory = old.Theory
+	lesson.Steps = old.Steps
+	lesson.Submissions = old.Submissions
+	lesson.Blob = old.Blob
+	lesson.Data = old.Data
+}
+
+func MigrateSubjectV0(dst unsafe.Pointer, src unsafe.Pointer) {
+	subject := (*Subject)(dst)
+	old := (*SubjectV0)(src)
+
+	subject.LessonContainer = old.LessonContainer
+	subject.TeacherID = old.TeacherID
+	subject.GroupID = old.GroupID
+	subject.CreatedOn = old.CreatedOn
+	subject.Data = old.Data
+}
+
+func MigrateSubmissionV0(dst unsafe.Pointer, src unsafe.Pointer) {
+	submission := (*SubmissionV4)(dst)
+	old := (*SubmissionV0)(src)
+
+	submission.ID = old.ID
+	submission.Flags = old.Flags
+	submission.UserID = old.UserID
+	submission.LessonID = old.LessonID
+	submission.Status = old.Status
+	submission.StartedAt = old.StartedAt
+	submission.FinishedAt = old.FinishedAt
+	submission.SubmittedSteps = old.SubmittedSteps
+	submission.Data = old.Data
+}
+
+func MigrateSubmissionV4(dst unsafe.Pointer, src unsafe.Pointer) {
+	submission := (*Submission)(dst)
+	old := (*SubmissionV4)(src)
+
+	submission.ID = old.ID
+	submission.Flags = old.Flags
+	submission.UserID = old.UserID
+	submission.LessonID = old.LessonID
+	submission.Status = old.Status
+	submission.StartedAt = old.StartedAt
+	submission.FinishedAt = old.FinishedAt
+	submission.SubmittedSteps = old.SubmittedSteps
+	submission.Blob = old.Blob
+	submission.Data = old.Data
+}
+
+func MigrateTaskFilesV3(dst unsafe.Pointer, src unsafe.Pointer) {
+	files := (*TaskFiles)(dst)
+	old := (*TaskFilesV3)(src)
+
+	files.ID = old.ID
+	files.Flags = old.Flags
+	files.StarterCode = old.StarterCode
+	files.Files = old.Files
+	files.HarnessFile = old.HarnessFile
+	files.Harness = old.Harness
+	files.Blob = old.Blob
+	files.Data = old.Data
+}
+
+func GetPath(dir string, name string) string {
+	buf := make([]byte, syscall.PATH_MAX)
+	n := PutPath(buf, dir, name)
+	return unsafe.String(unsafe.SliceData(buf), n)
+}
+
+func GetMigrationPath(dir string, name string, version int32) string {
+	return fmt.Sprintf("%s.v%d", GetPath(dir, name), version)
+}
+
+/* ReadSchemaVersions returns versions of all DBs stored in 'dir'. If there's no schema file, DBs were created before versioning was introduced. DBs missing from schema file were added later, so they are created with current layout. */
+func ReadSchemaVersions(dir string, versions *SchemaVersions) (bool, error) {
+	defer trace.End(trace.Begin(""))
+
+	buf, err := os.ReadFile(GetPath(dir, SchemaFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			*versions = SchemaVersions{}
+			return false, nil
+		}
+		return false, err
+	}
+	if (len(buf)%4 != 0) || (len(buf) > len(versions)*4) {
+		return false, fmt.Errorf("invalid schema file size %d", len(buf))
+	}
+
+	for i := 0; i < len(versions); i++ {
+		if i*4 < len(buf) {
+			versions[i] = int32(binary.LittleEndian.Uint32(buf[i*4:]))
+		} else {
+			versions[i] = SchemaVersion
+		}
+	}
+	return true, nil
+}
+
+func WriteSchemaVersions(dir string, versions *SchemaVersions) error {
+	defer trace.End(trace.Begin(""))
+
+	buf := make([]byte, 0, len(versions)*4)
+	for i := 0; i < len(versions); i++ {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(versions[i]))
+	}
+
+	return WriteFileAtomic(GetPath(dir, SchemaFile), buf)
+}
+
+/* WriteFileAtomic replaces contents of a file, so that after a crash it contains either old or new data. */
+func WriteFileAtomic(filename string, data []byte) error {
+	defer trace.End(trace.Begin(""))
+
+	tmp := filename + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filename)
+}
+
+/* MigrateDB writes records of DB converted by 'm' into a separate file. It's moved in place only after new version is recorded in schema file. */
+func MigrateDB(dir string, name string, m *Migration, version int32) error {
+	defer trace.End(trace.Begin(""))
+
+	src, err := os.Open(GetPath(dir, name))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(GetMigrationPath(dir, name, version))
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	/* NOTE(anton2920): header is owned by 'database' and does not depend on record layout. */
+	header := make([]byte, database.DataOffset)
+	if _, err := io.ReadFull(src, header); err != nil {
+		if err == io.EOF {
+			/* Empty DB, nothing to convert. */
+			return dst.Sync()
+		}
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	if _, err := dst.Write(header); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	/* NOTE(anton2920): 'uint64' buffers guarantee proper alignment for record structs. */
+	oldRecord := make([]uint64, (m.OldSize+7)/8)
+	oldBuf := unsafe.Slice((*byte)(unsafe.Pointer(&oldRecord[0])), m.OldSize)
+	newRecord := make([]uint64, (m.NewSize+7)/8)
+	newBuf := unsafe.Slice((*byte)(unsafe.Pointer(&newRecord[0])), m.NewSize)
+
+	for {
+		if _, err := io.ReadFull(src, oldBuf); err != nil {
+			if (err == io.EOF) || (err == io.ErrUnexpectedEOF) {
+				break
+			}
+			return fmt.Errorf("failed to read record: %w", err)
+		}
+
+		clear(newRecord)
+		m.Convert(unsafe.Pointer(&newRecord[0]), unsafe.Pointer(&oldRecord[0]))
+
+		if _, err := dst.Write(newBuf); err != nil {
+			return fmt.Errorf("failed to write record: %w", err)
+		}
+	}
+
+	return dst.Sync()
+}
+
+/* FinishMigrations moves in place or removes results of migrations interrupted by a crash. */
+func FinishMigrations(dir string, versions *SchemaVersions) error {
+	defer trace.End(trace.Begin(""))
+
+	for i := 0; i < len(SchemaDBs); i++ {
+		sdb := &SchemaDBs[i]
+
+		for v := int32(1); v <= SchemaVersion; v++ {
+			path := GetMigrationPath(dir, sdb.Name, v)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+
+			if versions[i] >= v {
+				if err := os.Rename(path, GetPath(dir, sdb.Name)); err != nil {
+					return err
+				}
+			} else {
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+/* CheckDBFile verifies that DB file has records of 'size' bytes. Versions are not stored in DB files, so DB file restored or copied without schema file would be read with a wrong layout otherwise. Every record starts with its ID, so the last record must have ID of its slot. */
+func CheckDBFile(dir string, name string, size int, version int32) error {
+	defer trace.End(trace.Begin(""))
+
+	f, err := os.Open(GetPath(dir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	n := fi.Size() - database.GetOffsetForID(0, size)
+	if n <= 0 {
+		return nil
+	}
+	if n%int64(size) != 0 {
+		return fmt.Errorf("%s does not match schema version %d: size of records %d is not a multiple of record size %d", name, version, n, size)
+	}
+
+	var id database.ID
+	last := database.ID(n/int64(size) - 1)
+	if _, err := f.ReadAt(unsafe.Slice((*byte)(unsafe.Pointer(&id)), unsafe.Sizeof(id)), database.GetOffsetForID(last, size)); err != nil {
+		return fmt.Errorf("failed to read last record of %s: %w", name, err)
+	}
+	if id != last {
+		return fmt.Errorf("%s does not match schema version %d: last record %d has ID %d", name, version, last, id)
+	}
+
+	return nil
+}
+
+/* RecordSize returns size of records of DB with schema version 'version'. */
+func (sdb *SchemaDB) RecordSize(version int32) int {
+	if version < SchemaVersion {
+		return sdb.Migrations[version].OldSize
+	}
+	return sdb.Migrations[SchemaVersion-1].NewSize
+}
+
+/* MigrateDBs upgrades all DBs in 'dir' to current schema version. Must be called before DBs are opened. */
+func MigrateDBs(dir string, created bool) error {
+	defer trace.End(trace.Begin(""))
+
+	var versions SchemaVersions
+	var migrated bool
+
+	/* NOTE(anton2920): WAL records are written at offsets of old layouts, so they would corrupt migrated DBs. See 'ReplayWALFile'. */
+	if fi, err := os.Stat(GetPath(dir, WALName)); (err == nil) && (fi.Size() > 0) {
+		return fmt.Errorf("WAL is not empty, unfinished transaction must be replayed before migration")
+	}
+
+	exists, err := ReadSchemaVersions(dir, &versions)
+	if err != nil {
+		return fmt.Errorf("failed to read schema versions: %w", err)
+	}
+	if !exists {
+		if created {
+			for i := 0; i < len(versions); i++ {
+				versions[i] = SchemaVersion
+			}
+		}
+		if err := WriteSchemaVersions(dir, &versions); err != nil {
+			return fmt.Errorf("failed to write schema versions: %w", err)
+		}
+	}
+
+	if err := FinishMigrations(dir, &versions); err != nil {
+		return fmt.Errorf("failed to finish interrupted migrations: %w", err)
+	}
+
+	for i := 0; i < len(SchemaDBs); i++ {
+		sdb := &SchemaDBs[i]
+
+		if versions[i] > SchemaVersion {
+			return fmt.Errorf("%s has schema version %d, which is newer than supported version %d", sdb.Name, versions[i], SchemaVersion)
+		}
+		if err := CheckDBFile(dir, sdb.Name, sdb.RecordSize(versions[i]), versions[i]); err != nil {
+			return err
+		}
+
+		for versions[i] < SchemaVersion {
+			next := versions[i] + 1
+			log.Infof("Migrating %s from schema version %d to %d...", sdb.Name, versions[i], next)
+
+			m := &sdb.Migrations[versions[i]]
+			if _, err := os.Stat(GetPath(dir, sdb.Name)); (err == nil) && (m.Convert != nil) {
+				if err := MigrateDB(dir, sdb.Name, m, next); err != nil {
+					return fmt.Errorf("failed to migrate %s: %w", sdb.Name, err)
+				}
+			}
+
+			migrated = true
+
+			versions[i] = next
+			if err := WriteSchemaVersions(dir, &versions); err != nil {
+				return fmt.Errorf("failed to write schema versions: %w", err)
+			}
+			if err := FinishMigrations(dir, &versions); err != nil {
+				return fmt.Errorf("failed to finish migration: %w", err)
+			}
+		}
+	}
+
+	/* NOTE(anton2920): indexes may depend on new fields, so they must be rebuilt. */
+	if migrated {
+		if err := os.Remove(GetPath(dir, IndexesFile)); (err != nil) && (!errors.Is(err, os.ErrNotExist)) {
+			return fmt.Errorf("failed to remove stale indexes: %w", err)
+		}
+	}
+
+	return nil
+}
+
+/* CheckDBs verifies without changing anything that DBs in 'dir' can be opened by this version of server. It's used by new process, while previous one still has DBs open. */
+func CheckDBs(dir string) error {
+	defer trace.End(trace.Begin(""))
+
+	var versions SchemaVersions
+
+	if _, err := os.Stat(dir); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if _, err := ReadSchemaVersions(dir, &versions); err != nil {
+		return fmt.Errorf("failed to read schema versions: %w", err)
+	}
+
+	for i := 0; i < len(SchemaDBs); i++ {
+		sdb := &SchemaDBs[i]
+
+		if versions[i] > SchemaVersion {
+			return fmt.Errorf("%s has schema version %d, which is newer than supported version %d", sdb.Name, versions[i], SchemaVersion)
+		}
+		if err := CheckDBFile(dir, sdb.Name, sdb.RecordSize(versions[i]), versions[i]); err != nil {
+			return err
+		}
+	}
+
+	names := [...]string{SchemaFile, WALName, BlobsName}
+	for i := 0; i < len(SchemaDBs)+len(names); i++ {
+		var name string
+		if i < len(SchemaDBs) {
+			name = SchemaDBs[i].Name
+		} else {
+			name = names[i-len(SchemaDBs)]
+		}
+
+		f, err := os.OpenFile(GetPath(dir, name), os.O_RDWR, 0)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		f.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+	"unsafe"
+
+	"github.com/anton2920/gofa/database"
+)
+
+func testWriteV0Users(t *testing.T, dir string, users []UserV0) {
+	t.Helper()
+
+	buf := make([]byte, database.DataOffset)
+	for i := 0; i < len(users); i++ {
+		buf = append(buf, unsafe.Slice((*byte)(unsafe.Pointer(&users[i])), unsafe.Sizeof(users[i]))...)
+	}
+	if err := os.WriteFile(GetPath(dir, "Users.db"), buf, 0644); err != nil {
+		t.Fatalf("Failed to write users DB: %v", err)
+	}
+}
+
+func testExpectSchemaVersions(t *testing.T, dir string, expected int32) {
+	t.Helper()
+
+	var versions SchemaVersions
+	exists, err := ReadSchemaVersions(dir, &versions)
+	if (err != nil) || (!exists) {
+		t.Fatalf("Failed to read schema versions: %v", err)
+	}
+	for i := 0; i < len(versions); i++ {
+		if versions[i] != expected {
+			t.Errorf("Expected %s to have version %d, got %d", SchemaDBs[i].Name, expected, versions[i])
+		}
+	}
+}
+
+func TestMigrateDBs(t *testing.T) {
+	dir := t.TempDir()
+
+	users := make([]UserV0, 2)
+	for i := 0; i < len(users); i++ {
+		users[i].ID = database.ID(i)
+		users[i].Flags = UserActive
+		users[i].CreatedOn = int64(i + 100)
+		users[i].Data[0] = byte(i + 1)
+	}
+	testWriteV0Users(t, dir, users)
+
+	if err := MigrateDBs(dir, false); err != nil {
+		t.Fatalf("Failed to migrate DBs: %v", err)
+	}
+	testExpectSchemaVersions(t, dir, SchemaVersion)
+
+	buf, err := os.ReadFile(GetPath(dir, "Users.db"))
+	if err != nil {
+		t.Fatalf("Failed to read users DB: %v", err)
+	}
+	if len(buf) != int(database.DataOffset)+len(users)*int(unsafe.Sizeof(User{})) {
+		t.Fatalf("Unexpected size of migrated users DB: %d", len(buf))
+	}
+
+	migrated := make([]User, len(users))
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&migrated[0])), len(buf)-int(database.DataOffset)), buf[database.DataOffset:])
+	for i := 0; i < len(users); i++ {
+		user := &migrated[i]
+		if (user.ID != users[i].ID) || (user.CreatedOn != users[i].CreatedOn) || (user.Data[0] != users[i].Data[0]) || (user.Blob != Blob{}) {
+			t.Errorf("User %d was not migrated correctly", i)
+		}
+	}
+
+	/* Running migrations again must not change anything. */
+	if err := MigrateDBs(dir, false); err != nil {
+		t.Fatalf("Failed to migrate DBs: %v", err)
+	}
+	buf2, err := os.ReadFile(GetPath(dir, "Users.db"))
+	if (err != nil) || (string(buf) != string(buf2)) {
+		t.Errorf("Expected second migration to be a no-op")
+	}
+}
+
+func TestMigrateDBsCreated(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := MigrateDBs(dir, true); err != nil {
+		t.Fatalf("Failed to migrate DBs: %v", err)
+	}
+	testExpectSchemaVersions(t, dir, SchemaVersion)
+}
+
+func TestMigrateDBsMismatchedFile(t *testing.T) {
+	dir := t.TempDir()
+
+	users := make([]UserV0, 3)
+	for i := 0; i < len(users); i++ {
+		users[i].ID = database.ID(i)
+	}
+	testWriteV0Users(t, dir, users)
+
+	/* Users.db of schema version 0 is restored on its own next to schema file of current version. */
+	if err := MigrateDBs(dir, true); err == nil {
+		t.Errorf("Expected users DB in old layout not to match schema file")
+	}
+}
+
+func TestReadSchemaVersionsAddedDB(t *testing.T) {
+	dir := t.TempDir()
+
+	/* Schema file written before the last DB was added. */
+	buf := make([]byte, 0, (len(SchemaDBs)-1)*4)
+	for i := 0; i < len(SchemaDBs)-1; i++ {
+		buf = binary.LittleEndian.AppendUint32(buf, 2)
+	}
+	if err := os.WriteFile(GetPath(dir, SchemaFile), buf, 0644); err != nil {
+		t.Fatalf("Failed to write schema file: %v", err)
+	}
+
+	var versions SchemaVersions
+	if _, err := ReadSchemaVersions(dir, &versions); err != nil {
+		t.Fatalf("Failed to read schema versions: %v", err)
+	}
+	for i := 0; i < len(versions)-1; i++ {
+		if versions[i] != 2 {
+			t.Errorf("Expected %s to have version 2, got %d", SchemaDBs[i].Name, versions[i])
+		}
+	}
+	if versions[len(versions)-1] != SchemaVersion {
+		t.Errorf("Expected new DB to have version %d, got %d", SchemaVersion, versions[len(versions)-1])
+	}
+
+	if err := os.WriteFile(GetPath(dir, SchemaFile), buf[:5], 0644); err != nil {
+		t.Fatalf("Failed to write schema file: %v", err)
+	}
+	if _, err := ReadSchemaVersions(dir, &versions); err == nil {
+		t.Errorf("Expected error for truncated schema file")
+	}
+}
+
+func TestFinishMigrations(t *testing.T) {
+	dir := t.TempDir()
+
+	testWriteV0Users(t, dir, make([]UserV0, 1))
+	if err := os.WriteFile(GetMigrationPath(dir, "Users.db", 1), []byte("new"), 0644); err != nil {
+		t.Fatalf("Failed to write migrated users DB: %v", err)
+	}
+
+	/* Crash before schema version was updated: migrated file must be discarded. */
+	var versions SchemaVersions
+	if err := FinishMigrations(dir, &versions); err != nil {
+		t.Fatalf("Failed to finish migrations: %v", err)
+	}
+	if _, err := os.Stat(GetMigrationPath(dir, "Users.db", 1)); err == nil {
+		t.Errorf("Expected incomplete migration to be removed")
+	}
+
+	/* Crash after schema version was updated: migrated file must be moved in place. */
+	if err := os.WriteFile(GetMigrationPath(dir, "Users.db", 1), []byte("new"), 0644); err != nil {
+		t.Fatalf("Failed to write migrated users DB: %v", err)
+	}
+	versions[0] = 1
+	if err := FinishMigrations(dir, &versions); err != nil {
+		t.Fatalf("Failed to finish migrations: %v", err)
+	}
+	if buf, err := os.ReadFile(GetPath(dir, "Users.db")); (err != nil) || (string(buf) != "new") {
+		t.Errorf("Expected complete migration to be moved in place")
+	}
+}
+
+func TestMigrateLessonsV1(t *testing.T) {
+	dir := t.TempDir()
+
+	lessons := []LessonV1{
+		{ID: 0, ContainerType: LessonContainerCourse},
+		{ID: 1, ContainerType: LessonContainerSubject},
+	}
+	buf := make([]byte, database.DataOffset)
+	for i := 0; i < len(lessons); i++ {
+		buf = append(buf, unsafe.Slice((*byte)(unsafe.Pointer(&lessons[i])), unsafe.Sizeof(lessons[i]))...)
+	}
+	if err := os.WriteFile(GetPath(dir, "Lessons.db"), buf, 0644); err != nil {
+		t.Fatalf("Failed to write lessons DB: %v", err)
+	}
+
+	versions := SchemaVersions{1, 1, 1, 1, 1, 1}
+	if err := WriteSchemaVersions(dir, &versions); err != nil {
+		t.Fatalf("Failed to write schema versions: %v", err)
+	}
+	if err := MigrateDBs(dir, false); err != nil {
+		t.Fatalf("Failed to migrate DBs: %v", err)
+	}
+	testExpectSchemaVersions(t, dir, SchemaVersion)
+
+	buf, err := os.ReadFile(GetPath(dir, "Lessons.db"))
+	if err != nil {
+		t.Fatalf("Failed to read lessons DB: %v", err)
+	}
+	if len(buf) != int(database.DataOffset)+len(lessons)*int(unsafe.Sizeof(Lesson{})) {
+		t.Fatalf("Unexpected size of migrated lessons DB: %d", len(buf))
+	}
+
+	migrated := make([]Lesson, len(lessons))
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&migrated[0])), len(buf)-int(database.DataOffset)), buf[database.DataOffset:])
+	if (migrated[0].Version != 1) || (migrated[0].SourceVersion != 0) {
+		t.Errorf("Expected course lesson to have version 1, got %d", migrated[0].Version)
+	}
+	if (migrated[1].ID != 1) || (migrated[1].Version != 0) || (migrated[1].SourceVersion != 0) {
+		t.Errorf("Expected subject lesson to stay unlinked")
+	}
+}
+
+func TestMigrateCoursesV2(t *testing.T) {
+	dir := t.TempDir()
+
+	courses := make([]CourseV1, 2)
+	for i := 0; i < len(courses); i++ {
+		courses[i].ID = database.ID(i)
+		courses[i].Flags = CourseActive
+		courses[i].Data[0] = byte(i + 1)
+	}
+	buf := make([]byte, database.DataOffset)
+	for i := 0; i < len(courses); i++ {
+		buf = append(buf, unsafe.Slice((*byte)(unsafe.Pointer(&courses[i])), unsafe.Sizeof(courses[i]))...)
+	}
+	if err := os.WriteFile(GetPath(dir, "Courses.db"), buf, 0644); err != nil {
+		t.Fatalf("Failed to write courses DB: %v", err)
+	}
+	if err := os.WriteFile(GetPath(dir, IndexesFile), []byte("stale"), 0644); err != nil {
+		t.Fatalf("Failed to write indexes: %v", err)
+	}
+
+	versions := SchemaVersions{2, 2, 2, 2, 2, 2}
+	if err := WriteSchemaVersions(dir, &versions); err != nil {
+		t.Fatalf("Failed to write schema versions: %v", err)
+	}
+	if err := MigrateDBs(dir, false); err != nil {
+		t.Fatalf("Failed to migrate DBs: %v", err)
+	}
+	testExpectSchemaVersions(t, dir, SchemaVersion)
+
+	buf, err := os.ReadFile(GetPath(dir, "Courses.db"))
+	if err != nil {
+		t.Fatalf("Failed to read courses DB: %v", err)
+	}
+	if len(buf) != int(database.DataOffset)+len(courses)*int(unsafe.Sizeof(Course{})) {
+		t.Fatalf("Unexpected size of migrated courses DB: %d", len(buf))
+	}
+
+	migrated := make([]Course, len(courses))
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&migrated[0])), len(buf)-int(database.DataOffset)), buf[database.DataOffset:])
+	for i := 0; i < len(courses); i++ {
+		course := &migrated[i]
+		if (course.ID != courses[i].ID) || (course.Data[0] != courses[i].Data[0]) || (course.Published) || (len(course.CoAuthors) != 0) || (len(course.Viewers) != 0) {
+			t.Errorf("Course %d was not migrated correctly", i)
+		}
+	}
+
+	if _, err := os.Stat(GetPath(dir, IndexesFile)); err == nil {
+		t.Errorf("Expected stale indexes to be removed")
+	}
+}
+
+func TestMigrateTaskFilesV3(t *testing.T) {
+	dir := t.TempDir()
+
+	files := make([]TaskFilesV3, 2)
+	for i := 0; i < len(files); i++ {
+		files[i].ID = database.ID(i)
+		files[i].Flags = TaskFilesActive
+		files[i].Data[0] = byte(i + 1)
+	}
+	buf := make([]byte, database.DataOffset)
+	for i := 0; i < len(files); i++ {
+		buf = append(buf, unsafe.Slice((*byte)(unsafe.Pointer(&files[i])), unsafe.Sizeof(files[i]))...)
+	}
+	if err := os.WriteFile(GetPath(dir, "TaskFiles.db"), buf, 0644); err != nil {
+		t.Fatalf("Failed to write task files DB: %v", err)
+	}
+
+	var versions SchemaVersions
+	for i := 0; i < len(versions); i++ {
+		versions[i] = 3
+	}
+	if err := WriteSchemaVersions(dir, &versions); err != nil {
+		t.Fatalf("Failed to write schema versions: %v", err)
+	}
+	if err := MigrateDBs(dir, false); err != nil {
+		t.Fatalf("Failed to migrate DBs: %v", err)
+	}
+	testExpectSchemaVersions(t, dir, SchemaVersion)
+
+	buf, err := os.ReadFile(GetPath(dir, "TaskFiles.db"))
+	if err != nil {
+		t.Fatalf("Failed to read task files DB: %v", err)
+	}
+	if len(buf) != int(database.DataOffset)+len(files)*int(unsafe.Sizeof(TaskFiles{})) {
+		t.Fatalf("Unexpected size of migrated task files DB: %d", len(buf))
+	}
+
+	migrated := make([]TaskFiles, len(files))
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&migrated[0])), len(buf)-int(database.DataOffset)), buf[database.DataOffset:])
+	for i := 0; i < len(files); i++ {
+		f := &migrated[i]
+		if (f.ID != files[i].ID) || (f.Data[0] != files[i].Data[0]) || (f.InteractorFile != "") || (f.Interactor != "") {
+			t.Errorf("Task files %d were not migrated correctly", i)
+		}
+	}
+}
+
+func TestMigrateSubmissionsV4(t *testing.T) {
+	dir := t.TempDir()
+
+	submissions := make([]SubmissionV4, 2)
+	for i := 0; i < len(submissions); i++ {
+		submissions[i].ID = database.ID(i)
+		submissions[i].Flags = SubmissionActive
+		submissions[i].LessonID = database.ID(i + 3)
+		submissions[i].Status = SubmissionCheckDone
+		submissions[i].FinishedAt = int64(i + 100)
+		submissions[i].Data[0] = byte(i + 1)
+	}
+	buf := make([]byte, database.DataOffset)
+	for i := 0; i < len(submissions); i++ {
+		buf = append(buf, unsafe.Slice((*byte)(unsafe.Pointer(&submissions[i])), unsafe.Sizeof(submissions[i]))...)
+	}
+	if err := os.WriteFile(GetPath(dir, "Submissions.db"), buf, 0644); err != nil {
+		t.Fatalf("Failed to write submissions DB: %v", err)
+	}
+
+	var versions SchemaVersions
+	for i := 0; i < len(versions); i++ {
+		versions[i] = 4
+	}
+	if err := WriteSchemaVersions(dir, &versions); err != nil {
+		t.Fatalf("Failed to write schema versions: %v", err)
+	}
+	if err := MigrateDBs(dir, false); err != nil {
+		t.Fatalf("Failed to migrate DBs: %v", err)
+	}
+	testExpectSchemaVersions(t, dir, SchemaVersion)
+
+	buf, err := os.ReadFile(GetPath(dir, "Submissions.db"))
+	if err != nil {
+		t.Fatalf("Failed to read submissions DB: %v", err)
+	}
+	if len(buf) != int(database.DataOffset)+len(submissions)*int(unsafe.Sizeof(Submission{})) {
+		t.Fatalf("Unexpected size of migrated submissions DB: %d", len(buf))
+	}
+
+	migrated := make([]Submission, len(submissions))
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&migrated[0])), len(buf)-int(database.DataOffset)), buf[database.DataOffset:])
+	for i := 0; i < len(submissions); i++ {
+		s := &migrated[i]
+		if (s.ID != submissions[i].ID) || (s.LessonID != submissions[i].LessonID) || (s.Status != submissions[i].Status) || (s.FinishedAt != submissions[i].FinishedAt) || (s.Data[0] != submissions[i].Data[0]) || (s.RejudgedAt != 0) || (s.PreviousScore != 0) {
+			t.Errorf("Submission %d was not migrated correctly", i)
+		}
+	}
+}
+
+func TestMigrateDBsAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+
+	submissions := make([]SubmissionV4, 2)
+	for i := 0; i < len(submissions); i++ {
+		submissions[i].ID = database.ID(i)
+		submissions[i].Flags = SubmissionActive
+		submissions[i].Status = SubmissionCheckPending
+	}
+	buf := make([]byte, database.DataOffset)
+	for i := 0; i < len(submissions); i++ {
+		buf = append(buf, unsafe.Slice((*byte)(unsafe.Pointer(&submissions[i])), unsafe.Sizeof(submissions[i]))...)
+	}
+	if err := os.WriteFile(GetPath(dir, "Submissions.db"), buf, 0644); err != nil {
+		t.Fatalf("Failed to write submissions DB: %v", err)
+	}
+
+	var versions SchemaVersions
+	for i := 0; i < len(versions); i++ {
+		versions[i] = 4
+	}
+	if err := WriteSchemaVersions(dir, &versions); err != nil {
+		t.Fatalf("Failed to write schema versions: %v", err)
+	}
+
+	/* NOTE(anton2920): old version crashed after logging update of second submission in old layout. */
+	updated := submissions[1]
+	updated.Status = SubmissionCheckDone
+	updated.FinishedAt = 100
+	var tx Tx
+	tx.Records = append(tx.Records, TxRecord{DB: GetTxDBIndex(SubmissionsDB), Offset: int64(unsafe.Sizeof(updated)) + database.DataOffset, Data: unsafe.Slice((*byte)(unsafe.Pointer(&updated)), unsafe.Sizeof(updated))})
+	if err := os.WriteFile(GetPath(dir, WALName), EncodeTx(&tx), 0644); err != nil {
+		t.Fatalf("Failed to write WAL: %v", err)
+	}
+
+	if err := MigrateDBs(dir, false); err == nil {
+		t.Errorf("Expected migration to be refused while WAL is not empty")
+	}
+
+	replayed, err := ReplayWALFile(dir, WALName)
+	if (err != nil) || (!replayed) {
+		t.Fatalf("Expected WAL to be replayed, got %v", err)
+	}
+	if err := MigrateDBs(dir, false); err != nil {
+		t.Fatalf("Failed to migrate DBs: %v", err)
+	}
+
+	buf, err = os.ReadFile(GetPath(dir, "Submissions.db"))
+	if err != nil {
+		t.Fatalf("Failed to read submissions DB: %v", err)
+	}
+	if len(buf) != int(database.DataOffset)+len(submissions)*int(unsafe.Sizeof(Submission{})) {
+		t.Fatalf("Unexpected size of migrated submissions DB: %d", len(buf))
+	}
+
+	migrated := make([]Submission, len(submissions))
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&migrated[0])), len(buf)-int(database.DataOffset)), buf[database.DataOffset:])
+	if (migrated[0].Status != SubmissionCheckPending) || (migrated[0].FinishedAt != 0) {
+		t.Errorf("Expected first submission to be intact, got status %d", migrated[0].Status)
+	}
+	if (migrated[1].ID != 1) || (migrated[1].Status != SubmissionCheckDone) || (migrated[1].FinishedAt != 100) {
+		t.Errorf("Expected replayed update of second submission to survive migration, got %+v", migrated[1].Status)
+	}
+}
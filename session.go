@@ -52,7 +52,7 @@ func GetSessionFromToken(token string) (*Session, error) {
 		return nil, errors.New("session for this token has expired")
 	}
 
-	session.Expiry = now.Add(OneWeek)
+	session.Expiry = now.Add(time.Duration(Config.SessionLifetime))
 	return session, nil
 }
 
@@ -80,6 +80,17 @@ func GenerateSessionToken() (string, error) {
 	return string(token), nil
 }
 
+/* SessionUser copies user into session. Sessions don't need user's courses, so they are dropped to always fit into inline buffer. */
+func SessionUser(sessionUser *User, user *User) {
+	defer trace.End(trace.Begin(""))
+
+	tmp := *user
+	tmp.Courses = nil
+
+	User2DBUser(sessionUser, &tmp, unsafe.Slice(&sessionUser.Data[0], len(sessionUser.Data)), 0)
+	DBUser2User(sessionUser, &sessionUser.Data[0])
+}
+
 func UpdateAllUserSessions(user *User) {
 	defer trace.End(trace.Begin(""))
 
@@ -87,9 +98,7 @@ func UpdateAllUserSessions(user *User) {
 	for _, session := range Sessions {
 		if session.ID == user.ID {
 			session.Lock()
-			User2DBUser(&session.User, user, unsafe.Slice(&session.User.Data[0], len(session.User.Data)), 0)
-			DBUser2User(&session.User)
-			session.User.Courses = nil
+			SessionUser(&session.User, user)
 			session.Unlock()
 		}
 	}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	stdhttp "net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	sys "syscall"
+	"time"
+
+	"github.com/anton2920/gofa/log"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* Listeners are sockets server accepts connections on. 'TLS' and 'Redirect' are nil, if they are disabled. */
+type Listeners struct {
+	HTTP     *http.Listener
+	TLS      *net.TCPListener
+	Redirect *net.TCPListener
+}
+
+/* ShutdownTimeout is a default time in-flight requests and running verification have to finish after server is asked to stop. */
+const ShutdownTimeout = 30 * time.Second
+
+/*
+ * UpgradeEnv is set for a process, which takes listeners over from a previous one. Its value is PID of previous process.
+ * Listeners are passed as file descriptors starting from 3, in order of fields of 'Listeners'. Disabled listeners are skipped.
+ */
+const UpgradeEnv = "SEMS_UPGRADE_PARENT"
+
+/* UpgradeReadyEnv is a number of file descriptor, which follows listeners and which new process writes to once its configuration, self-test and DBs are fine. Previous process keeps serving until then. */
+const UpgradeReadyEnv = "SEMS_UPGRADE_READY"
+
+/* UpgradeTimeout is a time new process has to become ready. It's long enough to self-test all programming languages. */
+const UpgradeTimeout = 2 * time.Minute
+
+var (
+	ActiveRequests int32
+	ShuttingDown   int32
+)
+
+/* Conns are connections served by 'ServeConn'. On shutdown they are shut down for reading, so clients can't send new requests over kept-alive connections. */
+var (
+	Conns     = make(map[*http.Conn]struct{})
+	ConnsLock sync.Mutex
+)
+
+func ConnStart(c *http.Conn) {
+	ConnsLock.Lock()
+	defer ConnsLock.Unlock()
+
+	if atomic.LoadInt32(&ShuttingDown) == 1 {
+		sys.Shutdown(int(c.Socket), sys.SHUT_RD)
+	}
+	Conns[c] = struct{}{}
+}
+
+func ConnDone(c *http.Conn) {
+	ConnsLock.Lock()
+	delete(Conns, c)
+	ConnsLock.Unlock()
+}
+
+/* ShutdownConns makes reads from all connections return EOF. Responses to in-flight requests are still sent. */
+func ShutdownConns() {
+	defer trace.End(trace.Begin(""))
+
+	ConnsLock.Lock()
+	defer ConnsLock.Unlock()
+
+	for c := range Conns {
+		sys.Shutdown(int(c.Socket), sys.SHUT_RD)
+	}
+}
+
+/* RequestStart must be called by router, with 'RequestDone' deferred. Requests, which come after shutdown began, are rejected, so nothing uses DBs after they are closed. Returns false for such requests. */
+func RequestStart(w *http.Response) bool {
+	atomic.AddInt32(&ActiveRequests, 1)
+	if atomic.LoadInt32(&ShuttingDown) == 1 {
+		w.Headers.Set("Connection", "close")
+		return false
+	}
+	return true
+}
+
+func RequestDone() {
+	atomic.AddInt32(&ActiveRequests, -1)
+}
+
+/* WaitForRequests waits until all in-flight requests are handled. Returns false if deadline is reached first. */
+func WaitForRequests(deadline time.Time) bool {
+	defer trace.End(trace.Begin(""))
+
+	for atomic.LoadInt32(&ActiveRequests) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+func InheritListener(fd int, name string) (*net.TCPListener, error) {
+	f := os.NewFile(uintptr(fd), name)
+	defer f.Close()
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inherit %s listener: %w", name, err)
+	}
+	return l.(*net.TCPListener), nil
+}
+
+func ListenTCP(address string) (*net.TCPListener, error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return l.(*net.TCPListener), nil
+}
+
+/* Listen opens listeners from config or takes them over from previous process. */
+func Listen(ls *Listeners) error {
+	defer trace.End(trace.Begin(""))
+
+	var err error
+
+	if os.Getenv(UpgradeEnv) != "" {
+		fd := 3
+		ls.HTTP = &http.Listener{Socket: int32(fd)}
+		fd++
+		if TLSEnabled() {
+			if ls.TLS, err = InheritListener(fd, "TLS"); err != nil {
+				return err
+			}
+			fd++
+		}
+		if Config.RedirectAddress != "" {
+			if ls.Redirect, err = InheritListener(fd, "redirect"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if ls.HTTP, err = http.Listen(Config.Address); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", Config.Address, err)
+	}
+	if TLSEnabled() {
+		if ls.TLS, err = ListenTCP(Config.TLSAddress); err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", Config.TLSAddress, err)
+		}
+	}
+	if Config.RedirectAddress != "" {
+		if ls.Redirect, err = ListenTCP(Config.RedirectAddress); err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", Config.RedirectAddress, err)
+		}
+	}
+	return nil
+}
+
+/* ServeListeners starts serving HTTPS and redirects. Plain HTTP listener is served by event loop. */
+func ServeListeners(ls *Listeners) {
+	if ls.TLS != nil {
+		go ServeTLS(tls.NewListener(ls.TLS, TLSServerConfig()), TLSBackendAddress(Config.Address))
+	}
+	if ls.Redirect != nil {
+		go stdhttp.Serve(ls.Redirect, stdhttp.HandlerFunc(TLSRedirectHandler))
+	}
+}
+
+func CloseListeners(ls *Listeners) {
+	if ls.HTTP != nil {
+		ls.HTTP.Close()
+	}
+	if ls.TLS != nil {
+		ls.TLS.Close()
+	}
+	if ls.Redirect != nil {
+		ls.Redirect.Close()
+	}
+}
+
+/* WaitForParent tells previous process that this one is ready to take over and waits until it exits, so DBs and files are no longer used by it. Process is ready only if DBs in 'dir' can be opened by it, otherwise previous process keeps serving. */
+func WaitForParent(dir string, timeout time.Duration) error {
+	defer trace.End(trace.Begin(""))
+
+	env := os.Getenv(UpgradeEnv)
+	if env == "" {
+		return nil
+	}
+	os.Unsetenv(UpgradeEnv)
+
+	if err := CheckDBs(dir); err != nil {
+		return fmt.Errorf("DBs can't be opened: %w", err)
+	}
+
+	if ready := os.Getenv(UpgradeReadyEnv); ready != "" {
+		os.Unsetenv(UpgradeReadyEnv)
+
+		fd, err := strconv.Atoi(ready)
+		if err != nil {
+			return fmt.Errorf("invalid ready file descriptor %q: %w", ready, err)
+		}
+		f := os.NewFile(uintptr(fd), "ready")
+		_, err = f.Write([]byte{1})
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to tell previous process that new one is ready: %w", err)
+		}
+	}
+
+	pid, err := strconv.Atoi(env)
+	if err != nil {
+		return fmt.Errorf("invalid PID of previous process %q: %w", env, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for sys.Kill(pid, 0) != sys.ESRCH {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("previous process %d is still running after %v", pid, timeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil
+}
+
+/* UpgradeProcess is a new version of a server, which is being started. 'Ready' receives nil once it's ready to take over, or error if it failed to start and was killed. */
+type UpgradeProcess struct {
+	Cmd   *exec.Cmd
+	Ready chan error
+}
+
+/*
+ * Upgrade starts new version of a server, which inherits listeners. Current process keeps accepting connections until new one is ready, then it must shut down. If new process fails to start, it's killed and current process keeps serving.
+ * NOTE(anton2920): this is a restart with queued connections, not zero downtime. New process starts accepting only after current one has finished in-flight requests and closed DBs. Connections made in between are queued by kernel.
+ */
+func Upgrade(ls *Listeners) (*UpgradeProcess, error) {
+	defer trace.End(trace.Begin(""))
+
+	var files []*os.File
+	defer func() {
+		for i := 0; i < len(files); i++ {
+			files[i].Close()
+		}
+	}()
+
+	fd, err := sys.Dup(int(ls.HTTP.Socket))
+	if err != nil {
+		return nil, fmt.Errorf("failed to duplicate HTTP listener: %w", err)
+	}
+	files = append(files, os.NewFile(uintptr(fd), "HTTP"))
+
+	tcps := [...]*net.TCPListener{ls.TLS, ls.Redirect}
+	for i := 0; i < len(tcps); i++ {
+		if tcps[i] != nil {
+			f, err := tcps[i].File()
+			if err != nil {
+				return nil, fmt.Errorf("failed to duplicate listener: %w", err)
+			}
+			files = append(files, f)
+		}
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ready pipe: %w", err)
+	}
+	files = append(files, readyW)
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), UpgradeEnv+"="+strconv.Itoa(os.Getpid()), UpgradeReadyEnv+"="+strconv.Itoa(3+len(files)-1))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		ready.Close()
+		return nil, fmt.Errorf("failed to start new process: %w", err)
+	}
+
+	/* NOTE(anton2920): write end must be closed here, so read fails as soon as new process exits. */
+	readyW.Close()
+	files = files[:len(files)-1]
+
+	up := UpgradeProcess{Cmd: cmd, Ready: make(chan error, 1)}
+	go func(up *UpgradeProcess, ready *os.File) {
+		defer ready.Close()
+
+		ready.SetReadDeadline(time.Now().Add(UpgradeTimeout))
+		if _, err := ready.Read(make([]byte, 1)); err != nil {
+			up.Cmd.Process.Kill()
+			up.Cmd.Wait()
+			up.Ready <- fmt.Errorf("new process did not become ready: %w", err)
+			return
+		}
+		up.Ready <- nil
+	}(&up, ready)
+
+	return &up, nil
+}
+
+/*
+ * Shutdown stops accepting connections and requests, then waits for in-flight requests and running verification to finish. Submissions, which are not verified by then, are verified after restart.
+ * Returns false if something is still running, so DBs must be left open. Changes, which are committed after process exits, are completed or discarded from WAL on next start.
+ */
+func Shutdown(ls *Listeners) bool {
+	defer trace.End(trace.Begin(""))
+
+	stopped := true
+
+	atomic.StoreInt32(&ShuttingDown, 1)
+	CloseListeners(ls)
+	ShutdownConns()
+
+	deadline := time.Now().Add(time.Duration(Config.ShutdownTimeout))
+	if !WaitForRequests(deadline) {
+		log.Warnf("Shutdown timeout exceeded, interrupting %d request(s)", atomic.LoadInt32(&ActiveRequests))
+		stopped = false
+	}
+	if !StopSubmissionVerifyWorker(deadline) {
+		log.Warnf("Shutdown timeout exceeded, running verification will be restarted on next start")
+		stopped = false
+	}
+
+	if err := StoreSessionsToFile(Config.SessionsFile); err != nil {
+		log.Warnf("Failed to store sessions to file: %v", err)
+	}
+	return stopped
+}
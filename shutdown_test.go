@@ -0,0 +1,147 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+	sys "syscall"
+	"testing"
+	"time"
+
+	"github.com/anton2920/gofa/net/http"
+)
+
+func TestWaitForRequests(t *testing.T) {
+	var w http.Response
+
+	RequestStart(&w)
+	if w.Headers.Get("Connection") != "" {
+		t.Errorf("Expected connection to be kept before shutdown")
+	}
+	if WaitForRequests(time.Now().Add(20 * time.Millisecond)) {
+		t.Errorf("Expected deadline to be reached with request in flight")
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		RequestDone()
+	}()
+	if !WaitForRequests(time.Now().Add(time.Second)) {
+		t.Errorf("Expected in-flight request to finish")
+	}
+
+	atomic.StoreInt32(&ShuttingDown, 1)
+	defer atomic.StoreInt32(&ShuttingDown, 0)
+
+	w = http.Response{}
+	started := RequestStart(&w)
+	RequestDone()
+	if started {
+		t.Errorf("Expected request to be rejected during shutdown")
+	}
+	if w.Headers.Get("Connection") != "close" {
+		t.Errorf("Expected connection to be closed during shutdown, got %q", w.Headers.Get("Connection"))
+	}
+}
+
+func TestWaitForParentReady(t *testing.T) {
+	/* NOTE(anton2920): process, which has already exited, plays previous one. */
+	parent := exec.Command("true")
+	if err := parent.Run(); err != nil {
+		t.Fatalf("Failed to run process: %v", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer r.Close()
+	fd, err := sys.Dup(int(w.Fd()))
+	if err != nil {
+		t.Fatalf("Failed to duplicate pipe: %v", err)
+	}
+	w.Close()
+
+	os.Setenv(UpgradeEnv, strconv.Itoa(parent.Process.Pid))
+	os.Setenv(UpgradeReadyEnv, strconv.Itoa(fd))
+	if err := WaitForParent("db_test", time.Second); err != nil {
+		t.Fatalf("Failed to wait for parent: %v", err)
+	}
+
+	buf := make([]byte, 2)
+	if n, err := r.Read(buf); (err != nil) || (n != 1) {
+		t.Errorf("Expected parent to be told that process is ready, got %d bytes, %v", n, err)
+	}
+	if n, err := r.Read(buf); err != io.EOF {
+		t.Errorf("Expected ready pipe to be closed, got %d bytes, %v", n, err)
+	}
+}
+
+func TestWaitForParentBadDBs(t *testing.T) {
+	dir := t.TempDir()
+
+	var versions SchemaVersions
+	for i := 0; i < len(versions); i++ {
+		versions[i] = SchemaVersion + 1
+	}
+	if err := WriteSchemaVersions(dir, &versions); err != nil {
+		t.Fatalf("Failed to write schema versions: %v", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer r.Close()
+	fd, err := sys.Dup(int(w.Fd()))
+	if err != nil {
+		t.Fatalf("Failed to duplicate pipe: %v", err)
+	}
+	w.Close()
+
+	os.Setenv(UpgradeEnv, strconv.Itoa(os.Getpid()))
+	os.Setenv(UpgradeReadyEnv, strconv.Itoa(fd))
+	defer os.Unsetenv(UpgradeReadyEnv)
+	if err := WaitForParent(dir, time.Second); err == nil {
+		t.Errorf("Expected error for DBs of newer version")
+	}
+	sys.Close(fd)
+
+	if n, err := r.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected parent not to be told that process is ready, got %d bytes, %v", n, err)
+	}
+}
+
+func TestSubmissionVerifyRequeue(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	/* NOTE(anton2920): submission was being verified when previous process was killed. */
+	submission := Submission{LessonID: 2, UserID: 2, Status: SubmissionCheckInProgress, SubmittedSteps: make([]SubmittedStep, 1)}
+	submittedStep := &submission.SubmittedSteps[0]
+	submittedStep.Type = SubmittedTypeTest
+	submittedStep.Status = SubmissionCheckInProgress
+	submittedTest, _ := Submitted2Test(submittedStep)
+	testRejudgeTestStep(&submittedTest.Step, 1)
+	submittedTest.SubmittedQuestions = []SubmittedQuestion{{SelectedAnswers: []int{1}}}
+	if err := CreateSubmission(&submission); err != nil {
+		t.Fatalf("Failed to create submission: %v", err)
+	}
+
+	if err := SubmissionVerifyRequeue(); err != nil {
+		t.Fatalf("Failed to requeue submissions: %v", err)
+	}
+	testWaitForJails()
+
+	if err := GetSubmissionByID(submission.ID, &submission); err != nil {
+		t.Fatalf("Failed to get submission: %v", err)
+	}
+	if submission.Status != SubmissionCheckDone {
+		t.Errorf("Expected requeued submission to be verified, got status %d", submission.Status)
+	}
+	if score, maximum := GetSubmissionScore(&submission); (score != 1) || (maximum != 1) {
+		t.Errorf("Expected score 1/1, got %d/%d", score, maximum)
+	}
+}
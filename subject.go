@@ -8,7 +8,6 @@ import (
 	"github.com/anton2920/gofa/database"
 	"github.com/anton2920/gofa/net/http"
 	"github.com/anton2920/gofa/strings"
-	"github.com/anton2920/gofa/syscall"
 	"github.com/anton2920/gofa/trace"
 )
 
@@ -19,6 +18,7 @@ type Subject struct {
 	GroupID   database.ID
 	CreatedOn int64
 
+	Blob Blob
 	Data [1024]byte
 }
 
@@ -63,23 +63,26 @@ func WhoIsUserInSubject(userID database.ID, subject *Subject) (SubjectUserType,
 	return SubjectUserNone, nil
 }
 
-func CreateSubject(subject *Subject) error {
+func CreateSubjectTx(tx *Tx, subject *Subject) error {
 	defer trace.End(trace.Begin(""))
 
-	var err error
-
-	subject.ID, err = database.IncrementNextID(SubjectsDB)
-	if err != nil {
-		return fmt.Errorf("failed to increment subject ID: %w", err)
-	}
+	subject.ID = NewIDTx(tx, SubjectsDB)
 
-	return SaveSubject(subject)
+	return SaveSubjectTx(tx, subject)
 }
 
-func DBSubject2Subject(subject *Subject) {
+func CreateSubject(subject *Subject) error {
 	defer trace.End(trace.Begin(""))
 
-	data := &subject.Data[0]
+	var tx Tx
+	if err := CreateSubjectTx(&tx, subject); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func DBSubject2Subject(subject *Subject, data *byte) {
+	defer trace.End(trace.Begin(""))
 
 	subject.Name = database.Offset2String(subject.Name, data)
 
@@ -90,44 +93,68 @@ func DBSubject2Subject(subject *Subject) {
 func GetSubjectByID(id database.ID, subject *Subject) error {
 	defer trace.End(trace.Begin(""))
 
-	if err := database.Read(SubjectsDB, id, unsafe.Pointer(subject), int(unsafe.Sizeof(*subject))); err != nil {
+	if err := DBRead(SubjectsDB, id, unsafe.Pointer(subject), int(unsafe.Sizeof(*subject))); err != nil {
+		return err
+	}
+	if subject.ID != id {
+		return database.NotFound
+	}
+
+	data, err := GetBlobData(&subject.Blob, subject.Data[:])
+	if err != nil {
 		return err
 	}
 
-	DBSubject2Subject(subject)
+	DBSubject2Subject(subject, data)
 	return nil
 }
 
 func GetSubjects(pos *int64, subjects []Subject) (int, error) {
 	defer trace.End(trace.Begin(""))
 
-	n, err := database.ReadMany(SubjectsDB, pos, *(*[]byte)(unsafe.Pointer(&subjects)), int(unsafe.Sizeof(subjects[0])))
+	n, err := DBReadManyValid(SubjectsDB, pos, subjects, func(subject *Subject) database.ID { return subject.ID })
 	if err != nil {
 		return 0, err
 	}
 
 	for i := 0; i < n; i++ {
-		DBSubject2Subject(&subjects[i])
+		data, err := GetBlobData(&subjects[i].Blob, subjects[i].Data[:])
+		if err != nil {
+			return 0, err
+		}
+		DBSubject2Subject(&subjects[i], data)
 	}
 	return n, nil
 }
 
-func DeleteSubjectByID(id database.ID) error {
+func DeleteSubjectByIDTx(tx *Tx, id database.ID) error {
 	defer trace.End(trace.Begin(""))
 
 	flags := SubjectDeleted
 	var subject Subject
 
 	offset := int64(int(id)*int(unsafe.Sizeof(subject))) + database.DataOffset + int64(unsafe.Offsetof(subject.Flags))
-	_, err := syscall.Pwrite(SubjectsDB.FD, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
-	if err != nil {
-		return fmt.Errorf("failed to delete subject from DB: %w", err)
-	}
+	tx.WriteAt(SubjectsDB, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
 
+	tx.OnCommit(func() { UnindexSubject(id) })
 	return nil
 }
 
-func SaveSubject(subject *Subject) error {
+func DeleteSubjectByID(id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := DeleteSubjectByIDTx(&tx, id); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func SubjectDataSize(subject *Subject) int {
+	return DBStringSize(subject.Name) + DBSliceSize(subject.Lessons)
+}
+
+func SaveSubjectTx(tx *Tx, subject *Subject) error {
 	defer trace.End(trace.Begin(""))
 
 	var subjectDB Subject
@@ -138,14 +165,35 @@ func SaveSubject(subject *Subject) error {
 	subjectDB.TeacherID = subject.TeacherID
 	subjectDB.GroupID = subject.GroupID
 
-	/* TODO(anton2920): save up to a sizeof(subject.Data). */
-	data := unsafe.Slice(&subjectDB.Data[0], len(subjectDB.Data))
+	data, err := GetDataBuffer(subjectDB.Data[:], SubjectDataSize(subject))
+	if err != nil {
+		return err
+	}
+
 	n += database.String2DBString(&subjectDB.Name, subject.Name, data, n)
 	n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&subjectDB.Lessons)), *(*[]byte)(unsafe.Pointer(&subject.Lessons)), int(unsafe.Sizeof(subject.Lessons[0])), int(unsafe.Alignof(subject.Lessons[0])), data, n)
 
 	subjectDB.CreatedOn = subject.CreatedOn
 
-	return database.Write(SubjectsDB, subjectDB.ID, unsafe.Pointer(&subjectDB), int(unsafe.Sizeof(subjectDB)))
+	if err := SaveBlob(&subjectDB.Blob, subjectDB.Data[:], data[:n]); err != nil {
+		return err
+	}
+
+	tx.Write(SubjectsDB, subjectDB.ID, unsafe.Pointer(&subjectDB), int(unsafe.Sizeof(subjectDB)))
+
+	indexed := *subject
+	tx.OnCommit(func() { IndexSubject(&indexed) })
+	return nil
+}
+
+func SaveSubject(subject *Subject) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := SaveSubjectTx(&tx, subject); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
 }
 
 func DisplaySubjectCoursesSelect(w *http.Response, l Language, subject *Subject, teacher *User) {
@@ -153,37 +201,31 @@ func DisplaySubjectCoursesSelect(w *http.Response, l Language, subject *Subject,
 	DisplayHiddenID(w, "ID", subject.ID)
 
 	if len(subject.Lessons) == 0 {
-		courses := make([]Course, 32)
 		var displayed bool
-		var pos int64
+		var course Course
 
-		for {
-			n, err := GetCourses(&pos, courses)
-			if err != nil {
+		ids := GetUserCourseIDs(teacher)
+		for i := 0; i < len(ids); i++ {
+			if err := GetCourseByID(ids[i], &course); err != nil {
 				/* TODO(anton2920): report error. */
+				continue
 			}
-			if n == 0 {
-				break
+			if course.Flags != CourseActive {
+				continue
 			}
-			for i := 0; i < n; i++ {
-				course := &courses[i]
-				if (course.Flags != CourseActive) || (!UserOwnsCourse(teacher, course.ID)) {
-					continue
-				}
 
-				if !displayed {
-					w.WriteString(`<label>`)
-					w.WriteString(Ls(l, "Courses"))
-					w.WriteString(`: `)
-					w.WriteString(`<select name="CourseID">`)
-					displayed = true
-				}
-				w.WriteString(`<option value="`)
-				w.WriteInt(i)
-				w.WriteString(`">`)
-				w.WriteHTMLString(course.Name)
-				w.WriteString(`</option>`)
+			if !displayed {
+				w.WriteString(`<label>`)
+				w.WriteString(Ls(l, "Courses"))
+				w.WriteString(`: `)
+				w.WriteString(`<select name="CourseID">`)
+				displayed = true
 			}
+			w.WriteString(`<option value="`)
+			w.WriteInt(int(course.ID))
+			w.WriteString(`">`)
+			w.WriteHTMLString(course.Name)
+			w.WriteString(`</option>`)
 		}
 		if displayed {
 			w.WriteString(`</select>`)
@@ -256,7 +298,7 @@ func SubjectsPageHandler(w *http.Response, r *http.Request) error {
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -397,8 +439,8 @@ func SubjectPageHandler(w *http.Response, r *http.Request) error {
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
-		DisplaySidebarWithLessons(w, GL, session, subject.Lessons)
+		DisplayHeader(w, GL, session)
+		DisplaySidebarWithLessons(w, GL, session, subject.Lessons, GetStudentLessonStates(session.ID, &subject))
 
 		DisplayMainStart(w)
 
@@ -459,8 +501,26 @@ func SubjectPageHandler(w *http.Response, r *http.Request) error {
 				DisplayLessons(w, GL, subject.Lessons)
 			}
 
+			DisplaySubjectAnnouncements(w, GL, &subject, who)
+
 			if (session.ID == AdminID) || (session.ID == subject.TeacherID) {
 				DisplaySubjectCoursesSelect(w, GL, &subject, &teacher)
+
+				lessons, err := GetSubjectSyncLessons(&subject)
+				if err != nil {
+					return http.ServerError(err)
+				}
+				if len(lessons) > 0 {
+					w.WriteString(`<form method="POST" action="/subject/sync">`)
+					DisplayHiddenID(w, "ID", subject.ID)
+					w.WriteString(`<p>`)
+					w.WriteString(Ls(GL, "Lessons with course updates"))
+					w.WriteString(`: `)
+					w.WriteInt(len(lessons))
+					DisplayButton(w, GL, "", "Review")
+					w.WriteString(`</p>`)
+					w.WriteString(`</form>`)
+				}
 			}
 		}
 		DisplayPageEnd(w)
@@ -569,7 +629,7 @@ func SubjectCreateEditPageHandler(w *http.Response, r *http.Request, session *Se
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -688,7 +748,7 @@ func SubjectLessonsMainPageHandler(w *http.Response, r *http.Request, session *S
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -803,20 +863,26 @@ func SubjectLessonsPageHandler(w *http.Response, r *http.Request) error {
 		if err != nil {
 			return http.ClientError(err)
 		}
-		if !UserOwnsCourse(&user, courseID) {
-			return ForbiddenError
-		}
 		if err := GetCourseByID(courseID, &course); err != nil {
 			if err == database.NotFound {
 				return http.NotFound("course with this ID does not exist")
 			}
 			return http.ServerError(err)
 		}
+		if UserCourseAccess(&user, &course) == CourseAccessNone {
+			return ForbiddenError
+		}
 		if course.Flags != CourseActive {
 			return http.ClientError(nil)
 		}
 
-		LessonsDeepCopy(&subject.Lessons, course.Lessons, subject.ID, LessonContainerSubject)
+		if err := LessonsDeepCopy(&subject.Lessons, course.Lessons, subject.ID, LessonContainerSubject); err != nil {
+			return http.ServerError(err)
+		}
+		if err := NotifyLessonsPublished(&subject, subject.Lessons); err != nil {
+			return http.ServerError(err)
+		}
+		Audit(r, session.ID, "import", "subject", subject.ID, AuditCourseSummary(&course), fmt.Sprintf("%d lessons", len(subject.Lessons)))
 	case Ls(GL, "give as is"):
 		var course Course
 
@@ -824,20 +890,26 @@ func SubjectLessonsPageHandler(w *http.Response, r *http.Request) error {
 		if err != nil {
 			return http.ClientError(err)
 		}
-		if !UserOwnsCourse(&user, courseID) {
-			return ForbiddenError
-		}
 		if err := GetCourseByID(courseID, &course); err != nil {
 			if err == database.NotFound {
 				return http.NotFound("course with this ID does not exist")
 			}
 			return http.ServerError(err)
 		}
+		if UserCourseAccess(&user, &course) == CourseAccessNone {
+			return ForbiddenError
+		}
 		if course.Flags != CourseActive {
 			return http.ClientError(nil)
 		}
 
-		LessonsDeepCopy(&subject.Lessons, course.Lessons, subject.ID, LessonContainerSubject)
+		if err := LessonsDeepCopy(&subject.Lessons, course.Lessons, subject.ID, LessonContainerSubject); err != nil {
+			return http.ServerError(err)
+		}
+		if err := NotifyLessonsPublished(&subject, subject.Lessons); err != nil {
+			return http.ServerError(err)
+		}
+		Audit(r, session.ID, "import", "subject", subject.ID, AuditCourseSummary(&course), fmt.Sprintf("%d lessons", len(subject.Lessons)))
 
 		w.Redirect(w.PathID("/subject/", subjectID), http.StatusSeeOther)
 		return nil
@@ -870,7 +942,9 @@ func SubjectLessonsPageHandler(w *http.Response, r *http.Request) error {
 		}
 		defer SaveLesson(&lesson)
 
-		LessonFillFromRequest(r.Form, &lesson)
+		if err := LessonFillFromRequest(r.Form, &lesson); err != nil {
+			return http.ClientError(err)
+		}
 	case "Test":
 		li, err := GetValidIndex(r.Form.Get("LessonIndex"), len(subject.Lessons))
 		if err != nil {
@@ -929,10 +1003,17 @@ func SubjectLessonsPageHandler(w *http.Response, r *http.Request) error {
 		if err := LessonVerify(GL, &lesson); err != nil {
 			return LessonAddPageHandler(w, r, session, &subject.LessonContainer, &lesson, err)
 		}
+		published := lesson.Flags == LessonDraft
 		lesson.Flags = LessonActive
 		if err := SaveLesson(&lesson); err != nil {
 			return http.ServerError(err)
 		}
+		Audit(r, session.ID, "edit", "lesson", lesson.ID, "", AuditLessonSummary(&lesson))
+		if published {
+			if err := NotifyLessonsPublished(&subject, []database.ID{lesson.ID}); err != nil {
+				return http.ServerError(err)
+			}
+		}
 
 		return SubjectLessonsMainPageHandler(w, r, session, &subject, nil)
 	case Ls(GL, "Add lesson"):
@@ -980,6 +1061,7 @@ func SubjectLessonsPageHandler(w *http.Response, r *http.Request) error {
 		if err := SubjectLessonsVerify(GL, &subject); err != nil {
 			return SubjectLessonsMainPageHandler(w, r, session, &subject, err)
 		}
+		Audit(r, session.ID, "edit", "subject", subjectID, "", fmt.Sprintf("%d lessons", len(subject.Lessons)))
 
 		w.Redirect(w.PathID("/subject/", subjectID), http.StatusSeeOther)
 		return nil
@@ -1030,6 +1112,8 @@ func SubjectCreateHandler(w *http.Response, r *http.Request) error {
 		return http.ServerError(err)
 	}
 
+	Audit(r, session.ID, "create", "subject", subject.ID, "", AuditSubjectSummary(&subject))
+
 	w.Redirect("/subjects", http.StatusSeeOther)
 	return nil
 }
@@ -1062,6 +1146,8 @@ func SubjectDeleteHandler(w *http.Response, r *http.Request) error {
 		return http.ServerError(err)
 	}
 
+	Audit(r, session.ID, "delete", "subject", subjectID, AuditSubjectSummary(&subject), "")
+
 	w.Redirect("/subjects", http.StatusSeeOther)
 	return nil
 }
@@ -1113,6 +1199,7 @@ func SubjectEditHandler(w *http.Response, r *http.Request) error {
 		return http.ClientError(err)
 	}
 
+	before := AuditSubjectSummary(&subject)
 	subject.Name = name
 	subject.TeacherID = teacherID
 	subject.GroupID = groupID
@@ -1121,6 +1208,8 @@ func SubjectEditHandler(w *http.Response, r *http.Request) error {
 		return http.ServerError(err)
 	}
 
+	Audit(r, session.ID, "edit", "subject", subjectID, before, AuditSubjectSummary(&subject))
+
 	w.Redirect(w.PathID("/subject/", subjectID), http.StatusSeeOther)
 	return nil
 }
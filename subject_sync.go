@@ -0,0 +1,546 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/trace"
+)
+
+type DiffOp byte
+
+const (
+	DiffEqual DiffOp = iota
+	DiffInsert
+	DiffDelete
+)
+
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+/* SubjectSyncLesson is a lesson in subject, which course lesson has been published since it was last synced. */
+type SubjectSyncLesson struct {
+	Index  int
+	Lesson Lesson
+	Source Lesson
+}
+
+/* Changes, which can be propagated from course lesson. Change of step 'i' is 'SubjectSyncSteps+i'. */
+const (
+	SubjectSyncName = iota
+	SubjectSyncTheory
+	SubjectSyncSteps
+)
+
+func SplitLines(s string) []string {
+	var lines []string
+
+	if len(s) == 0 {
+		return nil
+	}
+
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			end := i
+			if (end > start) && (s[end-1] == '\r') {
+				end--
+			}
+			lines = append(lines, s[start:end])
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		lines = append(lines, s[start:])
+	}
+
+	return lines
+}
+
+/* DiffLines returns line diff, which turns 'a' into 'b', based on longest common subsequence. */
+func DiffLines(a []string, b []string) []DiffLine {
+	defer trace.End(trace.Begin(""))
+
+	/* lcs[i][j] is a length of LCS of a[i:] and b[j:]. */
+	lcs := make([][]int, len(a)+1)
+	for i := 0; i < len(lcs); i++ {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := make([]DiffLine, 0, len(a)+len(b))
+	i, j := 0, 0
+	for (i < len(a)) && (j < len(b)) {
+		if a[i] == b[j] {
+			diff = append(diff, DiffLine{DiffEqual, a[i]})
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			diff = append(diff, DiffLine{DiffDelete, a[i]})
+			i++
+		} else {
+			diff = append(diff, DiffLine{DiffInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, DiffLine{DiffDelete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, DiffLine{DiffInsert, b[j]})
+	}
+
+	return diff
+}
+
+/* StepLines returns text representation of a step, which is used for comparison and diffs. */
+func StepLines(l Language, step *Step) []string {
+	defer trace.End(trace.Begin(""))
+
+	var lines []string
+
+	lines = append(lines, Ls(l, "Name")+": "+step.Name)
+	lines = append(lines, Ls(l, "Type")+": "+StepStringType(l, step))
+
+	switch step.Type {
+	default:
+		panic("invalid step type")
+	case StepTypeTest:
+		test, _ := Step2Test(step)
+
+		for i := 0; i < len(test.Questions); i++ {
+			question := &test.Questions[i]
+
+			lines = append(lines, fmt.Sprintf("%s #%d: %s", Ls(l, "Question"), i+1, question.Name))
+			for j := 0; j < len(question.Answers); j++ {
+				mark := "[ ] "
+				for k := 0; k < len(question.CorrectAnswers); k++ {
+					if question.CorrectAnswers[k] == j {
+						mark = "[x] "
+						break
+					}
+				}
+				lines = append(lines, mark+question.Answers[j])
+			}
+		}
+	case StepTypeProgramming:
+		task, _ := Step2Programming(step)
+
+		lines = append(lines, Ls(l, "Description")+":")
+		lines = append(lines, SplitLines(task.Description)...)
+
+		languages := Ls(l, "Any")
+		if task.Languages != 0 {
+			languages = ""
+			for i := 0; i < len(ProgrammingLanguages); i++ {
+				if (task.Languages & (1 << uint(i))) != 0 {
+					if languages != "" {
+						languages += ", "
+					}
+					languages += ProgrammingLanguages[i].Name
+				}
+			}
+		}
+		lines = append(lines, Ls(l, "Languages")+": "+languages)
+
+		lines = append(lines, TaskFilesLines(l, task)...)
+
+		checkNames := [...]string{CheckTypeExample: "Examples", CheckTypeTest: "Tests"}
+		for i := 0; i < len(task.Checks); i++ {
+			for j := 0; j < len(task.Checks[i]); j++ {
+				check := &task.Checks[i][j]
+
+				lines = append(lines, fmt.Sprintf("%s #%d", Ls(l, checkNames[i]), j+1))
+				lines = append(lines, Ls(l, "Input")+":")
+				lines = append(lines, SplitLines(check.Input)...)
+				lines = append(lines, Ls(l, "Output")+":")
+				lines = append(lines, SplitLines(check.Output)...)
+			}
+		}
+	}
+
+	return lines
+}
+
+/* TaskFilesLines returns text representation of task files. If files can't be read, their ID is used instead, so they are different from any other files. */
+func TaskFilesLines(l Language, task *StepProgramming) []string {
+	defer trace.End(trace.Begin(""))
+
+	var files TaskFiles
+	var lines []string
+
+	if err := GetStepTaskFiles(task, &files); err != nil {
+		return append(lines, fmt.Sprintf("%s: #%d", Ls(l, "Files"), task.Files))
+	}
+
+	if files.StarterCode != "" {
+		lines = append(lines, Ls(l, "Starter code")+":")
+		lines = append(lines, SplitLines(files.StarterCode)...)
+	}
+	for i := 0; i < len(files.Files); i++ {
+		file := &files.Files[i]
+
+		lines = append(lines, Ls(l, "Files")+": "+file.Name)
+		lines = append(lines, SplitLines(file.Contents)...)
+	}
+	if files.Harness != "" {
+		lines = append(lines, Ls(l, "Test harness")+": "+files.HarnessFile)
+		lines = append(lines, SplitLines(files.Harness)...)
+	}
+	if files.Interactor != "" {
+		var language string
+		if (files.InteractorLanguage >= 0) && (int(files.InteractorLanguage) < len(ProgrammingLanguages)) {
+			language = ProgrammingLanguages[files.InteractorLanguage].Name
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s (%s)", Ls(l, "Interactor"), files.InteractorFile, language))
+		lines = append(lines, SplitLines(files.Interactor)...)
+	}
+
+	return lines
+}
+
+func StepsEqual(a *Step, b *Step) bool {
+	al := StepLines(EN, a)
+	bl := StepLines(EN, b)
+
+	if len(al) != len(bl) {
+		return false
+	}
+	for i := 0; i < len(al); i++ {
+		if al[i] != bl[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/* GetSubjectSyncChanges returns changes, which differ between subject lesson and its course lesson. */
+func GetSubjectSyncChanges(lesson *Lesson, source *Lesson) []int {
+	defer trace.End(trace.Begin(""))
+
+	var changes []int
+
+	if lesson.Name != source.Name {
+		changes = append(changes, SubjectSyncName)
+	}
+	if lesson.Theory != source.Theory {
+		changes = append(changes, SubjectSyncTheory)
+	}
+	for i := 0; i < max(len(lesson.Steps), len(source.Steps)); i++ {
+		if (i >= len(lesson.Steps)) || (i >= len(source.Steps)) || (!StepsEqual(&lesson.Steps[i], &source.Steps[i])) {
+			changes = append(changes, SubjectSyncSteps+i)
+		}
+	}
+
+	return changes
+}
+
+/* GetSubjectSyncLessons returns linked lessons of a subject, which course lessons have newer published versions. */
+func GetSubjectSyncLessons(subject *Subject) ([]SubjectSyncLesson, error) {
+	defer trace.End(trace.Begin(""))
+
+	var lessons []SubjectSyncLesson
+
+	for i := 0; i < len(subject.Lessons); i++ {
+		/* NOTE(anton2920): lessons are read in place, because their strings point into 'Data'. */
+		lessons = append(lessons, SubjectSyncLesson{Index: i})
+		sl := &lessons[len(lessons)-1]
+
+		if err := GetLessonByID(subject.Lessons[i], &sl.Lesson); err != nil {
+			return nil, err
+		}
+		if sl.Lesson.SourceVersion == 0 {
+			lessons = lessons[:len(lessons)-1]
+			continue
+		}
+
+		if err := GetLessonByID(sl.Lesson.SourceID, &sl.Source); err != nil {
+			if err == database.NotFound {
+				lessons = lessons[:len(lessons)-1]
+				continue
+			}
+			return nil, err
+		}
+		if (sl.Source.ContainerType != LessonContainerCourse) || (sl.Source.Flags != LessonActive) || (sl.Source.Version <= sl.Lesson.SourceVersion) {
+			lessons = lessons[:len(lessons)-1]
+			continue
+		}
+	}
+
+	return lessons, nil
+}
+
+/*
+ * SyncLesson copies selected changes from course lesson. Steps, which are not selected, are kept as is. Submissions are not affected, because they have their own copies of steps.
+ * Lesson is marked as synced only when no changes are left, so declined ones are offered again.
+ */
+func SyncLesson(lesson *Lesson, source *Lesson, selected []bool) {
+	defer trace.End(trace.Begin(""))
+
+	if selected[SubjectSyncName] {
+		lesson.Name = source.Name
+	}
+	if selected[SubjectSyncTheory] {
+		lesson.Theory = source.Theory
+	}
+
+	n := max(len(lesson.Steps), len(source.Steps))
+	steps := make([]Step, 0, n)
+	for i := 0; i < n; i++ {
+		if selected[SubjectSyncSteps+i] {
+			if i < len(source.Steps) {
+				steps = append(steps, Step{})
+				StepDeepCopy(&steps[len(steps)-1], &source.Steps[i])
+			}
+		} else if i < len(lesson.Steps) {
+			steps = append(steps, lesson.Steps[i])
+		}
+	}
+	lesson.Steps = steps
+
+	if len(GetSubjectSyncChanges(lesson, source)) == 0 {
+		lesson.SourceVersion = source.Version
+	}
+}
+
+func DisplayDiff(w *http.Response, diff []DiffLine) {
+	w.WriteString(`<pre class="border rounded p-2">`)
+	for i := 0; i < len(diff); i++ {
+		line := &diff[i]
+
+		switch line.Op {
+		case DiffEqual:
+			w.WriteString(`  `)
+			w.WriteHTMLString(line.Text)
+		case DiffInsert:
+			w.WriteString(`<span class="text-success">+ `)
+			w.WriteHTMLString(line.Text)
+			w.WriteString(`</span>`)
+		case DiffDelete:
+			w.WriteString(`<span class="text-danger">- `)
+			w.WriteHTMLString(line.Text)
+			w.WriteString(`</span>`)
+		}
+		w.WriteString("\n")
+	}
+	w.WriteString(`</pre>`)
+}
+
+func DisplaySubjectSyncChange(w *http.Response, l Language, sl *SubjectSyncLesson, change int) {
+	defer trace.End(trace.Begin(""))
+
+	lesson := &sl.Lesson
+	source := &sl.Source
+
+	w.WriteString(`<div class="form-check">`)
+	w.WriteString(`<input class="form-check-input" type="checkbox" name="Change" value="`)
+	w.WriteInt(sl.Index)
+	w.WriteString(`.`)
+	w.WriteInt(change)
+	w.WriteString(`" checked> `)
+
+	switch change {
+	case SubjectSyncName:
+		w.WriteString(Ls(l, "Name"))
+		w.WriteString(`</div>`)
+		DisplayDiff(w, DiffLines([]string{lesson.Name}, []string{source.Name}))
+	case SubjectSyncTheory:
+		w.WriteString(Ls(l, "Theory"))
+		w.WriteString(`</div>`)
+		DisplayDiff(w, DiffLines(SplitLines(lesson.Theory), SplitLines(source.Theory)))
+	default:
+		i := change - SubjectSyncSteps
+
+		w.WriteString(Ls(l, "Step"))
+		w.WriteString(` #`)
+		w.WriteInt(i + 1)
+
+		var oldLines, newLines []string
+		if i < len(lesson.Steps) {
+			oldLines = StepLines(l, &lesson.Steps[i])
+		}
+		if i < len(source.Steps) {
+			newLines = StepLines(l, &source.Steps[i])
+		}
+
+		w.WriteString(` (`)
+		if oldLines == nil {
+			w.WriteString(Ls(l, "added"))
+		} else if newLines == nil {
+			w.WriteString(Ls(l, "removed"))
+		} else {
+			w.WriteString(Ls(l, "changed"))
+		}
+		w.WriteString(`)`)
+		w.WriteString(`</div>`)
+
+		DisplayDiff(w, DiffLines(oldLines, newLines))
+	}
+}
+
+func SubjectSyncMainPageHandler(w *http.Response, r *http.Request, session *Session, subject *Subject, lessons []SubjectSyncLesson, err error) error {
+	defer trace.End(trace.Begin(""))
+
+	const width = WidthLarge
+
+	DisplayHTMLStart(w)
+
+	DisplayHeadStart(w)
+	{
+		w.WriteString(`<title>`)
+		w.WriteString(Ls(GL, "Course updates"))
+		w.WriteString(`</title>`)
+	}
+	DisplayHeadEnd(w)
+
+	DisplayBodyStart(w)
+	{
+		DisplayHeader(w, GL, session)
+		DisplaySidebar(w, GL, session)
+
+		DisplayMainStart(w)
+
+		DisplayCrumbsStart(w, width)
+		{
+			DisplayCrumbsLinkID(w, "/subject", subject.ID, subject.Name)
+			DisplayCrumbsItem(w, GL, "Course updates")
+		}
+		DisplayCrumbsEnd(w)
+
+		DisplayFormPageStart(w, r, GL, width, "Course updates", string(r.URL.Path), err)
+		{
+			if len(lessons) == 0 {
+				w.WriteString(`<p>`)
+				w.WriteString(Ls(GL, "All lessons are up to date with their courses"))
+				w.WriteString(`</p>`)
+			}
+
+			for i := 0; i < len(lessons); i++ {
+				sl := &lessons[i]
+
+				DisplayFrameStart(w)
+
+				w.WriteString(`<p><b>`)
+				w.WriteString(Ls(GL, "Lesson"))
+				w.WriteString(` #`)
+				w.WriteInt(sl.Index + 1)
+				w.WriteString(`: `)
+				w.WriteHTMLString(sl.Lesson.Name)
+				w.WriteString(`</b></p>`)
+
+				changes := GetSubjectSyncChanges(&sl.Lesson, &sl.Source)
+				if len(changes) == 0 {
+					w.WriteString(`<p>`)
+					w.WriteString(Ls(GL, "No changes"))
+					w.WriteString(`</p>`)
+				}
+				for j := 0; j < len(changes); j++ {
+					DisplaySubjectSyncChange(w, GL, sl, changes[j])
+				}
+
+				DisplayFrameEnd(w)
+			}
+
+			if len(lessons) > 0 {
+				w.WriteString(`<p>`)
+				w.WriteString(Ls(GL, "Note: submissions, which have already been started, keep steps they were started with"))
+				w.WriteString(`</p>`)
+
+				DisplaySubmit(w, GL, "NextPage", "Apply selected changes", true)
+			}
+		}
+		DisplayFormPageEnd(w)
+		DisplayMainEnd(w)
+	}
+	DisplayBodyEnd(w)
+
+	DisplayHTMLEnd(w)
+	return nil
+}
+
+func SubjectSyncPageHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var subject Subject
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	subjectID, err := r.Form.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if err := GetSubjectByID(subjectID, &subject); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "subject with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+	if (session.ID != AdminID) && (session.ID != subject.TeacherID) {
+		return ForbiddenError
+	}
+
+	lessons, err := GetSubjectSyncLessons(&subject)
+	if err != nil {
+		return http.ServerError(err)
+	}
+
+	switch r.Form.Get("NextPage") {
+	default:
+		return SubjectSyncMainPageHandler(w, r, session, &subject, lessons, nil)
+	case Ls(GL, "Apply selected changes"):
+		/* selected[i][c] is true if change 'c' of lessons[i] must be applied. */
+		selected := make([][]bool, len(lessons))
+		for i := 0; i < len(lessons); i++ {
+			selected[i] = make([]bool, SubjectSyncSteps+max(len(lessons[i].Lesson.Steps), len(lessons[i].Source.Steps)))
+		}
+
+		changes := r.Form.GetMany("Change")
+		for i := 0; i < len(changes); i++ {
+			li, _, change, ssindex, err := GetIndicies(changes[i])
+			if (err != nil) || (ssindex == "") {
+				return http.ClientError(err)
+			}
+
+			/* NOTE(anton2920): course lesson may have been published again after page was displayed, in which case change is ignored. */
+			for j := 0; j < len(lessons); j++ {
+				if lessons[j].Index == li {
+					if (change < 0) || (change >= len(selected[j])) {
+						return http.ClientError(nil)
+					}
+					selected[j][change] = true
+					break
+				}
+			}
+		}
+
+		var tx Tx
+		for i := 0; i < len(lessons); i++ {
+			SyncLesson(&lessons[i].Lesson, &lessons[i].Source, selected[i])
+			if err := SaveLessonTx(&tx, &lessons[i].Lesson); err != nil {
+				return http.ServerError(err)
+			}
+		}
+		if err := CommitTx(&tx); err != nil {
+			return http.ServerError(err)
+		}
+
+		Audit(r, session.ID, "sync", "subject", subject.ID, "", fmt.Sprintf("%d changes", len(changes)))
+
+		w.Redirect(w.PathID("/subject/", subject.ID), http.StatusSeeOther)
+		return nil
+	}
+}
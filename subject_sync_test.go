@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/anton2920/gofa/net/http"
+)
+
+func TestDiffLines(t *testing.T) {
+	diff := DiffLines([]string{"a", "b", "c"}, []string{"a", "c", "d"})
+	expected := [...]DiffLine{{DiffEqual, "a"}, {DiffDelete, "b"}, {DiffEqual, "c"}, {DiffInsert, "d"}}
+
+	if len(diff) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, diff)
+	}
+	for i := 0; i < len(diff); i++ {
+		if diff[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, diff)
+			break
+		}
+	}
+}
+
+func testPublishCourseLesson(t *testing.T, theory string, removeSteps bool) {
+	t.Helper()
+
+	var lesson Lesson
+	if err := GetLessonByID(0, &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	lesson.Theory = theory
+	if removeSteps {
+		lesson.Steps = lesson.Steps[:1]
+	}
+	lesson.Version++
+	if err := SaveLesson(&lesson); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+}
+
+func TestSubjectSyncPageHandler(t *testing.T) {
+	const endpoint = "/subject/sync"
+
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	testPostAuth(t, "/subject/lessons", testTokens[AdminID], url.Values{"ID": {"0"}, "CourseID": {"0"}, "Action": {Ls(GL, "give as is")}}, http.StatusSeeOther)
+
+	var subject Subject
+	if err := GetSubjectByID(0, &subject); err != nil {
+		t.Fatalf("Failed to get subject: %v", err)
+	}
+	if lessons, err := GetSubjectSyncLessons(&subject); (err != nil) || (len(lessons) != 0) {
+		t.Fatalf("Expected no lessons to sync right after copy, got %d (%v)", len(lessons), err)
+	}
+
+	testPublishCourseLesson(t, "Updated introduction.", true)
+
+	lessons, err := GetSubjectSyncLessons(&subject)
+	if (err != nil) || (len(lessons) != 1) {
+		t.Fatalf("Expected one lesson to sync, got %d (%v)", len(lessons), err)
+	}
+	changes := GetSubjectSyncChanges(&lessons[0].Lesson, &lessons[0].Source)
+	if (len(changes) != 2) || (changes[0] != SubjectSyncTheory) || (changes[1] != SubjectSyncSteps+1) {
+		t.Fatalf("Expected theory and second step to change, got %v", changes)
+	}
+
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"0"}}, http.StatusOK)
+	testPostAuth(t, endpoint, testTokens[1], url.Values{"ID": {"0"}}, http.StatusForbidden)
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"a"}}, http.StatusBadRequest)
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"5"}}, http.StatusNotFound)
+	testPost(t, endpoint, url.Values{"ID": {"0"}}, http.StatusUnauthorized)
+
+	expectedBadRequest := [...]url.Values{
+		{"ID": {"0"}, "Change": {"a"}, "NextPage": {Ls(GL, "Apply selected changes")}},
+		{"ID": {"0"}, "Change": {"0"}, "NextPage": {Ls(GL, "Apply selected changes")}},
+		{"ID": {"0"}, "Change": {"0.10"}, "NextPage": {Ls(GL, "Apply selected changes")}},
+	}
+	for _, test := range expectedBadRequest {
+		testPostAuth(t, endpoint, testTokens[AdminID], test, http.StatusBadRequest)
+	}
+
+	/* Only theory is synced, removed step is kept. */
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"0"}, "Change": {"0.1"}, "NextPage": {Ls(GL, "Apply selected changes")}}, http.StatusSeeOther)
+
+	if err := GetSubjectByID(0, &subject); err != nil {
+		t.Fatalf("Failed to get subject: %v", err)
+	}
+	var lesson Lesson
+	if err := GetLessonByID(subject.Lessons[0], &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	if (lesson.Theory != "Updated introduction.") || (len(lesson.Steps) != 2) || (lesson.SourceVersion != 1) {
+		t.Errorf("Unexpected lesson after partial sync: theory %q, %d steps, source version %d", lesson.Theory, len(lesson.Steps), lesson.SourceVersion)
+	}
+
+	/* Declined change is still offered. */
+	lessons, err = GetSubjectSyncLessons(&subject)
+	if (err != nil) || (len(lessons) != 1) {
+		t.Fatalf("Expected lesson to still need sync, got %d (%v)", len(lessons), err)
+	}
+	if changes := GetSubjectSyncChanges(&lessons[0].Lesson, &lessons[0].Source); (len(changes) != 1) || (changes[0] != SubjectSyncSteps+1) {
+		t.Errorf("Expected only second step to be left, got %v", changes)
+	}
+
+	testPostAuth(t, endpoint, testTokens[AdminID], url.Values{"ID": {"0"}, "Change": {"0.3"}, "NextPage": {Ls(GL, "Apply selected changes")}}, http.StatusSeeOther)
+
+	if err := GetLessonByID(subject.Lessons[0], &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	if (len(lesson.Steps) != 1) || (lesson.SourceVersion != 2) {
+		t.Errorf("Unexpected lesson after sync: %d steps, source version %d", len(lesson.Steps), lesson.SourceVersion)
+	}
+	if lessons, err := GetSubjectSyncLessons(&subject); (err != nil) || (len(lessons) != 0) {
+		t.Errorf("Expected no lessons to sync after sync, got %d (%v)", len(lessons), err)
+	}
+}
+
+func TestStepsEqual(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	var lesson Lesson
+	if err := GetLessonByID(0, &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	a := lesson.Steps[1]
+	b := lesson.Steps[1]
+	if !StepsEqual(&a, &b) {
+		t.Fatalf("Expected copies of step to be equal")
+	}
+
+	task, _ := Step2Programming(&b)
+	task.Languages = 1
+	if StepsEqual(&a, &b) {
+		t.Errorf("Expected steps with different languages to differ")
+	}
+	task.Languages = 0
+
+	files := TaskFiles{HarnessFile: "harness.py", Harness: "print('PASS')"}
+	if err := SaveStepTaskFiles(task, &files); err != nil {
+		t.Fatalf("Failed to save task files: %v", err)
+	}
+	if StepsEqual(&a, &b) {
+		t.Errorf("Expected steps with different task files to differ")
+	}
+
+	c := b
+	if !StepsEqual(&b, &c) {
+		t.Errorf("Expected steps with the same task files to be equal")
+	}
+}
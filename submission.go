@@ -19,17 +19,6 @@ type (
 		SelectedAnswers []int
 	}
 
-	ProgrammingLanguage struct {
-		Name         string
-		Compiler     string
-		CompilerArgs []string
-		Runner       string
-		RunnerArgs   []string
-		SourceFile   string
-		Executable   string
-		Available    bool
-	}
-
 	SubmittedCommon struct {
 		Type   SubmittedType
 		Flags  SubmittedFlag
@@ -70,6 +59,12 @@ type (
 		FinishedAt     int64
 		SubmittedSteps []SubmittedStep
 
+		/* RejudgedAt is a time of the last rejudge, zero if submission was never rejudged. Previous score is a total score before it. */
+		RejudgedAt      int64
+		PreviousScore   int32
+		PreviousMaximum int32
+
+		Blob Blob
 		Data [16384]byte
 	}
 )
@@ -91,7 +86,7 @@ const (
 
 const (
 	SubmissionActive int32 = iota
-	_
+	SubmissionDeleted
 	SubmissionDraft
 )
 
@@ -100,20 +95,15 @@ const (
 	MaxSolutionLen = 1024
 )
 
+/* ProgrammingRunMaxDisplayLen is a maximum number of characters of program output displayed after custom run. */
+const ProgrammingRunMaxDisplayLen = 4096
+
 var (
 	stdc SubmittedCommon
 	stdt SubmittedTest
 	stdp SubmittedProgramming
 )
 
-var ProgrammingLanguages = []ProgrammingLanguage{
-	{"c", "cc", nil, "", nil, "main.c", "./a.out", true},
-	{"c++", "c++", nil, "", nil, "main.cpp", "./a.out", true},
-	{"go", "sh", []string{"-c", "/usr/local/bin/go-build"}, "", nil, "main.go", "./main", true},
-	{"php", "php", []string{"-l"}, "php", nil, "main.php", "", true},
-	{"python3", "python3", []string{"-c", `import ast; ast.parse(open("main.py").read())`}, "python3", nil, "main.py", "", true},
-}
-
 func Submitted2Test(submittedStep *SubmittedStep) (*SubmittedTest, error) {
 	defer trace.End(trace.Begin(""))
 
@@ -132,17 +122,22 @@ func Submitted2Programming(submittedStep *SubmittedStep) (*SubmittedProgramming,
 	return (*SubmittedProgramming)(unsafe.Pointer(submittedStep)), nil
 }
 
-func CreateSubmission(submission *Submission) error {
+func CreateSubmissionTx(tx *Tx, submission *Submission) error {
 	defer trace.End(trace.Begin(""))
 
-	var err error
+	submission.ID = NewIDTx(tx, SubmissionsDB)
 
-	submission.ID, err = database.IncrementNextID(SubmissionsDB)
-	if err != nil {
-		return fmt.Errorf("failed to increment submission ID: %w", err)
-	}
+	return SaveSubmissionTx(tx, submission)
+}
 
-	return SaveSubmission(submission)
+func CreateSubmission(submission *Submission) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := CreateSubmissionTx(&tx, submission); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
 }
 
 func DBSubmitted2Submitted(submittedStep *SubmittedStep, data *byte) {
@@ -189,11 +184,9 @@ func DBSubmitted2Submitted(submittedStep *SubmittedStep, data *byte) {
 
 }
 
-func DBSubmission2Submission(submission *Submission) {
+func DBSubmission2Submission(submission *Submission, data *byte) {
 	defer trace.End(trace.Begin(""))
 
-	data := &submission.Data[0]
-
 	slice := database.Offset2Slice(*(*[]byte)(unsafe.Pointer(&submission.SubmittedSteps)), data)
 	submission.SubmittedSteps = *(*[]SubmittedStep)(unsafe.Pointer(&slice))
 	for i := 0; i < len(submission.SubmittedSteps); i++ {
@@ -204,31 +197,91 @@ func DBSubmission2Submission(submission *Submission) {
 func GetSubmissionByID(id database.ID, submission *Submission) error {
 	defer trace.End(trace.Begin(""))
 
-	if err := database.Read(SubmissionsDB, id, unsafe.Pointer(submission), int(unsafe.Sizeof(*submission))); err != nil {
+	if err := DBRead(SubmissionsDB, id, unsafe.Pointer(submission), int(unsafe.Sizeof(*submission))); err != nil {
+		return err
+	}
+	if submission.ID != id {
+		return database.NotFound
+	}
+
+	data, err := GetBlobData(&submission.Blob, submission.Data[:])
+	if err != nil {
 		return err
 	}
 
-	DBSubmission2Submission(submission)
+	DBSubmission2Submission(submission, data)
 	return nil
 }
 
 func GetSubmissions(pos *int64, submissions []Submission) (int, error) {
 	defer trace.End(trace.Begin(""))
 
-	n, err := database.ReadMany(SubmissionsDB, pos, *(*[]byte)(unsafe.Pointer(&submissions)), int(unsafe.Sizeof(submissions[0])))
+	n, err := DBReadManyValid(SubmissionsDB, pos, submissions, func(submission *Submission) database.ID { return submission.ID })
 	if err != nil {
 		return 0, err
 	}
 
 	for i := 0; i < n; i++ {
-		DBSubmission2Submission(&submissions[i])
+		data, err := GetBlobData(&submissions[i].Blob, submissions[i].Data[:])
+		if err != nil {
+			return 0, err
+		}
+		DBSubmission2Submission(&submissions[i], data)
 	}
 	return n, nil
 }
 
+func DeleteSubmissionByIDTx(tx *Tx, id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	flags := SubmissionDeleted
+	var submission Submission
+
+	offset := int64(int(id)*int(unsafe.Sizeof(submission))) + database.DataOffset + int64(unsafe.Offsetof(submission.Flags))
+	tx.WriteAt(SubmissionsDB, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
+
+	tx.OnCommit(func() { UnindexSubmission(id) })
+	return nil
+}
+
+func SubmittedDataSize(submittedStep *SubmittedStep) int {
+	defer trace.End(trace.Begin(""))
+
+	size := StepDataSize(&submittedStep.Step) + DBStringSize(submittedStep.Error)
+
+	switch submittedStep.Type {
+	default:
+		panic("invalid step type")
+	case SubmittedTypeTest:
+		submittedTest, _ := Submitted2Test(submittedStep)
+
+		for i := 0; i < len(submittedTest.SubmittedQuestions); i++ {
+			size += DBSliceSize(submittedTest.SubmittedQuestions[i].SelectedAnswers)
+		}
+		size += DBSliceSize(submittedTest.SubmittedQuestions)
+		size += DBSliceSize(submittedTest.Scores)
+	case SubmittedTypeProgramming:
+		submittedTask, _ := Submitted2Programming(submittedStep)
+
+		size += DBStringSize(submittedTask.Solution)
+		for i := 0; i < 2; i++ {
+			size += DBSliceSize(submittedTask.Scores[i])
+			for j := 0; j < len(submittedTask.Messages[i]); j++ {
+				size += DBStringSize(submittedTask.Messages[i][j])
+			}
+			size += DBSliceSize(submittedTask.Messages[i])
+		}
+	}
+
+	return size
+}
+
+/* Submitted2DBSubmitted returns number of bytes written to 'data' starting at 'n'. */
 func Submitted2DBSubmitted(ds *SubmittedStep, ss *SubmittedStep, data []byte, n int) int {
 	defer trace.End(trace.Begin(""))
 
+	start := n
+
 	ds.Flags = ss.Flags
 	ds.Status = ss.Status
 
@@ -274,10 +327,23 @@ func Submitted2DBSubmitted(ds *SubmittedStep, ss *SubmittedStep, data []byte, n
 		}
 	}
 
-	return n
+	return n - start
 }
 
-func SaveSubmission(submission *Submission) error {
+func SubmissionDataSize(submission *Submission) int {
+	defer trace.End(trace.Begin(""))
+
+	var size int
+
+	for i := 0; i < len(submission.SubmittedSteps); i++ {
+		size += SubmittedDataSize(&submission.SubmittedSteps[i])
+	}
+	size += DBSliceSize(submission.SubmittedSteps)
+
+	return size
+}
+
+func SaveSubmissionTx(tx *Tx, submission *Submission) error {
 	defer trace.End(trace.Begin(""))
 
 	var submissionDB Submission
@@ -290,16 +356,40 @@ func SaveSubmission(submission *Submission) error {
 	submissionDB.LessonID = submission.LessonID
 	submissionDB.StartedAt = submission.StartedAt
 	submissionDB.FinishedAt = submission.FinishedAt
+	submissionDB.RejudgedAt = submission.RejudgedAt
+	submissionDB.PreviousScore = submission.PreviousScore
+	submissionDB.PreviousMaximum = submission.PreviousMaximum
+
+	data, err := GetDataBuffer(submissionDB.Data[:], SubmissionDataSize(submission))
+	if err != nil {
+		return err
+	}
 
-	/* TODO(anton2920): save up to a sizeof(lesson.Data). */
-	data := unsafe.Slice(&submissionDB.Data[0], len(submissionDB.Data))
 	submissionDB.SubmittedSteps = make([]SubmittedStep, len(submission.SubmittedSteps))
 	for i := 0; i < len(submission.SubmittedSteps); i++ {
 		n += Submitted2DBSubmitted(&submissionDB.SubmittedSteps[i], &submission.SubmittedSteps[i], data, n)
 	}
 	n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&submissionDB.SubmittedSteps)), *(*[]byte)(unsafe.Pointer(&submissionDB.SubmittedSteps)), int(unsafe.Sizeof(submissionDB.SubmittedSteps[0])), int(unsafe.Alignof(submissionDB.SubmittedSteps[0])), data, n)
 
-	return database.Write(SubmissionsDB, submissionDB.ID, unsafe.Pointer(&submissionDB), int(unsafe.Sizeof(submissionDB)))
+	if err := SaveBlob(&submissionDB.Blob, submissionDB.Data[:], data[:n]); err != nil {
+		return err
+	}
+
+	tx.Write(SubmissionsDB, submissionDB.ID, unsafe.Pointer(&submissionDB), int(unsafe.Sizeof(submissionDB)))
+
+	indexed := *submission
+	tx.OnCommit(func() { IndexSubmission(&indexed) })
+	return nil
+}
+
+func SaveSubmission(submission *Submission) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := SaveSubmissionTx(&tx, submission); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
 }
 
 func GetSubmittedStepScore(submittedStep *SubmittedStep) int {
@@ -355,12 +445,29 @@ func DisplaySubmittedStepScore(w *http.Response, l Language, submittedStep *Subm
 	w.WriteString(`</p>`)
 }
 
-func DisplaySubmissionTotalScore(w *http.Response, submission *Submission) {
+/* GetSubmissionScore returns total score of a submission and its maximum. */
+func GetSubmissionScore(submission *Submission) (int, int) {
+	defer trace.End(trace.Begin(""))
+
 	var score, maximum int
 	for i := 0; i < len(submission.SubmittedSteps); i++ {
 		score += GetSubmittedStepScore(&submission.SubmittedSteps[i])
 		maximum += GetStepMaximumScore(&submission.SubmittedSteps[i].Step)
 	}
+	return score, maximum
+}
+
+/* GetSubmissionPercent returns total score of a submission in percents. Submissions without scored steps get 100%. */
+func GetSubmissionPercent(submission *Submission) int {
+	score, maximum := GetSubmissionScore(submission)
+	if maximum == 0 {
+		return 100
+	}
+	return score * 100 / maximum
+}
+
+func DisplaySubmissionTotalScore(w *http.Response, submission *Submission) {
+	score, maximum := GetSubmissionScore(submission)
 
 	w.WriteInt(score)
 	w.WriteString(`/`)
@@ -373,8 +480,12 @@ func DisplaySubmissionLanguageSelect(w *http.Response, submittedTask *SubmittedP
 		w.WriteString(` disabled`)
 	}
 	w.WriteString(`>`)
+	task, _ := Step2Programming(&submittedTask.Step)
 	for i := database.ID(0); i < database.ID(len(ProgrammingLanguages)); i++ {
 		lang := &ProgrammingLanguages[i]
+		if (enabled) && ((!lang.Available) || (!ProgrammingLanguageAccepted(task, i))) {
+			continue
+		}
 
 		w.WriteString(`<option value="`)
 		w.WriteInt(int(i))
@@ -384,6 +495,11 @@ func DisplaySubmissionLanguageSelect(w *http.Response, submittedTask *SubmittedP
 		}
 		w.WriteString(`>`)
 		w.WriteString(lang.Name)
+		if lang.Version != "" {
+			w.WriteString(` (`)
+			w.WriteHTMLString(lang.Version)
+			w.WriteString(`)`)
+		}
 		w.WriteString(`</option>`)
 	}
 	w.WriteString(`</select>`)
@@ -434,6 +550,14 @@ func DisplaySubmissionLink(w *http.Response, l Language, submission *Submission)
 		w.WriteString(`</i>`)
 	case SubmissionCheckDone:
 		DisplaySubmissionTotalScore(w, submission)
+		if submission.RejudgedAt != 0 {
+			w.WriteString(`, `)
+			w.WriteString(Ls(l, "was"))
+			w.WriteString(` `)
+			w.WriteInt(int(submission.PreviousScore))
+			w.WriteString(`/`)
+			w.WriteInt(int(submission.PreviousMaximum))
+		}
 	}
 	w.WriteString(`)`)
 	w.WriteString(`</a>`)
@@ -497,8 +621,8 @@ func SubmissionPageHandler(w *http.Response, r *http.Request) error {
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
-		DisplaySidebarWithLessons(w, GL, session, subject.Lessons)
+		DisplayHeader(w, GL, session)
+		DisplaySidebarWithLessons(w, GL, session, subject.Lessons, GetStudentLessonStates(session.ID, &subject))
 
 		DisplayMainStart(w)
 
@@ -529,6 +653,8 @@ func SubmissionPageHandler(w *http.Response, r *http.Request) error {
 			DisplayFormattedTime(w, submission.FinishedAt)
 			w.WriteString(`</p>`)
 
+			DisplaySubmissionRejudgeInfo(w, GL, &submission)
+
 			w.WriteString(`<form method="POST" action="/submission/results">`)
 
 			DisplayHiddenID(w, "ID", id)
@@ -569,14 +695,16 @@ func SubmissionPageHandler(w *http.Response, r *http.Request) error {
 						w.WriteString(Ls(GL, "Pending"))
 						w.WriteString(` `)
 						w.WriteString(Ls(GL, "verification"))
-						w.WriteString(`...`)
+						w.WriteString(`... `)
+						DisplayVerifyStepProgress(w, i)
 						w.WriteString(`</i></p>`)
 					case SubmissionCheckInProgress:
 						w.WriteString(`<p><i>`)
 						w.WriteString(Ls(GL, "Verification"))
 						w.WriteString(` `)
 						w.WriteString(Ls(GL, "in progress"))
-						w.WriteString(`...`)
+						w.WriteString(`... `)
+						DisplayVerifyStepProgress(w, i)
 						w.WriteString(`</i></p>`)
 					case SubmissionCheckDone:
 						DisplaySubmittedStepScore(w, GL, submittedStep)
@@ -614,11 +742,16 @@ func SubmissionPageHandler(w *http.Response, r *http.Request) error {
 				DisplaySubmissionTotalScore(w, &submission)
 				w.WriteString(`</p>`)
 				if teacher {
+					DisplaySubmissionRejudgeRefresh(w, GL)
 					DisplayCommand(w, GL, "Re-check")
 				}
 			}
 
 			w.WriteString(`</form>`)
+
+			if submission.Status != SubmissionCheckDone {
+				DisplayVerifyJobProgress(w, GL, submission.ID)
+			}
 		}
 		DisplayPageEnd(w)
 		DisplayMainEnd(w)
@@ -652,8 +785,8 @@ func SubmissionResultsTestPageHandler(w *http.Response, r *http.Request, session
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
-		DisplaySidebarWithLessons(w, GL, session, subject.Lessons)
+		DisplayHeader(w, GL, session)
+		DisplaySidebarWithLessons(w, GL, session, subject.Lessons, GetStudentLessonStates(session.ID, subject))
 
 		DisplayMainStart(w)
 
@@ -832,8 +965,8 @@ func SubmissionResultsProgrammingPageHandler(w *http.Response, r *http.Request,
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
-		DisplaySidebarWithLessons(w, GL, session, subject.Lessons)
+		DisplayHeader(w, GL, session)
+		DisplaySidebarWithLessons(w, GL, session, subject.Lessons, GetStudentLessonStates(session.ID, subject))
 
 		DisplayMainStart(w)
 
@@ -982,28 +1115,28 @@ func SubmissionResultsPageHandler(w *http.Response, r *http.Request) error {
 
 				return SubmissionResultsStepPageHandler(w, r, session, &subject, &lesson, &submission, submittedStep)
 			case Ls(GL, "Re-check"):
+				if r.Form.Get("Teacher") == "" {
+					return ForbiddenError
+				}
+				/* NOTE(anton2920): verifier would overwrite results of a new check with ones of a previous check. */
+				if submission.Status != SubmissionCheckDone {
+					return http.BadRequest("%s", Ls(GL, "submission is still being verified"))
+				}
+
+				si := -1
 				if spindex != "" {
 					if (pindex < 0) || (pindex >= len(submission.SubmittedSteps)) {
 						return http.ClientError(nil)
 					}
-					submittedStep := &submission.SubmittedSteps[pindex]
-
-					submission.Status = SubmissionCheckPending
-					submittedStep.Status = SubmissionCheckPending
-					submittedStep.Error = ""
-				} else {
-					submission.Status = SubmissionCheckPending
-					for i := 0; i < len(submission.SubmittedSteps); i++ {
-						submittedStep := &submission.SubmittedSteps[i]
-						submittedStep.Status = SubmissionCheckPending
-						submittedStep.Error = ""
-					}
+					si = pindex
 				}
+				SubmissionRejudge(&submission, &lesson, si, r.Form.Get("Refresh") != "")
 				if err := SaveSubmission(&submission); err != nil {
 					return http.ServerError(err)
 				}
 
-				SubmissionVerifyChannel <- submission.ID
+				SubmissionVerifyEnqueue(submission.ID)
+				Audit(r, session.ID, "rejudge", "submission", submission.ID, AuditScoreSummary(int(submission.PreviousScore), int(submission.PreviousMaximum)), fmt.Sprintf("step %d", si))
 
 				w.Redirect(w.PathID("/submission/", submission.ID), http.StatusSeeOther)
 				return nil
@@ -1047,6 +1180,9 @@ func SubmissionNewVerify(l Language, submission *Submission) error {
 	if empty {
 		return http.BadRequest("%s", Ls(l, "you have to pass at least one step"))
 	}
+	if SubmissionDataSize(submission) > MaxBlobLen {
+		return http.BadRequest(Ls(l, "submission is too large, maximum size is %d bytes"), MaxBlobLen)
+	}
 	return nil
 }
 
@@ -1123,7 +1259,7 @@ func SubmissionNewTestPageHandler(w *http.Response, r *http.Request, session *Se
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -1239,6 +1375,10 @@ func SubmissionNewProgrammingVerify(submittedTask *SubmittedProgramming, l Langu
 	if !ProgrammingLanguages[submittedTask.LanguageID].Available {
 		return http.BadRequest("%s", Ls(l, "selected language is not available"))
 	}
+	task, _ := Step2Programming(&submittedTask.Step)
+	if !ProgrammingLanguageAccepted(task, submittedTask.LanguageID) {
+		return http.BadRequest("%s", Ls(l, "selected language is not accepted by this task"))
+	}
 
 	if !strings.LengthInRange(submittedTask.Solution, MinSolutionLen, MaxSolutionLen) {
 		return http.BadRequest(Ls(l, "solution length must be between %d and %d characters long"), MinSolutionLen, MaxSolutionLen)
@@ -1281,12 +1421,51 @@ func SubmissionNewDisplayProgrammingChecks(w *http.Response, l Language, task *S
 	w.WriteString(`</ol>`)
 }
 
-func SubmissionNewProgrammingPageHandler(w *http.Response, r *http.Request, session *Session, subject *Subject, lesson *Lesson, submittedTask *SubmittedProgramming, err error) error {
+func SubmissionNewDisplayProgrammingRun(w *http.Response, l Language, run *ProgrammingRun) {
+	defer trace.End(trace.Begin(""))
+
+	w.WriteString(`<h4>`)
+	w.WriteString(Ls(l, "Result"))
+	w.WriteString(`</h4>`)
+
+	w.WriteString(`<p>`)
+	w.WriteString(Ls(l, "Exit code"))
+	w.WriteString(`: `)
+	w.WriteInt(run.ExitCode)
+	w.WriteString(`</p>`)
+
+	w.WriteString(`<p>`)
+	w.WriteString(Ls(l, "Time"))
+	w.WriteString(`: `)
+	w.WriteInt(int(run.Duration.Milliseconds()))
+	w.WriteString(` `)
+	w.WriteString(Ls(l, "ms"))
+	w.WriteString(`</p>`)
+
+	DisplayLabel(w, l, "Standard output")
+	w.WriteString(`<textarea class="form-control" rows="5" readonly>`)
+	DisplayShortenedString(w, run.Stdout, ProgrammingRunMaxDisplayLen)
+	w.WriteString(`</textarea>`)
+	w.WriteString(`<br>`)
+
+	DisplayLabel(w, l, "Standard error")
+	w.WriteString(`<textarea class="form-control" rows="5" readonly>`)
+	DisplayShortenedString(w, run.Stderr, ProgrammingRunMaxDisplayLen)
+	w.WriteString(`</textarea>`)
+	w.WriteString(`<br>`)
+}
+
+func SubmissionNewProgrammingPageHandler(w *http.Response, r *http.Request, session *Session, subject *Subject, lesson *Lesson, submittedTask *SubmittedProgramming, run *ProgrammingRun, err error) error {
 	defer trace.End(trace.Begin(""))
 
 	const width = WidthLarge
 
+	var files TaskFiles
+
 	task, _ := Step2Programming(&submittedTask.Step)
+	if err := GetStepTaskFiles(task, &files); err != nil {
+		return http.ServerError(err)
+	}
 
 	DisplayHTMLStart(w)
 
@@ -1302,7 +1481,7 @@ func SubmissionNewProgrammingPageHandler(w *http.Response, r *http.Request, sess
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -1344,6 +1523,8 @@ func SubmissionNewProgrammingPageHandler(w *http.Response, r *http.Request, sess
 			w.WriteString(`</h4>`)
 			SubmissionNewDisplayProgrammingChecks(w, GL, task, CheckTypeExample)
 
+			DisplayTaskFiles(w, GL, &files)
+
 			w.WriteString(`<h4>`)
 			w.WriteString(Ls(GL, "Solution"))
 			w.WriteString(`</h4>`)
@@ -1354,11 +1535,23 @@ func SubmissionNewProgrammingPageHandler(w *http.Response, r *http.Request, sess
 			w.WriteString(`<br>`)
 
 			w.WriteString(`<textarea class="form-control" rows="10" name="Solution">`)
-			w.WriteHTMLString(submittedTask.Solution)
+			w.WriteHTMLString(strings.Or(submittedTask.Solution, files.StarterCode))
+			w.WriteString(`</textarea>`)
+			w.WriteString(`<br>`)
+
+			DisplayLabel(w, GL, "Input")
+			w.WriteString(`<textarea class="form-control" rows="3" name="Input">`)
+			w.WriteHTMLString(r.Form.Get("Input"))
 			w.WriteString(`</textarea>`)
+			w.WriteString(`<br>`)
 
+			DisplaySubmit(w, GL, "NextPage", "Run", true)
 			w.WriteString(`<br><br>`)
 
+			if run != nil {
+				SubmissionNewDisplayProgrammingRun(w, GL, run)
+			}
+
 			DisplaySubmit(w, GL, "NextPage", "Save", true)
 			DisplaySubmit(w, GL, "NextPage", "Discard", true)
 		}
@@ -1372,6 +1565,28 @@ func SubmissionNewProgrammingPageHandler(w *http.Response, r *http.Request, sess
 	return nil
 }
 
+/* SubmissionNewProgrammingRun runs solution of a student with custom input. */
+func SubmissionNewProgrammingRun(l Language, userID database.ID, submittedTask *SubmittedProgramming, input string, run *ProgrammingRun) error {
+	defer trace.End(trace.Begin(""))
+
+	if err := SubmissionNewProgrammingVerify(submittedTask, l); err != nil {
+		return err
+	}
+	if len(input) > MaxCheckLen {
+		return http.BadRequest(Ls(l, "input length must not exceed %d characters"), MaxCheckLen)
+	}
+
+	if err := ProgrammingRunAcquire(l, userID); err != nil {
+		return err
+	}
+	defer ProgrammingRunRelease()
+
+	if err := SubmissionRunProgramming(l, submittedTask, input, run); err != nil {
+		return http.BadRequest("%v", err)
+	}
+	return nil
+}
+
 func SubmissionNewStepVerify(l Language, submittedStep *SubmittedStep) error {
 	defer trace.End(trace.Begin(""))
 
@@ -1387,7 +1602,7 @@ func SubmissionNewStepVerify(l Language, submittedStep *SubmittedStep) error {
 			return err
 		}
 
-		if err := SubmissionVerifyProgramming(GL, submittedTask, CheckTypeExample); err != nil {
+		if err := SubmissionVerifyProgramming(GL, submittedTask, CheckTypeExample, nil); err != nil {
 			return http.BadRequest("%v", err)
 		}
 
@@ -1413,7 +1628,7 @@ func SubmissionNewStepPageHandler(w *http.Response, r *http.Request, session *Se
 		return SubmissionNewTestPageHandler(w, r, session, subject, lesson, submittedTest, err)
 	case SubmittedTypeProgramming:
 		submittedTask, _ := Submitted2Programming(submittedStep)
-		return SubmissionNewProgrammingPageHandler(w, r, session, subject, lesson, submittedTask, err)
+		return SubmissionNewProgrammingPageHandler(w, r, session, subject, lesson, submittedTask, nil, err)
 	}
 }
 
@@ -1438,7 +1653,7 @@ func SubmissionNewMainPageHandler(w *http.Response, r *http.Request, session *Se
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -1578,6 +1793,15 @@ func SubmissionNewPageHandler(w *http.Response, r *http.Request) error {
 	if who != SubjectUserStudent {
 		return ForbiddenError
 	}
+	if lesson.RequiredScore > 0 {
+		states, err := GetUserLessonStates(session.ID, subject.Lessons)
+		if err != nil {
+			return http.ServerError(err)
+		}
+		if err := LessonCheckUnlocked(GL, subject.Lessons, states, &lesson); err != nil {
+			return err
+		}
+	}
 
 	submissionIndex := r.Form.Get("SubmissionIndex")
 	if submissionIndex == "" {
@@ -1590,12 +1814,17 @@ func SubmissionNewPageHandler(w *http.Response, r *http.Request) error {
 			submittedStep := &submission.SubmittedSteps[i]
 			StepDeepCopy(&submittedStep.Step, &lesson.Steps[i])
 		}
-		if err := CreateSubmission(&submission); err != nil {
+		var tx Tx
+		if err := CreateSubmissionTx(&tx, &submission); err != nil {
 			return http.ServerError(err)
 		}
 
 		lesson.Submissions = append(lesson.Submissions, submission.ID)
-		if err := SaveLesson(&lesson); err != nil {
+		if err := SaveLessonTx(&tx, &lesson); err != nil {
+			return http.ServerError(err)
+		}
+
+		if err := CommitTx(&tx); err != nil {
 			return http.ServerError(err)
 		}
 		r.Form.SetInt("SubmissionIndex", len(lesson.Submissions)-1)
@@ -1610,6 +1839,8 @@ func SubmissionNewPageHandler(w *http.Response, r *http.Request) error {
 	}
 	defer SaveSubmission(&submission)
 
+	/* NOTE(anton2920): steps are copied into submission when it's started, so lesson may be changed (e.g. synced with a course) while submission is in progress. */
+
 	for i := 0; i < len(r.Form.Keys); i++ {
 		k := r.Form.Keys[i]
 
@@ -1628,7 +1859,7 @@ func SubmissionNewPageHandler(w *http.Response, r *http.Request) error {
 	/* 'currentPage' is the page to save before leaving it. */
 	switch currentPage {
 	case "Test":
-		si, err := GetValidIndex(r.Form.Get("StepIndex"), len(lesson.Steps))
+		si, err := GetValidIndex(r.Form.Get("StepIndex"), len(submission.SubmittedSteps))
 		if err != nil {
 			return http.ClientError(err)
 		}
@@ -1642,7 +1873,7 @@ func SubmissionNewPageHandler(w *http.Response, r *http.Request) error {
 			return SubmissionNewTestPageHandler(w, r, session, &subject, &lesson, submittedTest, err)
 		}
 	case "Programming":
-		si, err := GetValidIndex(r.Form.Get("StepIndex"), len(lesson.Steps))
+		si, err := GetValidIndex(r.Form.Get("StepIndex"), len(submission.SubmittedSteps))
 		if err != nil {
 			return http.ClientError(err)
 		}
@@ -1653,7 +1884,7 @@ func SubmissionNewPageHandler(w *http.Response, r *http.Request) error {
 			return http.ClientError(err)
 		}
 		if err := SubmissionNewProgrammingFillFromRequest(r.Form, submittedTask); err != nil {
-			return SubmissionNewProgrammingPageHandler(w, r, session, &subject, &lesson, submittedTask, err)
+			return SubmissionNewProgrammingPageHandler(w, r, session, &subject, &lesson, submittedTask, nil, err)
 		}
 	}
 
@@ -1661,7 +1892,7 @@ func SubmissionNewPageHandler(w *http.Response, r *http.Request) error {
 	default:
 		return SubmissionNewMainPageHandler(w, r, session, &subject, &lesson, &submission, nil)
 	case Ls(GL, "Save"):
-		si, err := GetValidIndex(r.Form.Get("StepIndex"), len(lesson.Steps))
+		si, err := GetValidIndex(r.Form.Get("StepIndex"), len(submission.SubmittedSteps))
 		if err != nil {
 			return http.ClientError(err)
 		}
@@ -1673,8 +1904,24 @@ func SubmissionNewPageHandler(w *http.Response, r *http.Request) error {
 		submittedStep.Flags = SubmittedStepPassed
 
 		return SubmissionNewMainPageHandler(w, r, session, &subject, &lesson, &submission, nil)
+	case Ls(GL, "Run"):
+		var run ProgrammingRun
+
+		si, err := GetValidIndex(r.Form.Get("StepIndex"), len(submission.SubmittedSteps))
+		if err != nil {
+			return http.ClientError(err)
+		}
+		submittedTask, err := Submitted2Programming(&submission.SubmittedSteps[si])
+		if err != nil {
+			return http.ClientError(err)
+		}
+
+		if err := SubmissionNewProgrammingRun(GL, session.ID, submittedTask, r.Form.Get("Input"), &run); err != nil {
+			return SubmissionNewProgrammingPageHandler(w, r, session, &subject, &lesson, submittedTask, nil, err)
+		}
+		return SubmissionNewProgrammingPageHandler(w, r, session, &subject, &lesson, submittedTask, &run, nil)
 	case Ls(GL, "Discard"):
-		si, err := GetValidIndex(r.Form.Get("StepIndex"), len(lesson.Steps))
+		si, err := GetValidIndex(r.Form.Get("StepIndex"), len(submission.SubmittedSteps))
 		if err != nil {
 			return http.ClientError(err)
 		}
@@ -1693,7 +1940,8 @@ func SubmissionNewPageHandler(w *http.Response, r *http.Request) error {
 		if err := SaveSubmission(&submission); err != nil {
 			return http.ServerError(err)
 		}
-		SubmissionVerifyChannel <- submission.ID
+		SubmissionVerifyEnqueue(submission.ID)
+		Audit(r, session.ID, "submit", "submission", submission.ID, "", AuditLessonSummary(&lesson))
 
 		w.Redirect(w.PathID("/lesson/", lessonID), http.StatusSeeOther)
 		return nil
@@ -3,7 +3,9 @@ package main
 import (
 	"net/url"
 	"testing"
+	"time"
 
+	"github.com/anton2920/gofa/database"
 	"github.com/anton2920/gofa/net/http"
 )
 
@@ -81,3 +83,58 @@ func TestSubmissionNewPageHandler(t *testing.T) {
 
 	testPostAuth(t, endpoint, testTokens[1], url.Values{"ID": {"3"}}, http.StatusForbidden)
 }
+
+func TestProgrammingRunAcquire(t *testing.T) {
+	const userID = 100
+
+	if err := ProgrammingRunAcquire(GL, userID); err != nil {
+		t.Fatalf("Expected first run to be allowed, got error %v", err)
+	}
+	ProgrammingRunRelease()
+	if err := ProgrammingRunAcquire(GL, userID); err == nil {
+		t.Errorf("Expected repeated run to be rate limited")
+	}
+
+	for i := 0; i < cap(ProgrammingRunSlots); i++ {
+		if err := ProgrammingRunAcquire(GL, database.ID(userID+1+i)); err != nil {
+			t.Fatalf("Expected run %d to be allowed, got error %v", i, err)
+		}
+	}
+	if err := ProgrammingRunAcquire(GL, database.ID(userID+1+cap(ProgrammingRunSlots))); err == nil {
+		t.Errorf("Expected run to be rejected when all slots are taken")
+	}
+	for i := 0; i < cap(ProgrammingRunSlots); i++ {
+		ProgrammingRunRelease()
+	}
+
+	ProgrammingRunLock.Lock()
+	ProgrammingRunLastRuns[userID] = time.Now().Add(-time.Duration(Config.ProgrammingRunInterval))
+	ProgrammingRunLock.Unlock()
+	if err := ProgrammingRunAcquire(GL, userID-1); err != nil {
+		t.Fatalf("Expected run after interval to be allowed, got error %v", err)
+	}
+	ProgrammingRunRelease()
+	ProgrammingRunLock.Lock()
+	if _, ok := ProgrammingRunLastRuns[userID]; ok {
+		t.Errorf("Expected expired entries to be pruned")
+	}
+	delete(ProgrammingRunLastRuns, userID-1)
+	for i := 0; i <= cap(ProgrammingRunSlots)+1; i++ {
+		delete(ProgrammingRunLastRuns, database.ID(userID+i))
+	}
+	ProgrammingRunLock.Unlock()
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := LimitedBuffer{Limit: 4}
+
+	if n, err := b.Write([]byte("abc")); (n != 3) || (err != nil) {
+		t.Errorf("Expected 3 bytes to be written, got %d, %v", n, err)
+	}
+	if n, err := b.Write([]byte("defgh")); (n != 5) || (err != nil) {
+		t.Errorf("Expected discarded bytes to be reported as written, got %d, %v", n, err)
+	}
+	if b.String() != "abcd" {
+		t.Errorf("Expected %q, got %q", "abcd", b.String())
+	}
+}
@@ -2,19 +2,24 @@ package main
 
 import (
 	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"sync/atomic"
 	sys "syscall"
 	"time"
+	"unicode/utf8"
 	"unsafe"
 
 	"github.com/anton2920/gofa/database"
 	"github.com/anton2920/gofa/jail"
 	"github.com/anton2920/gofa/log"
+	"github.com/anton2920/gofa/net/http"
 	"github.com/anton2920/gofa/syscall"
 	"github.com/anton2920/gofa/trace"
 )
@@ -27,8 +32,53 @@ const (
 	SubmissionCheckDone
 )
 
+/* ProgrammingRun is a result of running solution with custom input. */
+type ProgrammingRun struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Duration time.Duration
+}
+
+/* ProgrammingRunInterval is a default minimal interval between runs of the same user. */
+const ProgrammingRunInterval = 5 * time.Second
+
+var (
+	ProgrammingRunLastRuns = make(map[database.ID]time.Time)
+	ProgrammingRunLock     sync.Mutex
+
+	/* ProgrammingRunSlots limits number of custom runs executed at the same time. */
+	ProgrammingRunSlots = make(chan struct{}, 4)
+)
+
+/* ProgrammingRunMaxOutputLen is a maximum number of bytes of program output kept after custom run. It is enough to display 'ProgrammingRunMaxDisplayLen' characters of any UTF-8 text. */
+const ProgrammingRunMaxOutputLen = ProgrammingRunMaxDisplayLen * utf8.UTFMax
+
+/* LimitedBuffer keeps first 'Limit' bytes written to it and silently discards the rest, so program is not killed by closed pipe. */
+type LimitedBuffer struct {
+	bytes.Buffer
+	Limit int
+}
+
+func (b *LimitedBuffer) Write(p []byte) (int, error) {
+	if left := b.Limit - b.Len(); left > 0 {
+		if len(p) > left {
+			b.Buffer.Write(p[:left])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
 var SubmissionVerifyChannel = make(chan database.ID, 128)
 
+/* SubmissionVerifyQuit is closed to stop worker after current job. Worker closes SubmissionVerifyStopped when it exits. */
+var (
+	SubmissionVerifyQuit    = make(chan struct{})
+	SubmissionVerifyStopped = make(chan struct{})
+)
+
 func SubmissionVerifyTest(submittedTest *SubmittedTest) error {
 	defer trace.End(trace.Begin(""))
 
@@ -68,7 +118,7 @@ func SubmissionVerifyTest(submittedTest *SubmittedTest) error {
 	return nil
 }
 
-func PutProgrammingSource(buffer []byte, j jail.Jail, lang *ProgrammingLanguage) int {
+func PutProgrammingFile(buffer []byte, j jail.Jail, name string) int {
 	defer trace.End(trace.Begin(""))
 
 	var n int
@@ -78,11 +128,15 @@ func PutProgrammingSource(buffer []byte, j jail.Jail, lang *ProgrammingLanguage)
 	buffer[n] = '/'
 	n++
 
-	n += copy(buffer[n:], lang.SourceFile)
+	n += copy(buffer[n:], name)
 
 	return n
 }
 
+func PutProgrammingSource(buffer []byte, j jail.Jail, lang *ProgrammingLanguage) int {
+	return PutProgrammingFile(buffer, j, lang.SourceFile)
+}
+
 func PutProgrammingExecutable(buffer []byte, j jail.Jail, lang *ProgrammingLanguage) int {
 	defer trace.End(trace.Begin(""))
 
@@ -98,33 +152,77 @@ func PutProgrammingExecutable(buffer []byte, j jail.Jail, lang *ProgrammingLangu
 	return n
 }
 
-func SubmissionVerifyProgrammingCreateSource(j jail.Jail, lang *ProgrammingLanguage, solution string) error {
+func SubmissionVerifyProgrammingCreateFile(j jail.Jail, name string, contents string) error {
 	defer trace.End(trace.Begin(""))
 
 	buffer := make([]byte, syscall.PATH_MAX)
-	n := PutProgrammingSource(buffer, j, lang)
-	source := unsafe.String(unsafe.SliceData(buffer), n)
+	n := PutProgrammingFile(buffer, j, name)
+	path := unsafe.String(unsafe.SliceData(buffer), n)
 
-	fd, err := syscall.Open(source, syscall.O_WRONLY|syscall.O_CREAT, 0644)
+	fd, err := syscall.Open(path, syscall.O_WRONLY|syscall.O_CREAT, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to create source file: %w", err)
+		return fmt.Errorf("failed to create file %q: %w", name, err)
 	}
 
-	if _, err := syscall.Write(fd, unsafe.Slice(unsafe.StringData(solution), len(solution))); err != nil {
+	if _, err := syscall.Write(fd, unsafe.Slice(unsafe.StringData(contents), len(contents))); err != nil {
 		if err := syscall.Close(fd); err != nil {
-			log.Warnf("Failed to close source file: %v", err)
+			log.Warnf("Failed to close file %q: %v", name, err)
 		}
-		return fmt.Errorf("failed to write data to a source file: %w", err)
+		return fmt.Errorf("failed to write data to a file %q: %w", name, err)
 	}
 
 	if err := syscall.Close(fd); err != nil {
-		log.Warnf("Failed to close a source file: %v", err)
+		log.Warnf("Failed to close a file %q: %v", name, err)
 	}
 
 	return nil
 }
 
-func SubmissionVerifyProgrammingCleanup(j jail.Jail, lang *ProgrammingLanguage) error {
+func SubmissionVerifyProgrammingCreateSource(j jail.Jail, lang *ProgrammingLanguage, solution string) error {
+	return SubmissionVerifyProgrammingCreateFile(j, lang.SourceFile, solution)
+}
+
+/* SubmissionVerifyProgrammingCreateFiles puts helper files and harness of a task next to source. Harness of interpreted languages is created before each run instead, see 'SubmissionVerifyProgrammingHarnessCheck'. */
+func SubmissionVerifyProgrammingCreateFiles(j jail.Jail, lang *ProgrammingLanguage, files *TaskFiles) error {
+	defer trace.End(trace.Begin(""))
+
+	for i := 0; i < len(files.Files); i++ {
+		file := &files.Files[i]
+		if file.Name == lang.SourceFile {
+			return fmt.Errorf("file %q conflicts with source file of %s", file.Name, lang.Name)
+		}
+		if err := SubmissionVerifyProgrammingCreateFile(j, file.Name, file.Contents); err != nil {
+			return err
+		}
+	}
+
+	if files.HarnessFile != "" {
+		if files.HarnessFile == lang.SourceFile {
+			return fmt.Errorf("harness file %q conflicts with source file of %s", files.HarnessFile, lang.Name)
+		}
+		if lang.Runner == "" {
+			if err := SubmissionVerifyProgrammingCreateFile(j, files.HarnessFile, files.Harness); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func SubmissionVerifyProgrammingUnlink(buffer []byte, j jail.Jail, name string) error {
+	n := PutProgrammingFile(buffer, j, name)
+	path := unsafe.String(unsafe.SliceData(buffer), n)
+
+	if err := syscall.Unlink(path); err != nil {
+		if err.(syscall.Error).Errno != syscall.ENOENT {
+			return fmt.Errorf("failed to remove file %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func SubmissionVerifyProgrammingCleanup(j jail.Jail, lang *ProgrammingLanguage, files *TaskFiles) error {
 	defer trace.End(trace.Begin(""))
 
 	var err error
@@ -139,6 +237,19 @@ func SubmissionVerifyProgrammingCleanup(j jail.Jail, lang *ProgrammingLanguage)
 		}
 	}
 
+	if files != nil {
+		for i := 0; i < len(files.Files); i++ {
+			if err1 := SubmissionVerifyProgrammingUnlink(buffer, j, files.Files[i].Name); err1 != nil {
+				err = errors.Join(err, err1)
+			}
+		}
+		if files.HarnessFile != "" {
+			if err1 := SubmissionVerifyProgrammingUnlink(buffer, j, files.HarnessFile); err1 != nil {
+				err = errors.Join(err, err1)
+			}
+		}
+	}
+
 	if lang.Executable != "" {
 		n = PutProgrammingExecutable(buffer, j, lang)
 		executable := unsafe.String(unsafe.SliceData(buffer), n)
@@ -150,7 +261,7 @@ func SubmissionVerifyProgrammingCleanup(j jail.Jail, lang *ProgrammingLanguage)
 		}
 	}
 
-	return nil
+	return err
 }
 
 func SubmissionVerifyProgramWatchdog(cmd *exec.Cmd, seconds time.Duration, done <-chan struct{}, timeout *int32) {
@@ -165,12 +276,21 @@ func SubmissionVerifyProgramWatchdog(cmd *exec.Cmd, seconds time.Duration, done
 }
 
 /* TODO(anton2920): rewrite without using standard library. */
-func SubmissionVerifyProgrammingCompile(l Language, j jail.Jail, lang *ProgrammingLanguage) error {
+func SubmissionVerifyProgrammingCompile(l Language, j jail.Jail, lang *ProgrammingLanguage, files *TaskFiles) error {
 	defer trace.End(trace.Begin(""))
 
 	var buffer bytes.Buffer
 
-	cmd := exec.Command(lang.Compiler, append(lang.CompilerArgs, lang.SourceFile)...)
+	args := make([]string, 0, len(lang.CompilerArgs)+2)
+	args = append(args, lang.CompilerArgs...)
+	args = append(args, lang.SourceFile)
+
+	/* NOTE(anton2920): harness is compiled together with solution by compiled languages and run instead of it by interpreted ones. */
+	if (files != nil) && (files.HarnessFile != "") && (lang.Runner == "") {
+		args = append(args, files.HarnessFile)
+	}
+
+	cmd := exec.Command(lang.Compiler, args...)
 	cmd.Dir = "/tmp"
 	cmd.SysProcAttr = &sys.SysProcAttr{Setsid: true, Jail: int(j.ID)}
 	cmd.Stdout = &buffer
@@ -178,9 +298,9 @@ func SubmissionVerifyProgrammingCompile(l Language, j jail.Jail, lang *Programmi
 
 	done := make(chan struct{})
 
-	const timeout = 5
+	timeout := ProgrammingLanguageTimeout(lang, Config.CompileTimeout)
 	var timeoutExceeded int32
-	go SubmissionVerifyProgramWatchdog(cmd, timeout, done, &timeoutExceeded)
+	go SubmissionVerifyProgramWatchdog(cmd, time.Duration(timeout), done, &timeoutExceeded)
 
 	err := cmd.Run()
 	close(done)
@@ -194,52 +314,262 @@ func SubmissionVerifyProgrammingCompile(l Language, j jail.Jail, lang *Programmi
 	return nil
 }
 
-func SubmissionVerifyProgrammingRun(l Language, j jail.Jail, lang *ProgrammingLanguage, input string, output *bytes.Buffer) error {
-	defer trace.End(trace.Begin(""))
-
+/* SubmissionVerifyProgrammingCommand returns command, which runs 'main' file of a language inside jail. Compiled languages run their executable instead. */
+func SubmissionVerifyProgrammingCommand(j jail.Jail, lang *ProgrammingLanguage, main string) *exec.Cmd {
 	var exe string
 	var args []string
 	if lang.Executable != "" {
 		exe = lang.Executable
 	} else {
 		exe = lang.Runner
-		args = append(lang.RunnerArgs, lang.SourceFile)
+		args = make([]string, 0, len(lang.RunnerArgs)+1)
+		args = append(args, lang.RunnerArgs...)
+		args = append(args, main)
 	}
 
 	cmd := exec.Command(exe, args...)
 	cmd.Dir = "/tmp"
 	cmd.SysProcAttr = &sys.SysProcAttr{Setsid: true, Jail: int(j.ID)}
-	cmd.Stdout = output
-	cmd.Stderr = output
+	return cmd
+}
+
+/* GenerateHarnessSecret returns random string, which harness prints with results, so solution can't report them instead. */
+func GenerateHarnessSecret() (string, error) {
+	defer trace.End(trace.Begin(""))
+
+	var buffer [16]byte
+	if _, err := syscall.Getrandom(buffer[:], 0); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer[:]), nil
+}
+
+/* SubmissionVerifyProgrammingExec runs program with 'input'. If 'secret' is not empty, it's available to program on file descriptor 3. Error is returned only if program could not be run or exceeded timeout, otherwise state of exited program is returned. */
+func SubmissionVerifyProgrammingExec(l Language, j jail.Jail, lang *ProgrammingLanguage, files *TaskFiles, input string, secret string, stdout io.Writer, stderr io.Writer) (*os.ProcessState, error) {
+	defer trace.End(trace.Begin(""))
+
+	main := lang.SourceFile
+	if (files != nil) && (files.HarnessFile != "") {
+		main = files.HarnessFile
+	}
+
+	cmd := SubmissionVerifyProgrammingCommand(j, lang, main)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if secret != "" {
+		/* NOTE(anton2920): secret is shorter than pipe buffer, so it's written before program starts. Once harness has read it, solution can't get it again. */
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, fmt.Errorf(Ls(l, "failed to create pipe: %v"), err)
+		}
+		_, err = io.WriteString(w, secret)
+		w.Close()
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf(Ls(l, "failed to write input string: %w"), err)
+		}
+		defer r.Close()
+		cmd.ExtraFiles = []*os.File{r}
+	}
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
-		return fmt.Errorf(Ls(l, "failed to create stdin pipe: %w"), err)
+		return nil, fmt.Errorf(Ls(l, "failed to create stdin pipe: %w"), err)
 	}
 	if _, err := io.WriteString(stdin, input); err != nil {
-		return fmt.Errorf(Ls(l, "failed to write input string: %w"), err)
+		return nil, fmt.Errorf(Ls(l, "failed to write input string: %w"), err)
 	}
 	stdin.Close()
 
 	done := make(chan struct{})
 
-	const timeout = 2
+	timeout := ProgrammingLanguageTimeout(lang, Config.RunTimeout)
 	var timeoutExceeded int32
-	go SubmissionVerifyProgramWatchdog(cmd, timeout, done, &timeoutExceeded)
+	go SubmissionVerifyProgramWatchdog(cmd, time.Duration(timeout), done, &timeoutExceeded)
 
 	err = cmd.Run()
 	close(done)
 
 	if atomic.LoadInt32(&timeoutExceeded) == 1 {
-		return fmt.Errorf(Ls(l, "failed to run program: exceeded timeout of %d seconds"), timeout)
+		return nil, fmt.Errorf(Ls(l, "failed to run program: exceeded timeout of %d seconds"), timeout)
 	}
+	if cmd.ProcessState == nil {
+		return nil, fmt.Errorf(Ls(l, "failed to run program: %s %w"), "", err)
+	}
+	return cmd.ProcessState, nil
+}
+
+func SubmissionVerifyProgrammingRun(l Language, j jail.Jail, lang *ProgrammingLanguage, files *TaskFiles, input string, output *bytes.Buffer) error {
+	defer trace.End(trace.Begin(""))
+
+	state, err := SubmissionVerifyProgrammingExec(l, j, lang, files, input, "", output, output)
 	if err != nil {
-		return fmt.Errorf(Ls(l, "failed to run program: %s %w"), output.String(), err)
+		return err
+	}
+	if !state.Success() {
+		return fmt.Errorf(Ls(l, "failed to run program: %s %w"), output.String(), &exec.ExitError{ProcessState: state})
 	}
 	return nil
 }
 
-func SubmissionVerifyProgrammingCheck(l Language, j jail.Jail, submittedTask *SubmittedProgramming, checkType CheckType) {
+/* SubmissionVerifyProgrammingHarnessCheck runs harness with 'input' and returns message of a failed check or empty string, if all test cases passed and all test cases from 'names' were reported. Exit code of harness is ignored, unless it reported nothing. */
+func SubmissionVerifyProgrammingHarnessCheck(l Language, j jail.Jail, lang *ProgrammingLanguage, files *TaskFiles, input string, names []string) string {
+	defer trace.End(trace.Begin(""))
+
+	var stdout, stderr bytes.Buffer
+
+	secret, err := GenerateHarnessSecret()
+	if err != nil {
+		return fmt.Errorf(Ls(l, "failed to run program: %s %w"), "", err).Error()
+	}
+
+	/* NOTE(anton2920): interpreted harness and solution are the same process, so harness removes its own file before calling solution. It's created again for every run. */
+	if lang.Runner != "" {
+		if err := SubmissionVerifyProgrammingCreateFile(j, files.HarnessFile, files.Harness); err != nil {
+			MetricsSandboxFailure()
+			return fmt.Errorf(Ls(l, "failed to run program: %s %w"), "", err).Error()
+		}
+		defer func(j jail.Jail, name string) {
+			buffer := make([]byte, syscall.PATH_MAX)
+			if err := SubmissionVerifyProgrammingUnlink(buffer, j, name); err != nil {
+				MetricsSandboxFailure()
+				log.Warnf("Failed to remove harness: %v", err)
+			}
+		}(j, files.HarnessFile)
+	}
+
+	state, err := SubmissionVerifyProgrammingExec(l, j, lang, files, input, secret, &stdout, &stderr)
+	if err != nil {
+		return err.Error()
+	}
+
+	passed, failed, message := ParseHarnessOutput(stdout.String(), secret)
+	switch {
+	case (len(passed) == 0) && (failed == 0):
+		if !state.Success() {
+			return fmt.Errorf(Ls(l, "failed to run program: %s %w"), stderr.String(), &exec.ExitError{ProcessState: state}).Error()
+		}
+		return Ls(l, "test harness reported no test cases")
+	case failed > 0:
+		return fmt.Sprintf(Ls(l, "%d of %d test cases passed, first failure: %s"), len(passed), len(passed)+failed, message)
+	}
+
+	for i := 0; i < len(names); i++ {
+		var reported bool
+		for j := 0; j < len(passed); j++ {
+			if passed[j] == names[i] {
+				reported = true
+				break
+			}
+		}
+		if !reported {
+			return fmt.Sprintf(Ls(l, "test case %q was not reported"), names[i])
+		}
+	}
+	return ""
+}
+
+/* SubmissionVerifyProgrammingInteractiveCheck runs solution in jail 'j' and interactor in jail 'ij' connected by pipes. Interactor gets 'input' from file descriptor 3. Returns message of a failed check or empty string, if interactor accepted solution. */
+func SubmissionVerifyProgrammingInteractiveCheck(l Language, j jail.Jail, ij jail.Jail, lang *ProgrammingLanguage, files *TaskFiles, input string) string {
+	defer trace.End(trace.Begin(""))
+
+	var solutionStderr, interactorStderr bytes.Buffer
+
+	if (files.InteractorLanguage < 0) || (int(files.InteractorLanguage) >= len(ProgrammingLanguages)) || (!ProgrammingLanguages[files.InteractorLanguage].Available) {
+		return Ls(l, "interactor language is not available")
+	}
+	interactorLang := &ProgrammingLanguages[files.InteractorLanguage]
+
+	solution := SubmissionVerifyProgrammingCommand(j, lang, lang.SourceFile)
+	interactor := SubmissionVerifyProgrammingCommand(ij, interactorLang, interactorLang.SourceFile)
+
+	/* NOTE(anton2920): 'pipes[0]' goes from solution to interactor, 'pipes[1]' from interactor to solution and 'pipes[2]' carries input to interactor. */
+	var pipes [3][2]*os.File
+	closePipes := func(n int) {
+		for i := 0; i < n; i++ {
+			pipes[i][0].Close()
+			pipes[i][1].Close()
+		}
+	}
+	for i := 0; i < len(pipes); i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closePipes(i)
+			return fmt.Sprintf(Ls(l, "failed to create pipe: %v"), err)
+		}
+		pipes[i] = [2]*os.File{r, w}
+	}
+
+	solution.Stdin = pipes[1][0]
+	solution.Stdout = pipes[0][1]
+	solution.Stderr = &solutionStderr
+
+	interactor.Stdin = pipes[0][0]
+	interactor.Stdout = pipes[1][1]
+	interactor.Stderr = &interactorStderr
+	interactor.ExtraFiles = []*os.File{pipes[2][0]}
+
+	if err := interactor.Start(); err != nil {
+		closePipes(len(pipes))
+		return fmt.Sprintf(Ls(l, "failed to run interactor: %v"), err)
+	}
+	if err := solution.Start(); err != nil {
+		closePipes(len(pipes))
+		syscall.Kill(-int32(interactor.Process.Pid), syscall.SIGKILL)
+		interactor.Wait()
+		return fmt.Errorf(Ls(l, "failed to run program: %s %w"), "", err).Error()
+	}
+
+	/* NOTE(anton2920): children have their own copies of pipes, so ours must be closed for them to see EOF. */
+	pipes[0][0].Close()
+	pipes[0][1].Close()
+	pipes[1][0].Close()
+	pipes[1][1].Close()
+	pipes[2][0].Close()
+	go func(w *os.File) {
+		io.WriteString(w, input)
+		w.Close()
+	}(pipes[2][1])
+
+	solutionDone := make(chan struct{})
+	interactorDone := make(chan struct{})
+
+	solutionTimeout := ProgrammingLanguageTimeout(lang, Config.RunTimeout)
+	interactorTimeout := ProgrammingLanguageTimeout(interactorLang, Config.RunTimeout) + solutionTimeout
+	var solutionTimeoutExceeded, interactorTimeoutExceeded int32
+	go SubmissionVerifyProgramWatchdog(solution, time.Duration(solutionTimeout), solutionDone, &solutionTimeoutExceeded)
+	go SubmissionVerifyProgramWatchdog(interactor, time.Duration(interactorTimeout), interactorDone, &interactorTimeoutExceeded)
+
+	solutionErr := solution.Wait()
+	close(solutionDone)
+	interactorErr := interactor.Wait()
+	close(interactorDone)
+
+	if atomic.LoadInt32(&solutionTimeoutExceeded) == 1 {
+		return fmt.Sprintf(Ls(l, "failed to run program: exceeded timeout of %d seconds"), solutionTimeout)
+	}
+	if atomic.LoadInt32(&interactorTimeoutExceeded) == 1 {
+		return fmt.Sprintf(Ls(l, "interactor exceeded timeout of %d seconds"), interactorTimeout)
+	}
+	if interactor.ProcessState == nil {
+		return fmt.Sprintf(Ls(l, "failed to run interactor: %v"), interactorErr)
+	}
+	if !interactor.ProcessState.Success() {
+		message, _, _ := strings.Cut(strings.TrimSpace(interactorStderr.String()), "\n")
+		if message == "" {
+			message = Ls(l, "wrong answer")
+		}
+		return message
+	}
+	if (solution.ProcessState == nil) || (!solution.ProcessState.Success()) {
+		return fmt.Errorf(Ls(l, "failed to run program: %s %w"), solutionStderr.String(), solutionErr).Error()
+	}
+	return ""
+}
+
+/* SubmissionVerifyProgrammingCheck runs solution against checks of provided type. Interactor, if any, runs in jail 'ij'. If 'progress' is not nil, it's called with number of checks done before each check and after the last one. */
+func SubmissionVerifyProgrammingCheck(l Language, j jail.Jail, ij jail.Jail, submittedTask *SubmittedProgramming, files *TaskFiles, checkType CheckType, progress func(int)) {
 	defer trace.End(trace.Begin(""))
 
 	var output bytes.Buffer
@@ -250,11 +580,31 @@ func SubmissionVerifyProgrammingCheck(l Language, j jail.Jail, submittedTask *Su
 	scores := make([]int, len(task.Checks[checkType]))
 	messages := make([]string, len(task.Checks[checkType]))
 	for i := 0; i < len(task.Checks[checkType]); i++ {
+		if progress != nil {
+			progress(i)
+		}
 		output.Reset()
 
 		check := &task.Checks[checkType][i]
 		input := strings.Replace(strings.TrimSpace(check.Input), "\r\n", "\n", -1)
-		if err := SubmissionVerifyProgrammingRun(l, j, lang, input, &output); err != nil {
+
+		if (files.HarnessFile != "") || (files.Interactor != "") {
+			if files.Interactor != "" {
+				messages[i] = SubmissionVerifyProgrammingInteractiveCheck(l, j, ij, lang, files, input)
+			} else {
+				messages[i] = SubmissionVerifyProgrammingHarnessCheck(l, j, lang, files, input, strings.Fields(check.Output))
+			}
+			if messages[i] != "" {
+				if checkType == CheckTypeExample {
+					break
+				}
+				continue
+			}
+			scores[i] = 1
+			continue
+		}
+
+		if err := SubmissionVerifyProgrammingRun(l, j, lang, files, input, &output); err != nil {
 			messages[i] = err.Error()
 			if checkType == CheckTypeExample {
 				break
@@ -274,50 +624,176 @@ func SubmissionVerifyProgrammingCheck(l Language, j jail.Jail, submittedTask *Su
 
 		scores[i] = 1
 	}
+	if progress != nil {
+		progress(len(task.Checks[checkType]))
+	}
 
 	submittedTask.Scores[checkType] = scores
 	submittedTask.Messages[checkType] = messages
 }
 
-func SubmissionVerifyProgramming(l Language, submittedTask *SubmittedProgramming, checkType CheckType) error {
+/* SubmissionVerifyProgrammingInJail compiles solution together with task files, if any, in a new protected jail and calls 'run' with it. Jail is removed afterwards. */
+func SubmissionVerifyProgrammingInJail(l Language, lang *ProgrammingLanguage, files *TaskFiles, solution string, run func(jail.Jail)) error {
 	defer trace.End(trace.Begin(""))
 
-	lang := &ProgrammingLanguages[submittedTask.LanguageID]
-
-	j, err := jail.New("/usr/local/jails/templates/workster", WorkingDirectory)
+	j, err := jail.New(Config.JailTemplate, WorkingDirectory)
 	if err != nil {
+		MetricsSandboxFailure()
 		return err
 	}
 	defer func(j jail.Jail) {
 		if err := jail.Remove(j); err != nil {
+			MetricsSandboxFailure()
 			log.Warnf("Failed to remove jail: %v", err)
 		}
 	}(j)
 
-	if err := SubmissionVerifyProgrammingCreateSource(j, lang, submittedTask.Solution); err != nil {
+	defer func(j jail.Jail, lang *ProgrammingLanguage, files *TaskFiles) {
+		if err := SubmissionVerifyProgrammingCleanup(j, lang, files); err != nil {
+			MetricsSandboxFailure()
+			log.Warnf("Failed to cleanup jail environment: %v", err)
+		}
+	}(j, lang, files)
+
+	if err := SubmissionVerifyProgrammingCreateSource(j, lang, solution); err != nil {
+		MetricsSandboxFailure()
 		return err
 	}
-	defer func(j jail.Jail, lang *ProgrammingLanguage) {
-		if err := SubmissionVerifyProgrammingCleanup(j, lang); err != nil {
-			log.Warnf("Failed to cleanup jail environment: %v", err)
+	if files != nil {
+		if err := SubmissionVerifyProgrammingCreateFiles(j, lang, files); err != nil {
+			MetricsSandboxFailure()
+			return err
 		}
-	}(j, lang)
+	}
 
 	if lang.Compiler != "" {
-		if err := SubmissionVerifyProgrammingCompile(l, j, lang); err != nil {
+		if err := SubmissionVerifyProgrammingCompile(l, j, lang, files); err != nil {
+			return err
+		}
+	}
+
+	/* NOTE(anton2920): harness is already a part of executable, so its source must not be available to solution. */
+	if (files != nil) && (files.HarnessFile != "") && (lang.Runner == "") {
+		buffer := make([]byte, syscall.PATH_MAX)
+		if err := SubmissionVerifyProgrammingUnlink(buffer, j, files.HarnessFile); err != nil {
+			MetricsSandboxFailure()
 			return err
 		}
 	}
 
 	if err := jail.Protect(j); err != nil {
+		MetricsSandboxFailure()
 		return err
 	}
 
-	SubmissionVerifyProgrammingCheck(l, j, submittedTask, checkType)
+	run(j)
 	return nil
 }
 
-func SubmissionVerifyStep(submittedStep *SubmittedStep) {
+func SubmissionVerifyProgramming(l Language, submittedTask *SubmittedProgramming, checkType CheckType, progress func(int)) error {
+	defer trace.End(trace.Begin(""))
+
+	var files TaskFiles
+
+	task, _ := Step2Programming(&submittedTask.Step)
+	if err := GetStepTaskFiles(task, &files); err != nil {
+		return err
+	}
+
+	lang := &ProgrammingLanguages[submittedTask.LanguageID]
+
+	/* NOTE(anton2920): interactor runs in a separate jail, so solution can't read it. */
+	if (files.Interactor != "") && (files.InteractorLanguage >= 0) && (int(files.InteractorLanguage) < len(ProgrammingLanguages)) && (ProgrammingLanguages[files.InteractorLanguage].Available) {
+		var err error
+
+		interactorLang := &ProgrammingLanguages[files.InteractorLanguage]
+		if err1 := SubmissionVerifyProgrammingInJail(l, interactorLang, nil, files.Interactor, func(ij jail.Jail) {
+			err = SubmissionVerifyProgrammingInJail(l, lang, &files, submittedTask.Solution, func(j jail.Jail) {
+				SubmissionVerifyProgrammingCheck(l, j, ij, submittedTask, &files, checkType, progress)
+			})
+		}); err1 != nil {
+			return fmt.Errorf(Ls(l, "failed to prepare interactor: %w"), err1)
+		}
+		return err
+	}
+
+	return SubmissionVerifyProgrammingInJail(l, lang, &files, submittedTask.Solution, func(j jail.Jail) {
+		SubmissionVerifyProgrammingCheck(l, j, jail.Jail{}, submittedTask, &files, checkType, progress)
+	})
+}
+
+/* ProgrammingRunAcquire checks that user is allowed to run program now. On success slot must be released with 'ProgrammingRunRelease'. */
+func ProgrammingRunAcquire(l Language, userID database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	now := time.Now()
+
+	ProgrammingRunLock.Lock()
+	defer ProgrammingRunLock.Unlock()
+
+	if last, ok := ProgrammingRunLastRuns[userID]; ok {
+		if wait := time.Duration(Config.ProgrammingRunInterval) - now.Sub(last); wait > 0 {
+			return http.BadRequest(Ls(l, "you are running programs too often, try again in %d seconds"), int((wait+time.Second-1)/time.Second))
+		}
+	}
+
+	select {
+	default:
+		return http.BadRequest("%s", Ls(l, "too many programs are running now, try again later"))
+	case ProgrammingRunSlots <- struct{}{}:
+	}
+
+	for id, last := range ProgrammingRunLastRuns {
+		if now.Sub(last) >= time.Duration(Config.ProgrammingRunInterval) {
+			delete(ProgrammingRunLastRuns, id)
+		}
+	}
+	ProgrammingRunLastRuns[userID] = now
+	return nil
+}
+
+func ProgrammingRunRelease() {
+	<-ProgrammingRunSlots
+}
+
+/* SubmissionRunProgramming runs solution with custom input in the same jail and with the same limits as checks. Helper files are available to it, but harness is not. */
+func SubmissionRunProgramming(l Language, submittedTask *SubmittedProgramming, input string, run *ProgrammingRun) error {
+	defer trace.End(trace.Begin(""))
+
+	var files TaskFiles
+	var runErr error
+
+	stdout := LimitedBuffer{Limit: ProgrammingRunMaxOutputLen}
+	stderr := LimitedBuffer{Limit: ProgrammingRunMaxOutputLen}
+
+	task, _ := Step2Programming(&submittedTask.Step)
+	if err := GetStepTaskFiles(task, &files); err != nil {
+		return err
+	}
+	helpers := TaskFiles{Files: files.Files}
+
+	lang := &ProgrammingLanguages[submittedTask.LanguageID]
+	input = strings.Replace(strings.TrimSpace(input), "\r\n", "\n", -1)
+
+	if err := SubmissionVerifyProgrammingInJail(l, lang, &helpers, submittedTask.Solution, func(j jail.Jail) {
+		start := time.Now()
+		state, err := SubmissionVerifyProgrammingExec(l, j, lang, &helpers, input, "", &stdout, &stderr)
+		run.Duration = time.Since(start)
+		if err != nil {
+			runErr = err
+			return
+		}
+		run.ExitCode = state.ExitCode()
+	}); err != nil {
+		return err
+	}
+
+	run.Stdout = stdout.String()
+	run.Stderr = stderr.String()
+	return runErr
+}
+
+func SubmissionVerifyStep(submittedStep *SubmittedStep, progress func(int)) {
 	defer trace.End(trace.Begin(""))
 
 	if submittedStep.Flags == SubmittedStepPassed {
@@ -333,9 +809,15 @@ func SubmissionVerifyStep(submittedStep *SubmittedStep) {
 			submittedTask, _ := Submitted2Programming(submittedStep)
 			if submittedTask.Status == SubmissionCheckPending {
 				submittedTask.Status = SubmissionCheckInProgress
-				if err := SubmissionVerifyProgramming(GL, submittedTask, CheckTypeTest); err != nil {
+				start := time.Now()
+				verdict := VerdictPassed
+				if err := SubmissionVerifyProgramming(GL, submittedTask, CheckTypeTest, progress); err != nil {
 					submittedTask.Error = err.Error()
+					verdict = VerdictError
+				} else if GetSubmittedStepScore(submittedStep) < GetStepMaximumScore(&submittedStep.Step) {
+					verdict = VerdictFailed
 				}
+				MetricsObserveVerification(ProgrammingLanguages[submittedTask.LanguageID].Name, verdict, time.Since(start))
 				submittedTask.Status = SubmissionCheckDone
 			}
 		}
@@ -346,30 +828,141 @@ func SubmissionVerify(submission *Submission) {
 	defer trace.End(trace.Begin(""))
 
 	for i := 0; i < len(submission.SubmittedSteps); i++ {
-		SubmissionVerifyStep(&submission.SubmittedSteps[i])
+		submittedStep := &submission.SubmittedSteps[i]
+		total := GetStepMaximumScore(&submittedStep.Step)
+
+		SubmissionVerifyStep(submittedStep, func(checked int) { VerifyJobProgress(submission.ID, i, checked, total) })
+		VerifyJobProgress(submission.ID, i, total, total)
 	}
 }
 
-func SubmissionVerifyWorker() {
+func SubmissionVerifyJob(submissionID database.ID) {
 	defer trace.End(trace.Begin(""))
 
 	var submission Submission
 
-	for submissionID := range SubmissionVerifyChannel {
-		start := time.Now()
+	start := time.Now()
+	VerifyJobStart(submissionID)
 
-		if err := GetSubmissionByID(submissionID, &submission); err != nil {
+	if err := GetSubmissionByID(submissionID, &submission); err != nil {
+		/* TODO(anton2920): report error. */
+	}
+	var tx Tx
+	var verified bool
+	if submission.Status == SubmissionCheckPending {
+		submission.Status = SubmissionCheckInProgress
+		SubmissionVerify(&submission)
+		submission.Status = SubmissionCheckDone
+		verified = true
+
+		if err := NotifySubmissionVerifiedTx(&tx, &submission); err != nil {
 			/* TODO(anton2920): report error. */
 		}
-		if submission.Status == SubmissionCheckPending {
-			submission.Status = SubmissionCheckInProgress
-			SubmissionVerify(&submission)
-			submission.Status = SubmissionCheckDone
+	}
+	if err := SaveSubmissionTx(&tx, &submission); err != nil {
+		/* TODO(anton2920): report error. */
+	}
+	if err := CommitTx(&tx); err != nil {
+		/* TODO(anton2920): report error. */
+	} else if verified {
+		var before string
+		if submission.RejudgedAt != 0 {
+			before = AuditScoreSummary(int(submission.PreviousScore), int(submission.PreviousMaximum))
 		}
-		if err := SaveSubmission(&submission); err != nil {
-			/* TODO(anton2920): report error. */
+		score, maximum := GetSubmissionScore(&submission)
+		Audit(nil, AuditSystem, "verify", "submission", submission.ID, before, AuditScoreSummary(score, maximum))
+	}
+	VerifyJobFinish(submissionID)
+
+	log.Debugf("Verified submission with ID = %d, took %v", submission.ID, time.Since(start))
+}
+
+func SubmissionVerifyWorker() {
+	defer trace.End(trace.Begin(""))
+
+	defer close(SubmissionVerifyStopped)
+
+	for {
+		/* NOTE(anton2920): quit is checked first, so queued jobs are not started after shutdown began. */
+		select {
+		case <-SubmissionVerifyQuit:
+			return
+		default:
 		}
 
-		log.Debugf("Verified submission with ID = %d, took %v", submission.ID, time.Since(start))
+		select {
+		case <-SubmissionVerifyQuit:
+			return
+		case submissionID := <-SubmissionVerifyChannel:
+			SubmissionVerifyJob(submissionID)
+		}
+	}
+}
+
+/* StopSubmissionVerifyWorker lets worker finish current job and waits for it until deadline. Returns false if job is still running. */
+func StopSubmissionVerifyWorker(deadline time.Time) bool {
+	defer trace.End(trace.Begin(""))
+
+	close(SubmissionVerifyQuit)
+
+	select {
+	case <-SubmissionVerifyStopped:
+		return true
+	case <-time.After(time.Until(deadline)):
+		return false
+	}
+}
+
+/*
+ * SubmissionVerifyRequeue enqueues submissions, which were not verified before server stopped.
+ * Since worker only saves verified submissions, interrupted ones are still pending. Submissions in progress are left by older versions and are reset.
+ */
+func SubmissionVerifyRequeue() error {
+	defer trace.End(trace.Begin(""))
+
+	var ids []database.ID
+
+	submissions := make([]Submission, 32)
+	var pos int64
+	for {
+		var tx Tx
+
+		n, err := GetSubmissions(&pos, submissions)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			submission := &submissions[i]
+			if (submission.Flags != SubmissionActive) || (submission.Status == SubmissionCheckDone) {
+				continue
+			}
+
+			if submission.Status == SubmissionCheckInProgress {
+				submission.Status = SubmissionCheckPending
+				for j := 0; j < len(submission.SubmittedSteps); j++ {
+					if submission.SubmittedSteps[j].Status == SubmissionCheckInProgress {
+						submission.SubmittedSteps[j].Status = SubmissionCheckPending
+					}
+				}
+				if err := SaveSubmissionTx(&tx, submission); err != nil {
+					return err
+				}
+			}
+			ids = append(ids, submission.ID)
+		}
+
+		/* NOTE(anton2920): buffer is reused by next batch, so changes are committed right away. */
+		if err := CommitTx(&tx); err != nil {
+			return err
+		}
 	}
+
+	if len(ids) > 0 {
+		log.Infof("Requeued %d submission(s) for verification", len(ids))
+	}
+	SubmissionVerifyEnqueue(ids...)
+	return nil
 }
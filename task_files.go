@@ -0,0 +1,533 @@
+package main
+
+import (
+	"unsafe"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/net/url"
+	"github.com/anton2920/gofa/strings"
+	"github.com/anton2920/gofa/trace"
+)
+
+type TaskFile struct {
+	Name     string
+	Contents string
+}
+
+/* TaskFiles are files of a programming task in addition to its checks. They are never changed after creation, so all copies of a step may share them. Records, which are no longer referenced by any lesson or submission, are removed by fsck. */
+type TaskFiles struct {
+	ID    database.ID
+	Flags int32
+
+	/* StarterCode is an initial solution displayed to students. */
+	StarterCode string
+
+	/* Files are read-only helper files, which are visible to students and are put next to solution. */
+	Files []TaskFile
+
+	/* Harness is a hidden file, which is compiled together with solution or run instead of it by interpreted languages. Before calling solution it must read secret from file descriptor 3 and close it, and harness of interpreted language must also remove its own file. Then it must print "PASS secret name" or "FAIL secret name: message" line for every test case. Output of checks lists names of test cases, which must pass. */
+	HarnessFile string
+	Harness     string
+
+	/* Interactor is a hidden program in interpreted language, which runs alongside solution in a separate jail with its standard input and output connected to solution's output and input. It reads check input from file descriptor 3 and decides the verdict: zero exit code means solution passed, otherwise the first line of its standard error is a message. */
+	InteractorLanguage database.ID
+	InteractorFile     string
+	Interactor         string
+
+	Blob Blob
+	Data [4096]byte
+}
+
+const (
+	TaskFilesActive int32 = iota
+	TaskFilesDeleted
+)
+
+const (
+	MinTaskFileNameLen = 1
+	MaxTaskFileNameLen = 64
+	MaxTaskFileLen     = 16384
+	MaxTaskFiles       = 8
+)
+
+const (
+	HarnessPass = "PASS"
+	HarnessFail = "FAIL"
+)
+
+func CreateTaskFilesTx(tx *Tx, files *TaskFiles) error {
+	defer trace.End(trace.Begin(""))
+
+	files.ID = NewIDTx(tx, TaskFilesDB)
+
+	/* NOTE(anton2920): zero 'StepCommon.Files' means step has no files, so record 0 is reserved. */
+	if files.ID == 0 {
+		reserved := TaskFiles{Flags: TaskFilesDeleted}
+		if err := SaveTaskFilesTx(tx, &reserved); err != nil {
+			return err
+		}
+
+		files.ID = NewIDTx(tx, TaskFilesDB)
+	}
+
+	return SaveTaskFilesTx(tx, files)
+}
+
+func CreateTaskFiles(files *TaskFiles) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := CreateTaskFilesTx(&tx, files); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func DBTaskFiles2TaskFiles(files *TaskFiles, data *byte) {
+	defer trace.End(trace.Begin(""))
+
+	files.StarterCode = database.Offset2String(files.StarterCode, data)
+
+	slice := database.Offset2Slice(*(*[]byte)(unsafe.Pointer(&files.Files)), data)
+	files.Files = *(*[]TaskFile)(unsafe.Pointer(&slice))
+	for i := 0; i < len(files.Files); i++ {
+		file := &files.Files[i]
+		file.Name = database.Offset2String(file.Name, data)
+		file.Contents = database.Offset2String(file.Contents, data)
+	}
+
+	files.HarnessFile = database.Offset2String(files.HarnessFile, data)
+	files.Harness = database.Offset2String(files.Harness, data)
+
+	files.InteractorFile = database.Offset2String(files.InteractorFile, data)
+	files.Interactor = database.Offset2String(files.Interactor, data)
+}
+
+func GetTaskFilesByID(id database.ID, files *TaskFiles) error {
+	defer trace.End(trace.Begin(""))
+
+	if err := DBRead(TaskFilesDB, id, unsafe.Pointer(files), int(unsafe.Sizeof(*files))); err != nil {
+		return err
+	}
+	if files.ID != id {
+		return database.NotFound
+	}
+
+	data, err := GetBlobData(&files.Blob, files.Data[:])
+	if err != nil {
+		return err
+	}
+
+	DBTaskFiles2TaskFiles(files, data)
+	return nil
+}
+
+func GetTaskFiless(pos *int64, files []TaskFiles) (int, error) {
+	defer trace.End(trace.Begin(""))
+
+	n, err := DBReadManyValid(TaskFilesDB, pos, files, func(files *TaskFiles) database.ID { return files.ID })
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < n; i++ {
+		data, err := GetBlobData(&files[i].Blob, files[i].Data[:])
+		if err != nil {
+			return 0, err
+		}
+		DBTaskFiles2TaskFiles(&files[i], data)
+	}
+	return n, nil
+}
+
+func DeleteTaskFilesByIDTx(tx *Tx, id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	flags := TaskFilesDeleted
+	var files TaskFiles
+
+	offset := int64(int(id)*int(unsafe.Sizeof(files))) + database.DataOffset + int64(unsafe.Offsetof(files.Flags))
+	tx.WriteAt(TaskFilesDB, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
+	return nil
+}
+
+func TaskFilesDataSize(files *TaskFiles) int {
+	size := DBStringSize(files.StarterCode) + DBStringSize(files.HarnessFile) + DBStringSize(files.Harness) + DBStringSize(files.InteractorFile) + DBStringSize(files.Interactor)
+	for i := 0; i < len(files.Files); i++ {
+		size += DBStringSize(files.Files[i].Name) + DBStringSize(files.Files[i].Contents)
+	}
+	size += DBSliceSize(files.Files)
+	return size
+}
+
+func SaveTaskFilesTx(tx *Tx, files *TaskFiles) error {
+	defer trace.End(trace.Begin(""))
+
+	var filesDB TaskFiles
+	var n int
+
+	filesDB.ID = files.ID
+	filesDB.Flags = files.Flags
+
+	data, err := GetDataBuffer(filesDB.Data[:], TaskFilesDataSize(files))
+	if err != nil {
+		return err
+	}
+
+	n += database.String2DBString(&filesDB.StarterCode, files.StarterCode, data, n)
+
+	filesDB.Files = make([]TaskFile, len(files.Files))
+	for i := 0; i < len(files.Files); i++ {
+		n += database.String2DBString(&filesDB.Files[i].Name, files.Files[i].Name, data, n)
+		n += database.String2DBString(&filesDB.Files[i].Contents, files.Files[i].Contents, data, n)
+	}
+	n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&filesDB.Files)), *(*[]byte)(unsafe.Pointer(&filesDB.Files)), int(unsafe.Sizeof(filesDB.Files[0])), int(unsafe.Alignof(filesDB.Files[0])), data, n)
+
+	n += database.String2DBString(&filesDB.HarnessFile, files.HarnessFile, data, n)
+	n += database.String2DBString(&filesDB.Harness, files.Harness, data, n)
+
+	filesDB.InteractorLanguage = files.InteractorLanguage
+	n += database.String2DBString(&filesDB.InteractorFile, files.InteractorFile, data, n)
+	n += database.String2DBString(&filesDB.Interactor, files.Interactor, data, n)
+
+	if err := SaveBlob(&filesDB.Blob, filesDB.Data[:], data[:n]); err != nil {
+		return err
+	}
+
+	tx.Write(TaskFilesDB, filesDB.ID, unsafe.Pointer(&filesDB), int(unsafe.Sizeof(filesDB)))
+	return nil
+}
+
+/* GetStepTaskFiles returns files of a programming task. Tasks without files get empty ones. */
+func GetStepTaskFiles(task *StepProgramming, files *TaskFiles) error {
+	defer trace.End(trace.Begin(""))
+
+	if task.Files == 0 {
+		*files = TaskFiles{}
+		return nil
+	}
+	return GetTaskFilesByID(task.Files, files)
+}
+
+func TaskFilesEmpty(files *TaskFiles) bool {
+	return (files.StarterCode == "") && (len(files.Files) == 0) && (files.HarnessFile == "") && (files.Harness == "") && (files.InteractorFile == "") && (files.Interactor == "")
+}
+
+func TaskFilesEqual(a *TaskFiles, b *TaskFiles) bool {
+	if (a.StarterCode != b.StarterCode) || (a.HarnessFile != b.HarnessFile) || (a.Harness != b.Harness) || (len(a.Files) != len(b.Files)) {
+		return false
+	}
+	if (a.InteractorFile != b.InteractorFile) || (a.Interactor != b.Interactor) || ((a.Interactor != "") && (a.InteractorLanguage != b.InteractorLanguage)) {
+		return false
+	}
+	for i := 0; i < len(a.Files); i++ {
+		if a.Files[i] != b.Files[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/* TaskFileNameValid allows only names of files in current directory, which are not hidden. */
+func TaskFileNameValid(name string) bool {
+	if (!strings.LengthInRange(name, MinTaskFileNameLen, MaxTaskFileNameLen)) || (name[0] == '.') {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if ((c < 'a') || (c > 'z')) && ((c < 'A') || (c > 'Z')) && ((c < '0') || (c > '9')) && (c != '.') && (c != '_') && (c != '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func TaskFilesVerify(files *TaskFiles) error {
+	defer trace.End(trace.Begin(""))
+
+	if len(files.StarterCode) > MaxSolutionLen {
+		return http.BadRequest("starter code length must not exceed %d characters", MaxSolutionLen)
+	}
+
+	if len(files.Files) > MaxTaskFiles {
+		return http.BadRequest("number of files must not exceed %d", MaxTaskFiles)
+	}
+	for i := 0; i < len(files.Files); i++ {
+		file := &files.Files[i]
+
+		if !TaskFileNameValid(file.Name) {
+			return http.BadRequest("file %d: name must be between %d and %d characters long and may contain only latin letters, digits, '.', '_' and '-'", i+1, MinTaskFileNameLen, MaxTaskFileNameLen)
+		}
+		if len(file.Contents) > MaxTaskFileLen {
+			return http.BadRequest("file %d: length must not exceed %d characters", i+1, MaxTaskFileLen)
+		}
+		for j := 0; j < i; j++ {
+			if files.Files[j].Name == file.Name {
+				return http.BadRequest("file %d: duplicate name %q", i+1, file.Name)
+			}
+		}
+	}
+
+	if (files.HarnessFile == "") != (files.Harness == "") {
+		return http.BadRequest("both harness file name and its contents must be set")
+	}
+	if files.HarnessFile != "" {
+		if !TaskFileNameValid(files.HarnessFile) {
+			return http.BadRequest("harness file name must be between %d and %d characters long and may contain only latin letters, digits, '.', '_' and '-'", MinTaskFileNameLen, MaxTaskFileNameLen)
+		}
+		if len(files.Harness) > MaxTaskFileLen {
+			return http.BadRequest("harness length must not exceed %d characters", MaxTaskFileLen)
+		}
+		for i := 0; i < len(files.Files); i++ {
+			if files.Files[i].Name == files.HarnessFile {
+				return http.BadRequest("harness file name %q is used by another file", files.HarnessFile)
+			}
+		}
+	}
+
+	if (files.InteractorFile == "") != (files.Interactor == "") {
+		return http.BadRequest("both interactor file name and its contents must be set")
+	}
+	if files.InteractorFile != "" {
+		if files.HarnessFile != "" {
+			return http.BadRequest("task may have either harness or interactor, but not both")
+		}
+		if !TaskFileNameValid(files.InteractorFile) {
+			return http.BadRequest("interactor file name must be between %d and %d characters long and may contain only latin letters, digits, '.', '_' and '-'", MinTaskFileNameLen, MaxTaskFileNameLen)
+		}
+		if len(files.Interactor) > MaxTaskFileLen {
+			return http.BadRequest("interactor length must not exceed %d characters", MaxTaskFileLen)
+		}
+		for i := 0; i < len(files.Files); i++ {
+			if files.Files[i].Name == files.InteractorFile {
+				return http.BadRequest("interactor file name %q is used by another file", files.InteractorFile)
+			}
+		}
+
+		/* NOTE(anton2920): interactor is run next to solution, so it must not produce executable with the same name. */
+		if (files.InteractorLanguage < 0) || (int(files.InteractorLanguage) >= len(ProgrammingLanguages)) || (ProgrammingLanguages[files.InteractorLanguage].Runner == "") {
+			return http.BadRequest("interactor must be written in interpreted programming language")
+		}
+	}
+
+	return nil
+}
+
+/* SaveStepTaskFiles makes task refer to 'files'. New record is created only if they changed. */
+func SaveStepTaskFiles(task *StepProgramming, files *TaskFiles) error {
+	defer trace.End(trace.Begin(""))
+
+	var old TaskFiles
+
+	if err := GetStepTaskFiles(task, &old); err != nil {
+		return err
+	}
+	if TaskFilesEqual(&old, files) {
+		return nil
+	}
+
+	if TaskFilesEmpty(files) {
+		task.Files = 0
+		return nil
+	}
+
+	files.ID = 0
+	if err := CreateTaskFiles(files); err != nil {
+		return err
+	}
+	task.Files = files.ID
+	return nil
+}
+
+/* CreateStepsTaskFilesTx creates 'files[i]' for every programming step 'steps[i]', which were kept in memory during verification. */
+func CreateStepsTaskFilesTx(tx *Tx, steps []Step, files []TaskFiles) error {
+	defer trace.End(trace.Begin(""))
+
+	for i := 0; i < len(steps); i++ {
+		task, err := Step2Programming(&steps[i])
+		if err != nil {
+			continue
+		}
+
+		task.Files = 0
+		if TaskFilesEmpty(&files[i]) {
+			continue
+		}
+
+		files[i].ID = 0
+		if err := CreateTaskFilesTx(tx, &files[i]); err != nil {
+			return err
+		}
+		task.Files = files[i].ID
+	}
+
+	return nil
+}
+
+func TaskFilesFillFromRequest(vs url.Values, files *TaskFiles) error {
+	defer trace.End(trace.Begin(""))
+
+	files.StarterCode = vs.Get("StarterCode")
+	files.HarnessFile = vs.Get("HarnessFile")
+	files.Harness = vs.Get("Harness")
+	files.InteractorFile = vs.Get("InteractorFile")
+	files.Interactor = vs.Get("Interactor")
+
+	if files.Interactor != "" {
+		id, err := GetValidID(vs.Get("InteractorLanguage"), database.ID(len(ProgrammingLanguages)))
+		if err != nil {
+			return http.ClientError(err)
+		}
+		files.InteractorLanguage = id
+	}
+
+	names := vs.GetMany("FileName")
+	contents := vs.GetMany("FileContents")
+	if len(names) != len(contents) {
+		return http.ClientError(nil)
+	}
+
+	files.Files = files.Files[:0]
+	for i := 0; i < len(names); i++ {
+		/* NOTE(anton2920): files are removed by clearing both name and contents. */
+		if (names[i] == "") && (contents[i] == "") {
+			continue
+		}
+		files.Files = append(files.Files, TaskFile{Name: names[i], Contents: contents[i]})
+	}
+
+	return TaskFilesVerify(files)
+}
+
+/* ParseHarnessOutput returns names of passed test cases reported by harness and message of the first failed one. Lines without 'secret' are printed by solution and are ignored. */
+func ParseHarnessOutput(output string, secret string) (passed []string, failed int, message string) {
+	defer trace.End(trace.Begin(""))
+
+	for len(output) > 0 {
+		line := output
+		if nl := strings.FindChar(output, '\n'); nl != -1 {
+			line = output[:nl]
+			output = output[nl+1:]
+		} else {
+			output = ""
+		}
+		if (len(line) > 0) && (line[len(line)-1] == '\r') {
+			line = line[:len(line)-1]
+		}
+
+		switch {
+		case strings.StartsWith(line, HarnessPass+" "+secret+" "):
+			passed = append(passed, line[len(HarnessPass)+len(secret)+2:])
+		case strings.StartsWith(line, HarnessFail+" "+secret+" "):
+			if failed == 0 {
+				message = line[len(HarnessFail)+len(secret)+2:]
+			}
+			failed++
+		}
+	}
+
+	return passed, failed, message
+}
+
+func DisplayTaskFiles(w *http.Response, l Language, files *TaskFiles) {
+	defer trace.End(trace.Begin(""))
+
+	if len(files.Files) == 0 {
+		return
+	}
+
+	w.WriteString(`<h4>`)
+	w.WriteString(Ls(l, "Files"))
+	w.WriteString(`</h4>`)
+	for i := 0; i < len(files.Files); i++ {
+		file := &files.Files[i]
+
+		w.WriteString(`<p><b>`)
+		w.WriteHTMLString(file.Name)
+		w.WriteString(`</b></p>`)
+		w.WriteString(`<textarea class="form-control" rows="5" readonly>`)
+		w.WriteHTMLString(file.Contents)
+		w.WriteString(`</textarea>`)
+		w.WriteString(`<br>`)
+	}
+}
+
+/* DisplayTaskFilesInputs displays inputs for all files of a task and an empty one for a new file. */
+func DisplayTaskFilesInputs(w *http.Response, l Language, files *TaskFiles) {
+	defer trace.End(trace.Begin(""))
+
+	DisplayLabel(w, l, "Starter code")
+	w.WriteString(`<textarea class="form-control" rows="5" name="StarterCode" maxlength="`)
+	w.WriteInt(MaxSolutionLen)
+	w.WriteString(`">`)
+	w.WriteHTMLString(files.StarterCode)
+	w.WriteString(`</textarea>`)
+	w.WriteString(`<br>`)
+
+	w.WriteString(`<h4>`)
+	w.WriteString(Ls(l, "Files"))
+	w.WriteString(`</h4>`)
+	w.WriteString(`<p>`)
+	w.WriteString(Ls(l, "Helper files are visible to students. To remove a file, clear its name and contents."))
+	w.WriteString(`</p>`)
+	for i := 0; i <= len(files.Files); i++ {
+		var file TaskFile
+		if i < len(files.Files) {
+			file = files.Files[i]
+		}
+
+		DisplayLabel(w, l, "File name")
+		DisplayInput(w, "text", "FileName", file.Name, false)
+		w.WriteString(`<textarea class="form-control" rows="5" name="FileContents">`)
+		w.WriteHTMLString(file.Contents)
+		w.WriteString(`</textarea>`)
+		w.WriteString(`<br>`)
+	}
+
+	w.WriteString(`<h4>`)
+	w.WriteString(Ls(l, "Test harness"))
+	w.WriteString(`</h4>`)
+	w.WriteString(`<p>`)
+	w.WriteString(Ls(l, "Harness is hidden from students. It is compiled together with solution or run instead of it by interpreted languages. Before calling solution it must read secret from file descriptor 3 and close it, and harness of interpreted language must also remove its own file. Then it must print 'PASS secret name' or 'FAIL secret name: message' line for every test case. Output of each check lists names of test cases, which must pass."))
+	w.WriteString(`</p>`)
+	DisplayLabel(w, l, "File name")
+	DisplayInput(w, "text", "HarnessFile", files.HarnessFile, false)
+	w.WriteString(`<textarea class="form-control" rows="10" name="Harness">`)
+	w.WriteHTMLString(files.Harness)
+	w.WriteString(`</textarea>`)
+	w.WriteString(`<br>`)
+
+	w.WriteString(`<h4>`)
+	w.WriteString(Ls(l, "Interactor"))
+	w.WriteString(`</h4>`)
+	w.WriteString(`<p>`)
+	w.WriteString(Ls(l, "Interactor is hidden from students. It runs alongside solution in interpreted language, reads test input from file descriptor 3, talks to solution through its standard input and output and exits with zero code if solution passed. Otherwise the first line of its standard error is displayed."))
+	w.WriteString(`</p>`)
+	DisplayLabel(w, l, "Programming language")
+	w.WriteString(` <select name="InteractorLanguage">`)
+	for i := 0; i < len(ProgrammingLanguages); i++ {
+		lang := &ProgrammingLanguages[i]
+		if lang.Runner == "" {
+			continue
+		}
+
+		w.WriteString(`<option value="`)
+		w.WriteInt(i)
+		w.WriteString(`"`)
+		if (files.Interactor != "") && (database.ID(i) == files.InteractorLanguage) {
+			w.WriteString(` selected`)
+		}
+		w.WriteString(`>`)
+		w.WriteHTMLString(lang.Name)
+		w.WriteString(`</option>`)
+	}
+	w.WriteString(`</select>`)
+	w.WriteString(`<br>`)
+	DisplayLabel(w, l, "File name")
+	DisplayInput(w, "text", "InteractorFile", files.InteractorFile, false)
+	w.WriteString(`<textarea class="form-control" rows="10" name="Interactor">`)
+	w.WriteHTMLString(files.Interactor)
+	w.WriteString(`</textarea>`)
+	w.WriteString(`<br>`)
+}
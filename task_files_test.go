@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHarnessOutput(t *testing.T) {
+	const secret = "0123456789abcdef"
+
+	tests := [...]struct {
+		Output  string
+		Passed  []string
+		Failed  int
+		Message string
+	}{
+		{"", nil, 0, ""},
+		{"hello\nworld\n", nil, 0, ""},
+		{"PASS 0123456789abcdef sum\nPASS 0123456789abcdef product", []string{"sum", "product"}, 0, ""},
+		{"PASS 0123456789abcdef sum\r\nFAIL 0123456789abcdef product: expected 6, got 5\r\nFAIL 0123456789abcdef div: panic\r\n", []string{"sum"}, 2, "product: expected 6, got 5"},
+		{"FAIL\nPASSED\nPASS\nPASS 0123456789abcdef", nil, 0, ""},
+		{"PASS sum\nPASS fedcba9876543210 product\nPASS 0123456789abcdef div", []string{"div"}, 0, ""},
+	}
+
+	for _, test := range tests {
+		passed, failed, message := ParseHarnessOutput(test.Output, secret)
+		if (!reflect.DeepEqual(passed, test.Passed)) || (failed != test.Failed) || (message != test.Message) {
+			t.Errorf("Expected (%v, %d, %q) for %q, got (%v, %d, %q)", test.Passed, test.Failed, test.Message, test.Output, passed, failed, message)
+		}
+	}
+}
+
+func TestTaskFilesVerify(t *testing.T) {
+	python, _ := GetProgrammingLanguageByName("python3")
+	c, _ := GetProgrammingLanguageByName("c")
+
+	expectedOK := [...]TaskFiles{
+		{},
+		{StarterCode: "int sum(int a, int b) {}"},
+		{Files: []TaskFile{{Name: "sum.h", Contents: "int sum(int, int);"}}, HarnessFile: "harness.c", Harness: "int main() {}"},
+		{InteractorLanguage: python, InteractorFile: "interactor.py", Interactor: "print(input())"},
+	}
+	for _, files := range expectedOK {
+		if err := TaskFilesVerify(&files); err != nil {
+			t.Errorf("Expected no error for %+v, got %v", files, err)
+		}
+	}
+
+	expectedFail := [...]TaskFiles{
+		{StarterCode: testString(MaxSolutionLen + 1)},
+		{Files: []TaskFile{{Name: "", Contents: "a"}}},
+		{Files: []TaskFile{{Name: ".hidden", Contents: "a"}}},
+		{Files: []TaskFile{{Name: "../sum.h", Contents: "a"}}},
+		{Files: []TaskFile{{Name: "sum.h", Contents: testString(MaxTaskFileLen + 1)}}},
+		{Files: []TaskFile{{Name: "sum.h"}, {Name: "sum.h"}}},
+		{Files: make([]TaskFile, MaxTaskFiles+1)},
+		{HarnessFile: "harness.c"},
+		{Harness: "int main() {}"},
+		{HarnessFile: "harness/main.c", Harness: "int main() {}"},
+		{Files: []TaskFile{{Name: "harness.c"}}, HarnessFile: "harness.c", Harness: "int main() {}"},
+		{InteractorLanguage: python, InteractorFile: "interactor.py"},
+		{InteractorLanguage: c, InteractorFile: "interactor.c", Interactor: "int main() {}"},
+		{InteractorLanguage: python, InteractorFile: "interactor.py", Interactor: "print(input())", HarnessFile: "harness.c", Harness: "int main() {}"},
+		{InteractorLanguage: python, InteractorFile: "data.txt", Interactor: "print(input())", Files: []TaskFile{{Name: "data.txt"}}},
+	}
+	for _, files := range expectedFail {
+		if err := TaskFilesVerify(&files); err == nil {
+			t.Errorf("Expected error for %+v, got nothing", files)
+		}
+	}
+}
+
+func TestSaveStepTaskFiles(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	var task StepProgramming
+	var files TaskFiles
+
+	expected := TaskFiles{StarterCode: "def solve():\n    pass\n", Files: []TaskFile{{Name: "data.txt", Contents: "1 2 3"}}, HarnessFile: "harness.py", Harness: "print('PASS solve')", InteractorLanguage: 4, InteractorFile: "interactor.py", Interactor: "import os"}
+	files = expected
+	if err := SaveStepTaskFiles(&task, &files); err != nil {
+		t.Fatalf("Failed to save task files: %v", err)
+	}
+	if task.Files == 0 {
+		t.Fatalf("Expected task files to be created")
+	}
+	id := task.Files
+
+	if err := GetStepTaskFiles(&task, &files); err != nil {
+		t.Fatalf("Failed to get task files: %v", err)
+	}
+	if !TaskFilesEqual(&files, &expected) {
+		t.Errorf("Expected %+v, got %+v", expected, files)
+	}
+
+	files = expected
+	if err := SaveStepTaskFiles(&task, &files); err != nil {
+		t.Fatalf("Failed to save task files: %v", err)
+	}
+	if task.Files != id {
+		t.Errorf("Expected unchanged task files to keep ID %d, got %d", id, task.Files)
+	}
+
+	files = TaskFiles{}
+	if err := SaveStepTaskFiles(&task, &files); err != nil {
+		t.Fatalf("Failed to save task files: %v", err)
+	}
+	if task.Files != 0 {
+		t.Errorf("Expected empty task files to reset ID, got %d", task.Files)
+	}
+}
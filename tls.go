@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	stdhttp "net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/anton2920/gofa/log"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/strings"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* HSTSMaxAge is a value of 'max-age' in 'Strict-Transport-Security' header, one year. */
+const HSTSMaxAge = "31536000"
+
+/* TLSHandshakeTimeout limits time clients have to complete TLS handshake, so they can't hold connections forever. */
+const TLSHandshakeTimeout = 10 * time.Second
+
+/* TLSCertificatePtr points to current certificate served to clients. It's replaced by 'LoadTLSCertificate' without restarting listeners. */
+var TLSCertificatePtr unsafe.Pointer
+
+/* TLSClients maps local addresses of connections from 'TLSProxy' to plain HTTP listener to addresses of TLS clients. */
+var (
+	TLSClients     = make(map[string]string)
+	TLSClientsLock sync.Mutex
+)
+
+func TLSEnabled() bool {
+	return Config.TLSAddress != ""
+}
+
+/* LoadTLSCertificate reads certificate and key from files. Old certificate is kept, if new one can't be loaded. */
+func LoadTLSCertificate(certFile string, keyFile string) error {
+	defer trace.End(trace.Begin(""))
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	atomic.StorePointer(&TLSCertificatePtr, unsafe.Pointer(&cert))
+	return nil
+}
+
+func TLSGetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return (*tls.Certificate)(atomic.LoadPointer(&TLSCertificatePtr)), nil
+}
+
+func TLSServerConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: TLSGetCertificate,
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"http/1.1"},
+	}
+}
+
+/* TLSBackendAddress returns an address for connecting to plain HTTP listener. */
+func TLSBackendAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	if (host == "") || (net.ParseIP(host).IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+/* TLSProxy decrypts traffic of a client and passes it to plain HTTP listener and back. */
+func TLSProxy(c *tls.Conn, backend string) {
+	defer trace.End(trace.Begin(""))
+
+	defer c.Close()
+
+	c.SetDeadline(time.Now().Add(TLSHandshakeTimeout))
+	if err := c.Handshake(); err != nil {
+		log.Debugf("TLS handshake with %s failed: %v", c.RemoteAddr(), err)
+		return
+	}
+	c.SetDeadline(time.Time{})
+
+	b, err := net.Dial("tcp", backend)
+	if err != nil {
+		log.Errorf("Failed to connect to %s: %v", backend, err)
+		return
+	}
+	defer b.Close()
+
+	/* NOTE(anton2920): backend sees this connection as coming from 'b.LocalAddr()', which is unique while it's open. */
+	local := b.LocalAddr().String()
+	TLSClientsLock.Lock()
+	TLSClients[local] = c.RemoteAddr().String()
+	TLSClientsLock.Unlock()
+	defer func() {
+		TLSClientsLock.Lock()
+		delete(TLSClients, local)
+		TLSClientsLock.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		io.Copy(b, c)
+		b.(*net.TCPConn).CloseWrite()
+		wg.Done()
+	}()
+	io.Copy(c, b)
+	c.CloseWrite()
+	wg.Wait()
+}
+
+/*
+ * ServeTLS accepts HTTPS connections and passes them to gofa server, which only works with plain sockets.
+ * NOTE(anton2920): server sees all requests as coming from loopback, so address of a client is looked up with 'TLSClientAddr'.
+ */
+func ServeTLS(l net.Listener, backend string) {
+	defer trace.End(trace.Begin(""))
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Errorf("Failed to accept TLS connection: %v", err)
+			return
+		}
+		go TLSProxy(c.(*tls.Conn), backend)
+	}
+}
+
+/* TLSClientAddr returns address of TLS client, if 'addr' is an address of connection from 'TLSProxy'. */
+func TLSClientAddr(addr string) (string, bool) {
+	TLSClientsLock.Lock()
+	defer TLSClientsLock.Unlock()
+
+	client, ok := TLSClients[addr]
+	return client, ok
+}
+
+/* TLSRedirectURL returns location of HTTPS version of a request. Port is taken from TLS address, unless it's a default one. */
+func TLSRedirectURL(host string, uri string, tlsAddress string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	} else if (len(host) > 1) && (host[0] == '[') && (host[len(host)-1] == ']') {
+		host = host[1 : len(host)-1]
+	}
+	if _, port, err := net.SplitHostPort(tlsAddress); (err == nil) && (port != "443") {
+		host = net.JoinHostPort(host, port)
+	} else if strings.FindChar(host, ':') != -1 {
+		host = "[" + host + "]"
+	}
+	return "https://" + host + uri
+}
+
+func TLSRedirectHandler(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	stdhttp.Redirect(w, r, TLSRedirectURL(r.Host, r.URL.RequestURI(), Config.TLSAddress), stdhttp.StatusMovedPermanently)
+}
+
+/* SetSecurityHeaders tells browsers to use HTTPS only, when it's available. */
+func SetSecurityHeaders(w *http.Response) {
+	if TLSEnabled() {
+		w.Headers.Set("Strict-Transport-Security", "max-age="+HSTSMaxAge)
+	}
+}
+
+/* SetTokenCookie sets session cookie. Cookie without 'Secure' flag is only used in debug mode without TLS. */
+func SetTokenCookie(w *http.Response, token string, expiry int64) {
+	if (Debug) && (!TLSEnabled()) {
+		w.SetCookieUnsafe("Token", token, expiry)
+	} else {
+		w.SetCookie("Token", token, expiry)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testWriteTLSCertificate(t *testing.T, dir string, name string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func testTLSCertificateName(t *testing.T) string {
+	t.Helper()
+
+	cert, _ := TLSGetCertificate(nil)
+	if cert == nil {
+		t.Fatalf("Expected certificate to be loaded")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestLoadTLSCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	certFile, keyFile := testWriteTLSCertificate(t, dir, "old.example")
+	if err := LoadTLSCertificate(certFile, keyFile); err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	if name := testTLSCertificateName(t); name != "old.example" {
+		t.Errorf("Expected certificate for old.example, got %q", name)
+	}
+
+	testWriteTLSCertificate(t, dir, "new.example")
+	if err := LoadTLSCertificate(certFile, keyFile); err != nil {
+		t.Fatalf("Failed to reload certificate: %v", err)
+	}
+	if name := testTLSCertificateName(t); name != "new.example" {
+		t.Errorf("Expected certificate for new.example after reload, got %q", name)
+	}
+
+	if err := os.WriteFile(keyFile, []byte("garbage"), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	if err := LoadTLSCertificate(certFile, keyFile); err == nil {
+		t.Errorf("Expected error for invalid key")
+	}
+	if name := testTLSCertificateName(t); name != "new.example" {
+		t.Errorf("Expected old certificate to be kept, got %q", name)
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	certFile, keyFile := testWriteTLSCertificate(t, t.TempDir(), "localhost")
+	if err := LoadTLSCertificate(certFile, keyFile); err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+
+	/* NOTE(anton2920): backend echoes everything back, like any server reading request and writing response. */
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer backend.Close()
+	clients := make(chan string, 1)
+	go func() {
+		c, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		client, _ := TLSClientAddr(c.RemoteAddr().String())
+		clients <- client
+		io.Copy(c, c)
+	}()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", TLSServerConfig())
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+	go ServeTLS(l, backend.Addr().String())
+
+	c, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer c.Close()
+
+	const request = "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"
+	if _, err := io.WriteString(c, request); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	c.CloseWrite()
+
+	response, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if string(response) != request {
+		t.Errorf("Expected %q to be passed through, got %q", request, response)
+	}
+	if client := <-clients; client != c.LocalAddr().String() {
+		t.Errorf("Expected backend to see client %s, got %q", c.LocalAddr(), client)
+	}
+}
+
+func TestTLSRedirectURL(t *testing.T) {
+	expected := [...]struct {
+		Host       string
+		URI        string
+		TLSAddress string
+		URL        string
+	}{
+		{"example.com", "/", "0.0.0.0:443", "https://example.com/"},
+		{"example.com:80", "/course/1?ID=2", ":443", "https://example.com/course/1?ID=2"},
+		{"example.com:8080", "/", "0.0.0.0:8443", "https://example.com:8443/"},
+		{"[::1]:80", "/", "[::]:443", "https://[::1]/"},
+		{"[::1]", "/", "[::]:8443", "https://[::1]:8443/"},
+	}
+
+	for _, test := range expected {
+		if url := TLSRedirectURL(test.Host, test.URI, test.TLSAddress); url != test.URL {
+			t.Errorf("Expected %q for %q%q, got %q", test.URL, test.Host, test.URI, url)
+		}
+	}
+}
+
+func TestTLSBackendAddress(t *testing.T) {
+	expected := [...][2]string{
+		{"0.0.0.0:7072", "127.0.0.1:7072"},
+		{":7072", "127.0.0.1:7072"},
+		{"[::]:7072", "127.0.0.1:7072"},
+		{"10.0.0.1:7072", "10.0.0.1:7072"},
+	}
+
+	for _, test := range expected {
+		if address := TLSBackendAddress(test[0]); address != test[1] {
+			t.Errorf("Expected %q for %q, got %q", test[1], test[0], address)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"net/mail"
 	"time"
 	"unicode"
@@ -12,7 +11,6 @@ import (
 	"github.com/anton2920/gofa/ints"
 	"github.com/anton2920/gofa/net/http"
 	"github.com/anton2920/gofa/strings"
-	"github.com/anton2920/gofa/syscall"
 	"github.com/anton2920/gofa/trace"
 )
 
@@ -27,6 +25,7 @@ type User struct {
 	Courses   []database.ID
 	CreatedOn int64
 
+	Blob Blob
 	Data [1024]byte
 }
 
@@ -69,45 +68,41 @@ func UserNameValid(l Language, name string) error {
 func GetUserByEmail(email string, user *User) error {
 	defer trace.End(trace.Begin(""))
 
-	users := make([]User, 32)
-	var pos int64
+	id, ok := GetUserIDByEmail(email)
+	if !ok {
+		return database.NotFound
+	}
 
-	for {
-		n, err := GetUsers(&pos, users)
-		if err != nil {
-			return err
-		}
-		if n == 0 {
-			break
-		}
-		for i := 0; i < n; i++ {
-			if (users[i].Flags != UserDeleted) && (users[i].Email == email) {
-				*user = users[i]
-				return nil
-			}
-		}
+	if err := GetUserByID(id, user); err != nil {
+		return err
+	}
+	if (user.Flags == UserDeleted) || (user.Email != email) {
+		return database.NotFound
 	}
 
-	return database.NotFound
+	return nil
 }
 
-func CreateUser(user *User) error {
+func CreateUserTx(tx *Tx, user *User) error {
 	defer trace.End(trace.Begin(""))
 
-	var err error
+	user.ID = NewIDTx(tx, UsersDB)
 
-	user.ID, err = database.IncrementNextID(UsersDB)
-	if err != nil {
-		return fmt.Errorf("failed to increment user ID: %w", err)
-	}
-
-	return SaveUser(user)
+	return SaveUserTx(tx, user)
 }
 
-func DBUser2User(user *User) {
+func CreateUser(user *User) error {
 	defer trace.End(trace.Begin(""))
 
-	data := &user.Data[0]
+	var tx Tx
+	if err := CreateUserTx(&tx, user); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func DBUser2User(user *User, data *byte) {
+	defer trace.End(trace.Begin(""))
 
 	user.FirstName = database.Offset2String(user.FirstName, data)
 	user.LastName = database.Offset2String(user.LastName, data)
@@ -121,50 +116,73 @@ func DBUser2User(user *User) {
 func GetUserByID(id database.ID, user *User) error {
 	defer trace.End(trace.Begin(""))
 
-	if err := database.Read(UsersDB, id, unsafe.Pointer(user), int(unsafe.Sizeof(*user))); err != nil {
+	if err := DBRead(UsersDB, id, unsafe.Pointer(user), int(unsafe.Sizeof(*user))); err != nil {
 		return err
 	}
+	if user.ID != id {
+		return database.NotFound
+	}
 
-	DBUser2User(user)
+	data, err := GetBlobData(&user.Blob, user.Data[:])
+	if err != nil {
+		return err
+	}
+
+	DBUser2User(user, data)
 	return nil
 }
 
 func GetUsers(pos *int64, users []User) (int, error) {
 	defer trace.End(trace.Begin(""))
 
-	n, err := database.ReadMany(UsersDB, pos, *(*[]byte)(unsafe.Pointer(&users)), int(unsafe.Sizeof(users[0])))
+	n, err := DBReadManyValid(UsersDB, pos, users, func(user *User) database.ID { return user.ID })
 	if err != nil {
 		return 0, err
 	}
 
 	for i := 0; i < n; i++ {
-		DBUser2User(&users[i])
+		data, err := GetBlobData(&users[i].Blob, users[i].Data[:])
+		if err != nil {
+			return 0, err
+		}
+		DBUser2User(&users[i], data)
 	}
 	return n, nil
 }
 
-func DeleteUserByID(id database.ID) error {
+func DeleteUserByIDTx(tx *Tx, id database.ID) error {
 	defer trace.End(trace.Begin(""))
 
 	flags := UserDeleted
 	var user User
 
 	offset := int64(int(id)*int(unsafe.Sizeof(user))) + database.DataOffset + int64(unsafe.Offsetof(user.Flags))
-	_, err := syscall.Pwrite(UsersDB.FD, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
-	if err != nil {
-		return fmt.Errorf("failed to delete user from DB: %w", err)
-	}
+	tx.WriteAt(UsersDB, unsafe.Slice((*byte)(unsafe.Pointer(&flags)), unsafe.Sizeof(flags)), offset)
 
+	tx.OnCommit(func() { UnindexUser(id) })
 	return nil
 }
 
-func User2DBUser(userDB *User, user *User, data []byte, n int) {
+func DeleteUserByID(id database.ID) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := DeleteUserByIDTx(&tx, id); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+func UserDataSize(user *User) int {
+	return DBStringSize(user.FirstName) + DBStringSize(user.LastName) + DBStringSize(user.Email) + DBStringSize(user.Password) + DBSliceSize(user.Courses)
+}
+
+func User2DBUser(userDB *User, user *User, data []byte, n int) int {
 	defer trace.End(trace.Begin(""))
 
 	userDB.ID = user.ID
 	userDB.Flags = user.Flags
 
-	/* TODO(anton2920): save up to a sizeof(user.Data). */
 	n += database.String2DBString(&userDB.FirstName, user.FirstName, data, n)
 	n += database.String2DBString(&userDB.LastName, user.LastName, data, n)
 	n += database.String2DBString(&userDB.Email, user.Email, data, n)
@@ -172,17 +190,45 @@ func User2DBUser(userDB *User, user *User, data []byte, n int) {
 	n += database.Slice2DBSlice((*[]byte)(unsafe.Pointer(&userDB.Courses)), *(*[]byte)(unsafe.Pointer(&user.Courses)), int(unsafe.Sizeof(user.Courses[0])), int(unsafe.Alignof(user.Courses[0])), data, n)
 
 	userDB.CreatedOn = user.CreatedOn
+
+	return n
 }
 
-func SaveUser(user *User) error {
+func SaveUserTx(tx *Tx, user *User) error {
 	defer trace.End(trace.Begin(""))
 
 	var userDB User
 
-	data := unsafe.Slice(&userDB.Data[0], len(userDB.Data))
-	User2DBUser(&userDB, user, data, 0)
+	data, err := GetDataBuffer(userDB.Data[:], UserDataSize(user))
+	if err != nil {
+		return err
+	}
+	n := User2DBUser(&userDB, user, data, 0)
 
-	return database.Write(UsersDB, userDB.ID, unsafe.Pointer(&userDB), int(unsafe.Sizeof(userDB)))
+	if err := SaveBlob(&userDB.Blob, userDB.Data[:], data[:n]); err != nil {
+		return err
+	}
+
+	tx.Write(UsersDB, userDB.ID, unsafe.Pointer(&userDB), int(unsafe.Sizeof(userDB)))
+
+	indexed := *user
+	tx.OnCommit(func() { IndexUser(&indexed) })
+	return nil
+}
+
+func SaveUser(user *User) error {
+	defer trace.End(trace.Begin(""))
+
+	var tx Tx
+	if err := SaveUserTx(&tx, user); err != nil {
+		return err
+	}
+	return CommitTx(&tx)
+}
+
+/* UserIsTeacher returns true for users, who may see course library. Owning a course doesn't count, because anyone can create one. */
+func UserIsTeacher(userID database.ID) bool {
+	return (userID == AdminID) || (len(GetTeacherSubjectIDs(userID)) > 0)
 }
 
 func UserOwnsCourse(user *User, courseID database.ID) bool {
@@ -202,36 +248,40 @@ func UserOwnsCourse(user *User, courseID database.ID) bool {
 }
 
 func DisplayUserGroups(w *http.Response, l Language, userID database.ID) {
-	groups := make([]Group, 32)
 	var displayed bool
-	var pos int64
+	var group Group
+	var ids []database.ID
 
-	for {
-		n, err := GetGroups(&pos, groups)
+	if userID == AdminID {
+		var err error
+		ids, err = GetAllIDs(GroupsDB)
 		if err != nil {
 			/* TODO(anton2920): report error. */
 		}
-		if n == 0 {
-			break
-		}
-		for i := 0; i < n; i++ {
-			group := &groups[i]
-			if (group.Flags == GroupDeleted) || (!UserInGroup(userID, group)) {
-				continue
-			}
+	} else {
+		ids = GetUserGroupIDs(userID)
+	}
 
-			if !displayed {
-				w.WriteString(`<h3>`)
-				w.WriteString(Ls(l, "Groups"))
-				w.WriteString(`</h3>`)
-				w.WriteString(`<ul>`)
-				displayed = true
-			}
+	for i := 0; i < len(ids); i++ {
+		if err := GetGroupByID(ids[i], &group); err != nil {
+			/* TODO(anton2920): report error. */
+			continue
+		}
+		if (group.Flags == GroupDeleted) || (!UserInGroup(userID, &group)) {
+			continue
+		}
 
-			w.WriteString(`<li>`)
-			DisplayGroupLink(w, l, group)
-			w.WriteString(`</li>`)
+		if !displayed {
+			w.WriteString(`<h3>`)
+			w.WriteString(Ls(l, "Groups"))
+			w.WriteString(`</h3>`)
+			w.WriteString(`<ul>`)
+			displayed = true
 		}
+
+		w.WriteString(`<li>`)
+		DisplayGroupLink(w, l, &group)
+		w.WriteString(`</li>`)
 	}
 	if displayed {
 		w.WriteString(`</ul>`)
@@ -277,44 +327,48 @@ func DisplayUserCourses(w *http.Response, l Language, user *User) {
 }
 
 func DisplayUserSubjects(w *http.Response, l Language, userID database.ID) {
-	subjects := make([]Subject, 32)
 	var displayed bool
-	var pos int64
+	var subject Subject
+	var ids []database.ID
 
-	for {
-		n, err := GetSubjects(&pos, subjects)
+	if userID == AdminID {
+		var err error
+		ids, err = GetAllIDs(SubjectsDB)
 		if err != nil {
 			/* TODO(anton2920): report error. */
 		}
-		if n == 0 {
-			break
-		}
-		for i := 0; i < n; i++ {
-			subject := &subjects[i]
-			if subject.Flags == SubjectDeleted {
-				continue
-			}
+	} else {
+		ids = GetUserSubjectIDs(userID)
+	}
 
-			who, err := WhoIsUserInSubject(userID, subject)
-			if err != nil {
-				/* TODO(anton2920): report error. */
-			}
-			if who == SubjectUserNone {
-				continue
-			}
+	for i := 0; i < len(ids); i++ {
+		if err := GetSubjectByID(ids[i], &subject); err != nil {
+			/* TODO(anton2920): report error. */
+			continue
+		}
+		if subject.Flags == SubjectDeleted {
+			continue
+		}
 
-			if !displayed {
-				w.WriteString(`<h3>`)
-				w.WriteString(Ls(l, "Subjects"))
-				w.WriteString(`</h3>`)
-				w.WriteString(`<ul>`)
-				displayed = true
-			}
+		who, err := WhoIsUserInSubject(userID, &subject)
+		if err != nil {
+			/* TODO(anton2920): report error. */
+		}
+		if who == SubjectUserNone {
+			continue
+		}
 
-			w.WriteString(`<li>`)
-			DisplaySubjectLink(w, l, subject)
-			w.WriteString(`</li>`)
+		if !displayed {
+			w.WriteString(`<h3>`)
+			w.WriteString(Ls(l, "Subjects"))
+			w.WriteString(`</h3>`)
+			w.WriteString(`<ul>`)
+			displayed = true
 		}
+
+		w.WriteString(`<li>`)
+		DisplaySubjectLink(w, l, &subject)
+		w.WriteString(`</li>`)
 	}
 	if displayed {
 		w.WriteString(`</ul>`)
@@ -381,7 +435,7 @@ func UsersPageHandler(w *http.Response, r *http.Request) error {
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -480,7 +534,7 @@ func UserPageHandler(w *http.Response, r *http.Request) error {
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -565,7 +619,7 @@ func UserCreateEditPageHandler(w *http.Response, r *http.Request, session *Sessi
 
 	DisplayBodyStart(w)
 	{
-		DisplayHeader(w, GL)
+		DisplayHeader(w, GL, session)
 		DisplaySidebar(w, GL, session)
 
 		DisplayMainStart(w)
@@ -759,6 +813,8 @@ func UserCreateHandler(w *http.Response, r *http.Request) error {
 		return http.ServerError(err)
 	}
 
+	Audit(r, session.ID, "create", "user", user.ID, "", AuditUserSummary(&user))
+
 	w.Redirect("/users", http.StatusSeeOther)
 	return nil
 
@@ -793,12 +849,20 @@ func UserDeleteHandler(w *http.Response, r *http.Request) error {
 
 	/* TODO(anton2920): maybe in race with 'UserSigninHandler'. */
 	RemoveAllUserSessions(userID)
-	if err := DeleteUserByID(userID); err != nil {
+	var tx Tx
+	if err := DeleteUserByIDTx(&tx, userID); err != nil {
 		return http.ServerError(err)
 	}
 	for i := 0; i < len(user.Courses); i++ {
-		_ = DeleteCourseByID(user.Courses[i])
+		if err := DeleteCourseByIDTx(&tx, user.Courses[i]); err != nil {
+			return http.ServerError(err)
+		}
 	}
+	if err := CommitTx(&tx); err != nil {
+		return http.ServerError(err)
+	}
+
+	Audit(r, session.ID, "delete", "user", userID, AuditUserSummary(&user), "")
 
 	w.Redirect("/users", http.StatusSeeOther)
 	return nil
@@ -858,6 +922,7 @@ func UserEditHandler(w *http.Response, r *http.Request) error {
 		return UserEditPageHandler(w, r, http.Conflict("%s", Ls(GL, "user with this email already exists")))
 	}
 
+	before := AuditUserSummary(&user)
 	user.FirstName = firstName
 	user.LastName = lastName
 	user.Email = email
@@ -869,6 +934,8 @@ func UserEditHandler(w *http.Response, r *http.Request) error {
 
 	UpdateAllUserSessions(&user)
 
+	Audit(r, session.ID, "edit", "user", userID, before, AuditUserSummary(&user))
+
 	w.Redirect(w.PathID("/user/", userID), http.StatusSeeOther)
 	return nil
 }
@@ -899,24 +966,21 @@ func UserSigninHandler(w *http.Response, r *http.Request) error {
 	if err != nil {
 		return http.ServerError(err)
 	}
-	expiry := time.Now().Add(OneWeek)
+	expiry := time.Now().Add(time.Duration(Config.SessionLifetime))
 
 	session := &Session{
 		ID:     user.ID,
 		Expiry: expiry,
 	}
-	User2DBUser(&session.User, &user, unsafe.Slice(&session.User.Data[0], len(session.User.Data)), 0)
-	DBUser2User(&session.User)
+	SessionUser(&session.User, &user)
 
 	SessionsLock.Lock()
 	Sessions[token] = session
 	SessionsLock.Unlock()
 
-	if Debug {
-		w.SetCookieUnsafe("Token", token, expiry.Unix())
-	} else {
-		w.SetCookie("Token", token, expiry.Unix())
-	}
+	Audit(r, user.ID, "signin", "user", user.ID, "", "")
+
+	SetTokenCookie(w, token, expiry.Unix())
 	w.Redirect("/", http.StatusSeeOther)
 	return nil
 }
@@ -929,7 +993,8 @@ func UserSignoutHandler(w *http.Response, r *http.Request) error {
 		return UnauthorizedError
 	}
 
-	if _, err := GetSessionFromToken(token); err != nil {
+	session, err := GetSessionFromToken(token)
+	if err != nil {
 		return UnauthorizedError
 	}
 
@@ -937,6 +1002,8 @@ func UserSignoutHandler(w *http.Response, r *http.Request) error {
 	delete(Sessions, token)
 	SessionsLock.Unlock()
 
+	Audit(r, session.ID, "signout", "user", session.ID, "", "")
+
 	w.DelCookie("Token")
 	w.Redirect("/", http.StatusSeeOther)
 	return nil
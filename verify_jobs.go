@@ -0,0 +1,463 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/net/http"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* VerifyJob is a verification of one submission by 'SubmissionVerifyWorker'. */
+type VerifyJob struct {
+	SubmissionID database.ID
+
+	QueuedAt   time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+
+	/* Step is an index of a step being verified, 'Checked' is a number of its checks done so far out of 'Total'. */
+	Step    int
+	Checked int
+	Total   int
+}
+
+/* VerifyJobStatus is sent to clients, which watch verification of a submission. */
+type VerifyJobStatus struct {
+	Status string `json:"status"`
+
+	/* Position is 1-based position in queue and ETA is an estimated number of seconds until verification is finished, -1 if unknown. */
+	Position int `json:"position"`
+	ETA      int `json:"eta"`
+
+	Step    int `json:"step"`
+	Checked int `json:"checked"`
+	Total   int `json:"total"`
+}
+
+const (
+	VerifyJobStatusPending = "pending"
+	VerifyJobStatusQueued  = "queued"
+	VerifyJobStatusRunning = "running"
+	VerifyJobStatusDone    = "done"
+)
+
+/* VerifyJobsMaxFinished is a number of finished jobs kept for status page and estimates. */
+const VerifyJobsMaxFinished = 50
+
+/* VerifyEventsTimeout is a maximum time event stream waits for updates before client has to reconnect. */
+const VerifyEventsTimeout = 15 * time.Second
+
+var VerifyJobs struct {
+	sync.Mutex
+
+	Queued   []VerifyJob
+	Running  []VerifyJob
+	Finished []VerifyJob
+
+	/* Version is incremented and 'Changed' is closed every time any job changes. */
+	Version int
+	Changed chan struct{}
+}
+
+func init() {
+	VerifyJobs.Changed = make(chan struct{})
+}
+
+/* VerifyJobsChanged must be called with 'VerifyJobs' locked. */
+func VerifyJobsChanged() {
+	VerifyJobs.Version++
+	close(VerifyJobs.Changed)
+	VerifyJobs.Changed = make(chan struct{})
+}
+
+func VerifyJobsFind(jobs []VerifyJob, submissionID database.ID) int {
+	for i := 0; i < len(jobs); i++ {
+		if jobs[i].SubmissionID == submissionID {
+			return i
+		}
+	}
+	return -1
+}
+
+/* SubmissionVerifyEnqueue sends submissions to verifier without blocking caller, because there may be more of them than channel can hold. */
+func SubmissionVerifyEnqueue(ids ...database.ID) {
+	defer trace.End(trace.Begin(""))
+
+	now := time.Now()
+
+	VerifyJobs.Lock()
+	for i := 0; i < len(ids); i++ {
+		VerifyJobs.Queued = append(VerifyJobs.Queued, VerifyJob{SubmissionID: ids[i], QueuedAt: now})
+	}
+	VerifyJobsChanged()
+	VerifyJobs.Unlock()
+
+	go func() {
+		for i := 0; i < len(ids); i++ {
+			SubmissionVerifyChannel <- ids[i]
+		}
+	}()
+}
+
+func VerifyJobStart(submissionID database.ID) {
+	defer trace.End(trace.Begin(""))
+
+	VerifyJobs.Lock()
+	defer VerifyJobs.Unlock()
+
+	job := VerifyJob{SubmissionID: submissionID}
+	if i := VerifyJobsFind(VerifyJobs.Queued, submissionID); i != -1 {
+		job = VerifyJobs.Queued[i]
+		VerifyJobs.Queued = append(VerifyJobs.Queued[:i], VerifyJobs.Queued[i+1:]...)
+	}
+	job.StartedAt = time.Now()
+	if job.QueuedAt.IsZero() {
+		job.QueuedAt = job.StartedAt
+	}
+
+	VerifyJobs.Running = append(VerifyJobs.Running, job)
+	VerifyJobsChanged()
+}
+
+func VerifyJobProgress(submissionID database.ID, step int, checked int, total int) {
+	defer trace.End(trace.Begin(""))
+
+	VerifyJobs.Lock()
+	defer VerifyJobs.Unlock()
+
+	if i := VerifyJobsFind(VerifyJobs.Running, submissionID); i != -1 {
+		job := &VerifyJobs.Running[i]
+		job.Step = step
+		job.Checked = checked
+		job.Total = total
+		VerifyJobsChanged()
+	}
+}
+
+func VerifyJobFinish(submissionID database.ID) {
+	defer trace.End(trace.Begin(""))
+
+	VerifyJobs.Lock()
+	defer VerifyJobs.Unlock()
+
+	i := VerifyJobsFind(VerifyJobs.Running, submissionID)
+	if i == -1 {
+		return
+	}
+	job := VerifyJobs.Running[i]
+	VerifyJobs.Running = append(VerifyJobs.Running[:i], VerifyJobs.Running[i+1:]...)
+
+	job.FinishedAt = time.Now()
+	VerifyJobs.Finished = append([]VerifyJob{job}, VerifyJobs.Finished...)
+	if len(VerifyJobs.Finished) > VerifyJobsMaxFinished {
+		VerifyJobs.Finished = VerifyJobs.Finished[:VerifyJobsMaxFinished]
+	}
+	VerifyJobsChanged()
+}
+
+/* VerifyJobsAverageDuration must be called with 'VerifyJobs' locked. Returns zero if no jobs have been finished yet. */
+func VerifyJobsAverageDuration() time.Duration {
+	if len(VerifyJobs.Finished) == 0 {
+		return 0
+	}
+
+	var total time.Duration
+	for i := 0; i < len(VerifyJobs.Finished); i++ {
+		job := &VerifyJobs.Finished[i]
+		total += job.FinishedAt.Sub(job.StartedAt)
+	}
+	return total / time.Duration(len(VerifyJobs.Finished))
+}
+
+/* GetVerifyJobStatus returns status of verification of a submission and current jobs version. Estimates assume that jobs take average time of recently finished ones. */
+func GetVerifyJobStatus(submission *Submission, status *VerifyJobStatus) int {
+	defer trace.End(trace.Begin(""))
+
+	VerifyJobs.Lock()
+	defer VerifyJobs.Unlock()
+
+	*status = VerifyJobStatus{ETA: -1}
+
+	average := VerifyJobsAverageDuration()
+	var remaining time.Duration
+	for i := 0; i < len(VerifyJobs.Running); i++ {
+		if left := average - time.Since(VerifyJobs.Running[i].StartedAt); left > remaining {
+			remaining = left
+		}
+	}
+
+	if i := VerifyJobsFind(VerifyJobs.Running, submission.ID); i != -1 {
+		job := &VerifyJobs.Running[i]
+		status.Status = VerifyJobStatusRunning
+		status.Step = job.Step
+		status.Checked = job.Checked
+		status.Total = job.Total
+		if average > 0 {
+			status.ETA = int((remaining + time.Second - 1) / time.Second)
+		}
+	} else if i := VerifyJobsFind(VerifyJobs.Queued, submission.ID); i != -1 {
+		status.Status = VerifyJobStatusQueued
+		status.Position = i + 1
+		if average > 0 {
+			status.ETA = int((remaining + time.Duration(status.Position)*average + time.Second - 1) / time.Second)
+		}
+	} else if submission.Status == SubmissionCheckDone {
+		status.Status = VerifyJobStatusDone
+	} else {
+		status.Status = VerifyJobStatusPending
+	}
+
+	return VerifyJobs.Version
+}
+
+func DisplayVerifyJobDuration(w *http.Response, d time.Duration) {
+	DisplayTableItemStart(w)
+	w.WriteString(d.Round(time.Millisecond).String())
+	DisplayTableItemEnd(w)
+}
+
+func DisplayVerifyJobSubmission(w *http.Response, l Language, submissionID database.ID) {
+	var submission Submission
+
+	DisplayTableItemStart(w)
+	if err := GetSubmissionByID(submissionID, &submission); err != nil {
+		w.WriteInt(int(submissionID))
+	} else {
+		DisplaySubmissionLink(w, l, &submission)
+	}
+	DisplayTableItemEnd(w)
+}
+
+/* VerifyJobsPageHandler displays queued, running and recently finished verification jobs to administrator. */
+func VerifyJobsPageHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	const width = WidthLarge
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+	if session.ID != AdminID {
+		return ForbiddenError
+	}
+
+	VerifyJobs.Lock()
+	queued := append([]VerifyJob(nil), VerifyJobs.Queued...)
+	running := append([]VerifyJob(nil), VerifyJobs.Running...)
+	finished := append([]VerifyJob(nil), VerifyJobs.Finished...)
+	average := VerifyJobsAverageDuration()
+	VerifyJobs.Unlock()
+
+	now := time.Now()
+
+	DisplayHTMLStart(w)
+
+	DisplayHeadStart(w)
+	{
+		w.WriteString(`<title>`)
+		w.WriteString(Ls(GL, "Verification queue"))
+		w.WriteString(`</title>`)
+	}
+	DisplayHeadEnd(w)
+
+	DisplayBodyStart(w)
+	{
+		DisplayHeader(w, GL, session)
+		DisplaySidebar(w, GL, session)
+
+		DisplayMainStart(w)
+
+		DisplayCrumbsStart(w, width)
+		{
+			DisplayCrumbsItem(w, GL, "Verification queue")
+		}
+		DisplayCrumbsEnd(w)
+
+		DisplayPageStart(w, width)
+		{
+			w.WriteString(`<h2 class="text-center">`)
+			w.WriteString(Ls(GL, "Verification queue"))
+			w.WriteString(`</h2>`)
+			w.WriteString(`<br>`)
+
+			w.WriteString(`<p>`)
+			w.WriteString(Ls(GL, "Average duration"))
+			w.WriteString(`: `)
+			w.WriteString(average.Round(time.Millisecond).String())
+			w.WriteString(`</p>`)
+
+			w.WriteString(`<h3>`)
+			w.WriteString(Ls(GL, "Running"))
+			w.WriteString(`</h3>`)
+			DisplayTableStart(w, GL, []string{"Submission", "Waited", "Running for", "Step", "Checks"})
+			for i := 0; i < len(running); i++ {
+				job := &running[i]
+
+				DisplayTableRowStart(w)
+				DisplayVerifyJobSubmission(w, GL, job.SubmissionID)
+				DisplayVerifyJobDuration(w, job.StartedAt.Sub(job.QueuedAt))
+				DisplayVerifyJobDuration(w, now.Sub(job.StartedAt))
+				DisplayTableItemInt(w, job.Step+1)
+				DisplayTableItemString(w, strconv.Itoa(job.Checked)+"/"+strconv.Itoa(job.Total))
+				DisplayTableRowEnd(w)
+			}
+			DisplayTableEnd(w)
+
+			w.WriteString(`<h3>`)
+			w.WriteString(Ls(GL, "Queued"))
+			w.WriteString(`</h3>`)
+			DisplayTableStart(w, GL, []string{"Position", "Submission", "Queued at", "Waiting for"})
+			for i := 0; i < len(queued); i++ {
+				job := &queued[i]
+
+				DisplayTableRowStart(w)
+				DisplayTableItemInt(w, i+1)
+				DisplayVerifyJobSubmission(w, GL, job.SubmissionID)
+				DisplayTableItemTime(w, job.QueuedAt.Unix())
+				DisplayVerifyJobDuration(w, now.Sub(job.QueuedAt))
+				DisplayTableRowEnd(w)
+			}
+			DisplayTableEnd(w)
+
+			w.WriteString(`<h3>`)
+			w.WriteString(Ls(GL, "Recently finished"))
+			w.WriteString(`</h3>`)
+			DisplayTableStart(w, GL, []string{"Submission", "Finished at", "Waited", "Duration"})
+			for i := 0; i < len(finished); i++ {
+				job := &finished[i]
+
+				DisplayTableRowStart(w)
+				DisplayVerifyJobSubmission(w, GL, job.SubmissionID)
+				DisplayTableItemTime(w, job.FinishedAt.Unix())
+				DisplayVerifyJobDuration(w, job.StartedAt.Sub(job.QueuedAt))
+				DisplayVerifyJobDuration(w, job.FinishedAt.Sub(job.StartedAt))
+				DisplayTableRowEnd(w)
+			}
+			DisplayTableEnd(w)
+		}
+		DisplayPageEnd(w)
+		DisplayMainEnd(w)
+	}
+	DisplayBodyEnd(w)
+
+	DisplayHTMLEnd(w)
+	return nil
+}
+
+func DisplayVerifyStepProgress(w *http.Response, index int) {
+	w.WriteString(`<span id="VerifyProgress`)
+	w.WriteInt(index)
+	w.WriteString(`"></span>`)
+}
+
+/* DisplayVerifyJobProgress displays script, which follows verification of a submission and updates elements with IDs 'VerifyStatus' and 'VerifyProgress<step>'. Page is reloaded once verification is done. */
+func DisplayVerifyJobProgress(w *http.Response, l Language, submissionID database.ID) {
+	w.WriteString(`<p id="VerifyStatus" data-queued="`)
+	w.WriteHTMLString(Ls(l, "Position in queue"))
+	w.WriteString(`" data-running="`)
+	w.WriteHTMLString(Ls(l, "Checks done"))
+	w.WriteString(`" data-eta="`)
+	w.WriteHTMLString(Ls(l, "estimated time left, seconds"))
+	w.WriteString(`"></p>`)
+
+	w.WriteString(`<script>`)
+	w.WriteString(`(function() {`)
+	w.WriteString(`var status = document.getElementById('VerifyStatus');`)
+	w.WriteString(`var source = new EventSource('/submission/events?ID=`)
+	w.WriteInt(int(submissionID))
+	w.WriteString(`');`)
+	w.WriteString(`source.onmessage = function(e) {`)
+	w.WriteString(`var s = JSON.parse(e.data);`)
+	w.WriteString(`if (s.status == 'done') { source.close(); location.reload(); return; }`)
+	w.WriteString(`var text = '';`)
+	w.WriteString(`if (s.status == 'queued') { text = status.dataset.queued + ': ' + s.position; }`)
+	w.WriteString(`if (s.status == 'running') { text = status.dataset.running + ': ' + s.checked + '/' + s.total; var p = document.getElementById('VerifyProgress' + s.step); if (p) { p.textContent = s.checked + '/' + s.total; } }`)
+	w.WriteString(`if (s.eta >= 0) { text += ', ' + status.dataset.eta + ': ' + s.eta; }`)
+	w.WriteString(`status.textContent = text;`)
+	w.WriteString(`};`)
+	w.WriteString(`})();`)
+	w.WriteString(`</script>`)
+}
+
+/* SubmissionEventsHandler is a Server-Sent Events endpoint, which reports progress of submission verification. Every response carries one event and asks client to reconnect, so responses don't have to be streamed. If client already has the latest event, response is delayed until something changes. */
+func SubmissionEventsHandler(w *http.Response, r *http.Request) error {
+	defer trace.End(trace.Begin(""))
+
+	var submission Submission
+	var subject Subject
+	var lesson Lesson
+	var status VerifyJobStatus
+
+	session, err := GetSessionFromRequest(r)
+	if err != nil {
+		return UnauthorizedError
+	}
+
+	submissionID, err := r.URL.Query.GetID("ID")
+	if err != nil {
+		return http.ClientError(err)
+	}
+	if err := GetSubmissionByID(submissionID, &submission); err != nil {
+		if err == database.NotFound {
+			return http.NotFound("%s", Ls(GL, "submission with this ID does not exist"))
+		}
+		return http.ServerError(err)
+	}
+
+	if err := GetLessonByID(submission.LessonID, &lesson); err != nil {
+		return http.ServerError(err)
+	}
+	if err := GetSubjectByID(lesson.ContainerID, &subject); err != nil {
+		return http.ServerError(err)
+	}
+	who, err := WhoIsUserInSubject(session.ID, &subject)
+	if err != nil {
+		return http.ServerError(err)
+	}
+	if (who != SubjectUserAdmin) && (who != SubjectUserTeacher) && (submission.UserID != session.ID) {
+		return ForbiddenError
+	}
+
+	VerifyJobs.Lock()
+	version := VerifyJobs.Version
+	changed := VerifyJobs.Changed
+	VerifyJobs.Unlock()
+
+	if lastID := r.Headers.Get("Last-Event-ID"); lastID != "" {
+		last, err := strconv.Atoi(lastID)
+		if err != nil {
+			return http.ClientError(err)
+		}
+		if last >= version {
+			select {
+			case <-changed:
+			case <-time.After(VerifyEventsTimeout):
+			}
+			if err := GetSubmissionByID(submissionID, &submission); err != nil {
+				return http.ServerError(err)
+			}
+		}
+	}
+	version = GetVerifyJobStatus(&submission, &status)
+
+	data, err := json.Marshal(&status)
+	if err != nil {
+		return http.ServerError(err)
+	}
+
+	w.Headers.Set("Content-Type", "text/event-stream")
+	w.Headers.Set("Cache-Control", "no-cache")
+	w.WriteString("retry: 500\n")
+	w.WriteString("id: ")
+	w.WriteInt(version)
+	w.WriteString("\n")
+	w.WriteString("data: ")
+	w.Write(data)
+	w.WriteString("\n\n")
+	return nil
+}
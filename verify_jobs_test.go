@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anton2920/gofa/net/http"
+)
+
+func TestVerifyJobs(t *testing.T) {
+	var status VerifyJobStatus
+
+	/* NOTE(anton2920): these IDs are never sent to worker, so jobs are moved by hand. */
+	submissions := [...]Submission{{ID: 1000}, {ID: 1001}}
+	now := time.Now()
+
+	VerifyJobs.Lock()
+	VerifyJobs.Queued = append(VerifyJobs.Queued, VerifyJob{SubmissionID: submissions[0].ID, QueuedAt: now}, VerifyJob{SubmissionID: submissions[1].ID, QueuedAt: now})
+	VerifyJobsChanged()
+	VerifyJobs.Unlock()
+
+	GetVerifyJobStatus(&submissions[1], &status)
+	if status.Status != VerifyJobStatusQueued {
+		t.Fatalf("Expected submission to be queued, got %q", status.Status)
+	}
+	position := status.Position
+
+	version := GetVerifyJobStatus(&submissions[0], &status)
+	VerifyJobStart(submissions[0].ID)
+	if v := GetVerifyJobStatus(&submissions[0], &status); v <= version {
+		t.Errorf("Expected version to change after job start, got %d, was %d", v, version)
+	}
+	if status.Status != VerifyJobStatusRunning {
+		t.Errorf("Expected submission to be running, got %q", status.Status)
+	}
+
+	VerifyJobProgress(submissions[0].ID, 1, 2, 5)
+	GetVerifyJobStatus(&submissions[0], &status)
+	if (status.Step != 1) || (status.Checked != 2) || (status.Total != 5) {
+		t.Errorf("Expected step 1 with 2/5 checks done, got %+v", status)
+	}
+
+	GetVerifyJobStatus(&submissions[1], &status)
+	if status.Position != position-1 {
+		t.Errorf("Expected position %d, got %d", position-1, status.Position)
+	}
+
+	VerifyJobFinish(submissions[0].ID)
+	VerifyJobStart(submissions[1].ID)
+	VerifyJobFinish(submissions[1].ID)
+
+	submissions[0].Status = SubmissionCheckDone
+	GetVerifyJobStatus(&submissions[0], &status)
+	if status.Status != VerifyJobStatusDone {
+		t.Errorf("Expected submission to be done, got %q", status.Status)
+	}
+	GetVerifyJobStatus(&submissions[1], &status)
+	if status.Status != VerifyJobStatusPending {
+		t.Errorf("Expected submission to be pending, got %q", status.Status)
+	}
+
+	VerifyJobs.Lock()
+	found := VerifyJobsFind(VerifyJobs.Finished, submissions[0].ID) != -1
+	VerifyJobs.Unlock()
+	if !found {
+		t.Errorf("Expected finished job to be kept")
+	}
+}
+
+func TestVerifyJobsPageHandler(t *testing.T) {
+	const endpoint = "/submission/queue"
+
+	testGetAuth(t, endpoint, testTokens[AdminID], http.StatusOK)
+	testGetAuth(t, endpoint, testTokens[1], http.StatusForbidden)
+	testGet(t, endpoint, http.StatusUnauthorized)
+}
+
+func TestSubmissionEventsHandler(t *testing.T) {
+	const endpoint = "/submission/events"
+
+	testCreateInitialDBs()
+
+	/* NOTE(anton2920): submission 0 belongs to user 2, user 3 is another student. */
+	testGetAuth(t, endpoint+"?ID=0", testTokens[AdminID], http.StatusOK)
+	testGetAuth(t, endpoint+"?ID=0", testTokens[1], http.StatusOK)
+	testGetAuth(t, endpoint+"?ID=0", testTokens[2], http.StatusOK)
+	testGetAuth(t, endpoint+"?ID=0", testTokens[3], http.StatusForbidden)
+	testGetAuth(t, endpoint+"?ID=a", testTokens[AdminID], http.StatusBadRequest)
+	testGetAuth(t, endpoint+"?ID=100", testTokens[AdminID], http.StatusNotFound)
+	testGet(t, endpoint+"?ID=0", http.StatusUnauthorized)
+}
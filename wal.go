@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	sys "syscall"
+	"time"
+	"unsafe"
+
+	"github.com/anton2920/gofa/database"
+	"github.com/anton2920/gofa/log"
+	"github.com/anton2920/gofa/syscall"
+	"github.com/anton2920/gofa/trace"
+)
+
+/* Tx is a set of record writes, which are applied to DBs atomically. */
+type Tx struct {
+	Records []TxRecord
+
+	Hooks []func()
+}
+
+type TxRecord struct {
+	DB     int32
+	Offset int64
+	Data   []byte
+}
+
+const (
+	/* NOTE(anton2920): header consists of payload length and its checksum. */
+	WALHeaderSize = 8 + 4
+
+	/* NOTE(anton2920): every record starts with DB index, data length and offset. */
+	WALRecordHeaderSize = 4 + 4 + 8
+)
+
+const WALName = "WAL.db"
+
+var (
+	WALFile *os.File
+	WALLock sync.Mutex
+
+	/* WALPending is a transaction, which is logged, but failed to apply. It stays in WAL and is applied again before the next one is logged. */
+	WALPending *Tx
+)
+
+/* TxDBs maps 'TxRecord.DB' to DB it refers to. Order must never change, because it's stored in WAL. */
+var TxDBs = [...]**database.DB{
+	&UsersDB,
+	&GroupsDB,
+	&CoursesDB,
+	&LessonsDB,
+	&SubjectsDB,
+	&SubmissionsDB,
+	&QuestionsDB,
+	&AnnouncementsDB,
+	&NotificationsDB,
+	&MessagesDB,
+	&TaskFilesDB,
+}
+
+/* TxBlobs is 'TxRecord.DB' of writes to blobs file, which is not a 'database.DB', so it goes right after 'TxDBs'. */
+const TxBlobs = int32(len(TxDBs))
+
+var WALCorrupted = errors.New("WAL is corrupted")
+
+func OpenWAL(dir string, name string) error {
+	defer trace.End(trace.Begin(""))
+
+	buf := make([]byte, syscall.PATH_MAX)
+	n := PutPath(buf, dir, name)
+
+	f, err := os.OpenFile(unsafe.String(unsafe.SliceData(buf), n), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	WALFile = f
+	return nil
+}
+
+func CloseWAL() error {
+	defer trace.End(trace.Begin(""))
+
+	if WALFile == nil {
+		return nil
+	}
+	return WALFile.Close()
+}
+
+func GetTxDBIndex(db *database.DB) int32 {
+	for i := 0; i < len(TxDBs); i++ {
+		if *TxDBs[i] == db {
+			return int32(i)
+		}
+	}
+	panic("unknown DB")
+}
+
+/* WriteAt adds write of 'data' at 'offset' in 'db' to transaction. 'data' is copied. */
+func (tx *Tx) WriteAt(db *database.DB, data []byte, offset int64) {
+	tx.Records = append(tx.Records, TxRecord{DB: GetTxDBIndex(db), Offset: offset, Data: append([]byte(nil), data...)})
+}
+
+/* WriteBlobAt adds write of 'data' at 'offset' in blobs file to transaction. 'data' is copied. */
+func (tx *Tx) WriteBlobAt(data []byte, offset int64) {
+	tx.Records = append(tx.Records, TxRecord{DB: TxBlobs, Offset: offset, Data: append([]byte(nil), data...)})
+}
+
+/* Write adds write of a whole record with provided ID to transaction. */
+func (tx *Tx) Write(db *database.DB, id database.ID, p unsafe.Pointer, size int) {
+	tx.WriteAt(db, unsafe.Slice((*byte)(p), size), int64(int(id)*size)+database.DataOffset)
+}
+
+/* OnCommit registers function, which is called after transaction is successfully committed. */
+func (tx *Tx) OnCommit(hook func()) {
+	tx.Hooks = append(tx.Hooks, hook)
+}
+
+func EncodeTx(tx *Tx) []byte {
+	defer trace.End(trace.Begin(""))
+
+	size := WALHeaderSize
+	for i := 0; i < len(tx.Records); i++ {
+		size += WALRecordHeaderSize + len(tx.Records[i].Data)
+	}
+
+	buf := make([]byte, WALHeaderSize, size)
+	for i := 0; i < len(tx.Records); i++ {
+		record := &tx.Records[i]
+
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(record.DB))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(record.Data)))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(record.Offset))
+		buf = append(buf, record.Data...)
+	}
+
+	binary.LittleEndian.PutUint64(buf[0:], uint64(len(buf)-WALHeaderSize))
+	binary.LittleEndian.PutUint32(buf[8:], crc32.ChecksumIEEE(buf[WALHeaderSize:]))
+
+	return buf
+}
+
+func DecodeTx(buf []byte, tx *Tx) error {
+	defer trace.End(trace.Begin(""))
+
+	if len(buf) < WALHeaderSize {
+		return WALCorrupted
+	}
+
+	size := binary.LittleEndian.Uint64(buf[0:])
+	if size > uint64(len(buf)-WALHeaderSize) {
+		return WALCorrupted
+	}
+	payload := buf[WALHeaderSize : WALHeaderSize+int(size)]
+	if binary.LittleEndian.Uint32(buf[8:]) != crc32.ChecksumIEEE(payload) {
+		return WALCorrupted
+	}
+
+	for len(payload) > 0 {
+		if len(payload) < WALRecordHeaderSize {
+			return WALCorrupted
+		}
+
+		var record TxRecord
+		record.DB = int32(binary.LittleEndian.Uint32(payload[0:]))
+		n := binary.LittleEndian.Uint32(payload[4:])
+		record.Offset = int64(binary.LittleEndian.Uint64(payload[8:]))
+		payload = payload[WALRecordHeaderSize:]
+
+		if (record.DB < 0) || (record.DB > TxBlobs) || (uint64(n) > uint64(len(payload))) {
+			return WALCorrupted
+		}
+		record.Data = payload[:n]
+		payload = payload[n:]
+
+		tx.Records = append(tx.Records, record)
+	}
+
+	return nil
+}
+
+/* LogTx durably writes transaction to WAL. After that transaction is considered committed. */
+func LogTx(tx *Tx) error {
+	defer trace.End(trace.Begin(""))
+
+	/* NOTE(anton2920): records may reference blobs, so they must be on disk first. */
+	if err := BlobsFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync blobs: %w", err)
+	}
+
+	if err := WALFile.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate WAL: %w", err)
+	}
+	if _, err := WALFile.WriteAt(EncodeTx(tx), 0); err != nil {
+		return fmt.Errorf("failed to write WAL: %w", err)
+	}
+	if err := WALFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync WAL: %w", err)
+	}
+
+	return nil
+}
+
+/* ApplyTx writes transaction records to DBs and syncs them. It's idempotent, so it's safe to apply the same transaction again after a crash. */
+func ApplyTx(tx *Tx) error {
+	defer trace.End(trace.Begin(""))
+
+	var touched [len(TxDBs) + 1]bool
+
+	for i := 0; i < len(tx.Records); i++ {
+		record := &tx.Records[i]
+
+		if record.DB == TxBlobs {
+			if _, err := BlobsFile.WriteAt(record.Data, record.Offset); err != nil {
+				return fmt.Errorf("failed to write blob: %w", err)
+			}
+		} else {
+			db := *TxDBs[record.DB]
+
+			start := time.Now()
+			if _, err := syscall.Pwrite(db.FD, record.Data, record.Offset); err != nil {
+				return fmt.Errorf("failed to write record to DB: %w", err)
+			}
+			MetricsObserveDBWrite(record.DB, time.Since(start))
+		}
+		touched[record.DB] = true
+	}
+
+	for i := 0; i < len(TxDBs); i++ {
+		if touched[i] {
+			if err := sys.Fsync(int((*TxDBs[i]).FD)); err != nil {
+				return fmt.Errorf("failed to sync DB: %w", err)
+			}
+		}
+	}
+	if touched[TxBlobs] {
+		if err := BlobsFile.Sync(); err != nil {
+			return fmt.Errorf("failed to sync blobs: %w", err)
+		}
+	}
+
+	return nil
+}
+
+/* CommitTx logs and applies transaction. Once it's logged, it's committed, so failure to apply it is not returned. Instead, it's applied again before the next transaction or on start. */
+func CommitTx(tx *Tx) error {
+	defer trace.End(trace.Begin(""))
+
+	if len(tx.Records) > 0 {
+		WALLock.Lock()
+		defer WALLock.Unlock()
+
+		/* NOTE(anton2920): logging next transaction overwrites WAL, so pending one must be applied first. */
+		if WALPending != nil {
+			if err := ApplyTx(WALPending); err != nil {
+				return fmt.Errorf("failed to apply previous transaction: %w", err)
+			}
+			WALPending = nil
+		}
+
+		if err := LogTx(tx); err != nil {
+			return err
+		}
+		if err := ApplyTx(tx); err != nil {
+			log.Errorf("Failed to apply committed transaction, it will be applied again: %v", err)
+			WALPending = tx
+		} else if err := WALFile.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate WAL: %w", err)
+		}
+	}
+
+	for i := 0; i < len(tx.Hooks); i++ {
+		tx.Hooks[i]()
+	}
+	return nil
+}
+
+/* ReplayWAL applies transaction left in WAL after a crash. Incomplete transaction is discarded. Returns true if anything was replayed. */
+func ReplayWAL() (bool, error) {
+	defer trace.End(trace.Begin(""))
+
+	WALLock.Lock()
+	defer WALLock.Unlock()
+
+	if _, err := WALFile.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	buf, err := io.ReadAll(WALFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read WAL: %w", err)
+	}
+	if len(buf) == 0 {
+		return false, nil
+	}
+
+	var tx Tx
+	var replayed bool
+	if err := DecodeTx(buf, &tx); err == nil {
+		if err := ApplyTx(&tx); err != nil {
+			return false, err
+		}
+		replayed = true
+	}
+	WALPending = nil
+
+	if err := WALFile.Truncate(0); err != nil {
+		return false, fmt.Errorf("failed to truncate WAL: %w", err)
+	}
+	return replayed, nil
+}
+
+/* ApplyTxToFiles writes transaction records to DB files in 'dir', which are not opened yet. */
+func ApplyTxToFiles(dir string, tx *Tx) error {
+	defer trace.End(trace.Begin(""))
+
+	var files [len(TxDBs) + 1]*os.File
+	defer func() {
+		for i := 0; i < len(files); i++ {
+			if files[i] != nil {
+				files[i].Close()
+			}
+		}
+	}()
+
+	for i := 0; i < len(tx.Records); i++ {
+		record := &tx.Records[i]
+
+		f := files[record.DB]
+		if f == nil {
+			name := BlobsName
+			if record.DB != TxBlobs {
+				name = SchemaDBs[record.DB].Name
+			}
+
+			var err error
+			if f, err = os.OpenFile(GetPath(dir, name), os.O_RDWR|os.O_CREATE, 0644); err != nil {
+				return fmt.Errorf("failed to open DB: %w", err)
+			}
+			files[record.DB] = f
+		}
+		if _, err := f.WriteAt(record.Data, record.Offset); err != nil {
+			return fmt.Errorf("failed to write record to DB: %w", err)
+		}
+	}
+
+	for i := 0; i < len(files); i++ {
+		if files[i] != nil {
+			if err := files[i].Sync(); err != nil {
+				return fmt.Errorf("failed to sync DB: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+ * ReplayWALFile is 'ReplayWAL' for DBs, which are not opened yet. Offsets in WAL are computed from record layouts DBs had when transaction was logged,
+ * so it must be called before DBs are migrated.
+ */
+func ReplayWALFile(dir string, name string) (bool, error) {
+	defer trace.End(trace.Begin(""))
+
+	filename := GetPath(dir, name)
+
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read WAL: %w", err)
+	}
+	if len(buf) == 0 {
+		return false, nil
+	}
+
+	var tx Tx
+	var replayed bool
+	if err := DecodeTx(buf, &tx); err == nil {
+		if err := ApplyTxToFiles(dir, &tx); err != nil {
+			return false, err
+		}
+		replayed = true
+	}
+
+	if err := os.Truncate(filename, 0); err != nil {
+		return false, fmt.Errorf("failed to truncate WAL: %w", err)
+	}
+	return replayed, nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/anton2920/gofa/database"
+)
+
+func testWALCreateSubmissionTx(t *testing.T, tx *Tx) (Lesson, Submission) {
+	t.Helper()
+
+	var lesson Lesson
+	if err := GetLessonByID(2, &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+
+	submission := Submission{LessonID: lesson.ID, UserID: 3, SubmittedSteps: make([]SubmittedStep, len(lesson.Steps))}
+	if err := CreateSubmissionTx(tx, &submission); err != nil {
+		t.Fatalf("Failed to create submission: %v", err)
+	}
+
+	lesson.Submissions = append(lesson.Submissions, submission.ID)
+	if err := SaveLessonTx(tx, &lesson); err != nil {
+		t.Fatalf("Failed to save lesson: %v", err)
+	}
+
+	return lesson, submission
+}
+
+func testWALExpectSubmissions(t *testing.T, expected int) {
+	t.Helper()
+
+	var lesson Lesson
+	if err := GetLessonByID(2, &lesson); err != nil {
+		t.Fatalf("Failed to get lesson: %v", err)
+	}
+	if len(lesson.Submissions) != expected {
+		t.Errorf("Expected %d submissions, got %d", expected, len(lesson.Submissions))
+	}
+}
+
+func testWALReplay(t *testing.T, expected bool) {
+	t.Helper()
+
+	replayed, err := ReplayWAL()
+	if err != nil {
+		t.Fatalf("Failed to replay WAL: %v", err)
+	}
+	if replayed != expected {
+		t.Errorf("Expected replayed = %v, got %v", expected, replayed)
+	}
+
+	if fi, err := WALFile.Stat(); (err != nil) || (fi.Size() != 0) {
+		t.Errorf("Expected WAL to be empty after replay")
+	}
+}
+
+func TestWALCrashAfterLog(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	var tx Tx
+	_, submission := testWALCreateSubmissionTx(t, &tx)
+
+	/* Crash right after transaction is logged, nothing is applied yet. */
+	if err := LogTx(&tx); err != nil {
+		t.Fatalf("Failed to log transaction: %v", err)
+	}
+	testWALExpectSubmissions(t, 1)
+
+	testWALReplay(t, true)
+	testWALExpectSubmissions(t, 2)
+
+	var saved Submission
+	if err := GetSubmissionByID(submission.ID, &saved); err != nil {
+		t.Fatalf("Failed to get submission: %v", err)
+	}
+	if saved.UserID != submission.UserID {
+		t.Errorf("Expected submission of user %d, got %d", submission.UserID, saved.UserID)
+	}
+}
+
+func TestWALCrashDuringApply(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	var tx Tx
+	testWALCreateSubmissionTx(t, &tx)
+
+	/* Crash after submission is written, but before lesson is updated. */
+	if err := LogTx(&tx); err != nil {
+		t.Fatalf("Failed to log transaction: %v", err)
+	}
+	if err := ApplyTx(&Tx{Records: tx.Records[:1]}); err != nil {
+		t.Fatalf("Failed to apply transaction: %v", err)
+	}
+	testWALExpectSubmissions(t, 1)
+
+	testWALReplay(t, true)
+	testWALExpectSubmissions(t, 2)
+}
+
+func TestWALCrashDuringLog(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	var tx Tx
+	testWALCreateSubmissionTx(t, &tx)
+
+	buf := EncodeTx(&tx)
+
+	/* Torn write: only part of transaction reached the disk. */
+	if _, err := WALFile.WriteAt(buf[:len(buf)/2], 0); err != nil {
+		t.Fatalf("Failed to write WAL: %v", err)
+	}
+	testWALReplay(t, false)
+	testWALExpectSubmissions(t, 1)
+
+	/* Corrupted write: length is intact, but payload is not. */
+	buf[len(buf)-1] ^= 0xFF
+	if _, err := WALFile.WriteAt(buf, 0); err != nil {
+		t.Fatalf("Failed to write WAL: %v", err)
+	}
+	testWALReplay(t, false)
+	testWALExpectSubmissions(t, 1)
+}
+
+func TestWALCommit(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	var tx Tx
+	_, submission := testWALCreateSubmissionTx(t, &tx)
+
+	if err := CommitTx(&tx); err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+	testWALExpectSubmissions(t, 2)
+
+	if ids := GetUserLessonSubmissionIDs(submission.UserID, submission.LessonID); (len(ids) != 1) || (ids[0] != submission.ID) {
+		t.Errorf("Expected index to contain submission %d, got %v", submission.ID, ids)
+	}
+	testWALReplay(t, false)
+}
+
+func TestWALApplyFailure(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	var tx Tx
+	testWALCreateSubmissionTx(t, &tx)
+
+	/* Write, which fails after submission is written, but before lesson is updated. */
+	tx.Records = append(tx.Records[:1], append([]TxRecord{{DB: GetTxDBIndex(UsersDB), Offset: -1, Data: []byte{0}}}, tx.Records[1:]...)...)
+	if err := CommitTx(&tx); err != nil {
+		t.Fatalf("Expected logged transaction to be committed, got %v", err)
+	}
+	testWALExpectSubmissions(t, 1)
+	if fi, err := WALFile.Stat(); (err != nil) || (fi.Size() == 0) {
+		t.Errorf("Expected transaction, which failed to apply, to stay in WAL")
+	}
+
+	var user User
+	if err := GetUserByID(AdminID, &user); err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if err := SaveUser(&user); err == nil {
+		t.Errorf("Expected next transaction to be rejected while previous one fails to apply")
+	}
+
+	/* Failure is gone, previous transaction must be applied before the next one. */
+	WALPending.Records = append(WALPending.Records[:1], WALPending.Records[2:]...)
+	if err := SaveUser(&user); err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+	testWALExpectSubmissions(t, 2)
+	testWALReplay(t, false)
+}
+
+func TestWALAbandonedID(t *testing.T) {
+	testCreateInitialDBs()
+	defer testCreateInitialDBs()
+
+	/* Transaction, which allocated ID, but was never committed. */
+	var abandoned Tx
+	gap := User{FirstName: "Abandoned", LastName: "User", Email: "abandoned@masters.com", Password: "abandoned"}
+	if err := CreateUserTx(&abandoned, &gap); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	user := User{FirstName: "Next", LastName: "User", Email: "next@masters.com", Password: "next"}
+	if err := CreateUser(&user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if user.ID != gap.ID+1 {
+		t.Fatalf("Expected user to get ID %d, got %d", gap.ID+1, user.ID)
+	}
+
+	var saved User
+	if err := GetUserByID(gap.ID, &saved); err != database.NotFound {
+		t.Errorf("Expected gap to be not found, got %v", err)
+	}
+
+	users := make([]User, 32)
+	var pos int64
+	for {
+		n, err := GetUsers(&pos, users)
+		if err != nil {
+			t.Fatalf("Failed to get users: %v", err)
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			if users[i].ID == gap.ID {
+				t.Errorf("Expected gap to be skipped")
+			}
+		}
+	}
+
+	if err := RebuildIndexes(); err != nil {
+		t.Fatalf("Failed to rebuild indexes: %v", err)
+	}
+	if err := GetUserByEmail("admin@masters.com", &saved); (err != nil) || (saved.ID != AdminID) {
+		t.Errorf("Expected to find administrator by email, got %v", err)
+	}
+
+	testFsck(t, false, 0)
+}